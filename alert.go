@@ -0,0 +1,206 @@
+package gobackupcleaner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultAlertWindow is the history averaged by relative AlertRules
+const defaultAlertWindow = 30 * 24 * time.Hour
+
+// alertWebhookTimeout bounds the delivery of an alert to AlertWebhook
+const alertWebhookTimeout = 10 * time.Second
+
+// AlertMetric selects the value of a run an AlertRule checks
+type AlertMetric int
+
+const (
+	// AlertFreedSize is the block-aligned size freed by the run in bytes
+	AlertFreedSize AlertMetric = iota
+	// AlertDeletedFiles is the number of files deleted by the run
+	AlertDeletedFiles
+	// AlertScanDuration is the scan duration in nanoseconds
+	AlertScanDuration
+	// AlertRetention is the age of the oldest backups left by a run that
+	// deleted files by age, in nanoseconds (see RunRecord.Retention). Runs
+	// that deleted nothing by age are not checked.
+	AlertRetention
+)
+
+// AlertRule raises an Alert after a run of a Runner whose metric is anomalous,
+// so runaway deletion or silent policy drift is noticed, e.g.
+//
+//	{Metric: AlertFreedSize, Factor: 2}                          // freed > 2x the 30-day average
+//	{Metric: AlertScanDuration, Factor: 2}                       // scan > 2x the 30-day average
+//	{Metric: AlertRetention, Below: float64(7 * 24 * time.Hour)} // oldest remaining < 7 days
+//
+// Durations are compared in nanoseconds, so limits can be written as
+// float64(time.Duration).
+type AlertRule struct {
+	Name   string // Identifies the rule in alerts (default: derived from the rule)
+	Metric AlertMetric
+
+	// Factor alerts when the value exceeds Factor times its average over the
+	// previous runs of the directory within Window (default: 30 days). It
+	// needs at least one previous run with a non-zero value.
+	Factor float64
+	Window time.Duration
+
+	// Above and Below alert when the value is above or below a fixed limit
+	// (0 disables them)
+	Above float64
+	Below float64
+}
+
+// name returns the name of the rule, derived from its limits if not set
+func (r AlertRule) name() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	switch {
+	case r.Factor > 0:
+		return fmt.Sprintf("%s > %gx average", r.Metric, r.Factor)
+	case r.Above > 0:
+		return fmt.Sprintf("%s > %g", r.Metric, r.Above)
+	default:
+		return fmt.Sprintf("%s < %g", r.Metric, r.Below)
+	}
+}
+
+// validate reports whether the rule checks a known metric against a limit
+func (r AlertRule) validate() error {
+	if !validEnum(alertMetricNames, int(r.Metric)) || r.Factor < 0 || r.Window < 0 || r.Above < 0 || r.Below < 0 {
+		return ErrInvalidConfig
+	}
+	if r.Factor == 0 && r.Above == 0 && r.Below == 0 {
+		return ErrInvalidConfig
+	}
+	return nil
+}
+
+// Alert is raised by an AlertRule for a run
+type Alert struct {
+	RunID   string    `json:"run_id,omitempty"`
+	Rule    string    `json:"rule"`
+	Dir     string    `json:"dir"`
+	Start   time.Time `json:"start"`             // Start of the run
+	Value   float64   `json:"value"`             // Value of the metric
+	Limit   float64   `json:"limit"`             // Limit the value crossed
+	Average float64   `json:"average,omitempty"` // Average the limit was derived from, for Factor rules
+	Message string    `json:"message"`
+}
+
+// metricValue returns the value of metric for a run, false if the run does
+// not provide it
+func metricValue(record RunRecord, metric AlertMetric) (float64, bool) {
+	switch metric {
+	case AlertFreedSize:
+		return float64(record.FreedSize), true
+	case AlertDeletedFiles:
+		return float64(record.DeletedFiles), true
+	case AlertScanDuration:
+		return float64(record.ScanDuration), true
+	case AlertRetention:
+		return float64(record.Retention), record.Retention > 0
+	}
+	return 0, false
+}
+
+// EvaluateAlerts checks a run against rules, averaging the previous runs of
+// its directory in history, and returns the alerts raised. Failed runs are
+// neither checked nor averaged.
+func EvaluateAlerts(rules []AlertRule, history []RunRecord, record RunRecord) []Alert {
+	if record.Error != "" {
+		return nil
+	}
+	var alerts []Alert
+	for _, rule := range rules {
+		value, ok := metricValue(record, rule.Metric)
+		if !ok {
+			continue
+		}
+		alert := Alert{RunID: record.RunID, Rule: rule.name(), Dir: record.Dir, Start: record.Start, Value: value}
+		switch {
+		case rule.Above > 0 && value > rule.Above:
+			alert.Limit = rule.Above
+		case rule.Below > 0 && value < rule.Below:
+			alert.Limit = rule.Below
+		case rule.Factor > 0:
+			average, ok := averageMetric(history, record, rule)
+			if !ok || value <= rule.Factor*average {
+				continue
+			}
+			alert.Limit = rule.Factor * average
+			alert.Average = average
+		default:
+			continue
+		}
+		alert.Message = fmt.Sprintf("%s: %s is %s, limit %s", record.Dir, rule.Metric, formatMetric(rule.Metric, value), formatMetric(rule.Metric, alert.Limit))
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// averageMetric returns the average of the metric over the successful runs
+// of the directory of record within the window of rule before it
+func averageMetric(history []RunRecord, record RunRecord, rule AlertRule) (float64, bool) {
+	window := rule.Window
+	if window == 0 {
+		window = defaultAlertWindow
+	}
+	since := record.Start.Add(-window)
+	var sum float64
+	var n int
+	for _, previous := range history {
+		if previous.Dir != record.Dir || previous.Error != "" || !previous.Start.Before(record.Start) || previous.Start.Before(since) {
+			continue
+		}
+		if value, ok := metricValue(previous, rule.Metric); ok {
+			sum += value
+			n++
+		}
+	}
+	if n == 0 || sum == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// formatMetric formats a value of metric for alert messages
+func formatMetric(metric AlertMetric, value float64) string {
+	switch metric {
+	case AlertFreedSize:
+		return formatSize(int64(value))
+	case AlertScanDuration, AlertRetention:
+		return time.Duration(value).Round(time.Second).String()
+	}
+	return fmt.Sprintf("%.0f", value)
+}
+
+// postAlert delivers an alert to a webhook as JSON
+func postAlert(url string, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), alertWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook: %s", resp.Status)
+	}
+	return nil
+}
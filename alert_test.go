@@ -0,0 +1,100 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEvaluateAlerts(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	var history []RunRecord
+	for i := 1; i <= 5; i++ {
+		history = append(history, RunRecord{Dir: "/backup", Start: start.Add(-time.Duration(i) * 24 * time.Hour), FreedSize: 100, ScanDuration: time.Minute})
+	}
+	// Outside the window, from another directory and failed runs are not averaged
+	history = append(history,
+		RunRecord{Dir: "/backup", Start: start.Add(-60 * 24 * time.Hour), FreedSize: 10000},
+		RunRecord{Dir: "/other", Start: start.Add(-time.Hour), FreedSize: 10000},
+		RunRecord{Dir: "/backup", Start: start.Add(-2 * time.Hour), Error: "failed"},
+	)
+	rules := []AlertRule{
+		{Metric: AlertFreedSize, Factor: 2},
+		{Metric: AlertScanDuration, Factor: 2},
+		{Name: "short retention", Metric: AlertRetention, Below: float64(7 * 24 * time.Hour)},
+		{Metric: AlertDeletedFiles, Above: 1000},
+	}
+
+	record := RunRecord{Dir: "/backup", Start: start, FreedSize: 250, ScanDuration: time.Minute, Retention: 3 * 24 * time.Hour, DeletedFiles: 10}
+	alerts := EvaluateAlerts(rules, history, record)
+	if len(alerts) != 2 {
+		t.Fatalf("Expected 2 alerts, got %+v", alerts)
+	}
+	if alerts[0].Rule != "freed-size > 2x average" || alerts[0].Average != 100 || alerts[0].Limit != 200 || alerts[0].Value != 250 {
+		t.Errorf("Unexpected freed size alert %+v", alerts[0])
+	}
+	if alerts[1].Rule != "short retention" || alerts[1].Message != "/backup: retention is 72h0m0s, limit 168h0m0s" {
+		t.Errorf("Unexpected retention alert %+v", alerts[1])
+	}
+
+	// Without history relative rules stay silent, and failed runs are not checked
+	if alerts := EvaluateAlerts(rules[:2], nil, record); len(alerts) != 0 {
+		t.Errorf("Expected no alerts without history, got %+v", alerts)
+	}
+	record.Error = "failed"
+	if alerts := EvaluateAlerts(rules, history, record); len(alerts) != 0 {
+		t.Errorf("Expected no alerts for a failed run, got %+v", alerts)
+	}
+}
+
+func TestRunnerAlertWebhook(t *testing.T) {
+	received := make(chan Alert, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Error(err)
+		}
+		received <- alert
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "backup")
+	createHostFiles(t, dir, 4, time.Now().Truncate(time.Hour))
+	var callbacks int
+	runner, err := NewRunner(RunnerConfig{
+		Policies: map[string]RunnerPolicy{
+			dir: {
+				Interval: time.Hour,
+				Config: CleaningConfig{
+					MaxSize:    int64Ptr(2 * 4096),
+					TimeWindow: time.Hour,
+					DiskInfo:   &failingDiskInfoProvider{},
+				},
+			},
+		},
+		AlertRules:   []AlertRule{{Name: "any deletion", Metric: AlertDeletedFiles, Above: 0.5}},
+		OnAlert:      func(alert Alert) { callbacks++ },
+		AlertWebhook: server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.run(context.Background(), runner.targets[0])
+
+	select {
+	case alert := <-received:
+		if alert.Rule != "any deletion" || alert.Dir != dir || alert.Value != 2 {
+			t.Errorf("Unexpected alert %+v", alert)
+		}
+	default:
+		t.Fatal("Expected the alert to be posted")
+	}
+	if callbacks != 1 || runner.Status()[0].AlertError != nil {
+		t.Errorf("Expected one OnAlert call and no error, got %d, %v", callbacks, runner.Status()[0].AlertError)
+	}
+}
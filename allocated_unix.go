@@ -0,0 +1,20 @@
+//go:build !windows && !js && !wasip1
+// +build !windows,!js,!wasip1
+
+package gobackupcleaner
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// GetAllocatedSize returns the space allocated to a file, from st_blocks
+func (d *DefaultDiskInfoProvider) GetAllocatedSize(path string, info os.FileInfo) (int64, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, errors.New("allocated size not available")
+	}
+	// st_blocks is in 512-byte units per POSIX
+	return int64(stat.Blocks) * 512, nil
+}
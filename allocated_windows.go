@@ -0,0 +1,52 @@
+//go:build windows
+// +build windows
+
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var procGetCompressedFileSize = kernel32.NewProc("GetCompressedFileSizeW")
+
+// clusterSizes caches the cluster size of each volume
+var clusterSizes sync.Map
+
+// GetAllocatedSize returns the space allocated to a file: the compressed size
+// of NTFS-compressed and sparse files, rounded up to the cluster size
+func (d *DefaultDiskInfoProvider) GetAllocatedSize(path string, info os.FileInfo) (int64, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	pathPtr, err := syscall.UTF16PtrFromString(absPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var high uint32
+	low, _, err := procGetCompressedFileSize.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&high)),
+	)
+	// INVALID_FILE_SIZE is also a valid low word, so check the error too
+	if uint32(low) == 0xFFFFFFFF && err != syscall.Errno(0) {
+		return 0, err
+	}
+	size := int64(high)<<32 | int64(uint32(low))
+
+	volume := filepath.VolumeName(absPath)
+	clusterSize, ok := clusterSizes.Load(volume)
+	if !ok {
+		cs, err := d.GetBlockSize(volume + `\`)
+		if err != nil {
+			return 0, err
+		}
+		clusterSize, _ = clusterSizes.LoadOrStore(volume, cs)
+	}
+	return calculateBlockSize(size, clusterSize.(int64)), nil
+}
@@ -0,0 +1,49 @@
+package gobackupcleaner
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// loadArtifacts finds the cleaner's own files below rootPath, the manifest,
+// the referenced list and the stamp file of RunIfDue, so the scan never
+// deletes or counts them even when they are kept next to the backups
+func (c *CleaningConfig) loadArtifacts(rootPath string) *referenceSet {
+	root, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil
+	}
+	var artifacts *referenceSet
+	for _, artifact := range []string{c.ManifestPath, c.ReferencedListFile, c.stampFile} {
+		if artifact == "" {
+			continue
+		}
+		abs, err := filepath.Abs(artifact)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if artifacts == nil {
+			artifacts = &referenceSet{
+				files: make(map[string]struct{}),
+				dirs:  make(map[string]struct{}),
+			}
+		}
+		// Scanned paths are joined to rootPath as given
+		path := filepath.Join(rootPath, rel)
+		artifacts.files[path] = struct{}{}
+		for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+			artifacts.dirs[filepath.Join(rootPath, dir)] = struct{}{}
+		}
+	}
+	return artifacts
+}
+
+// isArtifact reports whether a scanned file is one of the cleaner's own files,
+// or for a directory deleted as a whole, whether it contains one
+func (r *runState) isArtifact(path string, isDir bool) bool {
+	return r != nil && r.artifacts != nil && r.artifacts.contains(path, isDir)
+}
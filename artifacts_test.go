@@ -0,0 +1,59 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArtifactsExcluded(t *testing.T) {
+	tmpDir := t.TempDir()
+	old := time.Now().Add(-72 * time.Hour)
+	for _, name := range []string{"a.tar", "b.tar", "manifest.tsv"} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 1000, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The list lives in a directory that would otherwise be deleted as a whole
+	listPath := filepath.Join(tmpDir, "state", "referenced.txt")
+	if err := os.MkdirAll(filepath.Dir(listPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(listPath, []byte("a.tar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(listPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:            int64Ptr(1),
+		MaxDepth:           1,
+		ManifestPath:       filepath.Join(tmpDir, "manifest.tsv"),
+		ReferencedListFile: listPath,
+		DiskInfo:           &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ScannedFiles != 2 {
+		t.Errorf("Expected only the backups to be scanned, got %d files", report.ScannedFiles)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "b.tar")); !os.IsNotExist(err) {
+		t.Error("Expected b.tar to be deleted")
+	}
+	for _, path := range []string{filepath.Join(tmpDir, "a.tar"), filepath.Join(tmpDir, "manifest.tsv"), listPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to remain: %v", path, err)
+		}
+	}
+}
+
+func TestLoadArtifactsOutsideTarget(t *testing.T) {
+	tmpDir := t.TempDir()
+	config := CleaningConfig{ManifestPath: filepath.Join(t.TempDir(), "manifest.tsv")}
+	if artifacts := config.loadArtifacts(tmpDir); artifacts != nil {
+		t.Errorf("Expected no artifacts below the target directory, got %+v", artifacts)
+	}
+}
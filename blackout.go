@@ -0,0 +1,96 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"time"
+)
+
+// BlackoutWindow is a recurring period of the day during which no deletion
+// may run, e.g. the nightly backup window
+type BlackoutWindow struct {
+	Start time.Duration  // Time of day the window starts, e.g. 1 * time.Hour for 01:00
+	End   time.Duration  // Time of day the window ends; before Start, it ends the next day
+	Days  []time.Weekday // Days the window starts on, every day if empty
+}
+
+// valid reports whether the window lies within a day and is not empty
+func (w BlackoutWindow) valid() bool {
+	if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End >= 24*time.Hour || w.Start == w.End {
+		return false
+	}
+	for _, day := range w.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return false
+		}
+	}
+	return true
+}
+
+// startsOn reports whether the window starts on day
+func (w BlackoutWindow) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// blackoutEnd returns the end of the blackout windows t falls into, in the
+// time zone of t. Adjacent windows are followed to their last end, for at
+// most a week if they cover every day.
+func blackoutEnd(windows []BlackoutWindow, t time.Time) (time.Time, bool) {
+	var end time.Time
+	for i := 0; i <= 7*len(windows); i++ {
+		found := false
+		at := t
+		if !end.IsZero() {
+			at = end
+		}
+		for _, w := range windows {
+			// A window crossing midnight may have started the day before
+			for days := 0; days <= 1; days++ {
+				midnight := time.Date(at.Year(), at.Month(), at.Day()-days, 0, 0, 0, 0, at.Location())
+				if !w.startsOn(midnight.Weekday()) {
+					continue
+				}
+				start := midnight.Add(w.Start)
+				stop := midnight.Add(w.End)
+				if w.End < w.Start {
+					stop = time.Date(midnight.Year(), midnight.Month(), midnight.Day()+1, 0, 0, 0, 0, at.Location()).Add(w.End)
+				}
+				if !at.Before(start) && at.Before(stop) && stop.After(end) {
+					end = stop
+					found = true
+				}
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return end, !end.IsZero()
+}
+
+// waitBlackout blocks while the current time is in a blackout window. It
+// returns the context error if ctx is done first.
+func waitBlackout(ctx context.Context, windows []BlackoutWindow) error {
+	if len(windows) == 0 {
+		return nil
+	}
+	end, ok := blackoutEnd(windows, time.Now())
+	if !ok {
+		return nil
+	}
+	timer := time.NewTimer(time.Until(end))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,125 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBlackoutEnd(t *testing.T) {
+	// A Wednesday
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	nightly := BlackoutWindow{Start: 22 * time.Hour, End: 2 * time.Hour}
+	weekend := BlackoutWindow{Start: 9 * time.Hour, End: 17 * time.Hour, Days: []time.Weekday{time.Saturday, time.Sunday}}
+	adjacent := []BlackoutWindow{
+		{Start: time.Hour, End: 2 * time.Hour},
+		{Start: 2 * time.Hour, End: 3 * time.Hour},
+	}
+
+	tests := []struct {
+		name    string
+		windows []BlackoutWindow
+		at      time.Time
+		want    time.Time
+	}{
+		{"before", []BlackoutWindow{nightly}, day.Add(21 * time.Hour), time.Time{}},
+		{"evening", []BlackoutWindow{nightly}, day.Add(23 * time.Hour), day.Add(26 * time.Hour)},
+		{"after midnight", []BlackoutWindow{nightly}, day.Add(time.Hour), day.Add(2 * time.Hour)},
+		{"end excluded", []BlackoutWindow{nightly}, day.Add(2 * time.Hour), time.Time{}},
+		{"other day", []BlackoutWindow{weekend}, day.Add(10 * time.Hour), time.Time{}},
+		{"weekend", []BlackoutWindow{weekend}, day.AddDate(0, 0, 3).Add(10 * time.Hour), day.AddDate(0, 0, 3).Add(17 * time.Hour)},
+		{"adjacent", adjacent, day.Add(90 * time.Minute), day.Add(3 * time.Hour)},
+	}
+	for _, tt := range tests {
+		end, ok := blackoutEnd(tt.windows, tt.at)
+		if !end.Equal(tt.want) || ok != !tt.want.IsZero() {
+			t.Errorf("%s: blackoutEnd = %v, %t, want %v", tt.name, end, ok, tt.want)
+		}
+	}
+}
+
+// windowAround returns a blackout window from before until after now
+func windowAround(now time.Time, before, after time.Duration) BlackoutWindow {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := (now.Sub(midnight) - before + 24*time.Hour) % (24 * time.Hour)
+	end := (now.Sub(midnight) + after) % (24 * time.Hour)
+	return BlackoutWindow{Start: start, End: end}
+}
+
+func TestBlackoutPausesDeletion(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.tar"), 4096, time.Now().Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var deletedAt time.Time
+	start := time.Now()
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:         int64Ptr(1),
+		BlackoutWindows: []BlackoutWindow{windowAround(start, time.Minute, 300*time.Millisecond)},
+		DiskInfo:        &failingDiskInfoProvider{},
+		Callbacks: Callbacks{
+			OnFileDeleted: func(info FileDeletedInfo) { deletedAt = time.Now() },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 {
+		t.Fatalf("Expected the file to be deleted after the window, got %d files", report.DeletedFiles)
+	}
+	if deletedAt.Sub(start) < 200*time.Millisecond {
+		t.Errorf("Expected the deletion to wait for the end of the window, deleted after %v", deletedAt.Sub(start))
+	}
+
+	// Canceling during the window stops the run without deleting
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.tar"), 4096, time.Now().Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	cleaner, err := NewCleaner(CleaningConfig{
+		MaxSize:         int64Ptr(1),
+		BlackoutWindows: []BlackoutWindow{windowAround(time.Now(), time.Minute, time.Hour)},
+		DiskInfo:        &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	report, _ = cleaner.Clean(ctx, tmpDir)
+	if report.DeletedFiles != 0 {
+		t.Errorf("Expected no deletion during the window, got %d files", report.DeletedFiles)
+	}
+}
+
+func TestRunnerDefersBlackout(t *testing.T) {
+	tmpDir := t.TempDir()
+	runner, err := NewRunner(RunnerConfig{Policies: map[string]RunnerPolicy{
+		tmpDir: {
+			Interval: time.Hour,
+			Config: CleaningConfig{
+				MaxSize:         int64Ptr(1 << 30),
+				BlackoutWindows: []BlackoutWindow{windowAround(time.Now(), time.Minute, 200*time.Millisecond)},
+				DiskInfo:        &failingDiskInfoProvider{},
+			},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runner.Status()[0].Runs == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	status := runner.Status()[0]
+	if status.Deferred != 1 || status.Runs != 1 {
+		t.Errorf("Expected one deferred run followed by a run, got %+v", status)
+	}
+}
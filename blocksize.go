@@ -0,0 +1,85 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"sync"
+)
+
+// blockSizes resolves the block size of the file system of each file, so a
+// tree spanning mount points is accounted with the block size of each file
+// system instead of the one of the target directory
+type blockSizes struct {
+	provider DiskInfoProvider
+	root     int64 // Block size of the target directory
+
+	mu      sync.Mutex
+	devices map[uint64]int64 // Block sizes by device
+}
+
+// newBlockSizes returns the block sizes of the tree below rootPath, or nil if
+// every file uses rootBlockSize: with BlockSizeOverride, with apparent sizes,
+// or when devices cannot be told apart on this platform
+func newBlockSizes(config *CleaningConfig, rootPath string, rootBlockSize int64) *blockSizes {
+	if config.BlockSizeOverride != nil || rootBlockSize <= 0 {
+		return nil
+	}
+	info, err := config.fs().Stat(rootPath)
+	if err != nil {
+		return nil
+	}
+	dev, ok := deviceOf(info)
+	if !ok {
+		return nil
+	}
+	return &blockSizes{
+		provider: config.DiskInfo,
+		root:     rootBlockSize,
+		devices:  map[uint64]int64{dev: rootBlockSize},
+	}
+}
+
+// of returns the block size of the file system of path. The block size of a
+// file system the provider cannot report falls back to the root's.
+func (b *blockSizes) of(path string, info os.FileInfo) int64 {
+	dev, ok := deviceOf(info)
+	if !ok {
+		return b.root
+	}
+	b.mu.Lock()
+	blockSize, ok := b.devices[dev]
+	b.mu.Unlock()
+	if ok {
+		return blockSize
+	}
+
+	blockSize, err := b.provider.GetBlockSize(path)
+	if err != nil || blockSize <= 0 {
+		blockSize = b.root
+	}
+	b.mu.Lock()
+	b.devices[dev] = blockSize
+	b.mu.Unlock()
+	return blockSize
+}
+
+// spaceFunc returns the space accounted for a file
+type spaceFunc func(path string, info os.FileInfo) int64
+
+// apparentSize accounts files by their apparent size
+func apparentSize(path string, info os.FileInfo) int64 {
+	return info.Size()
+}
+
+// fileSpace returns the space accounted for a file: the allocated size in
+// SizeModeAllocated if the provider reports it, or the size rounded up to
+// blockSize otherwise
+func (c *CleaningConfig) fileSpace(path string, info os.FileInfo, blockSize int64) int64 {
+	if c.SizeMode == SizeModeAllocated {
+		if provider, ok := c.DiskInfo.(AllocatedSizeProvider); ok {
+			if size, err := provider.GetAllocatedSize(path, info); err == nil {
+				return size
+			}
+		}
+	}
+	return calculateBlockSize(info.Size(), blockSize)
+}
@@ -0,0 +1,116 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// countingDiskInfoProvider counts the block size lookups
+type countingDiskInfoProvider struct {
+	failingDiskInfoProvider
+	lookups int
+}
+
+func (c *countingDiskInfoProvider) GetBlockSize(path string) (int64, error) {
+	c.lookups++
+	return 65536, nil
+}
+
+func TestBlockSizesPerDevice(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("devices are not available on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	if err := createTestFile(t, path, 100, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The root's device is known, so its files use the root's block size
+	provider := &countingDiskInfoProvider{}
+	config := &CleaningConfig{DiskInfo: provider}
+	sizes := newBlockSizes(config, filepath.Dir(path), 512)
+	if got := sizes.of(path, info); got != 512 || provider.lookups != 0 {
+		t.Errorf("Expected the root's block size without lookups, got %d after %d lookups", got, provider.lookups)
+	}
+
+	// Files on another device are looked up once
+	sizes.devices = make(map[uint64]int64)
+	for i := 0; i < 2; i++ {
+		if got := sizes.of(path, info); got != 65536 {
+			t.Errorf("Expected the block size of the device, got %d", got)
+		}
+	}
+	if provider.lookups != 1 {
+		t.Errorf("Expected 1 lookup, got %d", provider.lookups)
+	}
+
+	override := int64(1024)
+	config.BlockSizeOverride = &override
+	if newBlockSizes(config, filepath.Dir(path), 512) != nil {
+		t.Error("Expected BlockSizeOverride to apply to all files")
+	}
+}
+
+func TestBlockSizeOverride(t *testing.T) {
+	tmpDir := t.TempDir()
+	createHostFiles(t, tmpDir, 4, time.Now().Truncate(time.Hour))
+
+	// With 1024 byte blocks the 4096 byte files fit twice into MaxSize
+	override := int64(1024)
+	maxSize := int64(2 * 4096)
+	provider := &countingDiskInfoProvider{}
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:           &maxSize,
+		TimeWindow:        time.Hour,
+		BlockSizeOverride: &override,
+		DiskInfo:          provider,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.BlockSize != 1024 || report.DeletedFiles != 2 || report.DeletedBlockSize != 2*4096 || provider.lookups != 0 {
+		t.Errorf("Unexpected report: block size %d, %d files, %d bytes, %d lookups", report.BlockSize, report.DeletedFiles, report.DeletedBlockSize, provider.lookups)
+	}
+}
+
+func TestSizeModeAllocated(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sparse files are not created by Truncate on Windows")
+	}
+	tmpDir := t.TempDir()
+	f, err := os.Create(filepath.Join(tmpDir, "sparse.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []SizeMode{SizeModeBlock, SizeModeAllocated} {
+		cleaner, err := NewCleaner(CleaningConfig{MaxSize: int64Ptr(0), SizeMode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := cleaner.Scan(context.Background(), tmpDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The hole of a sparse file is not allocated
+		file := result.Files[0]
+		allocated := file.BlockSize < file.Size
+		if allocated != (mode == SizeModeAllocated) {
+			t.Errorf("%s: unexpected block size %d for size %d", mode, file.BlockSize, file.Size)
+		}
+	}
+}
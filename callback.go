@@ -11,17 +11,21 @@ type Callbacks struct {
 	OnDirDeleted   func(info DirDeletedInfo)
 	OnComplete     func(info CompleteInfo)
 	OnError        func(info ErrorInfo)
+	OnWarning      func(info ConfigWarning) // Called by NewCleaner with the warnings of Lint
 }
 
 // StartInfo contains information at the start of cleaning
 type StartInfo struct {
+	RunID        string
 	TargetDir    string
 	CurrentUsage DiskUsage
 	TargetSize   int64 // Size to be deleted in bytes
+	FileSystem   FileSystemInfo
 }
 
 // ScanCompleteInfo contains information after file scanning is complete
 type ScanCompleteInfo struct {
+	RunID         string
 	ScannedFiles  int
 	TotalSize     int64
 	BlockSize     int64
@@ -31,34 +35,58 @@ type ScanCompleteInfo struct {
 
 // DeleteStartInfo contains information at the start of deletion
 type DeleteStartInfo struct {
+	RunID          string
 	EstimatedFiles int
 	EstimatedSize  int64
 }
 
 // FileDeletedInfo contains information about a deleted file
 type FileDeletedInfo struct {
+	RunID     string
 	Path      string
 	Size      int64
 	BlockSize int64
 	ModTime   time.Time
+	IsDir     bool // True when an opaque directory was removed as a whole (see MaxDepth)
+
+	// DisplayPath is Path truncated to DisplayPathWidth columns for logs and
+	// TUIs, empty when DisplayPathWidth is not set
+	DisplayPath string
+
+	// Deletions so far against the plan's estimates, including this file
+	Progress DeleteProgress
+
+	// Values of the CaptureXattrs the file had, read before deleting it
+	Xattrs map[string]string
 }
 
 // DirDeletedInfo contains information about a deleted directory
 type DirDeletedInfo struct {
-	Path string
+	RunID       string
+	Path        string
+	DisplayPath string // Path truncated to DisplayPathWidth columns, empty if not set
 }
 
 // CompleteInfo contains information at the completion of cleaning
 type CompleteInfo struct {
+	RunID            string
 	DeletedFiles     int
 	DeletedSize      int64
 	DeletedBlockSize int64
 	DeletedDirs      int
 	DeleteDuration   time.Duration
+
+	// Removed directory paths, collected when MaxRemovedDirPaths is set
+	RemovedDirs          []string
+	RemovedDirsTruncated bool
+
+	// Final progress, Complete, with the estimates to compare the deletion to
+	Progress DeleteProgress
 }
 
 // ErrorInfo contains error information
 type ErrorInfo struct {
+	RunID string
 	Type  ErrorType
 	Path  string
 	Error error
@@ -68,9 +96,12 @@ type ErrorInfo struct {
 type ErrorType string
 
 const (
-	ErrorTypeScan   ErrorType = "scan"
-	ErrorTypeDelete ErrorType = "delete"
-	ErrorTypeDir    ErrorType = "dir"
+	ErrorTypeScan     ErrorType = "scan"
+	ErrorTypeDelete   ErrorType = "delete"
+	ErrorTypeDir      ErrorType = "dir"
+	ErrorTypeManifest ErrorType = "manifest"
+	ErrorTypePrune    ErrorType = "prune"  // RepositoryPruner failures
+	ErrorTypeVerify   ErrorType = "verify" // Discrepancies found by VerifyAfterClean
 )
 
 // callSafe safely calls a callback function if it's not nil
@@ -78,4 +109,4 @@ func callSafe[T any](fn func(T), info T) {
 	if fn != nil {
 		fn(info)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,199 @@
+package gobackupcleaner
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MinSizeRule flags files matching Pattern that are smaller than MinSize as truncated
+type MinSizeRule struct {
+	Pattern string // Glob pattern matched against the file name (e.g. "*.tar.gz")
+	MinSize int64  // Minimum expected size in bytes
+}
+
+// fileClass classifies files that are deleted before age-based deletion
+type fileClass int
+
+const (
+	classNormal     fileClass = iota // Subject to age-based deletion
+	classBroken                      // Zero-byte or truncated file
+	classTemp                        // Leftover temp file or directory
+	classExpendable                  // File in an expendable directory
+	classExpired                     // File older than MaxAge or the MaxAge of its override
+	classRuleDelete                  // File matched by a RuleDelete rule
+	classKept                        // File matched by a RuleKeep rule, not deleted by age
+	classProtected                   // File matched by a RuleProtect rule, never deleted
+	classUnlisted                    // File missing from the referenced list
+	classReferenced                  // File on the referenced list, never deleted
+	classOverQuota                   // Oldest file of an owner above its quota (see OwnerQuotas)
+)
+
+// classNames are the categories of the classes reported by Scan
+var classNames = []string{"age-based", "broken", "temp", "expendable", "expired", "rule-delete", "kept", "protected", "unlisted", "referenced", "over-quota"}
+
+func (f fileClass) String() string { return enumString(classNames, int(f)) }
+
+// shouldDelete reports whether a file of the class is deleted with the threshold.
+// Priority classes are deleted regardless of age.
+func shouldDelete(class fileClass, modTime, threshold time.Time) bool {
+	switch class {
+	case classNormal:
+		return modTime.Before(threshold)
+	case classKept, classProtected, classReferenced:
+		return false
+	default:
+		return true
+	}
+}
+
+// isKept reports whether files of the class are kept out of the deletion
+func (f fileClass) isKept() bool {
+	return f == classKept || f == classProtected || f == classReferenced
+}
+
+// tempFilePatterns are the built-in name patterns of temp files
+var tempFilePatterns = []string{"*.part", "*.tmp"}
+
+// tempDirNames are the built-in names of temp directories deleted as a whole
+var tempDirNames = []string{".~tmp~"}
+
+// classStats counts deleted files of a class
+type classStats struct {
+	files int
+	size  int64
+}
+
+// classifier classifies files during a single run
+type classifier struct {
+	config     *CleaningConfig
+	now        time.Time
+	root       string
+	expendable []string // Absolute paths of the expendable directories
+	overrides  []resolvedOverride
+	rules      []compiledRule
+	references *referenceSet // Referenced files of the run, nil without a referenced list
+}
+
+// newClassifier creates a classifier for the files below rootPath
+func newClassifier(config *CleaningConfig, run *runState, rootPath string, now time.Time) *classifier {
+	c := &classifier{
+		config:    config,
+		now:       now,
+		root:      rootPath,
+		overrides: resolveOverrides(config.Overrides, rootPath),
+		rules:     compileRules(config.Rules),
+	}
+	for _, dir := range config.ExpendableDirs {
+		c.expendable = append(c.expendable, filepath.Join(rootPath, filepath.Clean(dir)))
+	}
+	if run != nil {
+		c.references = run.references
+	}
+	return c
+}
+
+// classifyFile determines whether a regular file should be deleted
+// before any age-based deletion, or kept out of the deletion
+func (c *classifier) classifyFile(path string, size int64, modTime time.Time) fileClass {
+	return c.classify(path, size, modTime, false)
+}
+
+// classifyDir classifies an opaque directory. size is the total size and
+// modTime the newest modification time of its files.
+func (c *classifier) classifyDir(path string, size int64, modTime time.Time) fileClass {
+	return c.classify(path, size, modTime, true)
+}
+
+// classify evaluates the rules and the cleanup policies for a deletion unit
+func (c *classifier) classify(path string, size int64, modTime time.Time, isDir bool) fileClass {
+	action := c.ruleAction(path, size, modTime)
+	if action == RuleProtect {
+		return classProtected
+	}
+	refs := c.references
+	if refs != nil && refs.contains(path, isDir) {
+		return classReferenced
+	}
+	// Expired files are deleted even while the constraints are met, when the
+	// other priority classes are not. RuleKeep keeps files from any deletion
+	// by age, MaxAge included.
+	if action != RuleKeep && c.isExpired(path, modTime) {
+		return classExpired
+	}
+	if refs != nil {
+		return classUnlisted
+	}
+
+	if c.isExpendable(path) {
+		return classExpendable
+	}
+	isTemp := c.config.isTempDir(path)
+	if !isDir {
+		isTemp = c.config.CleanTempFiles && isTempFile(path)
+	}
+	if isTemp && c.now.Sub(modTime) >= c.config.TempGracePeriod {
+		return classTemp
+	}
+	if !isDir && c.config.DeleteBrokenFirst && c.config.isBroken(path, size) {
+		return classBroken
+	}
+
+	switch action {
+	case RuleDelete:
+		return classRuleDelete
+	case RuleKeep:
+		return classKept
+	}
+	return classNormal
+}
+
+// isExpendable reports whether a path is inside an expendable directory
+func (c *classifier) isExpendable(path string) bool {
+	for _, dir := range c.expendable {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBroken reports whether a file is zero-byte or smaller than the minimum
+// expected size of the first matching MinExpectedSizes rule
+func (c *CleaningConfig) isBroken(path string, size int64) bool {
+	if size == 0 {
+		return true
+	}
+	name := filepath.Base(path)
+	for _, rule := range c.MinExpectedSizes {
+		if matched, _ := filepath.Match(rule.Pattern, name); matched {
+			return size < rule.MinSize
+		}
+	}
+	return false
+}
+
+// isTempDir reports whether a directory is a temp directory deleted as a whole
+func (c *CleaningConfig) isTempDir(path string) bool {
+	if !c.CleanTempFiles {
+		return false
+	}
+	name := filepath.Base(path)
+	for _, tempName := range tempDirNames {
+		if name == tempName {
+			return true
+		}
+	}
+	return false
+}
+
+// isTempFile reports whether a file name matches a temp file pattern
+func isTempFile(path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range tempFilePatterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsBroken(t *testing.T) {
+	config := CleaningConfig{
+		MinExpectedSizes: []MinSizeRule{
+			{Pattern: "*.tar.gz", MinSize: 1024},
+			{Pattern: "*", MinSize: 10},
+		},
+	}
+
+	tests := []struct {
+		path   string
+		size   int64
+		broken bool
+	}{
+		{"/backup/empty.log", 0, true},
+		{"/backup/db.tar.gz", 512, true},
+		{"/backup/db.tar.gz", 1024, false},
+		{"/backup/notes.txt", 5, true},
+		{"/backup/notes.txt", 10, false},
+	}
+	for _, tt := range tests {
+		if got := config.isBroken(tt.path, tt.size); got != tt.broken {
+			t.Errorf("isBroken(%q, %d) = %v, want %v", tt.path, tt.size, got, tt.broken)
+		}
+	}
+}
+
+// TestDeleteBrokenFirst tests that broken files are deleted before valid old backups
+func TestDeleteBrokenFirst(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-broken-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	files := []struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}{
+		{"old.tar.gz", 2 * 1024 * 1024, now.Add(-72 * time.Hour)},
+		{"mid.tar.gz", 2 * 1024 * 1024, now.Add(-48 * time.Hour)},
+		{"truncated.tar.gz", 100 * 1024, now},
+		{"empty.log", 0, now},
+	}
+	for _, f := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, f.name), f.size, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the broken files have to go to satisfy the limit
+	maxSize := int64(4 * 1024 * 1024)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:           &maxSize,
+		TimeWindow:        time.Hour,
+		DeleteBrokenFirst: true,
+		MinExpectedSizes:  []MinSizeRule{{Pattern: "*.tar.gz", MinSize: 1024 * 1024}},
+		DiskInfo:          &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.DeletedBrokenFiles != 2 || report.DeletedBrokenSize != 100*1024 {
+		t.Errorf("Expected 2 broken files of 100KB deleted, got %d files of %d bytes", report.DeletedBrokenFiles, report.DeletedBrokenSize)
+	}
+	if report.DeletedFiles != 2 {
+		t.Errorf("Expected 2 deleted files, got %d", report.DeletedFiles)
+	}
+	for _, name := range []string{"old.tar.gz", "mid.tar.gz"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to remain: %v", name, err)
+		}
+	}
+	for _, name := range []string{"truncated.tar.gz", "empty.log"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+}
+
+// TestCleanTempFiles tests that temp files past the grace period are reclaimed first
+func TestCleanTempFiles(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-temp-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	if err := os.Mkdir(filepath.Join(tmpDir, ".~tmp~"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := []struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}{
+		{"keep.txt", 2 * 1024 * 1024, now.Add(-72 * time.Hour)},
+		{"upload.part", 1024 * 1024, now.Add(-48 * time.Hour)},
+		{"fresh.tmp", 1024 * 1024, now},
+		{filepath.Join(".~tmp~", "partial.dat"), 1024 * 1024, now.Add(-48 * time.Hour)},
+	}
+	for _, f := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, f.name), f.size, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the expired temp files have to go to satisfy the limit
+	maxSize := int64(3 * 1024 * 1024)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:        &maxSize,
+		TimeWindow:     time.Hour,
+		CleanTempFiles: true,
+		DiskInfo:       &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.ReclaimedTempFiles != 2 || report.ReclaimedTempBytes != 2*1024*1024 {
+		t.Errorf("Expected 2 temp files of 2MB reclaimed, got %d files of %d bytes", report.ReclaimedTempFiles, report.ReclaimedTempBytes)
+	}
+	for _, name := range []string{"keep.txt", "fresh.tmp"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to remain: %v", name, err)
+		}
+	}
+	for _, name := range []string{"upload.part", ".~tmp~"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+}
+
+// TestExpendableDirs tests that expendable directories are emptied before age-based deletion
+func TestExpendableDirs(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-expendable-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	for _, dir := range []string{"tmp", filepath.Join("staging", "job"), "tmpfiles"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}{
+		{"old.dat", 2 * 1024 * 1024, now.Add(-72 * time.Hour)},
+		{filepath.Join("tmpfiles", "keep.dat"), 1024 * 1024, now},
+		{filepath.Join("tmp", "scratch.dat"), 1024 * 1024, now},
+		{filepath.Join("staging", "job", "upload.dat"), 1024 * 1024, now},
+	}
+	for _, f := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, f.name), f.size, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Emptying the expendable directories satisfies the limit
+	maxSize := int64(3 * 1024 * 1024)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:        &maxSize,
+		TimeWindow:     time.Hour,
+		ExpendableDirs: []string{"tmp/", "staging/"},
+		DiskInfo:       &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.DeletedExpendableFiles != 2 || report.DeletedExpendableSize != 2*1024*1024 {
+		t.Errorf("Expected 2 expendable files of 2MB deleted, got %d files of %d bytes", report.DeletedExpendableFiles, report.DeletedExpendableSize)
+	}
+	for _, name := range []string{"old.dat", filepath.Join("tmpfiles", "keep.dat")} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to remain: %v", name, err)
+		}
+	}
+	for _, name := range []string{filepath.Join("tmp", "scratch.dat"), filepath.Join("staging", "job", "upload.dat")} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+}
@@ -1,38 +1,440 @@
 package gobackupcleaner
 
 import (
+	"context"
+	"errors"
 	"os"
 	"time"
 )
 
 // CleanBackup cleans backup files based on the specified configuration
 func CleanBackup(dirPath string, config CleaningConfig) (CleaningReport, error) {
-	startTime := time.Now()
+	return CleanBackupContext(context.Background(), dirPath, config)
+}
+
+// CleanBackupContext is like CleanBackup, but stops the scan and the deletion
+// once ctx is canceled or its deadline passes, returning the partial report
+// together with ctx.Err()
+func CleanBackupContext(ctx context.Context, dirPath string, config CleaningConfig) (CleaningReport, error) {
+	cleaner, err := NewCleaner(config)
+	if err != nil {
+		return CleaningReport{}, err
+	}
+	return cleaner.Clean(ctx, dirPath)
+}
+
+// Cleaner runs cleaning operations with a configuration that is validated once.
+// It is safe for concurrent use, e.g. to clean several directories in parallel;
+// callbacks may then be invoked concurrently.
+type Cleaner struct {
+	config CleaningConfig
+}
 
-	// Set defaults and validate configuration
+// NewCleaner validates the configuration and creates a reusable Cleaner
+func NewCleaner(config CleaningConfig) (*Cleaner, error) {
 	config.setDefaults()
 	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.Callbacks.OnWarning != nil {
+		for _, warning := range config.Lint() {
+			config.Callbacks.OnWarning(warning)
+		}
+	}
+	if err := config.readReferencedList(); err != nil {
+		return nil, err
+	}
+	// All runs of the Cleaner share the cache
+	if config.DiskInfoCacheTTL > 0 {
+		config.DiskInfo = NewCachingDiskInfoProvider(config.DiskInfo, config.DiskInfoCacheTTL)
+	}
+	// All runs of the Cleaner share its limits
+	if config.RateLimiter == nil && (config.MaxDeletesPerSecond > 0 || config.MaxBytesPerSecond > 0) {
+		config.RateLimiter = NewRateLimiter(config.MaxDeletesPerSecond, config.MaxBytesPerSecond)
+	}
+	return &Cleaner{config: config}, nil
+}
+
+// Clean cleans backup files in dirPath. If ctx is canceled the run stops
+// gracefully and the partial report is returned together with the context error.
+func (c *Cleaner) Clean(ctx context.Context, dirPath string) (CleaningReport, error) {
+	return cleanBackup(ctx, dirPath, c.config, nil, nil)
+}
+
+// NeedsCleaning reports whether a run would delete files to free space in
+// dirPath, honouring StartFreeSpace and StartUsagePercent, along with the
+// current disk usage. Schedulers can call it to skip runs cheaply. With
+// MaxAge, in the configuration or an override, it always reports true, as
+// expired files are deleted on every run.
+func (c *Cleaner) NeedsCleaning(dirPath string) (bool, DiskUsage, error) {
+	usage, err := getDiskUsage(c.config.DiskInfo, dirPath)
+	if err != nil {
+		return false, DiskUsage{}, err
+	}
+	return c.config.hasMaxAge() || needsCleaning(usage, &c.config), *usage, nil
+}
+
+// CleanFromIndex is like Clean, but takes the files from a precomputed index
+// (a database, a previous scan, du output) instead of walking dirPath.
+// dirPath is still used to measure disk usage and to match the paths of
+// rules, overrides and ExpendableDirs. Only indexed files are deleted, and
+// files modified since the index was built are skipped.
+func (c *Cleaner) CleanFromIndex(ctx context.Context, dirPath string, index []FileRecord) (CleaningReport, error) {
+	if err := checkDir(c.config.fs(), dirPath); err != nil {
 		return CleaningReport{}, err
 	}
+	if err := validateIndex(dirPath, index); err != nil {
+		return CleaningReport{}, err
+	}
+	return cleanBackup(ctx, dirPath, c.config, func(ctx context.Context, s *scanner) error {
+		return s.load(ctx, dirPath, index)
+	}, nil)
+}
 
-	// Check if directory exists
-	if _, err := os.Stat(dirPath); err != nil {
-		if os.IsNotExist(err) {
-			return CleaningReport{}, ErrDirectoryNotFound
+// Plan computes which files in dirPath would be deleted, without deleting anything
+func (c *Cleaner) Plan(ctx context.Context, dirPath string) (plan *CleaningPlan, err error) {
+	config := c.config
+	ctx, span := startSpan(ctx, &config, SpanPlan)
+	span.SetAttribute(AttrTargetDir, dirPath)
+	defer func() { span.End(err) }()
+
+	plan, err = buildPlan(ctx, dirPath, &config, nil, false)
+	if plan != nil {
+		plan.cleaner = c
+	}
+	return plan, err
+}
+
+// PlanFromIndex is like Plan, but takes the files from a precomputed index
+// (see CleanFromIndex). dirPath does not need to exist, so a listing uploaded
+// from another machine can be planned, e.g. in a browser with js/wasm; use a
+// StaticDiskInfoProvider to describe its disk.
+func (c *Cleaner) PlanFromIndex(ctx context.Context, dirPath string, index []FileRecord) (plan *CleaningPlan, err error) {
+	config := c.config
+	ctx, span := startSpan(ctx, &config, SpanPlan)
+	span.SetAttribute(AttrTargetDir, dirPath)
+	defer func() { span.End(err) }()
+
+	if err := validateIndex(dirPath, index); err != nil {
+		return nil, err
+	}
+	plan, err = buildPlan(ctx, dirPath, &config, func(ctx context.Context, s *scanner) error {
+		return s.load(ctx, dirPath, index)
+	}, false)
+	if plan != nil {
+		plan.cleaner = c
+	}
+	return plan, err
+}
+
+// cleanBackup runs all phases of a cleaning operation. If populate is nil
+// dirPath is scanned. If planned is set, its candidates are deleted instead
+// (see Execute). The configuration must already have defaults applied and be
+// validated.
+func cleanBackup(ctx context.Context, dirPath string, config CleaningConfig, populate populateFunc, planned *CleaningPlan) (report CleaningReport, err error) {
+	startTime := time.Now()
+
+	// Cancellation by the caller is reported as an error, MaxDuration is not
+	parent := ctx
+	if config.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.MaxDuration)
+		defer cancel()
+	}
+
+	runID := runIDFrom(ctx)
+	config.Callbacks = config.Callbacks.withRunID(runID)
+	defer func() { report.RunID = runID }()
+
+	ctx, span := startSpan(ctx, &config, SpanClean)
+	span.SetAttribute(AttrRunID, runID)
+	span.SetAttribute(AttrTargetDir, dirPath)
+	defer func() { span.End(err) }()
+
+	// Cached disk usage is stale once the run freed space, or may be when a
+	// failed run deleted files before failing
+	defer func() {
+		if err != nil || report.DeletedFiles > 0 || report.DeletedDirs > 0 {
+			invalidateDiskUsage(&config)
+		}
+	}()
+
+	// Repositories free their space first, the plan sees the result
+	var pruned []Repository
+	if populate == nil && planned == nil {
+		pruned = pruneRepositories(ctx, dirPath, &config)
+		if len(pruned) > 0 {
+			invalidateDiskUsage(&config)
+		}
+	}
+
+	// Phase 1: Scan files and compute the plan
+	profiler := startPhaseMemory(config.ProfileMemory, PhaseScan)
+	plan := planned
+	if plan == nil {
+		plan, err = buildPlan(ctx, dirPath, &config, populate, config.Pipeline)
+	}
+	profile := profiler.end(nil)
+	if err != nil {
+		return CleaningReport{}, err
+	}
+	if !plan.needsDeletion {
+		// Nothing to delete, or the scan was interrupted
+		interrupted := ctx.Err() != nil
+		var manifest ManifestResult
+		if !interrupted {
+			manifest = updateManifest(dirPath, &config)
+		}
+		report := CleaningReport{
+			ScannedFiles:      plan.ScannedFiles,
+			ScanDuration:      plan.ScanDuration,
+			TotalDuration:     time.Since(startTime),
+			TimedOut:          interrupted && parent.Err() == nil,
+			PipelinedFiles:    plan.pipelined,
+			KeptLatestFiles:   plan.KeptLatestFiles,
+			KeptFiles:         plan.KeptFiles,
+			Protections:       plan.Protections,
+			Repositories:      plan.Repositories,
+			ScanWorkers:       plan.scanWorkers,
+			Timings:           plan.scanTimings,
+			Manifest:          manifest,
+			FileSystem:        plan.FileSystem,
+			UsageBase:         config.UsageBase,
+			ConfigFingerprint: plan.ConfigFingerprint,
+			PolicyName:        plan.PolicyName,
+			PolicyVersion:     plan.PolicyVersion,
+		}
+		report.PrunedRepositories = pruned
+		report.MemoryDegraded = plan.MemoryDegraded
+		report.MemoryProfile = profile
+		report.DroppedErrors = plan.droppedErrors
+		var deletedPaths map[string]struct{}
+		var ownerDeleted map[uint32]classStats
+		if plan.deleter != nil {
+			// Files deleted by the pipeline before the scan was interrupted
+			report.DeletedFiles, report.DeletedSize, report.DeletedBlockSize = plan.deleter.getStats()
+			report.DroppedErrors += plan.deleter.droppedErrors
+			deletedPaths = plan.deleter.deletedPaths
+			ownerDeleted = plan.deleter.ownerDeleted
+		}
+		report.Owners = ownerReport(plan.owners, ownerDeleted, plan.ownerQuotas)
+		report.setTarget(plan.target)
+		if config.DirectoryReport {
+			report.Directories = summarizeDirectories(dirPath, plan.scanned, deletedPaths)
 		}
+		return report, parent.Err()
+	}
+
+	// Phase 2: Delete files
+	deleteStartTime := time.Now()
+	profiler = startPhaseMemory(config.ProfileMemory, PhaseDelete)
+	_, deleteSpan := startSpan(ctx, &config, SpanDelete)
+
+	// Call OnDeleteStart callback
+	callSafe(config.Callbacks.OnDeleteStart, DeleteStartInfo{
+		EstimatedFiles: plan.EstimatedFiles,
+		EstimatedSize:  plan.EstimatedSize,
+	})
+
+	deleter := plan.deleter
+	if deleter == nil {
+		deleter = newDeleter(&config, plan.run, dirPath, config.accountingBlockSize(plan.BlockSize))
+		deleter.sizes = plan.sizes
+	}
+	deleter.protected = plan.protected
+	deleter.overQuota = plan.overQuota
+	deleter.estimatedFiles, deleter.estimatedSize = plan.EstimatedFiles, plan.EstimatedSize
+	deleter.thresholds = prefixThresholds(plan.Prefixes)
+	deleter.volumes = plan.volumes
+	deleter.volumeThresholds = volumeThresholdsByPath(plan.Volumes)
+	deleter.exact = planned != nil
+	if plan.PartialScan || plan.expiredOnly || populate != nil || planned != nil {
+		// Walking the whole tree could delete files that were not counted
+		err = deleter.deleteCandidates(ctx, plan.Candidates, plan.TimeThreshold)
+	} else {
+		err = deleter.deleteFiles(ctx, dirPath, plan.TimeThreshold)
+	}
+	if err != nil {
+		deleteSpan.End(err)
 		return CleaningReport{}, err
 	}
+	interrupted := ctx.Err() != nil
+
+	// Phase 3: Delete empty directories
+	var deletedDirs int
+	if !interrupted {
+		deletedDirs, _ = deleter.deleteEmptyDirs()
+		// Ignore error as it's non-fatal for directory deletion
+	}
+
+	// Files deleted while still open are silly-renamed on NFS and free no
+	// space until closed
+	var leftovers []Discrepancy
+	if plan.FileSystem.Network || config.VerifyAfterClean || config.RetrySillyRenamed {
+		leftovers = deleter.findSillyRenamed(plan.sillyRenamed)
+		if config.RetrySillyRenamed && !interrupted {
+			leftovers = deleter.retrySillyRenamed(ctx, leftovers)
+		}
+	}
+	var discrepancies []Discrepancy
+	if config.VerifyAfterClean {
+		discrepancies = deleter.verify(leftovers)
+	}
+
+	// Restore parent directory timestamps changed by the deletions
+	if config.PreserveParentMTimes {
+		deleter.restoreParentTimes()
+	}
+
+	deleteDuration := time.Since(deleteStartTime)
+	profile = profiler.end(profile)
+	deletedFiles, deletedSize, deletedBlocks := deleter.getStats()
+	broken := deleter.getClassStats(classBroken)
+	temp := deleter.getClassStats(classTemp)
+	expendable := deleter.getClassStats(classExpendable)
+	expired := deleter.getClassStats(classExpired)
+	byRule := deleter.getClassStats(classRuleDelete)
+	unlisted := deleter.getClassStats(classUnlisted)
+	overQuota := deleter.getClassStats(classOverQuota)
+	deleteSpan.SetAttribute(AttrDeletedFiles, deletedFiles)
+	deleteSpan.SetAttribute(AttrDeletedBytes, deletedBlocks)
+	deleteSpan.SetAttribute(AttrDeletedDirs, deletedDirs)
+	deleteSpan.End(nil)
+
+	// Call OnComplete callback
+	progress := deleter.progress()
+	progress.Complete = true
+	callSafe(config.Callbacks.OnComplete, CompleteInfo{
+		DeletedFiles:         deletedFiles,
+		DeletedSize:          deletedSize,
+		DeletedBlockSize:     deletedBlocks,
+		DeletedDirs:          deletedDirs,
+		DeleteDuration:       deleteDuration,
+		RemovedDirs:          deleter.removedDirs,
+		RemovedDirsTruncated: deleter.removedDirsTruncated,
+		Progress:             progress,
+	})
+
+	// Update the hash manifest of the surviving files
+	var manifest ManifestResult
+	if !interrupted {
+		manifest = updateManifest(dirPath, &config)
+	}
+
+	var directories []DirectoryUsage
+	if config.DirectoryReport {
+		directories = summarizeDirectories(dirPath, plan.scanned, deleter.deletedPaths)
+	}
+
+	// Create report
+	report = CleaningReport{
+		Manifest:               manifest,
+		DeletedFiles:           deletedFiles,
+		DeletedSize:            deletedSize,
+		DeletedBlockSize:       deletedBlocks,
+		DeletedDirs:            deletedDirs,
+		DeletedBrokenFiles:     broken.files,
+		DeletedBrokenSize:      broken.size,
+		ReclaimedTempFiles:     temp.files,
+		ReclaimedTempBytes:     temp.size,
+		DeletedExpendableFiles: expendable.files,
+		DeletedExpendableSize:  expendable.size,
+		DeletedExpiredFiles:    expired.files,
+		DeletedExpiredSize:     expired.size,
+		DeletedByRuleFiles:     byRule.files,
+		DeletedByRuleSize:      byRule.size,
+		DeletedUnlistedFiles:   unlisted.files,
+		DeletedUnlistedSize:    unlisted.size,
+		DeletedOverQuotaFiles:  overQuota.files,
+		DeletedOverQuotaSize:   overQuota.size,
+		Owners:                 ownerReport(plan.owners, deleter.ownerDeleted, plan.ownerQuotas),
+		Directories:            directories,
+		RemovedDirs:            deleter.removedDirs,
+		RemovedDirsTruncated:   deleter.removedDirsTruncated,
+		ScanDuration:           plan.ScanDuration,
+		DeleteDuration:         deleteDuration,
+		TotalDuration:          time.Since(startTime),
+		TimedOut:               interrupted && parent.Err() == nil,
+		PartialScan:            plan.PartialScan,
+		PipelinedFiles:         plan.pipelined,
+		KeptLatestFiles:        plan.KeptLatestFiles,
+		KeptFiles:              plan.KeptFiles,
+		Protections:            plan.Protections,
+		Repositories:           plan.Repositories,
+		PrunedRepositories:     pruned,
+		ScannedFiles:           plan.ScannedFiles,
+		TimeThreshold:          plan.TimeThreshold,
+		Prefixes:               deleter.prefixReport(plan.Prefixes),
+		Volumes:                deleter.volumeReport(plan.Volumes),
+		BlockSize:              plan.BlockSize,
+		FileSystem:             plan.FileSystem,
+		UsageBase:              config.UsageBase,
+		ScanWorkers:            plan.scanWorkers,
+		DeleteWorkers:          deleter.workerStats,
+		Timings:                plan.scanTimings.add(deleter.timings.snapshot()),
+		ConfigFingerprint:      plan.ConfigFingerprint,
+		PolicyName:             plan.PolicyName,
+		PolicyVersion:          plan.PolicyVersion,
+	}
+	report.Discrepancies = discrepancies
+	report.MemoryDegraded = plan.MemoryDegraded
+	report.MemoryProfile = profile
+	report.DroppedErrors = plan.droppedErrors + deleter.droppedErrors
+	report.DeferredDeletes, report.DeferredDeleteSize = deleter.deferredFiles, deleter.deferredSize
+	report.DirectoryLimitedFiles = deleter.dirLimited
+	report.EvictionSeed = plan.EvictionSeed
+	report.SillyRenamedFiles = len(leftovers)
+	for _, leftover := range leftovers {
+		report.SillyRenamedSize += calculateBlockSize(leftover.Size, deleter.blockSize)
+	}
+	report.setTarget(plan.target)
+	if deletedFiles > 0 {
+		invalidateDiskUsage(&config)
+		after, err := getDiskUsage(config.DiskInfo, dirPath)
+		if err != nil {
+			after = nil
+		}
+		reconciliation := report.reconcile(deleter, plan.trace.usage, after)
+		report.Reconciliation = &reconciliation
+	}
+	return report, parent.Err()
+}
+
+// updateManifest writes the hash manifest if ManifestPath is set.
+// Failures are reported via OnError as the files themselves are not affected.
+func updateManifest(dirPath string, config *CleaningConfig) ManifestResult {
+	if config.ManifestPath == "" {
+		return ManifestResult{}
+	}
+	result, err := writeManifest(dirPath, config)
+	if err != nil {
+		callSafe(config.Callbacks.OnError, ErrorInfo{
+			Type:  ErrorTypeManifest,
+			Path:  config.ManifestPath,
+			Error: err,
+		})
+	}
+	return result
+}
 
+// resolveTarget checks the directory and calculates how much space needs to be
+// freed. It returns -1 when disk usage is unavailable and the target is computed
+// from MaxSize after scanning, and 0 when nothing needs to be deleted.
+func resolveTarget(dirPath string, config *CleaningConfig) (int64, *DiskUsage, error) {
 	// Get current disk usage
-	currentUsage, err := config.DiskInfo.GetDiskUsage(dirPath)
+	currentUsage, err := getDiskUsage(config.DiskInfo, dirPath)
 	var diskUsageError error
+	if errors.Is(err, ErrInvalidDiskUsage) {
+		// A target computed from nonsense values would be nonsense too
+		return 0, nil, err
+	}
 	if err != nil {
 		// Save the error for later
 		diskUsageError = err
 		// Check if we can proceed without disk usage
 		if config.MaxSize == nil {
 			// Can't proceed without disk usage when only MaxUsagePercent or MinFreeSpace is specified
-			return CleaningReport{}, err
+			return 0, nil, err
 		}
 	}
 
@@ -45,20 +447,80 @@ func CleanBackup(dirPath string, config CleaningConfig) (CleaningReport, error)
 		// (e.g., restricted permissions, network storage, etc.)
 		targetSize = -1 // Special value to indicate "scan and delete until under MaxSize"
 	} else {
-		targetSize = calculateTargetSize(currentUsage, &config)
+		if !needsCleaning(currentUsage, config) {
+			return 0, currentUsage, nil
+		}
+		targetSize = calculateTargetSize(currentUsage, config)
 		if targetSize <= 0 {
 			// No need to delete anything
-			return CleaningReport{
-				TotalDuration: time.Since(startTime),
-			}, nil
+			return 0, currentUsage, nil
 		}
 	}
+	return targetSize, currentUsage, nil
+}
+
+// checkDir returns ErrDirectoryNotFound if the target directory does not exist
+func checkDir(fs FileSystem, dirPath string) error {
+	if _, err := fs.Stat(dirPath); err != nil {
+		if os.IsNotExist(err) {
+			return ErrDirectoryNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// populateFunc adds the files of the target directory to a scanner instead
+// of scanning it
+type populateFunc func(ctx context.Context, s *scanner) error
+
+// buildPlan scans the directory, or adds the files with populate if it is not
+// nil, and computes the deletion plan. If pipelined is set, files certain to
+// be deleted are deleted during the scan by the deleter stored in the plan.
+// The configuration must already have defaults applied and be validated.
+func buildPlan(ctx context.Context, dirPath string, config *CleaningConfig, populate populateFunc, pipelined bool) (*CleaningPlan, error) {
+	plan := &CleaningPlan{
+		DirPath:           dirPath,
+		CreatedAt:         time.Now(),
+		ConfigFingerprint: config.Fingerprint(),
+		PolicyName:        config.PolicyName,
+		PolicyVersion:     config.PolicyVersion,
+	}
+
+	// Files added by populate may come from a listing of another machine
+	if populate == nil {
+		if err := checkDir(config.fs(), dirPath); err != nil {
+			return nil, err
+		}
+	}
+	targetSize, currentUsage, err := resolveTarget(dirPath, config)
+	if err != nil {
+		return nil, err
+	}
+	plan.trace = &planTrace{config: *config, usage: currentUsage}
+	if targetSize == 0 && !config.hasMaxAge() {
+		// No need to delete anything
+		return plan, nil
+	}
+	quotas, err := config.resolveOwnerQuotas()
+	if err != nil {
+		return nil, err
+	}
+	plan.ownerQuotas = quotas
+	plan.TargetSize = targetSize
+	plan.target = max(targetSize, 0)
 
 	// Get block size
-	blockSize, err := config.DiskInfo.GetBlockSize(dirPath)
+	blockSize, err := config.blockSize(dirPath)
 	if err != nil {
-		return CleaningReport{}, err
+		return nil, err
+	}
+	plan.BlockSize = blockSize
+	if plan.run, err = loadRunState(dirPath, config, config.accountingBlockSize(blockSize)); err != nil {
+		return nil, err
 	}
+	plan.FileSystem = detectFileSystem(config.DiskInfo, dirPath)
+	config.applyNetworkTuning(plan.FileSystem)
 
 	// Call OnStart callback
 	if currentUsage != nil || targetSize == -1 {
@@ -70,97 +532,249 @@ func CleanBackup(dirPath string, config CleaningConfig) (CleaningReport, error)
 			TargetDir:    dirPath,
 			CurrentUsage: usage,
 			TargetSize:   targetSize,
+			FileSystem:   plan.FileSystem,
 		})
 	}
 
-	// Phase 1: Scan files
+	// Scan files
 	scanStartTime := time.Now()
-	scanner := newScanner(&config, blockSize)
-	if err := scanner.scan(dirPath); err != nil {
-		return CleaningReport{}, err
+	_, scanSpan := startSpan(ctx, config, SpanScan)
+	scanner := newScanner(config, plan.run, config.accountingBlockSize(blockSize))
+	scanner.sizes = newBlockSizes(config, dirPath, scanner.blockSize)
+	plan.sizes = scanner.sizes
+	scanner.collect = config.DirectoryReport
+	if populate == nil {
+		scanner.maxMemory = config.MaxMemoryBytes
 	}
-
-	// Get sorted time slots
+	scanCtx := ctx
+	if budget := config.scanBudget(); budget > 0 {
+		var cancel context.CancelFunc
+		scanCtx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+	if pipelined && targetSize != 0 {
+		plan.deleter = newDeleter(config, plan.run, dirPath, config.accountingBlockSize(blockSize))
+		plan.deleter.sizes = plan.sizes
+		scanner.pipeline = newPipeline(ctx, config, plan.deleter, targetSize)
+	}
+	if populate != nil {
+		err = populate(scanCtx, scanner)
+	} else {
+		err = scanner.scan(scanCtx, dirPath)
+	}
+	if scanner.pipeline != nil {
+		if pipelineErr := scanner.pipeline.close(); err == nil {
+			err = pipelineErr
+		}
+		plan.pipelined = scanner.pipeline.files
+	}
+	if err != nil {
+		scanSpan.End(err)
+		return nil, err
+	}
+	scanSpan.SetAttribute(AttrScannedFiles, scanner.getTotalFiles())
+	scanSpan.End(nil)
+	plan.scanned = scanner.all
+	plan.scanWorkers = scanner.workerStats
+	plan.scanTimings = scanner.timings.snapshot()
+	plan.droppedErrors = scanner.droppedErrors
+	plan.owners = scanner.getOwners()
+	if ctx.Err() != nil {
+		// A partial scan must not be used to compute a threshold
+		plan.ScanDuration = time.Since(scanStartTime)
+		plan.ScannedFiles = scanner.getTotalFiles()
+		return plan, nil
+	}
+	// Only the files scanned before the budget ran out are considered
+	plan.PartialScan = scanCtx.Err() != nil
+
+	// Keep the newest files of KeepLatestN overrides out of the deletion too
+	plan.protected = scanner.protectLatest()
+	// Owners above their quota free space ahead of age-based deletion
+	plan.overQuota = scanner.applyOwnerQuotas(quotas)
+	plan.KeptLatestFiles = scanner.keptLatestFiles
+	plan.KeptFiles = scanner.keptFiles
+	plan.Protections = scanner.protectionCounts()
+	plan.Repositories = scanner.getRepositories()
+	plan.MemoryDegraded = scanner.countOnly
+	plan.sillyRenamed = scanner.sillyRenamed
+
+	// Get sorted time slots and the files deleted ahead of age-based deletion
 	timeSlots := scanner.getTimeSlots()
-	if len(timeSlots) == 0 {
+	priorityFiles := scanner.getPriorityFiles()
+	if targetSize == 0 {
+		// Only files older than MaxAge are deleted while the constraints are met
+		priorityFiles = expiredFiles(priorityFiles)
+		plan.expiredOnly = true
+		if len(priorityFiles) == 0 {
+			plan.ScanDuration = time.Since(scanStartTime)
+			plan.ScannedFiles = scanner.getTotalFiles()
+			return plan, nil
+		}
+	}
+	if len(timeSlots) == 0 && len(priorityFiles) == 0 {
 		// No files found
-		return CleaningReport{
-			ScanDuration:  time.Since(scanStartTime),
-			TotalDuration: time.Since(startTime),
-		}, nil
+		plan.ScanDuration = time.Since(scanStartTime)
+		return plan, nil
+	}
+
+	var prioritySize, priorityBlockSize int64
+	for _, fi := range priorityFiles {
+		prioritySize += fi.size
+		priorityBlockSize += fi.blockSize
 	}
+	plan.trace.priorityFiles = len(priorityFiles)
+	plan.trace.priorityBlockSize = priorityBlockSize
+	plan.trace.keptBlockSize = scanner.keptBlockSize
+	plan.trace.slots = newTraceSlots(timeSlots)
 
 	// Calculate deletion threshold
+	_, thresholdSpan := startSpan(ctx, config, SpanThreshold)
+	thresholdSpan.SetAttribute(AttrTargetSize, targetSize)
 	var threshold time.Time
 	var estimatedFiles int
 	var estimatedSize int64
-	
-	if targetSize == -1 && config.MaxSize != nil {
+	var prefixes []*prefixSlots
+	var byVolume []*volumeSlots
+
+	if targetSize == 0 {
+		// Nothing is deleted by age
+	} else if config.FairShare {
+		// Split the size to delete across the prefixes
+		prefixes = groupSlotsByPrefix(dirPath, timeSlots)
+		applyMinRetention(prefixes, config.FairShareKeepLatestN, config.FairShareKeepWithin, scanner.now)
+		remaining := targetSize - priorityBlockSize
+		if targetSize == -1 && config.MaxSize != nil {
+			var total int64
+			for _, p := range prefixes {
+				total += p.totalBlockSize
+			}
+			maxSize := *config.MaxSize - scanner.keptBlockSize
+			if maxSize < 0 {
+				maxSize = 0
+			}
+			remaining = total - maxSize
+			plan.target = max(remaining+priorityBlockSize, 0)
+		}
+		plan.Prefixes, estimatedFiles, estimatedSize = fairShareThresholds(prefixes, remaining)
+	} else if volumes := scanner.getVolumes(dirPath); volumes != nil && currentUsage != nil {
+		// Each volume frees its own target, space freed elsewhere does not help it
+		byVolume = groupByVolume(volumes, timeSlots, priorityFiles)
+		plan.Volumes, estimatedFiles, estimatedSize = volumeThresholds(byVolume, dirPath, targetSize, config)
+		plan.volumes = volumes
+		plan.target = 0
+		for _, vs := range plan.Volumes {
+			plan.target += vs.TargetSize
+			if vs.Path == dirPath {
+				threshold = vs.Threshold
+			}
+		}
+	} else if targetSize == -1 && config.MaxSize != nil {
 		// Special case: delete until total size is under MaxSize
-		threshold, estimatedFiles, estimatedSize = calculateThresholdForMaxSize(timeSlots, *config.MaxSize)
+		// Priority files are not part of the slots, so they are already excluded from the total.
+		// Kept files stay, so the other files must fit into the rest.
+		maxSize := *config.MaxSize - scanner.keptBlockSize
+		if maxSize < 0 {
+			maxSize = 0
+		}
+		threshold, estimatedFiles, estimatedSize = calculateThresholdForMaxSize(timeSlots, maxSize)
+		plan.trace.ageTarget = getTotalBlockSize(timeSlots) - maxSize
+		plan.target = max(plan.trace.ageTarget+priorityBlockSize, 0)
+	} else if remaining := targetSize - priorityBlockSize; remaining > 0 {
+		// Priority files count toward the target
+		threshold, estimatedFiles, estimatedSize = calculateThreshold(timeSlots, remaining)
+		plan.trace.ageTarget = remaining
+	}
+	var unpicked map[string]struct{}
+	if config.Eviction != EvictionOldestFirst && plan.trace.ageTarget > 0 {
+		// Files are picked in the order of the strategy instead of below a
+		// cutoff; the older files that were not picked are kept like
+		// protected ones
+		if config.Eviction == EvictionAgeWeighted {
+			plan.EvictionSeed = config.evictionSeed()
+		}
+		threshold, estimatedFiles, estimatedSize, unpicked = config.selectEvicted(timeSlots, plan.trace.ageTarget, scanner.now, plan.EvictionSeed)
+		if plan.protected == nil {
+			plan.protected = make(map[string]struct{}, len(unpicked))
+		}
+		for path := range unpicked {
+			plan.protected[path] = struct{}{}
+		}
+	}
+	// A zero threshold means no file is deleted by age
+	estimatedFiles += len(priorityFiles)
+	estimatedSize += priorityBlockSize
+
+	plan.ScanDuration = time.Since(scanStartTime)
+	plan.ScannedFiles = scanner.getTotalFiles()
+	plan.TotalSize = getTotalSize(timeSlots) + prioritySize + scanner.keptSize
+	plan.TimeThreshold = threshold
+	plan.EstimatedFiles = estimatedFiles
+	plan.EstimatedSize = estimatedSize
+	if config.FairShare && targetSize != 0 {
+		plan.Candidates = fairShareCandidates(prefixes, priorityFiles, prefixThresholds(plan.Prefixes))
+	} else if byVolume != nil {
+		plan.Candidates = volumeCandidates(byVolume, plan.Volumes)
 	} else {
-		threshold, estimatedFiles, estimatedSize = calculateThreshold(timeSlots, targetSize)
+		plan.Candidates = withoutPaths(collectCandidates(timeSlots, priorityFiles, threshold), unpicked)
 	}
-	scanDuration := time.Since(scanStartTime)
+	if err := checkStrict(plan, config, scanner.keptBlockSize); err != nil {
+		thresholdSpan.End(err)
+		return nil, err
+	}
+	plan.needsDeletion = true
+	thresholdSpan.SetAttribute(AttrScannedBytes, plan.TotalSize)
+	thresholdSpan.SetAttribute(AttrEstimatedFiles, estimatedFiles)
+	thresholdSpan.SetAttribute(AttrEstimatedBytes, estimatedSize)
+	thresholdSpan.End(nil)
 
 	// Call OnScanComplete callback
 	callSafe(config.Callbacks.OnScanComplete, ScanCompleteInfo{
-		ScannedFiles:  scanner.getTotalFiles(),
-		TotalSize:     getTotalSize(timeSlots),
+		ScannedFiles:  plan.ScannedFiles,
+		TotalSize:     plan.TotalSize,
 		BlockSize:     blockSize,
 		TimeThreshold: threshold,
-		ScanDuration:  scanDuration,
+		ScanDuration:  plan.ScanDuration,
 	})
 
-	// Phase 2: Delete files
-	deleteStartTime := time.Now()
-	
-	// Call OnDeleteStart callback
-	callSafe(config.Callbacks.OnDeleteStart, DeleteStartInfo{
-		EstimatedFiles: estimatedFiles,
-		EstimatedSize:  estimatedSize,
-	})
+	return plan, nil
+}
 
-	deleter := newDeleter(&config, blockSize)
-	if err := deleter.deleteFiles(dirPath, threshold); err != nil {
-		return CleaningReport{}, err
+// needsCleaning reports whether usage breaches a capacity constraint, or its
+// start level when StartFreeSpace or StartUsagePercent is set
+func needsCleaning(usage *DiskUsage, config *CleaningConfig) bool {
+	if config.MaxSize != nil && int64(usage.Used) > *config.MaxSize {
+		return true
 	}
-
-	// Phase 3: Delete empty directories
-	deletedDirs, _ := deleter.deleteEmptyDirs()
-	// Ignore error as it's non-fatal for directory deletion
-
-	deleteDuration := time.Since(deleteStartTime)
-	deletedFiles, deletedSize, deletedBlocks := deleter.getStats()
-
-	// Call OnComplete callback
-	callSafe(config.Callbacks.OnComplete, CompleteInfo{
-		DeletedFiles:     deletedFiles,
-		DeletedSize:      deletedSize,
-		DeletedBlockSize: deletedBlocks,
-		DeletedDirs:      deletedDirs,
-		DeleteDuration:   deleteDuration,
-	})
-
-	// Create report
-	return CleaningReport{
-		DeletedFiles:     deletedFiles,
-		DeletedSize:      deletedSize,
-		DeletedBlockSize: deletedBlocks,
-		DeletedDirs:      deletedDirs,
-		ScanDuration:     scanDuration,
-		DeleteDuration:   deleteDuration,
-		TotalDuration:    time.Since(startTime),
-		ScannedFiles:     scanner.getTotalFiles(),
-		TimeThreshold:    threshold,
-		BlockSize:        blockSize,
-	}, nil
+	maxPercent, minFree := config.MaxUsagePercent, config.MinFreeSpace
+	if config.StartUsagePercent != nil {
+		maxPercent = config.StartUsagePercent
+	}
+	if config.StartFreeSpace != nil {
+		minFree = config.StartFreeSpace
+	}
+	if maxPercent != nil && config.usedPercent(usage) > *maxPercent {
+		return true
+	}
+	if minFree != nil && int64(config.freeSpace(usage)) < *minFree {
+		return true
+	}
+	return false
 }
 
-// calculateTargetSize calculates how much space needs to be freed
+// calculateTargetSize calculates how much space needs to be freed, down to
+// the TargetFreeSpaceAfterClean and TargetUsagePercentAfterClean levels when set
 func calculateTargetSize(usage *DiskUsage, config *CleaningConfig) int64 {
 	var targetSize int64
 
+	maxPercent, minFree := config.MaxUsagePercent, config.MinFreeSpace
+	if config.TargetUsagePercentAfterClean != nil {
+		maxPercent = config.TargetUsagePercentAfterClean
+	}
+	if config.TargetFreeSpaceAfterClean != nil {
+		minFree = config.TargetFreeSpaceAfterClean
+	}
+
 	// Check MaxSize
 	if config.MaxSize != nil {
 		currentSize := int64(usage.Used)
@@ -173,11 +787,12 @@ func calculateTargetSize(usage *DiskUsage, config *CleaningConfig) int64 {
 	}
 
 	// Check MaxUsagePercent
-	if config.MaxUsagePercent != nil {
-		if usage.UsedPercent > *config.MaxUsagePercent {
-			targetUsage := uint64(float64(usage.Total) * (*config.MaxUsagePercent / 100))
-			if usage.Used > targetUsage {
-				size := int64(usage.Used - targetUsage)
+	if maxPercent != nil {
+		used, total := config.percentBase(usage)
+		if config.usedPercent(usage) > *maxPercent {
+			targetUsage := uint64(float64(total) * (*maxPercent / 100))
+			if used > targetUsage {
+				size := int64(used - targetUsage)
 				if size > targetSize {
 					targetSize = size
 				}
@@ -186,10 +801,10 @@ func calculateTargetSize(usage *DiskUsage, config *CleaningConfig) int64 {
 	}
 
 	// Check MinFreeSpace
-	if config.MinFreeSpace != nil {
-		currentFree := int64(usage.Free)
-		if currentFree < *config.MinFreeSpace {
-			size := *config.MinFreeSpace - currentFree
+	if minFree != nil {
+		currentFree := int64(config.freeSpace(usage))
+		if currentFree < *minFree {
+			size := *minFree - currentFree
 			if size > targetSize {
 				targetSize = size
 			}
@@ -216,8 +831,8 @@ func calculateThreshold(slots []*timeSlot, targetSize int64) (time.Time, int, in
 
 	for _, slot := range slots {
 		accumulatedSize += slot.totalBlockSize
-		accumulatedFiles += len(slot.files)
-		
+		accumulatedFiles += slot.count()
+
 		if accumulatedSize >= targetSize {
 			// We've reached the target size
 			// Include all files up to and including this slot
@@ -229,6 +844,15 @@ func calculateThreshold(slots []*timeSlot, targetSize int64) (time.Time, int, in
 	return threshold, accumulatedFiles, accumulatedSize
 }
 
+// getTotalBlockSize calculates the total block-aligned size from time slots
+func getTotalBlockSize(slots []*timeSlot) int64 {
+	var total int64
+	for _, slot := range slots {
+		total += slot.totalBlockSize
+	}
+	return total
+}
+
 // getTotalSize calculates the total size from time slots
 func getTotalSize(slots []*timeSlot) int64 {
 	var total int64
@@ -244,7 +868,7 @@ func calculateThresholdForMaxSize(slots []*timeSlot, maxSize int64) (time.Time,
 	var remainingSize int64
 	var deleteFiles int
 	var deleteSize int64
-	
+
 	// Calculate total size
 	for _, slot := range slots {
 		totalSize += slot.totalBlockSize
@@ -258,27 +882,32 @@ func calculateThresholdForMaxSize(slots []*timeSlot, maxSize int64) (time.Time,
 	// Start from the newest files and work backwards
 	// We want to keep as much as possible under maxSize
 	remainingSize = totalSize
-	
+
 	// Find the cutoff point - delete old files until we're under maxSize
 	for i := 0; i < len(slots); i++ {
 		slot := slots[i]
-		
+
 		// Delete this entire slot
 		remainingSize -= slot.totalBlockSize
-		deleteFiles += len(slot.files)
+		deleteFiles += slot.count()
 		deleteSize += slot.totalBlockSize
-		
+
 		// Check if we've deleted enough
 		if remainingSize <= maxSize {
 			// We've reached our target - set threshold to include this slot
-			// Add an hour to ensure all files in this time window are included
-			return slot.time.Add(time.Hour), deleteFiles, deleteSize
+			// Add an hour to ensure all files in this time window are included,
+			// but not the files of the next slot
+			threshold := slot.time.Add(time.Hour)
+			if i+1 < len(slots) && slots[i+1].time.Before(threshold) {
+				threshold = slots[i+1].time
+			}
+			return threshold, deleteFiles, deleteSize
 		}
 	}
-	
+
 	// If we get here, we need to delete everything (shouldn't happen normally)
 	if len(slots) > 0 {
 		return time.Now().Add(time.Hour), deleteFiles, deleteSize
 	}
 	return time.Time{}, 0, 0
-}
\ No newline at end of file
+}
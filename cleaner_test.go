@@ -1,6 +1,7 @@
 package gobackupcleaner
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -161,6 +162,34 @@ func TestCalculateTargetSize(t *testing.T) {
 			},
 			expectedTarget: 3 * 1024 * 1024 * 1024, // MaxUsagePercent is most restrictive
 		},
+		{
+			name: "TargetFreeSpaceAfterClean",
+			usage: &DiskUsage{
+				Total:       10 * 1024 * 1024 * 1024, // 10GB
+				Used:        8 * 1024 * 1024 * 1024,  // 8GB
+				Free:        2 * 1024 * 1024 * 1024,  // 2GB
+				UsedPercent: 80.0,
+			},
+			config: &CleaningConfig{
+				MinFreeSpace:              int64Ptr(3 * 1024 * 1024 * 1024), // Need 3GB free
+				TargetFreeSpaceAfterClean: int64Ptr(5 * 1024 * 1024 * 1024), // Clean down to 5GB free
+			},
+			expectedTarget: 3 * 1024 * 1024 * 1024, // Need to free 3GB
+		},
+		{
+			name: "TargetUsagePercentAfterClean",
+			usage: &DiskUsage{
+				Total:       10 * 1024 * 1024 * 1024, // 10GB
+				Used:        8 * 1024 * 1024 * 1024,  // 8GB
+				Free:        2 * 1024 * 1024 * 1024,  // 2GB
+				UsedPercent: 80.0,
+			},
+			config: &CleaningConfig{
+				MaxUsagePercent:              float64Ptr(70.0), // 70% max
+				TargetUsagePercentAfterClean: float64Ptr(50.0), // Clean down to 50%
+			},
+			expectedTarget: 3 * 1024 * 1024 * 1024, // Need to free 3GB to reach 50%
+		},
 		{
 			name: "Already meeting constraints",
 			usage: &DiskUsage{
@@ -251,6 +280,195 @@ func TestConfigValidation(t *testing.T) {
 			},
 			shouldError: true,
 		},
+		{
+			name: "Negative MaxDepth",
+			config: CleaningConfig{
+				MaxSize:  int64Ptr(1024),
+				MaxDepth: -1,
+			},
+			shouldError: true,
+		},
+		{
+			name: "ExpendableDirs outside the target directory",
+			config: CleaningConfig{
+				MaxSize:        int64Ptr(1024),
+				ExpendableDirs: []string{"../tmp"},
+			},
+			shouldError: true,
+		},
+		{
+			name: "Override with negative KeepLatestN",
+			config: CleaningConfig{
+				MaxSize:   int64Ptr(1024),
+				Overrides: []RetentionOverride{{Path: "db/", KeepLatestN: -1}},
+			},
+			shouldError: true,
+		},
+		{
+			name: "Rule with invalid regexp",
+			config: CleaningConfig{
+				MaxSize: int64Ptr(1024),
+				Rules:   []Rule{{Match: RuleMatch{Regexp: "("}, Action: RuleKeep}},
+			},
+			shouldError: true,
+		},
+		{
+			name: "Negative MaxDuration",
+			config: CleaningConfig{
+				MaxSize:     int64Ptr(1024),
+				MaxDuration: -time.Minute,
+			},
+			shouldError: true,
+		},
+		{
+			name: "Negative FairShareKeepLatestN",
+			config: CleaningConfig{
+				MaxSize:              int64Ptr(1024),
+				FairShareKeepLatestN: -1,
+			},
+			shouldError: true,
+		},
+		{
+			name: "Zero BlockSizeOverride",
+			config: CleaningConfig{
+				MaxSize:           int64Ptr(1024),
+				BlockSizeOverride: int64Ptr(0),
+			},
+			shouldError: true,
+		},
+		{
+			name: "Negative MaxBytesPerSecond",
+			config: CleaningConfig{
+				MaxSize:           int64Ptr(1024),
+				MaxBytesPerSecond: -1,
+			},
+			shouldError: true,
+		},
+		{
+			name: "StartFreeSpace above MinFreeSpace",
+			config: CleaningConfig{
+				MinFreeSpace:   int64Ptr(1024),
+				StartFreeSpace: int64Ptr(2048),
+			},
+			shouldError: true,
+		},
+		{
+			name: "StartFreeSpace without MinFreeSpace",
+			config: CleaningConfig{
+				MaxSize:        int64Ptr(1024),
+				StartFreeSpace: int64Ptr(512),
+			},
+			shouldError: true,
+		},
+		{
+			name: "StartUsagePercent below MaxUsagePercent",
+			config: CleaningConfig{
+				MaxUsagePercent:   float64Ptr(80),
+				StartUsagePercent: float64Ptr(70),
+			},
+			shouldError: true,
+		},
+		{
+			name: "TargetFreeSpaceAfterClean below MinFreeSpace",
+			config: CleaningConfig{
+				MinFreeSpace:              int64Ptr(2048),
+				TargetFreeSpaceAfterClean: int64Ptr(1024),
+			},
+			shouldError: true,
+		},
+		{
+			name: "TargetUsagePercentAfterClean above MaxUsagePercent",
+			config: CleaningConfig{
+				MaxUsagePercent:              float64Ptr(70),
+				TargetUsagePercentAfterClean: float64Ptr(80),
+			},
+			shouldError: true,
+		},
+		{
+			name: "PerVolumeTargets with FairShare",
+			config: CleaningConfig{
+				MinFreeSpace:     int64Ptr(1000),
+				PerVolumeTargets: true,
+				FairShare:        true,
+			},
+			shouldError: true,
+		},
+		{
+			name: "Empty blackout window",
+			config: CleaningConfig{
+				MinFreeSpace:    int64Ptr(1000),
+				BlackoutWindows: []BlackoutWindow{{Start: time.Hour, End: time.Hour}},
+			},
+			shouldError: true,
+		},
+		{
+			name: "Blackout window beyond a day",
+			config: CleaningConfig{
+				MinFreeSpace:    int64Ptr(1000),
+				BlackoutWindows: []BlackoutWindow{{Start: time.Hour, End: 25 * time.Hour}},
+			},
+			shouldError: true,
+		},
+		{
+			name: "MaxMemoryBytes with KeepLatestN",
+			config: CleaningConfig{
+				MaxSize:        int64Ptr(1024),
+				MaxMemoryBytes: 1 << 20,
+				Overrides:      []RetentionOverride{{Path: "db", KeepLatestN: 3}},
+			},
+			shouldError: true,
+		},
+		{
+			name: "MaxMemoryBytes with FairShare",
+			config: CleaningConfig{
+				MaxSize:        int64Ptr(1024),
+				MaxMemoryBytes: 1 << 20,
+				FairShare:      true,
+			},
+			shouldError: true,
+		},
+		{
+			name: "Negative WatchdogTimeout",
+			config: CleaningConfig{
+				MaxSize:         int64Ptr(1024),
+				WatchdogTimeout: -time.Second,
+			},
+			shouldError: true,
+		},
+		{
+			name: "EvictionAgeWeighted with FairShare",
+			config: CleaningConfig{
+				MaxSize:   int64Ptr(1024),
+				Eviction:  EvictionAgeWeighted,
+				FairShare: true,
+			},
+			shouldError: true,
+		},
+		{
+			name: "EvictionRestoreTestedFirst without source",
+			config: CleaningConfig{
+				MaxSize:  int64Ptr(1024),
+				Eviction: EvictionRestoreTestedFirst,
+			},
+			shouldError: true,
+		},
+		{
+			name: "Malformed OpaqueDirPatterns",
+			config: CleaningConfig{
+				MaxSize:           int64Ptr(1024),
+				OpaqueDirPatterns: []string{"[chunks"},
+			},
+			shouldError: true,
+		},
+		{
+			name: "ScanBudgetRatio over 1",
+			config: CleaningConfig{
+				MaxSize:         int64Ptr(1024),
+				MaxDuration:     time.Minute,
+				ScanBudgetRatio: 1.5,
+			},
+			shouldError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -369,7 +587,7 @@ func TestCallbacks(t *testing.T) {
 
 // Helper functions
 
-func createTestFile(t *testing.T, path string, size int64, modTime time.Time) error {
+func createTestFile(t testing.TB, path string, size int64, modTime time.Time) error {
 	file, err := os.Create(path)
 	if err != nil {
 		return err
@@ -541,3 +759,604 @@ func TestCleanBackupWithoutDiskUsageAndNoMaxSize(t *testing.T) {
 		t.Error("Expected error when disk usage is not available and no MaxSize is specified")
 	}
 }
+
+// TestCleanBackupWithMaxDepth tests that directories at MaxDepth are deleted as whole units
+func TestCleanBackupWithMaxDepth(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-depth-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	// Create two backup sets, each with nested content
+	now := time.Now()
+	oldSet := filepath.Join(tmpDir, "set-old", "nested")
+	newSet := filepath.Join(tmpDir, "set-new", "nested")
+	for _, dir := range []string{oldSet, newSet} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createTestFile(t, filepath.Join(oldSet, "a.dat"), 1024*1024, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(oldSet, "b.dat"), 1024*1024, now.Add(-70*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(newSet, "c.dat"), 1024*1024, now.Add(-1*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var dirUnits int
+	maxSize := int64(1536 * 1024)
+	config := CleaningConfig{
+		MaxSize:         &maxSize,
+		MaxDepth:        1,
+		TimeWindow:      time.Hour,
+		RemoveEmptyDirs: true,
+		DiskInfo:        &failingDiskInfoProvider{},
+		Callbacks: Callbacks{
+			OnFileDeleted: func(info FileDeletedInfo) {
+				if info.IsDir {
+					dirUnits++
+				}
+			},
+		},
+	}
+
+	report, err := CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.ScannedFiles != 2 {
+		t.Errorf("Expected 2 scanned units, got %d", report.ScannedFiles)
+	}
+	if report.DeletedFiles != 2 {
+		t.Errorf("Expected 2 deleted files, got %d", report.DeletedFiles)
+	}
+	if dirUnits != 1 {
+		t.Errorf("Expected 1 directory unit deleted, got %d", dirUnits)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "set-old")); !os.IsNotExist(err) {
+		t.Error("Expected old backup set to be removed as a whole")
+	}
+	if _, err := os.Stat(filepath.Join(newSet, "c.dat")); err != nil {
+		t.Errorf("Expected new backup set to remain: %v", err)
+	}
+}
+
+// TestReportWorkerStats tests the per-worker statistics and timing breakdown in the report
+func TestReportWorkerStats(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-workers-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("file%d.txt", i))
+		if err := createTestFile(t, path, 1024*1024, now.Add(-time.Duration(i+1)*24*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	maxUsage := float64(70)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxUsagePercent: &maxUsage,
+		Concurrency:     2,
+		DiskInfo:        &mockDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.ScanWorkers) != 2 || len(report.DeleteWorkers) != 2 {
+		t.Fatalf("Expected 2 scan and 2 delete workers, got %d and %d",
+			len(report.ScanWorkers), len(report.DeleteWorkers))
+	}
+	scanTasks := 0
+	for _, w := range report.ScanWorkers {
+		scanTasks += w.Tasks
+	}
+	if scanTasks == 0 {
+		t.Error("Expected scan workers to process tasks")
+	}
+	// Files are stat'ed once while scanning and once while deleting
+	if report.Timings.StatCalls < 2*5 {
+		t.Errorf("Expected at least 10 stat calls, got %d", report.Timings.StatCalls)
+	}
+	if report.Timings.ReadDirCalls < 2 {
+		t.Errorf("Expected at least 2 readdir calls, got %d", report.Timings.ReadDirCalls)
+	}
+	if report.Timings.UnlinkCalls < report.DeletedFiles {
+		t.Errorf("Expected at least %d unlink calls, got %d", report.DeletedFiles, report.Timings.UnlinkCalls)
+	}
+}
+
+// TestReportRemovedDirs tests the bounded collection of removed directory paths
+func TestReportRemovedDirs(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-removed-dirs-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(tmpDir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(t, filepath.Join(dir, "old.txt"), 1024*1024, now.Add(-72*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "recent.txt"), 1024*1024, now); err != nil {
+		t.Fatal(err)
+	}
+
+	maxSize := int64(1024 * 1024)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:            &maxSize,
+		TimeWindow:         time.Hour,
+		RemoveEmptyDirs:    true,
+		MaxRemovedDirPaths: 1,
+		DiskInfo:           &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.DeletedDirs != 2 {
+		t.Fatalf("Expected 2 deleted directories, got %d", report.DeletedDirs)
+	}
+	if len(report.RemovedDirs) != 1 {
+		t.Errorf("Expected 1 collected directory path, got %v", report.RemovedDirs)
+	}
+	if !report.RemovedDirsTruncated {
+		t.Error("Expected the removed directory list to be marked as truncated")
+	}
+}
+
+// TestReportTargetAndShortfall tests that reports tell whether the target was met
+func TestReportTargetAndShortfall(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now()
+	for i, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, 24 * time.Hour} {
+		if err := createTestFile(t, filepath.Join(tmpDir, fmt.Sprintf("backup%d.tar", i)), 1024*1024, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Resolved from the scan when only MaxSize applies
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:    int64Ptr(1024 * 1024),
+		TimeWindow: time.Hour,
+		DiskInfo:   &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TargetSize != 2*1024*1024 || report.FreedSize != report.DeletedBlockSize || report.ShortfallSize != 0 {
+		t.Errorf("Expected the 2MB target to be met, got target %d, freed %d, shortfall %d", report.TargetSize, report.FreedSize, report.ShortfallSize)
+	}
+
+	// The remaining file cannot free the requested space
+	report, err = CleanBackup(tmpDir, CleaningConfig{
+		MinFreeSpace: int64Ptr(2 << 30),
+		TimeWindow:   time.Hour,
+		DiskInfo: &StaticDiskInfoProvider{Usage: &DiskUsage{
+			Total:       100 << 30,
+			Used:        99 << 30,
+			Free:        1 << 30,
+			UsedPercent: 99,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TargetSize != 1<<30 || report.ShortfallSize <= 0 || report.ShortfallSize != report.TargetSize-report.FreedSize {
+		t.Errorf("Expected a shortfall, got target %d, freed %d, shortfall %d", report.TargetSize, report.FreedSize, report.ShortfallSize)
+	}
+}
+
+// TestPreserveParentMTimes tests that parent directory mtimes are restored after deletion
+func TestPreserveParentMTimes(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-mtimes-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	hostDir := filepath.Join(tmpDir, "host")
+	if err := os.Mkdir(hostDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(hostDir, "old.txt"), 1024*1024, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(hostDir, "recent.txt"), 1024*1024, now); err != nil {
+		t.Fatal(err)
+	}
+	dirTime := now.Add(-24 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(hostDir, dirTime, dirTime); err != nil {
+		t.Fatal(err)
+	}
+
+	maxSize := int64(1024 * 1024)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:              &maxSize,
+		TimeWindow:           time.Hour,
+		PreserveParentMTimes: true,
+		DiskInfo:             &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 {
+		t.Fatalf("Expected 1 deleted file, got %d", report.DeletedFiles)
+	}
+
+	info, err := os.Stat(hostDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(dirTime) {
+		t.Errorf("Expected directory mtime %v to be preserved, got %v", dirTime, info.ModTime())
+	}
+}
+
+// TestMaxDurationTimesOut tests that a run stops gracefully once MaxDuration is reached
+func TestMaxDurationTimesOut(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-duration-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.txt"), 1024*1024, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "recent.txt"), 1024*1024, now); err != nil {
+		t.Fatal(err)
+	}
+
+	maxSize := int64(1024 * 1024)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:     &maxSize,
+		TimeWindow:  time.Hour,
+		MaxDuration: time.Nanosecond,
+		DiskInfo:    &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.TimedOut {
+		t.Error("Expected the report to be marked as timed out")
+	}
+	// A partial scan deletes nothing
+	if report.DeletedFiles != 0 {
+		t.Errorf("Expected no deleted files, got %d", report.DeletedFiles)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "old.txt")); err != nil {
+		t.Errorf("Expected old.txt to remain: %v", err)
+	}
+
+	// Without a budget the run completes
+	report, err = CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:    &maxSize,
+		TimeWindow: time.Hour,
+		DiskInfo:   &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TimedOut || report.DeletedFiles != 1 {
+		t.Errorf("Expected a complete run deleting 1 file, got timed out %v and %d deleted", report.TimedOut, report.DeletedFiles)
+	}
+}
+
+// TestDeleteCandidates tests list-based deletion used after a partial scan
+func TestDeleteCandidates(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-candidates-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	oldTime := now.Add(-72 * time.Hour)
+	for _, name := range []string{"listed.txt", "modified.txt", "unlisted.txt"} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 1024, oldTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := CleaningConfig{MaxSize: int64Ptr(0)}
+	config.setDefaults()
+	deleter := newDeleter(&config, nil, tmpDir, 4096)
+	candidates := []PlanFile{
+		{Path: filepath.Join(tmpDir, "listed.txt"), Size: 1024, ModTime: oldTime},
+		// Modified since it was listed
+		{Path: filepath.Join(tmpDir, "modified.txt"), Size: 1024, ModTime: oldTime.Add(-time.Hour)},
+		{Path: filepath.Join(tmpDir, "missing.txt"), Size: 1024, ModTime: oldTime},
+	}
+	if err := deleter.deleteCandidates(context.Background(), candidates, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _, _ := deleter.getStats(); files != 1 {
+		t.Errorf("Expected 1 deleted file, got %d", files)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "listed.txt")); !os.IsNotExist(err) {
+		t.Error("Expected listed.txt to be deleted")
+	}
+	for _, name := range []string{"modified.txt", "unlisted.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to remain: %v", name, err)
+		}
+	}
+}
+
+// TestCleanerConcurrentReuse tests that a Cleaner can clean several directories concurrently
+func TestCleanerConcurrentReuse(t *testing.T) {
+	if _, err := NewCleaner(CleaningConfig{}); err != ErrNoCapacitySpecified {
+		t.Errorf("Expected ErrNoCapacitySpecified, got %v", err)
+	}
+
+	maxSize := int64(1024 * 1024)
+	stats := &Stats{}
+	cleaner, err := NewCleaner(CleaningConfig{
+		MaxSize:    &maxSize,
+		TimeWindow: time.Hour,
+		Stats:      stats,
+		DiskInfo:   &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	dirs := make([]string, 4)
+	for i := range dirs {
+		dir, err := os.MkdirTemp("", "backup-cleaner-reuse-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := os.RemoveAll(dir); err != nil {
+				t.Logf("cleanup failed: %v", err)
+			}
+		}()
+		if err := createTestFile(t, filepath.Join(dir, "old.txt"), 1024*1024, now.Add(-72*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(t, filepath.Join(dir, "recent.txt"), 1024*1024, now); err != nil {
+			t.Fatal(err)
+		}
+		dirs[i] = dir
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(dirs))
+	reports := make([]CleaningReport, len(dirs))
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			reports[i], errs[i] = cleaner.Clean(context.Background(), dir)
+		}(i, dir)
+	}
+	wg.Wait()
+
+	for i := range dirs {
+		if errs[i] != nil {
+			t.Errorf("Clean(%s) failed: %v", dirs[i], errs[i])
+			continue
+		}
+		if reports[i].DeletedFiles != 1 {
+			t.Errorf("Expected 1 deleted file in %s, got %d", dirs[i], reports[i].DeletedFiles)
+		}
+	}
+	if deleted := stats.Snapshot().FilesDeleted; deleted != int64(len(dirs)) {
+		t.Errorf("Expected %d deleted files in shared stats, got %d", len(dirs), deleted)
+	}
+}
+
+// TestCleanerCanceled tests that canceling the context stops the run with an error
+func TestCleanerCanceled(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-cancel-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.txt"), 1024*1024, time.Now().Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	maxSize := int64(0)
+	cleaner, err := NewCleaner(CleaningConfig{
+		MaxSize:  &maxSize,
+		DiskInfo: &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := cleaner.Clean(ctx, tmpDir)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if report.TimedOut || report.DeletedFiles != 0 {
+		t.Errorf("Expected an interrupted run without deletions, got %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "old.txt")); err != nil {
+		t.Errorf("Expected old.txt to remain: %v", err)
+	}
+}
+
+// slowRemoveFS delays every deletion
+type slowRemoveFS struct {
+	OSFileSystem
+	latency time.Duration
+}
+
+func (f slowRemoveFS) Remove(path string) error {
+	time.Sleep(f.latency)
+	return os.Remove(path)
+}
+
+func TestCleanBackupContextDeadline(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("backup%d.tar", i))
+		if err := createTestFile(t, path, 4096, now.Add(-time.Duration(5-i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Deleting every file takes longer than the deadline allows
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	report, err := CleanBackupContext(ctx, tmpDir, CleaningConfig{
+		MaxSize:        int64Ptr(0),
+		TimeWindow:     time.Hour,
+		MaxConcurrency: 1,
+		DiskInfo:       &failingDiskInfoProvider{},
+		FS:             slowRemoveFS{latency: 50 * time.Millisecond},
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if report.TimedOut || report.DeletedFiles >= 5 {
+		t.Errorf("Expected a partial report, got %+v", report)
+	}
+	if remaining := countFiles(t, tmpDir); remaining != 5-report.DeletedFiles {
+		t.Errorf("Expected the report to count the %d deleted files, got %d", 5-remaining, report.DeletedFiles)
+	}
+}
+
+// fuzzSlots builds time slots from pairs of bytes: the minutes after the
+// previous slot (plus one, so slots stay sorted) and the size in blocks
+func fuzzSlots(data []byte) []*timeSlot {
+	var slots []*timeSlot
+	t := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i+1 < len(data); i += 2 {
+		t = t.Add((time.Duration(data[i]) + 1) * time.Minute)
+		size := int64(data[i+1]) * 4096
+		slots = append(slots, &timeSlot{time: t, totalSize: size, totalBlockSize: size, dropped: 1})
+	}
+	return slots
+}
+
+// includedSlots returns the number of slots below threshold, and their files and size
+func includedSlots(slots []*timeSlot, threshold time.Time) (n, files int, size int64) {
+	for _, slot := range slots {
+		if slot.time.Before(threshold) {
+			n++
+			files += slot.count()
+			size += slot.totalBlockSize
+		}
+	}
+	return n, files, size
+}
+
+func FuzzCalculateThreshold(f *testing.F) {
+	f.Add([]byte{1, 10, 2, 20, 5, 30}, int64(25*4096))
+	f.Add([]byte{0, 0, 0, 1}, int64(4096))
+	f.Add([]byte{}, int64(1))
+	f.Fuzz(func(t *testing.T, data []byte, target int64) {
+		if target <= 0 {
+			t.Skip("callers only compute a threshold for a positive target")
+		}
+		slots := fuzzSlots(data)
+		threshold, files, size := calculateThreshold(slots, target)
+		if len(slots) == 0 {
+			if !threshold.IsZero() || files != 0 || size != 0 {
+				t.Fatalf("Expected nothing to delete without slots, got %v %d %d", threshold, files, size)
+			}
+			return
+		}
+		n, wantFiles, wantSize := includedSlots(slots, threshold)
+		if files != wantFiles || size != wantSize {
+			t.Fatalf("Estimate %d files, %d bytes does not match the %d slots below the threshold", files, size, n)
+		}
+		if n < len(slots) && size < target {
+			t.Fatalf("Kept slots although %d bytes are short of %d", size, target)
+		}
+		if n > 1 && size-slots[n-1].totalBlockSize >= target {
+			t.Fatalf("Deleted more than one slot beyond the target: %d bytes for %d", size, target)
+		}
+		if newest := slots[len(slots)-1].time; threshold.After(newest.Add(time.Second)) {
+			t.Fatalf("Threshold %v after the newest slot %v", threshold, newest)
+		}
+	})
+}
+
+func FuzzCalculateThresholdForMaxSize(f *testing.F) {
+	f.Add([]byte{1, 10, 2, 20, 5, 30}, int64(25*4096))
+	f.Add([]byte{0, 1, 0, 1, 0, 1}, int64(0))
+	f.Add([]byte{100, 255}, int64(1<<40))
+	f.Fuzz(func(t *testing.T, data []byte, maxSize int64) {
+		if maxSize < 0 {
+			t.Skip("callers clamp maxSize to 0")
+		}
+		slots := fuzzSlots(data)
+		threshold, files, size := calculateThresholdForMaxSize(slots, maxSize)
+		total := getTotalBlockSize(slots)
+		if total <= maxSize {
+			if !threshold.IsZero() || files != 0 || size != 0 {
+				t.Fatalf("Expected nothing to delete within maxSize, got %v %d %d", threshold, files, size)
+			}
+			return
+		}
+		n, wantFiles, wantSize := includedSlots(slots, threshold)
+		if files != wantFiles || size != wantSize {
+			t.Fatalf("Estimate %d files, %d bytes does not match the %d slots below the threshold", files, size, n)
+		}
+		if total-size > maxSize {
+			t.Fatalf("%d bytes remain above maxSize %d", total-size, maxSize)
+		}
+		if n > 1 && total-(size-slots[n-1].totalBlockSize) <= maxSize {
+			t.Fatalf("Deleted more than one slot beyond maxSize: %d of %d bytes for %d", size, total, maxSize)
+		}
+		if newest := slots[len(slots)-1].time; threshold.After(newest.Add(time.Hour)) {
+			t.Fatalf("Threshold %v more than an hour after the newest slot %v", threshold, newest)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+// Package cleanertest provides test doubles that simulate slow and failing
+// storage, to test timeouts, retries and concurrency tuning of the cleaner
+// without a real slow mount:
+//
+//	fs := &cleanertest.SlowFS{Faults: map[cleanertest.Op]cleanertest.Fault{
+//		cleanertest.OpLstat:  {Latency: 2 * time.Millisecond},
+//		cleanertest.OpRemove: {ErrorRate: 0.1},
+//	}}
+//	report, err := gobackupcleaner.CleanBackup(dir, gobackupcleaner.CleaningConfig{FS: fs, ...})
+package cleanertest
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrInjected is the default error of failing calls
+var ErrInjected = errors.New("injected failure")
+
+// Op identifies an operation of SlowFS or SlowDiskInfo
+type Op string
+
+// Operations of SlowFS
+const (
+	OpLstat     Op = "lstat"
+	OpStat      Op = "stat"
+	OpReadDir   Op = "readdir"
+	OpOpen      Op = "open"
+	OpRemove    Op = "remove"
+	OpRemoveAll Op = "removeall"
+	OpRename    Op = "rename"
+	OpChtimes   Op = "chtimes"
+)
+
+// Operations of SlowDiskInfo
+const (
+	OpDiskUsage      Op = "diskusage"
+	OpBlockSize      Op = "blocksize"
+	OpFileSystemInfo Op = "filesysteminfo"
+)
+
+// Fault is the latency and failure rate injected into an operation
+type Fault struct {
+	Latency   time.Duration // Added to every call
+	Jitter    time.Duration // Random extra latency, up to this
+	ErrorRate float64       // Fraction of the calls that fail, from 0 to 1
+	Err       error         // Error of failing calls (default: ErrInjected)
+}
+
+// injector applies the faults of the operations and counts the calls
+type injector struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	calls    map[Op]int
+	failures map[Op]int
+}
+
+// inject delays a call of op by its fault and returns the error it fails
+// with, or nil. The failing calls and the jitter are drawn from seed.
+func (in *injector) inject(faults map[Op]Fault, seed int64, op Op) error {
+	fault := faults[op]
+	in.mu.Lock()
+	if in.rng == nil {
+		in.rng = rand.New(rand.NewSource(seed))
+		in.calls = make(map[Op]int)
+		in.failures = make(map[Op]int)
+	}
+	in.calls[op]++
+	delay := fault.Latency
+	if fault.Jitter > 0 {
+		delay += time.Duration(in.rng.Int63n(int64(fault.Jitter)))
+	}
+	fail := fault.ErrorRate > 0 && in.rng.Float64() < fault.ErrorRate
+	if fail {
+		in.failures[op]++
+	}
+	in.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if !fail {
+		return nil
+	}
+	if fault.Err != nil {
+		return fault.Err
+	}
+	return ErrInjected
+}
+
+// count returns the calls and the failures of op so far
+func (in *injector) count(op Op) (calls, failures int) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.calls[op], in.failures[op]
+}
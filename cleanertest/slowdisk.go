@@ -0,0 +1,67 @@
+package cleanertest
+
+import (
+	"errors"
+
+	cleaner "github.com/ideamans/go-backup-cleaner"
+)
+
+// SlowDiskInfo wraps a DiskInfoProvider, delaying and failing its calls
+// according to Faults, e.g. to simulate statfs on a hung network mount. Set
+// the fields before the first use.
+type SlowDiskInfo struct {
+	Provider cleaner.DiskInfoProvider // Wrapped provider (default: cleaner.DefaultDiskInfoProvider)
+	Faults   map[Op]Fault             // Faults per operation, operations without one pass through
+	Seed     int64                    // Seed of the failures and the jitter, for reproducible runs
+
+	injector injector
+}
+
+// GetDiskUsage returns the disk usage of the volume of path
+func (d *SlowDiskInfo) GetDiskUsage(path string) (*cleaner.DiskUsage, error) {
+	if err := d.injector.inject(d.Faults, d.Seed, OpDiskUsage); err != nil {
+		return nil, err
+	}
+	return d.provider().GetDiskUsage(path)
+}
+
+// GetBlockSize returns the block size of the file system of path
+func (d *SlowDiskInfo) GetBlockSize(path string) (int64, error) {
+	if err := d.injector.inject(d.Faults, d.Seed, OpBlockSize); err != nil {
+		return 0, err
+	}
+	return d.provider().GetBlockSize(path)
+}
+
+// GetFileSystemInfo returns the file system of path if the wrapped provider
+// can detect it
+func (d *SlowDiskInfo) GetFileSystemInfo(path string) (cleaner.FileSystemInfo, error) {
+	if err := d.injector.inject(d.Faults, d.Seed, OpFileSystemInfo); err != nil {
+		return cleaner.FileSystemInfo{}, err
+	}
+	detector, ok := d.provider().(cleaner.FileSystemTypeProvider)
+	if !ok {
+		return cleaner.FileSystemInfo{}, errors.ErrUnsupported
+	}
+	return detector.GetFileSystemInfo(path)
+}
+
+// Calls returns the number of calls of op so far, including failed ones
+func (d *SlowDiskInfo) Calls(op Op) int {
+	calls, _ := d.injector.count(op)
+	return calls
+}
+
+// Failures returns the number of calls of op that were failed so far
+func (d *SlowDiskInfo) Failures(op Op) int {
+	_, failures := d.injector.count(op)
+	return failures
+}
+
+// provider returns the wrapped provider
+func (d *SlowDiskInfo) provider() cleaner.DiskInfoProvider {
+	if d.Provider == nil {
+		return &cleaner.DefaultDiskInfoProvider{}
+	}
+	return d.Provider
+}
@@ -0,0 +1,104 @@
+package cleanertest
+
+import (
+	"io"
+	"os"
+	"time"
+
+	cleaner "github.com/ideamans/go-backup-cleaner"
+)
+
+// SlowFS wraps a FileSystem, delaying and failing its operations according
+// to Faults. Failing calls do not reach the wrapped file system, so a failed
+// Remove leaves the file in place. Set the fields before the first use.
+type SlowFS struct {
+	FS     cleaner.FileSystem // Wrapped file system (default: cleaner.OSFileSystem)
+	Faults map[Op]Fault       // Faults per operation, operations without one pass through
+	Seed   int64              // Seed of the failures and the jitter, for reproducible runs
+
+	injector injector
+}
+
+// Lstat returns the attributes of a file
+func (f *SlowFS) Lstat(path string) (os.FileInfo, error) {
+	if err := f.injector.inject(f.Faults, f.Seed, OpLstat); err != nil {
+		return nil, &os.PathError{Op: string(OpLstat), Path: path, Err: err}
+	}
+	return f.fs().Lstat(path)
+}
+
+// Stat returns the attributes of a file, following symlinks
+func (f *SlowFS) Stat(path string) (os.FileInfo, error) {
+	if err := f.injector.inject(f.Faults, f.Seed, OpStat); err != nil {
+		return nil, &os.PathError{Op: string(OpStat), Path: path, Err: err}
+	}
+	return f.fs().Stat(path)
+}
+
+// ReadDir reads a directory sorted by name
+func (f *SlowFS) ReadDir(path string) ([]os.DirEntry, error) {
+	if err := f.injector.inject(f.Faults, f.Seed, OpReadDir); err != nil {
+		return nil, &os.PathError{Op: string(OpReadDir), Path: path, Err: err}
+	}
+	return f.fs().ReadDir(path)
+}
+
+// Open opens a file for reading
+func (f *SlowFS) Open(path string) (io.ReadCloser, error) {
+	if err := f.injector.inject(f.Faults, f.Seed, OpOpen); err != nil {
+		return nil, &os.PathError{Op: string(OpOpen), Path: path, Err: err}
+	}
+	return f.fs().Open(path)
+}
+
+// Remove deletes a file or an empty directory
+func (f *SlowFS) Remove(path string) error {
+	if err := f.injector.inject(f.Faults, f.Seed, OpRemove); err != nil {
+		return &os.PathError{Op: string(OpRemove), Path: path, Err: err}
+	}
+	return f.fs().Remove(path)
+}
+
+// RemoveAll deletes a directory and everything below it
+func (f *SlowFS) RemoveAll(path string) error {
+	if err := f.injector.inject(f.Faults, f.Seed, OpRemoveAll); err != nil {
+		return &os.PathError{Op: string(OpRemoveAll), Path: path, Err: err}
+	}
+	return f.fs().RemoveAll(path)
+}
+
+// Rename moves a file or directory
+func (f *SlowFS) Rename(oldPath, newPath string) error {
+	if err := f.injector.inject(f.Faults, f.Seed, OpRename); err != nil {
+		return &os.LinkError{Op: string(OpRename), Old: oldPath, New: newPath, Err: err}
+	}
+	return f.fs().Rename(oldPath, newPath)
+}
+
+// Chtimes changes the access and modification times of a file
+func (f *SlowFS) Chtimes(path string, atime, mtime time.Time) error {
+	if err := f.injector.inject(f.Faults, f.Seed, OpChtimes); err != nil {
+		return &os.PathError{Op: string(OpChtimes), Path: path, Err: err}
+	}
+	return f.fs().Chtimes(path, atime, mtime)
+}
+
+// Calls returns the number of calls of op so far, including failed ones
+func (f *SlowFS) Calls(op Op) int {
+	calls, _ := f.injector.count(op)
+	return calls
+}
+
+// Failures returns the number of calls of op that were failed so far
+func (f *SlowFS) Failures(op Op) int {
+	_, failures := f.injector.count(op)
+	return failures
+}
+
+// fs returns the wrapped file system
+func (f *SlowFS) fs() cleaner.FileSystem {
+	if f.FS == nil {
+		return cleaner.OSFileSystem{}
+	}
+	return f.FS
+}
@@ -0,0 +1,130 @@
+package cleanertest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cleaner "github.com/ideamans/go-backup-cleaner"
+)
+
+// createBackups creates n files of 4096 bytes, one hour apart, oldest first
+func createBackups(t *testing.T, dir string, n int) {
+	t.Helper()
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < n; i++ {
+		path := filepath.Join(dir, string(rune('a'+i))+".tar")
+		if err := os.WriteFile(path, make([]byte, 4096), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-time.Duration(n-i) * time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// noDiskUsage reports no disk usage, so runs are bound by MaxSize
+
+type noDiskUsage struct{}
+
+func (noDiskUsage) GetDiskUsage(path string) (*cleaner.DiskUsage, error) {
+	return nil, errors.New("disk usage not available")
+}
+
+func (noDiskUsage) GetBlockSize(path string) (int64, error) { return 4096, nil }
+
+func TestSlowFSRetries(t *testing.T) {
+	tmpDir := t.TempDir()
+	createBackups(t, tmpDir, 4)
+
+	// Half of the deletions fail, the retries still delete every old file
+	fs := &SlowFS{Faults: map[Op]Fault{OpRemove: {ErrorRate: 0.5}}, Seed: 2}
+	report, err := cleaner.CleanBackup(tmpDir, cleaner.CleaningConfig{
+		MaxSize:       int64Ptr(8192),
+		TimeWindow:    time.Hour,
+		DeleteRetries: 8,
+		DiskInfo:      noDiskUsage{},
+		FS:            fs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 2 {
+		t.Errorf("Expected 2 deleted files, got %d", report.DeletedFiles)
+	}
+	if fs.Failures(OpRemove) == 0 {
+		t.Error("Expected some deletions to fail")
+	}
+}
+
+func TestSlowFSErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	createBackups(t, tmpDir, 2)
+
+	// Every deletion fails without retries
+	fs := &SlowFS{Faults: map[Op]Fault{OpRemove: {ErrorRate: 1, Err: os.ErrPermission}}}
+	_, err := cleaner.CleanBackup(tmpDir, cleaner.CleaningConfig{
+		MaxSize:    int64Ptr(0),
+		TimeWindow: time.Hour,
+		DiskInfo:   noDiskUsage{},
+		FS:         fs,
+	})
+	if !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Expected the injected error, got %v", err)
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 2 {
+		t.Errorf("Expected failed deletions to keep the files, got %d files", len(entries))
+	}
+}
+
+func TestSlowFSLatency(t *testing.T) {
+	tmpDir := t.TempDir()
+	createBackups(t, tmpDir, 5)
+
+	// Each deletion takes longer than the run may
+	fs := &SlowFS{Faults: map[Op]Fault{OpRemove: {Latency: 100 * time.Millisecond}}}
+	report, err := cleaner.CleanBackup(tmpDir, cleaner.CleaningConfig{
+		MaxSize:        int64Ptr(0),
+		TimeWindow:     time.Hour,
+		MaxDuration:    50 * time.Millisecond,
+		MaxConcurrency: 1,
+		DiskInfo:       noDiskUsage{},
+		FS:             fs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.TimedOut || report.DeletedFiles >= 5 {
+		t.Errorf("Expected the run to time out before deleting every file, got %+v", report)
+	}
+}
+
+func TestSlowDiskInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+	createBackups(t, tmpDir, 2)
+
+	// Without disk usage the run falls back to MaxSize
+	disk := &SlowDiskInfo{
+		Provider: noDiskUsage{},
+		Faults:   map[Op]Fault{OpBlockSize: {Latency: 10 * time.Millisecond}, OpDiskUsage: {ErrorRate: 1}},
+	}
+	report, err := cleaner.CleanBackup(tmpDir, cleaner.CleaningConfig{
+		MaxSize:    int64Ptr(4096),
+		TimeWindow: time.Hour,
+		DiskInfo:   disk,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 || disk.Failures(OpDiskUsage) == 0 {
+		t.Errorf("Expected 1 deletion after the failed disk usage, got %d", report.DeletedFiles)
+	}
+	if _, err := disk.GetFileSystemInfo(tmpDir); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported from a provider without detection, got %v", err)
+	}
+}
+
+func int64Ptr(v int64) *int64 { return &v }
@@ -1,10 +1,22 @@
 package gobackupcleaner
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"time"
 )
 
+const (
+	networkMaxConcurrency = 2 // Workers on network file systems (see NoNetworkTuning)
+	networkDeleteRetries  = 3 // DeleteRetries on network file systems
+)
+
 // CleaningConfig represents the configuration for cleaning operations
 type CleaningConfig struct {
 	// Capacity specifications (at least one required)
@@ -13,25 +25,379 @@ type CleaningConfig struct {
 	MaxUsagePercent *float64 // Maximum disk usage percentage (0-100)
 	MaxSize         *int64   // Maximum size in bytes (use when disk info is unavailable)
 
+	// StartFreeSpace and StartUsagePercent delay cleaning until free space
+	// falls below StartFreeSpace or usage exceeds StartUsagePercent. Cleaning
+	// then frees space up to MinFreeSpace and MaxUsagePercent, so scheduled
+	// runs don't flap around a single threshold (see NeedsCleaning).
+	StartFreeSpace    *int64   // At most MinFreeSpace
+	StartUsagePercent *float64 // At least MaxUsagePercent
+
+	// TargetFreeSpaceAfterClean and TargetUsagePercentAfterClean set the
+	// levels a run frees space to once MinFreeSpace or MaxUsagePercent is
+	// breached, so cleanup ends comfortably below the constraint and runs
+	// less often.
+	TargetFreeSpaceAfterClean    *int64   // At least MinFreeSpace
+	TargetUsagePercentAfterClean *float64 // At most MaxUsagePercent
+
+	// MaxAge deletes files older than this on every run, even while the
+	// capacity constraints are met, for policies such as "keep under 500GB
+	// but never more than 30 days". Files matched by a RuleKeep rule are not
+	// deleted by age. Overrides with a MaxAge take precedence below their
+	// path. 0 disables it.
+	MaxAge time.Duration
+
+	// MinKeepFiles and MinKeepPerDir never delete the newest files of the
+	// tree and of each directory, even if the target cannot be reached then,
+	// so an aggressive MinFreeSpace cannot wipe every backup. Only backups
+	// count, not files deleted first such as broken or temp files and
+	// RuleDelete matches. Directories deleted as a whole count as one file
+	// of their parent. 0 disables them.
+	MinKeepFiles  int
+	MinKeepPerDir int
+
+	// UsageBase selects the size the percent constraints are computed on
+	// (default: UsageBaseTotal). UsageBaseUsable excludes the blocks reserved
+	// for root, matching the usage df shows.
+	UsageBase UsageBase
+
+	// FreeSpaceScope selects the free space the free space constraints are
+	// compared with (default: FreeSpaceCaller). On Windows the free space of
+	// the caller is limited by its quota, FreeSpaceVolume targets the free
+	// space of the whole volume instead.
+	FreeSpaceScope FreeSpaceScope
+
 	// Optional settings
 	TimeWindow      time.Duration // Time interval for file aggregation (default: 5 minutes)
 	RemoveEmptyDirs bool          // Whether to remove empty directories (default: true)
-	
+
+	// DeleteBrokenFirst deletes zero-byte and truncated files before any
+	// age-based deletion, counting their freed bytes toward the target.
+	// Broken partial uploads are the best thing to reclaim.
+	DeleteBrokenFirst bool
+	// MinExpectedSizes flags files smaller than the expected size as truncated.
+	// The first rule whose pattern matches the file name applies.
+	MinExpectedSizes []MinSizeRule
+
+	// ExpendableDirs are directories relative to the target directory (e.g.
+	// "tmp/", "staging/") whose contents are deleted entirely before any
+	// age-based deletion, counting their freed bytes toward the target.
+	ExpendableDirs []string
+
+	// ReferencedListFile lists the files still referenced by the backup
+	// software, one path per line, absolute or relative to the target
+	// directory. Referenced files are kept, every other file is deleted ahead
+	// of age-based deletion regardless of its age, counting toward the target;
+	// only RuleProtect rules take precedence. The file is read on every run.
+	ReferencedListFile string
+	// ReferencedList provides the list from a reader instead, read once by
+	// NewCleaner
+	ReferencedList io.Reader
+
+	// RepositoryMode recognizes restic, borg and kopia repositories below the
+	// target directory and never deletes inside them, as their packs are
+	// shared between snapshots. Plain files around them are cleaned as usual.
+	RepositoryMode bool
+	// RepositoryPruner, if set in RepositoryMode, is asked to free space in
+	// the repositories at the target directory and its immediate
+	// subdirectories before the plain files are considered
+	RepositoryPruner RepositoryPruner
+
+	// Rules are evaluated in order for every file before the capacity
+	// algorithm; the first matching rule decides whether the file is deleted
+	// first, kept or protected. Files matching no rule follow the normal policy.
+	Rules []Rule
+
+	// Overrides adjust the retention of subdirectories, so a single run can
+	// apply different policies below one target directory. The override with
+	// the longest matching path applies to each file.
+	Overrides []RetentionOverride
+
+	// StrictPolicy fails the run with a *ProtectionConflictError, before
+	// anything is deleted (except by Pipeline), when files kept by rules,
+	// overrides or open file checks make the capacity target unreachable,
+	// instead of freeing what it can and leaving a shortfall, so automation
+	// can escalate rather than retry. Plan fails the same way.
+	StrictPolicy bool
+
+	// CleanTempFiles deletes leftover temp files (*.part, *.tmp and rsync
+	// .~tmp~ directories) older than TempGracePeriod before any age-based
+	// deletion, counting their freed bytes toward the target.
+	CleanTempFiles bool
+	// TempGracePeriod protects temp files that may still be in use (default: 24 hours)
+	TempGracePeriod time.Duration
+
+	// MaxDuration limits the wall-clock time of a run to stay within a
+	// maintenance window. When it is reached the run stops gracefully and
+	// returns a partial report with TimedOut set; the next run rescans.
+	// A run that times out while scanning deletes nothing. 0 means no limit.
+	MaxDuration time.Duration
+	// ScanBudgetRatio is the fraction of MaxDuration available for scanning
+	// (default: 0.5). A scan that exceeds its budget stops early and only the
+	// files scanned so far are considered, leaving time to delete something.
+	ScanBudgetRatio float64
+
+	// MaxMemoryBytes bounds the memory the scan spends on its per-file lists.
+	// Beyond it the scan degrades to counting files per time slot, which is
+	// enough to compute the threshold as deletion walks the tree again, and
+	// the report notes the degradation. A partial scan then only deletes the
+	// files deleted ahead of age-based deletion, and DirectoryReport is
+	// dropped. Not with FairShare, PerVolumeTargets, KeepLatestN overrides or
+	// MinKeepFiles, which select files from the lists. 0 means no limit.
+	MaxMemoryBytes int64
+
+	// ProfileMemory records the allocations and the peak heap of the scan
+	// and delete phases in CleaningReport.MemoryProfile, to quantify the
+	// effect of settings such as TimeWindow and MaxMemoryBytes. Sampling the
+	// heap briefly stops the world, so it is meant for tuning only.
+	ProfileMemory bool
+
+	// PreserveParentMTimes records the modification times of directories
+	// before files are deleted from them and restores them afterwards, for
+	// incremental backup tooling that watches directory mtimes.
+	PreserveParentMTimes bool
+
+	// NoAtime opens directories and files with O_NOATIME on Linux so the
+	// cleaner does not update access times, which would skew atime-based
+	// policies and HSM systems. It has no effect on other platforms.
+	NoAtime bool
+
+	// SkipOpenFiles keeps files that are open by a process when the run
+	// starts, e.g. a backup still being written or uploaded, whose space
+	// would only be freed once the writer closes them. On Linux it lists the
+	// open files of all processes from /proc at the start of every run,
+	// which is costly on busy hosts; only root sees the files of other
+	// users' processes. It has no effect on other platforms.
+	SkipOpenFiles bool
+
+	// SnapshotLayout cleans rsnapshot-style hard-link farms: the rotation
+	// directories directly below the target directory (hourly.0, daily.3,
+	// weekly.1, ...) are deleted as a whole, oldest first by the
+	// modification time of the directory, instead of file by file, which
+	// would corrupt the snapshots. Each is accounted with the space it really
+	// frees: files hard-linked into newer snapshots are freed with the newest
+	// of them. Other entries are cleaned as usual.
+	SnapshotLayout bool
+
+	// ManifestPath enables a post-clean pass that writes the hashes of all
+	// remaining files to this path. Hashes are reused for files whose size and
+	// modification time are unchanged since the previous manifest.
+	ManifestPath string
+
+	// ContentIDs computes the hashes of the manifest. The default is
+	// SHA256ContentIDProvider; NoContentIDProvider disables hashing.
+	ContentIDs ContentIDProvider
+
+	// MaxRemovedDirPaths is the maximum number of removed directory paths
+	// collected into the report, so downstream systems can update their own
+	// directory indexes. 0 disables collection.
+	MaxRemovedDirPaths int
+
+	// CaptureXattrs names extended attributes (alternate data streams on
+	// Windows), e.g. "user.checksum" or "user.origin_host", read from each
+	// file before it is deleted into FileDeletedInfo.Xattrs, so provenance
+	// recorded by audit logs is not lost with the file. Attributes are not
+	// read on other platforms.
+	CaptureXattrs []string
+
+	// DisplayPathWidth truncates the paths of OnFileDeleted and OnDirDeleted
+	// to this many terminal columns into their DisplayPath field (see
+	// TruncatePath), so deeply nested backups do not flood logs. 0 disables it.
+	DisplayPathWidth int
+
+	// MaxDepth limits how deep the scanner descends below the target directory.
+	// Directories found at this depth are treated as opaque backup sets: their
+	// contents are aggregated into a single unit (total size, newest mtime) and
+	// deleted as a whole. 0 means unlimited depth.
+	MaxDepth int
+
+	// OpaqueDirPatterns are glob patterns matched against directory names
+	// (e.g. "*.vbk.d", "*.chunks"). Matching directories are treated like
+	// directories at MaxDepth, as a single unit with the total size and
+	// newest mtime of their files, so chunked backup formats are never
+	// deleted partially.
+	OpaqueDirPatterns []string
+
+	// IncludePatterns restricts deletion to files matching one of these glob
+	// patterns (e.g. "*.tar.gz", "db-*.dump"); other files are neither
+	// counted nor deleted, so unrelated files sharing the directory are never
+	// touched. Directories deleted as a whole must match too. Patterns with a
+	// slash match the slash-separated path relative to the target directory,
+	// others the name. Empty includes all files.
+	IncludePatterns []string
+
+	// ExcludePatterns skips files and directories matching one of these glob
+	// patterns (e.g. "*/important/*"), matched like IncludePatterns. Excluded
+	// directories are skipped with all their contents.
+	ExcludePatterns []string
+
+	// DeleteMode selects how files are deleted. DeleteModeTombstone renames
+	// files to "<name>.deleted-<timestamp>" instead of removing them, keeping
+	// them in place for tools that locate backups by directory. Tombstones are
+	// skipped by later runs and can be removed with PurgeTombstones. Note that
+	// tombstones still occupy disk space.
+	DeleteMode DeleteMode
+
+	// Symlinks selects how symbolic links are handled (default: SymlinkSkip)
+	Symlinks SymlinkPolicy
+
+	// SizeMode selects how the space used by files is accounted (default: SizeModeBlock)
+	SizeMode SizeMode
+	// BlockSizeOverride is the block size used for every file instead of the
+	// detected ones, for file systems that misreport it. Without it, a tree
+	// spanning mount points is accounted with the block size of each file system.
+	BlockSizeOverride *int64
+
+	// FairShare deletes from each immediate subdirectory of the target
+	// directory (e.g. one folder per host) in proportion to its size, each with
+	// its own time threshold, instead of letting the oldest files of one busy
+	// host absorb the entire target.
+	FairShare bool
+	// FairShareKeepLatestN and FairShareKeepWithin guarantee that each prefix
+	// keeps at least its newest N files and the files newer than the duration
+	// in FairShare mode, even if other prefixes must give up more. This keeps
+	// a quiet host from losing all its history. 0 disables the guarantee.
+	FairShareKeepLatestN int
+	FairShareKeepWithin  time.Duration
+
+	// MaxDeletePerDirectory bounds the block-aligned size deleted from each
+	// immediate subdirectory of the target directory in one run (e.g. one
+	// folder per host), so reclamation spreads across the tree and runs
+	// instead of wiping the history of a single host in one pass. Files
+	// beyond it are kept for later runs, leaving a shortfall. Files directly
+	// in the target directory are not limited. 0 means no limit.
+	MaxDeletePerDirectory int64
+
+	// Eviction selects which files age-based deletion takes (default:
+	// EvictionOldestFirst). EvictionSeed seeds EvictionAgeWeighted, so runs
+	// over the same files with the same seed delete the same files; 0 picks
+	// a random seed, reported in CleaningReport.EvictionSeed. Not with
+	// FairShare, PerVolumeTargets, Pipeline or MaxMemoryBytes.
+	Eviction     EvictionStrategy
+	EvictionSeed int64
+	// RestoreTested locates the time each backup was last restore tested,
+	// for EvictionRestoreTestedFirst
+	RestoreTested RestoreTestSource
+
+	// PerVolumeTargets treats each file system mounted below the target
+	// directory as its own volume, with a target computed from its own disk
+	// usage and its own time threshold, as freeing space on one volume does
+	// not help the constraints of another. The run still starts only when
+	// the target directory's volume needs cleaning. Not with FairShare.
+	PerVolumeTargets bool
+
+	// DirectoryReport adds the size and the oldest and newest modification
+	// time of each immediate subdirectory of the target directory, before and
+	// after cleaning, to the report (like du), e.g. one folder per host.
+	DirectoryReport bool
+
+	// OwnerReport adds the space scanned and deleted per file owner to the
+	// report (see CleaningReport.Owners), for multi-user servers where each
+	// user's backups land in one shared tree. Owners are user IDs; they are
+	// not available on Windows.
+	OwnerReport bool
+	// OwnerQuotas limit the block-aligned size of the files of each owner,
+	// keyed by user ID or user name. Once a run deletes files, the oldest
+	// files of an owner above its quota are deleted ahead of age-based
+	// deletion until it is within the quota. Not with MaxMemoryBytes.
+	OwnerQuotas map[string]int64
+
+	// VerifyAfterClean checks after deletion that the deleted files are gone
+	// and looks for .nfsXXXX files NFS leaves behind when an open file is
+	// deleted, in the directories the run deleted from. Discrepancies are
+	// reported via OnError and in CleaningReport.Discrepancies.
+	VerifyAfterClean bool
+	// RetrySillyRenamed deletes the .nfsXXXX files left behind by deleting
+	// files that were still open again at the end of the run, a few times
+	// with increasing delays, in case they were closed in the meantime
+	RetrySillyRenamed bool
+
+	// Pipeline overlaps scanning and deletion: files that are certain to be
+	// deleted whatever the rest of the scan finds are deleted while the scan
+	// is still running, which shortens runs on large trees. Deletion blocks
+	// the scan when it falls behind. Which files are deleted does not change,
+	// but OnFileDeleted may be invoked before OnScanComplete.
+	Pipeline bool
+
+	// MaxDeletesPerSecond and MaxBytesPerSecond limit the deletion rate to
+	// leave IO for other workloads. The limits are shared by all runs of a
+	// Cleaner. 0 means no limit.
+	MaxDeletesPerSecond float64
+	MaxBytesPerSecond   int64
+	// RateLimiter shares deletion limits across Cleaners, e.g. the policies of
+	// a Runner, so concurrent runs collectively respect them. It takes
+	// precedence over MaxDeletesPerSecond and MaxBytesPerSecond.
+	RateLimiter *RateLimiter
+
+	// BlackoutWindows are recurring periods of the day, in local time, during
+	// which deletion pauses until the window ends, so no deletion IO competes
+	// with e.g. the nightly backups. Scanning continues. A Runner defers the
+	// runs that fall into a window to its end.
+	BlackoutWindows []BlackoutWindow
+
+	// NoNetworkTuning disables the defaults applied when the target directory
+	// is on a network file system (NFS, SMB): at most 2 workers, DeleteRetries
+	// of 3 and, in SizeModeBlock without BlockSizeOverride, apparent sizes
+	// instead of the block size reported by the server, which often does not
+	// reflect the space used.
+	NoNetworkTuning bool
+	// ReadDirPlus takes the attributes of the files of a directory from its
+	// entries (DirEntry.Info) right after reading it, while the attribute
+	// cache NFS clients fill with READDIRPLUS is warm, instead of an Lstat
+	// per file when the file is processed, which costs a GETATTR round trip
+	// once the cache expired. A file replaced in between is seen as it was
+	// when its directory was read.
+	ReadDirPlus bool
+	// DeleteRetries is the number of times a failed deletion is retried
+	// (default: 0, 3 on network file systems)
+	DeleteRetries int
+	// DeferLockedDeletes schedules files that cannot be deleted because
+	// another process has them open (a sharing violation on Windows) for
+	// deletion at the next reboot with MoveFileEx, instead of failing on
+	// every run. Files already pending from an earlier run are not scheduled
+	// again. It requires administrator rights and has no effect on other
+	// platforms, where open files can be deleted.
+	DeferLockedDeletes bool
+
+	// DiskInfoCacheTTL caches the disk usage, block size and file system
+	// reported by DiskInfo for this long, within a run and across the runs
+	// of a Cleaner such as a Runner's periodic checks, for volumes where
+	// statfs is slow. The cached usage is dropped after a run deleted files.
+	// 0 disables caching.
+	DiskInfoCacheTTL time.Duration
+
 	// Concurrency settings
 	// Concurrency specifies the desired level of concurrency.
 	// If 0, defaults to runtime.NumCPU().
 	Concurrency int
-	
+
 	// MaxConcurrency limits the maximum level of concurrency.
 	// Defaults to 4, as benchmarks show diminishing returns beyond this value.
 	// The actual concurrency will be min(Concurrency, MaxConcurrency).
 	MaxConcurrency int
 
+	// WatchdogTimeout fails the scan or deletion with ErrWatchdogTimeout once
+	// its workers made no progress for this long, e.g. stuck on a hung mount
+	// or in a callback that never returns. The stuck workers are abandoned.
+	// 0 disables the watchdog.
+	WatchdogTimeout time.Duration
+
+	// Policy identification (optional)
+	// These are recorded in reports together with the config fingerprint,
+	// so historical deletions can be attributed to the policy that caused them.
+	PolicyName    string
+	PolicyVersion string
+
 	// Callbacks
 	Callbacks Callbacks
 
 	// Dependency injection
 	DiskInfo DiskInfoProvider // If nil, uses default implementation
+	FS       FileSystem       // If nil, uses the operating system's (see OSFileSystem)
+	Tracer   Tracer           // Optional tracer for phase spans (nil disables tracing)
+	Stats    *Stats           // Optional live counters, e.g. published via expvar
+
+	referencedPaths []string // Paths read from ReferencedList
+	stampFile       string   // Stamp file of RunIfDue
 }
 
 // setDefaults sets default values for the configuration
@@ -39,20 +405,32 @@ func (c *CleaningConfig) setDefaults() {
 	if c.TimeWindow == 0 {
 		c.TimeWindow = 5 * time.Minute
 	}
-	
+
+	if c.MaxDuration > 0 && c.ScanBudgetRatio == 0 {
+		c.ScanBudgetRatio = 0.5
+	}
+
+	if c.CleanTempFiles && c.TempGracePeriod == 0 {
+		c.TempGracePeriod = 24 * time.Hour
+	}
+
 	// Set default concurrency to CPU count if not specified
 	if c.Concurrency == 0 {
 		c.Concurrency = runtime.NumCPU()
 	}
-	
+
 	// Set default max concurrency
 	if c.MaxConcurrency == 0 {
 		c.MaxConcurrency = 4
 	}
-	
+
 	if c.DiskInfo == nil {
 		c.DiskInfo = &DefaultDiskInfoProvider{}
 	}
+
+	if c.ContentIDs == nil {
+		c.ContentIDs = &SHA256ContentIDProvider{}
+	}
 	// RemoveEmptyDirs defaults to true, but we can't override explicit false
 	// So we don't set it here - let the caller decide
 }
@@ -66,12 +444,162 @@ func (c *CleaningConfig) ActualWorkerCount() int {
 	return workers
 }
 
+// Fingerprint returns a stable hash of the effective configuration (after defaults).
+// Only settings that affect which files are deleted are included; concurrency,
+// callbacks and providers are not part of the fingerprint.
+func (c *CleaningConfig) Fingerprint() string {
+	effective := *c
+	effective.setDefaults()
+
+	h := sha256.New()
+	effective.writeFingerprint(h)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeFingerprint writes the canonical representation of the policy settings
+func (c *CleaningConfig) writeFingerprint(w io.Writer) {
+	fmt.Fprintf(w, "MinFreeSpace=%s\n", formatOptional(c.MinFreeSpace))
+	fmt.Fprintf(w, "MaxUsagePercent=%s\n", formatOptional(c.MaxUsagePercent))
+	fmt.Fprintf(w, "MaxSize=%s\n", formatOptional(c.MaxSize))
+	fmt.Fprintf(w, "StartFreeSpace=%s\n", formatOptional(c.StartFreeSpace))
+	fmt.Fprintf(w, "StartUsagePercent=%s\n", formatOptional(c.StartUsagePercent))
+	fmt.Fprintf(w, "TargetFreeSpaceAfterClean=%s\n", formatOptional(c.TargetFreeSpaceAfterClean))
+	fmt.Fprintf(w, "TargetUsagePercentAfterClean=%s\n", formatOptional(c.TargetUsagePercentAfterClean))
+	fmt.Fprintf(w, "MaxAge=%d\n", c.MaxAge)
+	fmt.Fprintf(w, "MinKeep=%d:%d\n", c.MinKeepFiles, c.MinKeepPerDir)
+	fmt.Fprintf(w, "UsageBase=%s\n", c.UsageBase)
+	fmt.Fprintf(w, "FreeSpaceScope=%s\n", c.FreeSpaceScope)
+	fmt.Fprintf(w, "TimeWindow=%d\n", c.TimeWindow)
+	fmt.Fprintf(w, "RemoveEmptyDirs=%t\n", c.RemoveEmptyDirs)
+	fmt.Fprintf(w, "MaxDepth=%d\n", c.MaxDepth)
+	for _, pattern := range c.OpaqueDirPatterns {
+		fmt.Fprintf(w, "OpaqueDirPattern=%q\n", pattern)
+	}
+	for _, pattern := range c.IncludePatterns {
+		fmt.Fprintf(w, "IncludePattern=%q\n", pattern)
+	}
+	for _, pattern := range c.ExcludePatterns {
+		fmt.Fprintf(w, "ExcludePattern=%q\n", pattern)
+	}
+	fmt.Fprintf(w, "DeleteMode=%s\n", c.DeleteMode)
+	fmt.Fprintf(w, "Symlinks=%s\n", c.Symlinks)
+	fmt.Fprintf(w, "SizeMode=%s\n", c.SizeMode)
+	fmt.Fprintf(w, "BlockSizeOverride=%s\n", formatOptional(c.BlockSizeOverride))
+	fmt.Fprintf(w, "DeleteBrokenFirst=%t\n", c.DeleteBrokenFirst)
+	for _, rule := range c.MinExpectedSizes {
+		fmt.Fprintf(w, "MinExpectedSize=%q:%d\n", rule.Pattern, rule.MinSize)
+	}
+	for _, dir := range c.ExpendableDirs {
+		fmt.Fprintf(w, "ExpendableDir=%q\n", dir)
+	}
+	fmt.Fprintf(w, "ReferencedList=%q:%t\n", c.ReferencedListFile, c.ReferencedList != nil || c.referencedPaths != nil)
+	fmt.Fprintf(w, "RepositoryMode=%t\n", c.RepositoryMode)
+	for _, r := range c.Rules {
+		m := r.Match
+		var condition string
+		if m.Condition != nil {
+			condition = m.Condition.String()
+		}
+		fmt.Fprintf(w, "Rule=%d:%q:%q:%d:%d:%d:%d:%q\n", r.Action, m.Glob, m.Regexp, m.MinAge, m.MaxAge, m.MinSize, m.MaxSize, condition)
+	}
+	for _, o := range c.Overrides {
+		fmt.Fprintf(w, "Override=%q:%d:%d\n", o.Path, o.KeepLatestN, o.MaxAge)
+	}
+	fmt.Fprintf(w, "FairShare=%t:%d:%d\n", c.FairShare, c.FairShareKeepLatestN, c.FairShareKeepWithin)
+	fmt.Fprintf(w, "MaxDeletePerDirectory=%d\n", c.MaxDeletePerDirectory)
+	fmt.Fprintf(w, "Eviction=%s:%d\n", c.Eviction, c.EvictionSeed)
+	fmt.Fprintf(w, "RestoreTested=%q:%q\n", c.RestoreTested.Xattr, c.RestoreTested.SidecarSuffix)
+	fmt.Fprintf(w, "StrictPolicy=%t\n", c.StrictPolicy)
+	fmt.Fprintf(w, "PerVolumeTargets=%t\n", c.PerVolumeTargets)
+	owners := make([]string, 0, len(c.OwnerQuotas))
+	for owner := range c.OwnerQuotas {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	for _, owner := range owners {
+		fmt.Fprintf(w, "OwnerQuota=%q:%d\n", owner, c.OwnerQuotas[owner])
+	}
+	fmt.Fprintf(w, "SkipOpenFiles=%t\n", c.SkipOpenFiles)
+	fmt.Fprintf(w, "SnapshotLayout=%t\n", c.SnapshotLayout)
+	fmt.Fprintf(w, "CleanTempFiles=%t\n", c.CleanTempFiles)
+	fmt.Fprintf(w, "TempGracePeriod=%d\n", c.TempGracePeriod)
+	fmt.Fprintf(w, "PolicyName=%q\n", c.PolicyName)
+	fmt.Fprintf(w, "PolicyVersion=%q\n", c.PolicyVersion)
+}
+
+// formatOptional formats an optional value for fingerprinting
+func formatOptional[T any](v *T) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprint(*v)
+}
+
+// applyNetworkTuning adjusts the configuration of a run on a network file
+// system, unless NoNetworkTuning is set
+func (c *CleaningConfig) applyNetworkTuning(fs FileSystemInfo) {
+	if !fs.Network || c.NoNetworkTuning {
+		return
+	}
+	if c.MaxConcurrency > networkMaxConcurrency {
+		c.MaxConcurrency = networkMaxConcurrency
+	}
+	if c.DeleteRetries == 0 {
+		c.DeleteRetries = networkDeleteRetries
+	}
+	if c.BlockSizeOverride == nil && c.SizeMode == SizeModeBlock {
+		c.SizeMode = SizeModeApparent
+	}
+}
+
+// blockSize returns BlockSizeOverride if set, or the block size of dirPath
+func (c *CleaningConfig) blockSize(dirPath string) (int64, error) {
+	if c.BlockSizeOverride != nil {
+		return *c.BlockSizeOverride, nil
+	}
+	return c.DiskInfo.GetBlockSize(dirPath)
+}
+
+// isOpaqueDepth reports whether a directory at the given depth should be
+// treated as a single backup unit
+func (c *CleaningConfig) isOpaqueDepth(depth int) bool {
+	return c.MaxDepth > 0 && depth >= c.MaxDepth
+}
+
+// scanBudget returns the time available for scanning, or 0 if unlimited
+func (c *CleaningConfig) scanBudget() time.Duration {
+	if c.MaxDuration <= 0 {
+		return 0
+	}
+	return time.Duration(float64(c.MaxDuration) * c.ScanBudgetRatio)
+}
+
+// accountingBlockSize returns the block size used to account file sizes
+func (c *CleaningConfig) accountingBlockSize(blockSize int64) int64 {
+	if c.SizeMode == SizeModeApparent {
+		return 0
+	}
+	return blockSize
+}
+
+// isDeletableFile reports whether a non-directory entry is a deletion unit
+func (c *CleaningConfig) isDeletableFile(info os.FileInfo) bool {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return c.Symlinks == SymlinkDelete
+	}
+	return info.Mode().IsRegular()
+}
+
 // validate checks if the configuration is valid
 func (c *CleaningConfig) validate() error {
 	if c.MinFreeSpace == nil && c.MaxUsagePercent == nil && c.MaxSize == nil {
 		return ErrNoCapacitySpecified
 	}
+	return c.validateSettings()
+}
 
+// validateSettings checks the settings without requiring a capacity limit
+func (c *CleaningConfig) validateSettings() error {
 	if c.MinFreeSpace != nil && *c.MinFreeSpace < 0 {
 		return ErrInvalidConfig
 	}
@@ -84,6 +612,24 @@ func (c *CleaningConfig) validate() error {
 		return ErrInvalidConfig
 	}
 
+	// Cleaning must start no later than its constraint is breached
+	if c.StartFreeSpace != nil && (c.MinFreeSpace == nil || *c.StartFreeSpace < 0 || *c.StartFreeSpace > *c.MinFreeSpace) {
+		return ErrInvalidConfig
+	}
+
+	if c.StartUsagePercent != nil && (c.MaxUsagePercent == nil || *c.StartUsagePercent < *c.MaxUsagePercent || *c.StartUsagePercent > 100) {
+		return ErrInvalidConfig
+	}
+
+	// Cleaning must free at least as much as its constraint requires
+	if c.TargetFreeSpaceAfterClean != nil && (c.MinFreeSpace == nil || *c.TargetFreeSpaceAfterClean < *c.MinFreeSpace) {
+		return ErrInvalidConfig
+	}
+
+	if c.TargetUsagePercentAfterClean != nil && (c.MaxUsagePercent == nil || *c.TargetUsagePercentAfterClean < 0 || *c.TargetUsagePercentAfterClean > *c.MaxUsagePercent) {
+		return ErrInvalidConfig
+	}
+
 	if c.TimeWindow < 0 {
 		return ErrInvalidConfig
 	}
@@ -96,5 +642,132 @@ func (c *CleaningConfig) validate() error {
 		return ErrInvalidConfig
 	}
 
+	for _, dir := range c.ExpendableDirs {
+		if !filepath.IsLocal(dir) || filepath.Clean(dir) == "." {
+			return ErrInvalidConfig
+		}
+	}
+
+	for _, r := range c.Rules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, o := range c.Overrides {
+		if !filepath.IsLocal(o.Path) || o.KeepLatestN < 0 || o.MaxAge < 0 {
+			return ErrInvalidConfig
+		}
+	}
+
+	if c.MaxDuration < 0 {
+		return ErrInvalidConfig
+	}
+
+	if c.ScanBudgetRatio < 0 || c.ScanBudgetRatio > 1 {
+		return ErrInvalidConfig
+	}
+
+	if c.TempGracePeriod < 0 {
+		return ErrInvalidConfig
+	}
+
+	if c.FairShareKeepLatestN < 0 || c.FairShareKeepWithin < 0 || c.MaxDeletePerDirectory < 0 {
+		return ErrInvalidConfig
+	}
+
+	if c.PerVolumeTargets && c.FairShare {
+		return ErrInvalidConfig
+	}
+
+	// The selection of these modes needs the per-file lists
+	if c.MaxMemoryBytes < 0 || (c.MaxMemoryBytes > 0 && (c.FairShare || c.PerVolumeTargets)) {
+		return ErrInvalidConfig
+	}
+	for _, o := range c.Overrides {
+		if c.MaxMemoryBytes > 0 && o.KeepLatestN > 0 {
+			return ErrInvalidConfig
+		}
+	}
+	if c.MinKeepFiles < 0 || c.MinKeepPerDir < 0 || (c.MaxMemoryBytes > 0 && (c.MinKeepFiles > 0 || c.MinKeepPerDir > 0)) {
+		return ErrInvalidConfig
+	}
+	for _, quota := range c.OwnerQuotas {
+		if quota < 0 || c.MaxMemoryBytes > 0 {
+			return ErrInvalidConfig
+		}
+	}
+
+	for _, w := range c.BlackoutWindows {
+		if !w.valid() {
+			return ErrInvalidConfig
+		}
+	}
+
+	if c.BlockSizeOverride != nil && *c.BlockSizeOverride <= 0 {
+		return ErrInvalidConfig
+	}
+
+	if c.DeleteRetries < 0 {
+		return ErrInvalidConfig
+	}
+
+	if c.WatchdogTimeout < 0 {
+		return ErrInvalidConfig
+	}
+
+	if c.MaxDeletesPerSecond < 0 || c.MaxBytesPerSecond < 0 {
+		return ErrInvalidConfig
+	}
+
+	if !validEnum(deleteModeNames, int(c.DeleteMode)) ||
+		!validEnum(symlinkPolicyNames, int(c.Symlinks)) ||
+		!validEnum(sizeModeNames, int(c.SizeMode)) ||
+		!validEnum(usageBaseNames, int(c.UsageBase)) ||
+		!validEnum(freeSpaceScopeNames, int(c.FreeSpaceScope)) ||
+		!validEnum(evictionStrategyNames, int(c.Eviction)) {
+		return ErrInvalidConfig
+	}
+
+	// The selection needs the per-file lists of a single target
+	if c.Eviction != EvictionOldestFirst && (c.FairShare || c.PerVolumeTargets || c.Pipeline || c.MaxMemoryBytes > 0) {
+		return ErrInvalidConfig
+	}
+	if c.Eviction == EvictionRestoreTestedFirst && c.RestoreTested == (RestoreTestSource{}) {
+		return ErrInvalidConfig
+	}
+
+	if c.ReferencedListFile != "" && c.ReferencedList != nil {
+		return ErrInvalidConfig
+	}
+
+	if c.MaxRemovedDirPaths < 0 || c.DisplayPathWidth < 0 {
+		return ErrInvalidConfig
+	}
+
+	for _, rule := range c.MinExpectedSizes {
+		if _, err := filepath.Match(rule.Pattern, ""); err != nil || rule.MinSize < 0 {
+			return ErrInvalidConfig
+		}
+	}
+
+	if c.MaxDepth < 0 || c.MaxAge < 0 {
+		return ErrInvalidConfig
+	}
+
+	for _, pattern := range c.OpaqueDirPatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+			return ErrInvalidConfig
+		}
+	}
+
+	for _, patterns := range [][]string{c.IncludePatterns, c.ExcludePatterns} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+				return ErrInvalidConfig
+			}
+		}
+	}
+
 	return nil
-}
\ No newline at end of file
+}
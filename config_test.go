@@ -97,4 +97,36 @@ func TestConfigTimeWindowDefault(t *testing.T) {
 	if config2.TimeWindow != customWindow {
 		t.Errorf("Expected TimeWindow %v, got %v", customWindow, config2.TimeWindow)
 	}
-}
\ No newline at end of file
+}
+// TestConfigFingerprint tests that the fingerprint reflects policy settings only
+func TestConfigFingerprint(t *testing.T) {
+	maxSize := int64(1024)
+	base := CleaningConfig{MaxSize: &maxSize, PolicyName: "nightly", PolicyVersion: "1"}
+
+	// Defaults are applied before fingerprinting
+	explicit := base
+	explicit.TimeWindow = 5 * time.Minute
+	if base.Fingerprint() != explicit.Fingerprint() {
+		t.Error("Expected explicit default TimeWindow to produce the same fingerprint")
+	}
+
+	// Concurrency does not affect which files are deleted
+	concurrent := base
+	concurrent.Concurrency = 3
+	if base.Fingerprint() != concurrent.Fingerprint() {
+		t.Error("Expected Concurrency to be excluded from the fingerprint")
+	}
+
+	// Policy changes produce a different fingerprint
+	otherSize := int64(2048)
+	changed := base
+	changed.MaxSize = &otherSize
+	if base.Fingerprint() == changed.Fingerprint() {
+		t.Error("Expected a different MaxSize to change the fingerprint")
+	}
+	versioned := base
+	versioned.PolicyVersion = "2"
+	if base.Fingerprint() == versioned.Fingerprint() {
+		t.Error("Expected a different PolicyVersion to change the fingerprint")
+	}
+}
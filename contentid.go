@@ -0,0 +1,86 @@
+package gobackupcleaner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ContentIDProvider computes content identifiers of files, such as the hashes
+// of the manifest (see ManifestPath). Implementations can delegate the work,
+// e.g. to a faster hash like xxhash or to checksums the file system already
+// maintains like those of ZFS.
+type ContentIDProvider interface {
+	// Name identifies the algorithm. Identifiers computed by another
+	// algorithm are never reused.
+	Name() string
+	// ContentID returns an identifier that is equal for files with equal
+	// content. ErrContentIDUnsupported leaves the file without identifier.
+	ContentID(path string) (string, error)
+}
+
+// SHA256ContentIDProvider hashes files with SHA-256. It is the default.
+type SHA256ContentIDProvider struct{}
+
+// Name returns "sha256"
+func (p *SHA256ContentIDProvider) Name() string { return "sha256" }
+
+// ContentID computes the SHA-256 hash of a file without updating its access time
+func (p *SHA256ContentIDProvider) ContentID(path string) (string, error) {
+	f, err := openNoAtime(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NoContentIDProvider disables hashing. Manifests then only list the files
+// with their sizes and modification times.
+type NoContentIDProvider struct{}
+
+// Name returns "none"
+func (p *NoContentIDProvider) Name() string { return "none" }
+
+// ContentID returns ErrContentIDUnsupported without reading the file
+func (p *NoContentIDProvider) ContentID(path string) (string, error) {
+	return "", ErrContentIDUnsupported
+}
+
+// noContentID is stored for files without identifier
+const noContentID = "-"
+
+// storedContentID computes the identifier of a file as stored in manifests:
+// SHA-256 hashes as is, for compatibility with earlier manifests, and the
+// identifiers of other algorithms prefixed by "<name>:".
+func storedContentID(provider ContentIDProvider, path string) (string, error) {
+	id, err := provider.ContentID(path)
+	if errors.Is(err, ErrContentIDUnsupported) {
+		return noContentID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, ok := provider.(*SHA256ContentIDProvider); ok {
+		return id, nil
+	}
+	return provider.Name() + ":" + id, nil
+}
+
+// reusableContentID reports whether a stored identifier was computed by provider
+func reusableContentID(provider ContentIDProvider, stored string) bool {
+	switch provider.(type) {
+	case *NoContentIDProvider:
+		return stored == noContentID
+	case *SHA256ContentIDProvider:
+		return len(stored) == sha256.Size*2 && !strings.Contains(stored, ":")
+	}
+	return strings.HasPrefix(stored, provider.Name()+":")
+}
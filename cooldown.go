@@ -0,0 +1,68 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RunIfDue cleans dirPath unless a successful run started less than
+// minInterval ago, as recorded in stampFile, so it can be called from
+// frequent cron jobs or systemd timers without bookkeeping in the caller.
+// ran reports whether a run took place. The stamp is only updated after a
+// successful run, so a failed run is retried on the next call. A stamp file
+// below dirPath is never deleted. Concurrent calls are not serialized.
+func RunIfDue(dirPath string, config CleaningConfig, minInterval time.Duration, stampFile string) (report CleaningReport, ran bool, err error) {
+	if minInterval < 0 || stampFile == "" {
+		return CleaningReport{}, false, ErrInvalidConfig
+	}
+	now := time.Now()
+	if last, ok := readStamp(stampFile); ok && now.Sub(last) < minInterval && !last.After(now) {
+		return CleaningReport{}, false, nil
+	}
+
+	config.stampFile = stampFile
+	report, err = CleanBackup(dirPath, config)
+	if err != nil {
+		return report, true, err
+	}
+	return report, true, writeStamp(stampFile, now)
+}
+
+// readStamp returns the start of the last successful run recorded in a
+// stamp file. A missing or unreadable stamp makes the run due.
+func readStamp(path string) (time.Time, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	last, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(content)))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return last, true
+}
+
+// writeStamp records the start of a successful run atomically
+func writeStamp(path string, start time.Time) error {
+	return writeFileAtomic(path, []byte(start.Format(time.RFC3339Nano)+"\n"))
+}
+
+// writeFileAtomic replaces the content of path via a temporary file
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,59 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunIfDue(t *testing.T) {
+	tmpDir := t.TempDir()
+	stampFile := filepath.Join(tmpDir, ".last-clean")
+	config := CleaningConfig{
+		MaxSize:  int64Ptr(1),
+		DiskInfo: &failingDiskInfoProvider{},
+	}
+
+	if err := createTestFile(t, filepath.Join(tmpDir, "first.tar"), 4096, time.Now().Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	report, ran, err := RunIfDue(tmpDir, config, time.Hour, stampFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ran || report.DeletedFiles != 1 {
+		t.Fatalf("Expected the first call to run, got ran=%t, %d deleted files", ran, report.DeletedFiles)
+	}
+	if _, err := os.Stat(stampFile); err != nil {
+		t.Fatalf("Expected the stamp file below the target directory to remain: %v", err)
+	}
+
+	// Within the interval the call does nothing
+	if err := createTestFile(t, filepath.Join(tmpDir, "second.tar"), 4096, time.Now().Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ran, err := RunIfDue(tmpDir, config, time.Hour, stampFile); err != nil || ran {
+		t.Errorf("Expected the second call to be skipped, got ran=%t, err=%v", ran, err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "second.tar")); err != nil {
+		t.Errorf("Expected second.tar to remain: %v", err)
+	}
+
+	// Once the interval has passed the call runs again
+	if err := os.WriteFile(stampFile, []byte(time.Now().Add(-2*time.Hour).Format(time.RFC3339Nano)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ran, err := RunIfDue(tmpDir, config, time.Hour, stampFile); err != nil || !ran {
+		t.Errorf("Expected the call to run after the interval, got ran=%t, err=%v", ran, err)
+	}
+
+	// Failed runs do not update the stamp
+	failedStamp := filepath.Join(t.TempDir(), "stamp")
+	if _, ran, err := RunIfDue(filepath.Join(tmpDir, "missing"), config, time.Hour, failedStamp); err == nil || !ran {
+		t.Errorf("Expected a failed run, got ran=%t, err=%v", ran, err)
+	}
+	if _, err := os.Stat(failedStamp); !os.IsNotExist(err) {
+		t.Errorf("Expected no stamp after a failed run, got %v", err)
+	}
+}
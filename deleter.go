@@ -1,77 +1,168 @@
 package gobackupcleaner
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// deletedDirs tracks directories that contained deleted files
+// deletedDirShards is the number of shards of deletedDirs
+const deletedDirShards = 16
+
+// deletedDirs tracks directories that contained deleted files. It is
+// sharded by directory so concurrent deletions rarely contend.
 type deletedDirs struct {
+	shards [deletedDirShards]deletedDirShard
+}
+
+// deletedDirShard is one shard of deletedDirs
+type deletedDirShard struct {
 	mu   sync.Mutex
 	dirs map[string]struct{}
 }
 
 // add adds a directory to the set
 func (d *deletedDirs) add(dir string) {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	d.dirs[dir] = struct{}{}
+	// FNV-1a, without allocating
+	hash := uint32(2166136261)
+	for i := 0; i < len(dir); i++ {
+		hash ^= uint32(dir[i])
+		hash *= 16777619
+	}
+	shard := &d.shards[hash%deletedDirShards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.dirs == nil {
+		shard.dirs = make(map[string]struct{})
+	}
+	shard.dirs[dir] = struct{}{}
 }
 
 // toSlice returns all directories as a slice
 func (d *deletedDirs) toSlice() []string {
-	d.mu.Lock()
-	defer d.mu.Unlock()
-	
-	dirs := make([]string, 0, len(d.dirs))
-	for dir := range d.dirs {
-		dirs = append(dirs, dir)
+	var dirs []string
+	for i := range d.shards {
+		shard := &d.shards[i]
+		shard.mu.Lock()
+		for dir := range shard.dirs {
+			dirs = append(dirs, dir)
+		}
+		shard.mu.Unlock()
 	}
 	return dirs
 }
 
+// deleteRetryDelay is the delay before the first retry of a failed deletion,
+// doubled for each further retry
+const deleteRetryDelay = 100 * time.Millisecond
+
 // deleter handles file deletion operations
 type deleter struct {
-	config        *CleaningConfig
-	blockSize     int64
-	workerCount   int
-	deletedDirs   *deletedDirs
-	mu            sync.Mutex
-	deletedFiles  int
-	deletedSize   int64
-	deletedBlocks int64
-}
-
-// newDeleter creates a new deleter instance
-func newDeleter(config *CleaningConfig, blockSize int64) *deleter {
+	config               *CleaningConfig
+	blockSize            int64
+	sizes                *blockSizes // Block sizes of other file systems (see scanner)
+	workerCount          int
+	workerStats          []WorkerStats
+	timings              opTimings
+	deletedDirs          *deletedDirs
+	startTime            time.Time
+	classifier           *classifier
+	run                  *runState            // State loaded when the run started, nil in tests
+	protected            map[string]struct{}  // Paths that must not be deleted (read-only)
+	thresholds           map[string]time.Time // Per-prefix thresholds in FairShare mode (read-only)
+	removedDirs          []string             // Removed directory paths, bounded by MaxRemovedDirPaths
+	removedDirsTruncated bool
+	classDeleted         map[fileClass]classStats // Deleted priority files per class
+	deletedPaths         map[string]struct{}      // Deleted paths, collected for DirectoryReport and VerifyAfterClean
+	prefixDeleted        map[string]classStats    // Deleted files per prefix in FairShare mode
+	parentTimesMu        sync.Mutex
+	parentTimes          map[string]time.Time // Original mtimes of parent directories
+	mu                   sync.Mutex
+	deletedFiles         atomic.Int64
+	deletedSize          atomic.Int64
+	deletedBlocks        atomic.Int64
+
+	// Volumes and their thresholds with PerVolumeTargets (read-only)
+	volumes          *volumeSet
+	volumeThresholds map[string]time.Time
+	volumeDeleted    map[string]classStats // Deleted files and block sizes per volume
+
+	// Locked files scheduled for deletion at the next reboot (see DeferLockedDeletes)
+	deferredFiles int
+	deferredSize  int64
+
+	droppedErrors int       // Errors not passed to OnError (see errorCollector)
+	watchdog      *watchdog // Set per deletion, nil if WatchdogTimeout is not set
+
+	// Estimates of the plan, for DeleteProgress
+	estimatedFiles int
+	estimatedSize  int64
+
+	// Deleted space the volume may not get back (see Reconciliation)
+	hardLinkedSize atomic.Int64
+	sparseSize     atomic.Int64
+
+	// Size deleted per immediate subdirectory and the files kept beyond
+	// MaxDeletePerDirectory, guarded by mu
+	dirDeleted map[string]int64
+	dirLimited int
+
+	// Files selected by OwnerQuotas (read-only) and the deleted files per
+	// owner, guarded by mu (see OwnerReport)
+	overQuota    map[string]struct{}
+	ownerDeleted map[uint32]classStats
+
+	// Delete the candidates unless they changed since they were planned,
+	// regardless of the thresholds (see Execute)
+	exact bool
+}
+
+// newDeleter creates a new deleter instance for the files below rootPath
+func newDeleter(config *CleaningConfig, run *runState, rootPath string, blockSize int64) *deleter {
+	startTime := time.Now()
 	return &deleter{
-		config:      config,
-		blockSize:   blockSize,
-		workerCount: config.ActualWorkerCount(),
-		deletedDirs: &deletedDirs{
-			dirs: make(map[string]struct{}),
-		},
+		config:        config,
+		run:           run,
+		blockSize:     blockSize,
+		workerCount:   config.ActualWorkerCount(),
+		workerStats:   make([]WorkerStats, config.ActualWorkerCount()),
+		startTime:     startTime,
+		classifier:    newClassifier(config, run, rootPath, startTime),
+		parentTimes:   make(map[string]time.Time),
+		classDeleted:  make(map[fileClass]classStats),
+		deletedPaths:  make(map[string]struct{}),
+		prefixDeleted: make(map[string]classStats),
+		volumeDeleted: make(map[string]classStats),
+		deletedDirs:   &deletedDirs{},
 	}
 }
 
-// deleteFiles deletes files older than the threshold
-func (d *deleter) deleteFiles(rootPath string, threshold time.Time) error {
+// deleteFiles deletes files older than the threshold.
+// Once ctx is done the remaining paths are skipped.
+func (d *deleter) deleteFiles(ctx context.Context, rootPath string, threshold time.Time) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d.watchdog = newWatchdog(d.config.WatchdogTimeout)
 	taskChan := make(chan scanTask, 100)
-	errChan := make(chan error, d.workerCount)
+	errs := newErrorCollector(ErrorTypeDelete, d.config.Callbacks.OnError)
 	var wg sync.WaitGroup
 	var taskWg sync.WaitGroup
 
 	// Start workers
+	d.config.Stats.addWorkers(d.workerCount)
+	defer d.config.Stats.addWorkers(-d.workerCount)
 	for i := 0; i < d.workerCount; i++ {
 		wg.Add(1)
-		go d.worker(taskChan, errChan, threshold, &wg, &taskWg)
+		go d.worker(ctx, i, taskChan, errs, threshold, &wg, &taskWg)
 	}
 
 	// Start with root directory
 	taskWg.Add(1)
-	taskChan <- scanTask{path: rootPath}
+	d.config.Stats.addQueued(1)
+	taskChan <- scanTask{path: rootPath, depth: 0}
 
 	// Close task channel when all tasks are done
 	go func() {
@@ -79,107 +170,457 @@ func (d *deleter) deleteFiles(rootPath string, threshold time.Time) error {
 		close(taskChan)
 	}()
 
-	// Wait for all workers to complete
+	// Wait for all workers to complete and the errors to be reported
+	return d.wait(&wg, errs)
+}
+
+// deleteCandidates deletes only the listed candidates instead of walking the
+// tree. Candidates that were modified since they were listed are skipped.
+func (d *deleter) deleteCandidates(ctx context.Context, candidates []PlanFile, threshold time.Time) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d.watchdog = newWatchdog(d.config.WatchdogTimeout)
+	candidateChan := make(chan PlanFile)
+	errs := newErrorCollector(ErrorTypeDelete, d.config.Callbacks.OnError)
+	var wg sync.WaitGroup
+
+	for i := 0; i < d.workerCount; i++ {
+		wg.Add(1)
+		go func(stats *WorkerStats) {
+			defer wg.Done()
+			for candidate := range candidateChan {
+				start := time.Now()
+				d.watchdog.touch()
+				errs.add(runTask(candidate.Path, func() error {
+					return d.deleteCandidate(ctx, candidate, threshold)
+				}))
+				stats.Tasks++
+				stats.BusyTime += time.Since(start)
+			}
+		}(&d.workerStats[i])
+	}
+
 	go func() {
-		wg.Wait()
-		close(errChan)
+		defer close(candidateChan)
+		for _, candidate := range candidates {
+			if ctx.Err() != nil {
+				return
+			}
+			candidateChan <- candidate
+		}
 	}()
 
-	// Collect errors
+	return d.wait(&wg, errs)
+}
+
+// wait waits for the workers to complete and their errors to be reported,
+// returning the first error. With WatchdogTimeout it gives up once the
+// workers made no progress for that long.
+func (d *deleter) wait(wg *sync.WaitGroup, errs *errorCollector) error {
 	var firstErr error
-	for err := range errChan {
-		if firstErr == nil && err != nil {
-			firstErr = err
-		}
-		if d.config.Callbacks.OnError != nil {
-			d.config.Callbacks.OnError(ErrorInfo{
-				Type:  ErrorTypeDelete,
-				Error: err,
-			})
+	var dropped int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wg.Wait()
+		firstErr, dropped = errs.close()
+	}()
+	if err := d.watchdog.wait(done); err != nil {
+		return err
+	}
+	d.droppedErrors += dropped
+	return firstErr
+}
+
+// deleteCandidate deletes a single listed candidate
+func (d *deleter) deleteCandidate(ctx context.Context, candidate PlanFile, threshold time.Time) error {
+	if d.config.isFilteredOut(d.classifier.root, candidate.Path) {
+		return nil
+	}
+	statStart := time.Now()
+	info, err := d.config.fs().Lstat(candidate.Path)
+	d.timings.addStat(statStart)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
 		}
+		return err
 	}
 
-	return firstErr
+	if d.exact {
+		threshold = candidate.ModTime.Add(time.Nanosecond)
+	}
+	if candidate.IsDir && info.IsDir() {
+		return d.deleteOpaqueDir(ctx, candidate.Path, info, threshold)
+	}
+	if !d.config.isDeletableFile(info) || !info.ModTime().Equal(candidate.ModTime) || d.isProtected(candidate.Path) || d.run.isOpenFile(info) {
+		return nil
+	}
+	class := d.quotaClass(candidate.Path, d.classifier.classifyFile(candidate.Path, info.Size(), info.ModTime()))
+	if shouldDelete(class, info.ModTime(), d.thresholdFor(candidate.Path, false, threshold)) {
+		return d.deleteFile(ctx, candidate.Path, info, class)
+	}
+	return nil
 }
 
 // worker processes deletion tasks
-func (d *deleter) worker(taskChan chan scanTask, errChan chan error, threshold time.Time, wg *sync.WaitGroup, taskWg *sync.WaitGroup) {
+func (d *deleter) worker(ctx context.Context, id int, taskChan chan scanTask, errs *errorCollector, threshold time.Time, wg *sync.WaitGroup, taskWg *sync.WaitGroup) {
 	defer wg.Done()
 
+	stats := &d.workerStats[id]
 	for task := range taskChan {
-		if err := d.processPath(task.path, taskChan, threshold, taskWg); err != nil {
-			errChan <- err
-		}
+		d.config.Stats.addQueued(-1)
+		d.config.Stats.addBusy(1)
+		start := time.Now()
+		// A panic must not skip taskWg.Done, or the traversal never ends
+		errs.add(runTask(task.path, func() error {
+			return d.processPath(ctx, task, taskChan, threshold, taskWg)
+		}))
+		stats.Tasks++
+		stats.BusyTime += time.Since(start)
+		d.config.Stats.addBusy(-1)
 		taskWg.Done()
 	}
 }
 
 // processPath processes a single path for deletion
-func (d *deleter) processPath(path string, taskChan chan scanTask, threshold time.Time, taskWg *sync.WaitGroup) error {
-	info, err := os.Lstat(path) // Use Lstat to detect symlinks
-	if err != nil {
-		if os.IsNotExist(err) {
-			// File already deleted, not an error
-			return nil
+func (d *deleter) processPath(ctx context.Context, task scanTask, taskChan chan scanTask, threshold time.Time, taskWg *sync.WaitGroup) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	d.watchdog.touch()
+
+	path, depth, info := task.path, task.depth, task.info
+	if info == nil {
+		statStart := time.Now()
+		var err error
+		info, err = d.config.fs().Lstat(path) // Use Lstat to detect symlinks
+		d.timings.addStat(statStart)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// File already deleted, not an error
+				return nil
+			}
+			return err
 		}
-		return err
 	}
 
-	// Skip symlinks
-	if info.Mode()&os.ModeSymlink != 0 {
+	// Skip files that were already soft-deleted or silly-renamed by NFS, and
+	// symlinks unless they are deleted
+	if isTombstone(path) || (info.Mode()&os.ModeSymlink != 0 && d.config.Symlinks != SymlinkDelete) || (!info.IsDir() && isSillyRename(info.Name())) {
+		return nil
+	}
+
+	if d.config.isExcluded(d.classifier.root, path) {
 		return nil
 	}
 
 	if info.IsDir() {
-		entries, err := os.ReadDir(path)
+		if _, ok := d.config.repositoryAt(path); ok {
+			return nil
+		}
+	}
+
+	// Directories containing the cleaner's own files are descended into
+	if info.IsDir() && d.config.isOpaqueDir(path, depth, d.run) && !d.run.isArtifact(path, true) {
+		if !d.config.isIncluded(d.classifier.root, path) {
+			return nil
+		}
+		return d.deleteOpaqueDir(ctx, path, info, threshold)
+	} else if info.IsDir() {
+		readDirStart := time.Now()
+		entries, err := d.config.fs().ReadDir(path)
+		d.timings.addReadDir(readDirStart)
 		if err != nil {
 			return err
 		}
 
 		for _, entry := range entries {
-			fullPath := filepath.Join(path, entry.Name())
+			child := scanTask{path: filepath.Join(path, entry.Name()), depth: depth + 1, info: d.config.entryInfo(entry)}
 			taskWg.Add(1)
+			d.config.Stats.addQueued(1)
 			select {
-			case taskChan <- scanTask{path: fullPath}:
+			case taskChan <- child:
 			default:
 				// If channel is full, process synchronously
+				d.config.Stats.addQueued(-1)
 				taskWg.Done()
-				if err := d.processPath(fullPath, taskChan, threshold, taskWg); err != nil {
+				if err := d.processPath(ctx, child, taskChan, threshold, taskWg); err != nil {
 					return err
 				}
 			}
 		}
-	} else if info.Mode().IsRegular() && info.ModTime().Before(threshold) {
-		// Delete file if it's older than threshold
-		size := info.Size()
-		blockSize := calculateBlockSize(size, d.blockSize)
-		
-		if err := os.Remove(path); err != nil {
-			return err
+	} else if d.config.isDeletableFile(info) && !d.run.isArtifact(path, false) && d.config.isIncluded(d.classifier.root, path) && !d.isProtected(path) && !d.run.isOpenFile(info) {
+		// Priority files are deleted regardless of age, others if older than threshold
+		class := d.quotaClass(path, d.classifier.classifyFile(path, info.Size(), info.ModTime()))
+		if shouldDelete(class, info.ModTime(), d.thresholdFor(path, false, threshold)) {
+			return d.deleteFile(ctx, path, info, class)
+		}
+	}
+
+	return nil
+}
+
+// deleteFile deletes a single regular file and records it
+func (d *deleter) deleteFile(ctx context.Context, path string, info os.FileInfo, class fileClass) error {
+	size := info.Size()
+	blockSize := d.spaceOf(path, info)
+	if !d.reserveDirectory(path, false, blockSize) {
+		return nil
+	}
+	if waitBlackout(ctx, d.config.BlackoutWindows) != nil || d.config.RateLimiter.wait(ctx, size) != nil {
+		// The run was canceled while waiting
+		d.releaseDirectory(path, false, blockSize)
+		return nil
+	}
+
+	xattrs := d.config.captureXattrs(path)
+	d.recordParentTime(path)
+	unlinkStart := time.Now()
+	err := d.remove(path, false)
+	d.timings.addUnlink(unlinkStart)
+	if err != nil {
+		d.releaseDirectory(path, false, blockSize)
+		if os.IsNotExist(err) && d.config.ReadDirPlus {
+			// Deleted since its directory was read
+			return nil
 		}
+		if d.deferLocked(path, blockSize, err) {
+			return nil
+		}
+		return err
+	}
 
-		// Track deleted file
-		d.mu.Lock()
-		d.deletedFiles++
-		d.deletedSize += size
-		d.deletedBlocks += blockSize
-		d.mu.Unlock()
+	d.recordDeleted(path, false, class, 1, size, blockSize)
+	d.recordReconciliation(path, info, blockSize)
+	d.recordOwner(info, blockSize)
 
-		// Track parent directory
-		d.deletedDirs.add(filepath.Dir(path))
+	// Track parent directory
+	d.deletedDirs.add(filepath.Dir(path))
 
-		// Call callback
-		callSafe(d.config.Callbacks.OnFileDeleted, FileDeletedInfo{
-			Path:      path,
-			Size:      size,
-			BlockSize: blockSize,
-			ModTime:   info.ModTime(),
-		})
+	// Call callback
+	callSafe(d.config.Callbacks.OnFileDeleted, FileDeletedInfo{
+		Path:        path,
+		Size:        size,
+		BlockSize:   blockSize,
+		ModTime:     info.ModTime(),
+		DisplayPath: d.config.displayPath(path),
+		Progress:    d.progress(),
+		Xattrs:      xattrs,
+	})
+
+	return nil
+}
+
+// deleteOpaqueDir deletes a whole directory treated as a single backup unit
+// if its newest file is older than the threshold
+func (d *deleter) deleteOpaqueDir(ctx context.Context, path string, info os.FileInfo, threshold time.Time) error {
+	if d.isProtected(path) {
+		return nil
+	}
+	summary, err := d.config.summarizeOpaque(path, info, d.spaceOf, d.run)
+	if err != nil {
+		return err
+	}
+	modTime := summary.modTime
+	if modTime.IsZero() {
+		modTime = info.ModTime()
+	}
+	class := d.quotaClass(path, d.classifier.classifyDir(path, summary.size, modTime))
+	if !shouldDelete(class, modTime, d.thresholdFor(path, true, threshold)) {
+		return nil
+	}
+
+	if !d.reserveDirectory(path, true, summary.blockSize) {
+		return nil
+	}
+	if waitBlackout(ctx, d.config.BlackoutWindows) != nil || d.config.RateLimiter.wait(ctx, summary.size) != nil {
+		d.releaseDirectory(path, true, summary.blockSize)
+		return nil
+	}
+	xattrs := d.config.captureXattrs(path)
+	d.recordParentTime(path)
+	if err := d.remove(path, true); err != nil {
+		d.releaseDirectory(path, true, summary.blockSize)
+		return err
 	}
+	d.recordDeleted(path, true, class, summary.files, summary.size, summary.blockSize)
+	d.recordOwner(info, summary.blockSize)
+
+	// Track parent directory
+	d.deletedDirs.add(filepath.Dir(path))
+
+	// Call callback
+	callSafe(d.config.Callbacks.OnFileDeleted, FileDeletedInfo{
+		Path:        path,
+		Size:        summary.size,
+		BlockSize:   summary.blockSize,
+		ModTime:     modTime,
+		IsDir:       true,
+		DisplayPath: d.config.displayPath(path),
+		Progress:    d.progress(),
+		Xattrs:      xattrs,
+	})
 
 	return nil
 }
 
+// thresholdFor returns the threshold of the volume of path with
+// PerVolumeTargets, of its prefix in FairShare mode, or threshold otherwise.
+// Prefixes that were not scanned are not deleted by age.
+func (d *deleter) thresholdFor(path string, isDir bool, threshold time.Time) time.Time {
+	if d.exact {
+		return threshold
+	}
+	if d.volumes != nil {
+		return d.volumeThresholds[d.volumes.of(path)]
+	}
+	if d.thresholds == nil {
+		return threshold
+	}
+	return d.thresholds[topLevelDir(d.classifier.root, path, isDir)]
+}
+
+// spaceOf returns the space accounted for a file
+func (d *deleter) spaceOf(path string, info os.FileInfo) int64 {
+	blockSize := d.blockSize
+	if d.sizes != nil {
+		blockSize = d.sizes.of(path, info)
+	}
+	return d.config.fileSpace(path, info, blockSize)
+}
+
+// reserveDirectory counts blockSize toward the MaxDeletePerDirectory of the
+// immediate subdirectory of path, and reports false, keeping the file, if it
+// would exceed the limit
+func (d *deleter) reserveDirectory(path string, isDir bool, blockSize int64) bool {
+	limit := d.config.MaxDeletePerDirectory
+	if limit <= 0 {
+		return true
+	}
+	dir := topLevelDir(d.classifier.root, path, isDir)
+	if dir == "." {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dirDeleted[dir]+blockSize > limit {
+		d.dirLimited++
+		return false
+	}
+	if d.dirDeleted == nil {
+		d.dirDeleted = make(map[string]int64)
+	}
+	d.dirDeleted[dir] += blockSize
+	return true
+}
+
+// releaseDirectory returns a reservation of a file that was not deleted
+func (d *deleter) releaseDirectory(path string, isDir bool, blockSize int64) {
+	if d.config.MaxDeletePerDirectory <= 0 {
+		return
+	}
+	dir := topLevelDir(d.classifier.root, path, isDir)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.dirDeleted[dir]; ok {
+		d.dirDeleted[dir] -= blockSize
+	}
+}
+
+// isProtected reports whether a path must be kept regardless of age
+func (d *deleter) isProtected(path string) bool {
+	_, ok := d.protected[path]
+	return ok
+}
+
+// recordDeleted tracks deleted files. The totals are atomic, the mutex is
+// only taken when deletions are broken down.
+func (d *deleter) recordDeleted(path string, isDir bool, class fileClass, files int, size, blockSize int64) {
+	d.deletedFiles.Add(int64(files))
+	d.deletedSize.Add(size)
+	d.deletedBlocks.Add(blockSize)
+	d.config.Stats.addDeleted(int64(files), blockSize)
+	if !d.config.DirectoryReport && !d.config.VerifyAfterClean && !d.config.FairShare && d.volumes == nil && class == classNormal {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.config.DirectoryReport || d.config.VerifyAfterClean {
+		d.deletedPaths[path] = struct{}{}
+	}
+	if d.config.FairShare {
+		prefix := topLevelDir(d.classifier.root, path, isDir)
+		stats := d.prefixDeleted[prefix]
+		stats.files += files
+		stats.size += size
+		d.prefixDeleted[prefix] = stats
+	}
+	if d.volumes != nil {
+		root := d.volumes.of(path)
+		stats := d.volumeDeleted[root]
+		stats.files += files
+		stats.size += blockSize
+		d.volumeDeleted[root] = stats
+	}
+	if class != classNormal {
+		stats := d.classDeleted[class]
+		stats.files += files
+		stats.size += size
+		d.classDeleted[class] = stats
+	}
+}
+
+// remove deletes a file or an opaque directory, retrying failures up to
+// DeleteRetries times
+func (d *deleter) remove(path string, isDir bool) error {
+	err := d.removeOnce(path, isDir)
+	for i := 0; err != nil && i < d.config.DeleteRetries; i++ {
+		time.Sleep(deleteRetryDelay << i)
+		err = d.removeOnce(path, isDir)
+		if os.IsNotExist(err) {
+			// An earlier attempt succeeded, but its reply was lost
+			return nil
+		}
+	}
+	return err
+}
+
+// deferLocked schedules the deletion of a file another process has locked
+// at the next reboot with DeferLockedDeletes, reporting whether it is
+// scheduled. Files scheduled by an earlier run are not scheduled or counted
+// again.
+func (d *deleter) deferLocked(path string, blockSize int64, err error) bool {
+	if !d.config.DeferLockedDeletes || d.config.DeleteMode == DeleteModeTombstone || !rebootDeletes.isLocked(err) {
+		return false
+	}
+	if rebootDeletes.isScheduled(path) {
+		// Scheduling it again would add a duplicate entry
+		return true
+	}
+	if rebootDeletes.schedule(path) != nil {
+		return false
+	}
+	d.mu.Lock()
+	d.deferredFiles++
+	d.deferredSize += blockSize
+	d.mu.Unlock()
+	return true
+}
+
+// removeOnce deletes a file or an opaque directory.
+// In soft delete mode it is renamed to a tombstone instead.
+func (d *deleter) removeOnce(path string, isDir bool) error {
+	if d.config.DeleteMode == DeleteModeTombstone {
+		return d.config.fs().Rename(path, tombstonePath(path, d.startTime))
+	}
+	if isDir {
+		return d.config.fs().RemoveAll(path)
+	}
+	return d.config.fs().Remove(path)
+}
+
 // deleteEmptyDirs deletes empty directories
 func (d *deleter) deleteEmptyDirs() (int, error) {
 	if !d.config.RemoveEmptyDirs {
@@ -209,7 +650,9 @@ func (d *deleter) deleteEmptyDirs() (int, error) {
 // deleteEmptyDirRecursive recursively deletes empty directories
 func (d *deleter) deleteEmptyDirRecursive(dir string, deletedCount *int) error {
 	// Check if directory is empty
-	entries, err := os.ReadDir(dir)
+	readDirStart := time.Now()
+	entries, err := d.config.fs().ReadDir(dir)
+	d.timings.addReadDir(readDirStart)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Directory already deleted
@@ -220,15 +663,21 @@ func (d *deleter) deleteEmptyDirRecursive(dir string, deletedCount *int) error {
 
 	if len(entries) == 0 {
 		// Directory is empty, delete it
-		if err := os.Remove(dir); err != nil {
+		d.recordParentTime(dir)
+		unlinkStart := time.Now()
+		err = d.config.fs().Remove(dir)
+		d.timings.addUnlink(unlinkStart)
+		if err != nil {
 			return err
 		}
 
 		(*deletedCount)++
-		
+		d.recordRemovedDir(dir)
+
 		// Call callback
 		callSafe(d.config.Callbacks.OnDirDeleted, DirDeletedInfo{
-			Path: dir,
+			Path:        dir,
+			DisplayPath: d.config.displayPath(dir),
 		})
 
 		// Try to delete parent directory
@@ -241,9 +690,87 @@ func (d *deleter) deleteEmptyDirRecursive(dir string, deletedCount *int) error {
 	return nil
 }
 
-// getStats returns deletion statistics
-func (d *deleter) getStats() (files int, size int64, blocks int64) {
+// recordParentTime remembers the modification time of the parent directory of
+// path before the first deletion inside it, when PreserveParentMTimes is set
+func (d *deleter) recordParentTime(path string) {
+	if !d.config.PreserveParentMTimes {
+		return
+	}
+	parent := filepath.Dir(path)
+
+	d.parentTimesMu.Lock()
+	defer d.parentTimesMu.Unlock()
+	if _, exists := d.parentTimes[parent]; exists {
+		return
+	}
+	// Stat while holding the lock so no other worker deletes from this
+	// directory before its original time is recorded
+	info, err := d.config.fs().Lstat(parent)
+	if err != nil {
+		return
+	}
+	d.parentTimes[parent] = info.ModTime()
+}
+
+// restoreParentTimes restores the recorded modification times of directories
+// that still exist after deletion
+func (d *deleter) restoreParentTimes() {
+	d.parentTimesMu.Lock()
+	defer d.parentTimesMu.Unlock()
+
+	for dir, modTime := range d.parentTimes {
+		// A zero access time leaves the access time unchanged
+		if err := d.config.fs().Chtimes(dir, time.Time{}, modTime); err != nil {
+			if os.IsNotExist(err) {
+				// Directory was removed as empty
+				continue
+			}
+			callSafe(d.config.Callbacks.OnError, ErrorInfo{
+				Type:  ErrorTypeDir,
+				Path:  dir,
+				Error: err,
+			})
+		}
+	}
+}
+
+// recordRemovedDir collects a removed directory path, up to MaxRemovedDirPaths
+func (d *deleter) recordRemovedDir(dir string) {
+	if d.config.MaxRemovedDirPaths <= 0 {
+		return
+	}
+	if len(d.removedDirs) >= d.config.MaxRemovedDirPaths {
+		d.removedDirsTruncated = true
+		return
+	}
+	d.removedDirs = append(d.removedDirs, dir)
+}
+
+// getClassStats returns the deleted files of a priority class
+func (d *deleter) getClassStats(class fileClass) classStats {
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	return d.deletedFiles, d.deletedSize, d.deletedBlocks
-}
\ No newline at end of file
+	return d.classDeleted[class]
+}
+
+// prefixReport adds the deleted files of each prefix to the shares
+func (d *deleter) prefixReport(shares []PrefixShare) []PrefixShare {
+	if shares == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	report := make([]PrefixShare, len(shares))
+	for i, ps := range shares {
+		stats := d.prefixDeleted[ps.Name]
+		ps.DeletedFiles = stats.files
+		ps.DeletedSize = stats.size
+		report[i] = ps
+	}
+	return report
+}
+
+// getStats returns deletion statistics
+func (d *deleter) getStats() (files int, size int64, blocks int64) {
+	return int(d.deletedFiles.Load()), d.deletedSize.Load(), d.deletedBlocks.Load()
+}
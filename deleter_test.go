@@ -0,0 +1,33 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"testing"
+)
+
+// BenchmarkRecordDeleted measures the bookkeeping of concurrent deletions of
+// many small files, excluding the unlink itself
+func BenchmarkRecordDeleted(b *testing.B) {
+	config := CleaningConfig{}
+	config.setDefaults()
+	d := newDeleter(&config, nil, "/backup", 4096)
+	dirs := make([]string, 64)
+	files := make([]string, len(dirs))
+	for i := range dirs {
+		dirs[i] = fmt.Sprintf("/backup/host%d", i)
+		files[i] = dirs[i] + "/backup.tar"
+	}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			d.recordDeleted(files[i%len(files)], false, classNormal, 1, 100, 4096)
+			d.deletedDirs.add(dirs[i%len(dirs)])
+			i++
+		}
+	})
+	if files, _, _ := d.getStats(); files != b.N {
+		b.Fatalf("Expected %d deleted files, got %d", b.N, files)
+	}
+}
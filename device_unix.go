@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package gobackupcleaner
+
+import (
+	"os"
+	"syscall"
+)
+
+// deviceOf returns the device of the file system holding a file
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
+
+// linksOf returns the identity and the number of hard links of a file
+func linksOf(info os.FileInfo) (fileID, uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, 0, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, uint64(stat.Nlink), true
+}
+
+// ownerOf returns the user ID owning a file
+func ownerOf(info os.FileInfo) (uint32, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return stat.Uid, true
+}
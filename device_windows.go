@@ -0,0 +1,24 @@
+//go:build windows
+// +build windows
+
+package gobackupcleaner
+
+import "os"
+
+// deviceOf is not available on Windows, as os.FileInfo does not expose the
+// volume of a file; every file uses the block size of the target directory
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// linksOf is not available on Windows, so every file counts as unique to
+// the snapshot holding it (see SnapshotLayout)
+func linksOf(info os.FileInfo) (fileID, uint64, bool) {
+	return fileID{}, 0, false
+}
+
+// ownerOf is not available on Windows, as os.FileInfo does not expose the
+// owner SID of a file; owners are not reported (see OwnerReport)
+func ownerOf(info os.FileInfo) (uint32, bool) {
+	return 0, false
+}
@@ -0,0 +1,110 @@
+package gobackupcleaner
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirectoryUsage is the usage of an immediate subdirectory of the target
+// directory before and after cleaning (see DirectoryReport)
+type DirectoryUsage struct {
+	Name   string // Subdirectory name, "." for the files directly in the target directory
+	Before DirUsage
+	After  DirUsage
+}
+
+// DirUsage is the size and age range of the files in a directory
+type DirUsage struct {
+	Files     int // Number of files, opaque directories count as one (see MaxDepth)
+	Size      int64
+	BlockSize int64
+	Oldest    time.Time // Oldest modification time, zero if there are no files
+	Newest    time.Time // Newest modification time, zero if there are no files
+}
+
+// add adds a file to the usage
+func (u *DirUsage) add(size, blockSize int64, modTime time.Time) {
+	u.Files++
+	u.Size += size
+	u.BlockSize += blockSize
+	if u.Oldest.IsZero() || modTime.Before(u.Oldest) {
+		u.Oldest = modTime
+	}
+	if modTime.After(u.Newest) {
+		u.Newest = modTime
+	}
+}
+
+// Directories returns the usage of each immediate subdirectory, sorted by name.
+// Nothing is deleted by a scan, so After equals Before.
+func (r *ScanResult) Directories() []DirectoryUsage {
+	usage := make(map[string]*DirectoryUsage)
+	for _, f := range r.Files {
+		name := "."
+		if i := strings.IndexByte(f.Path, '/'); i >= 0 {
+			name = f.Path[:i]
+		} else if f.IsDir {
+			name = f.Path
+		}
+		u := directoryUsage(usage, name)
+		u.Before.add(f.Size, f.BlockSize, f.ModTime)
+		u.After.add(f.Size, f.BlockSize, f.ModTime)
+	}
+	return sortDirectoryUsage(usage)
+}
+
+// summarizeDirectories aggregates the scanned files by immediate subdirectory
+// of rootPath. Files in deleted are only counted before cleaning.
+func summarizeDirectories(rootPath string, files []fileInfo, deleted map[string]struct{}) []DirectoryUsage {
+	usage := make(map[string]*DirectoryUsage)
+	for _, fi := range files {
+		u := directoryUsage(usage, topLevelDir(rootPath, fi.path, fi.isDir))
+		u.Before.add(fi.size, fi.blockSize, fi.modTime)
+		if _, ok := deleted[fi.path]; !ok {
+			u.After.add(fi.size, fi.blockSize, fi.modTime)
+		}
+	}
+	return sortDirectoryUsage(usage)
+}
+
+// topLevelDir returns the name of the immediate subdirectory of rootPath that
+// contains path, or "." for files directly in rootPath. An opaque directory
+// directly in rootPath is such a subdirectory itself.
+func topLevelDir(rootPath, path string, isDir bool) string {
+	rel, err := filepath.Rel(rootPath, path)
+	if err != nil {
+		return "."
+	}
+	rel = filepath.ToSlash(rel)
+	if i := strings.IndexByte(rel, '/'); i >= 0 {
+		return rel[:i]
+	}
+	if isDir {
+		return rel
+	}
+	return "."
+}
+
+// directoryUsage returns the usage of a subdirectory, creating it if needed
+func directoryUsage(usage map[string]*DirectoryUsage, name string) *DirectoryUsage {
+	u, ok := usage[name]
+	if !ok {
+		u = &DirectoryUsage{Name: name}
+		usage[name] = u
+	}
+	return u
+}
+
+// sortDirectoryUsage returns the usage sorted by name
+func sortDirectoryUsage(usage map[string]*DirectoryUsage) []DirectoryUsage {
+	result := make([]DirectoryUsage, 0, len(usage))
+	for _, u := range usage {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,83 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirectoryReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Second)
+	for _, dir := range []string{"host-a", "host-b/daily"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []struct {
+		name    string
+		modTime time.Time
+	}{
+		{"host-a/old.bak", now.Add(-96 * time.Hour)},
+		{"host-a/new.bak", now.Add(-time.Hour)},
+		{"host-b/daily/1.bak", now.Add(-72 * time.Hour)},
+		{"host-b/daily/2.bak", now.Add(-2 * time.Hour)},
+		{"README", now.Add(-3 * time.Hour)},
+	}
+	for _, f := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, f.name), 4096, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Keep the 3 newest files
+	maxSize := int64(3 * 4096)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:         &maxSize,
+		TimeWindow:      time.Hour,
+		DirectoryReport: true,
+		DiskInfo:        &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Directories) != 3 {
+		t.Fatalf("Expected 3 directories, got %+v", report.Directories)
+	}
+	root, hostA, hostB := report.Directories[0], report.Directories[1], report.Directories[2]
+	if root.Name != "." || hostA.Name != "host-a" || hostB.Name != "host-b" {
+		t.Fatalf("Unexpected names %q, %q, %q", root.Name, hostA.Name, hostB.Name)
+	}
+	if hostA.Before.Files != 2 || hostA.Before.Size != 8192 || !hostA.Before.Oldest.Equal(now.Add(-96*time.Hour)) {
+		t.Errorf("Unexpected host-a usage before cleaning: %+v", hostA.Before)
+	}
+	if hostA.After.Files != 1 || !hostA.After.Oldest.Equal(now.Add(-time.Hour)) || !hostA.After.Newest.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Unexpected host-a usage after cleaning: %+v", hostA.After)
+	}
+	if hostB.Before.Files != 2 || hostB.After.Files != 1 {
+		t.Errorf("Unexpected host-b usage: %+v", hostB)
+	}
+	if root.Before.Files != 1 || root.After.Files != 1 {
+		t.Errorf("Unexpected root usage: %+v", root)
+	}
+}
+
+func TestScanResultDirectories(t *testing.T) {
+	modTime := time.Now()
+	result := &ScanResult{Files: []ScannedFile{
+		{Path: "a/x.bak", Size: 1, ModTime: modTime},
+		{Path: "a/y/z.bak", Size: 2, ModTime: modTime.Add(-time.Hour)},
+		{Path: "set", Size: 4, ModTime: modTime, IsDir: true},
+		{Path: "top.bak", Size: 8, ModTime: modTime},
+	}}
+
+	dirs := result.Directories()
+	if len(dirs) != 3 || dirs[0].Name != "." || dirs[1].Name != "a" || dirs[2].Name != "set" {
+		t.Fatalf("Unexpected directories %+v", dirs)
+	}
+	if dirs[1].Before.Size != 3 || !dirs[1].Before.Oldest.Equal(modTime.Add(-time.Hour)) || dirs[1].After != dirs[1].Before {
+		t.Errorf("Unexpected usage of a: %+v", dirs[1])
+	}
+}
@@ -1,11 +1,108 @@
 package gobackupcleaner
 
+import (
+	"fmt"
+	"math"
+	"os"
+)
+
 // DiskUsage represents disk usage information
 type DiskUsage struct {
 	Total       uint64
 	Free        uint64
 	Used        uint64
 	UsedPercent float64
+
+	// Free space available to the caller, limited by per-user quotas on
+	// Windows and excluding the blocks reserved for root on Unix, and free
+	// space of the whole volume (see FreeSpaceScope). Free is FreeForCaller
+	// for the default provider. Zero where not available.
+	FreeForCaller uint64
+	FreeTotal     uint64
+
+	// Raw values reported by the file system, for debugging. The block counts
+	// are in units of FragmentSize (f_frsize). Zero where not available.
+	FragmentSize    uint64
+	TotalBlocks     uint64
+	FreeBlocks      uint64 // Including the blocks reserved for root
+	AvailableBlocks uint64 // Available to unprivileged users
+}
+
+// Validate returns an error wrapping ErrInvalidDiskUsage unless the sizes
+// fit into int64, which the target is computed in, and are consistent with
+// each other. Runs validate the usage reported by their DiskInfoProvider.
+func (u *DiskUsage) Validate() error {
+	for _, v := range []uint64{u.Total, u.Free, u.Used, u.FreeForCaller, u.FreeTotal} {
+		if v > math.MaxInt64 {
+			return fmt.Errorf("%w: %d bytes exceed the supported range", ErrInvalidDiskUsage, v)
+		}
+	}
+	if u.Used > u.Total || u.Free > u.Total || u.FreeForCaller > u.Total || u.FreeTotal > u.Total {
+		return fmt.Errorf("%w: %d bytes used and %d free of %d", ErrInvalidDiskUsage, u.Used, u.Free, u.Total)
+	}
+	if math.IsNaN(u.UsedPercent) || u.UsedPercent < 0 || u.UsedPercent > 100 {
+		return fmt.Errorf("%w: %v%% used", ErrInvalidDiskUsage, u.UsedPercent)
+	}
+	return nil
+}
+
+// reservedSize returns the size of the free blocks reserved for root, or 0
+// where the provider does not report block counts
+func (u *DiskUsage) reservedSize() uint64 {
+	if u.FreeBlocks <= u.AvailableBlocks {
+		return 0
+	}
+	reserved := (u.FreeBlocks - u.AvailableBlocks) * u.FragmentSize
+	if reserved > u.Used || u.FragmentSize != 0 && reserved/u.FragmentSize != u.FreeBlocks-u.AvailableBlocks {
+		return 0
+	}
+	return reserved
+}
+
+// freeSpace returns the free space MinFreeSpace and the other free space
+// constraints are compared with (see FreeSpaceScope). Providers that report
+// neither FreeForCaller nor FreeTotal are taken by Free.
+func (c *CleaningConfig) freeSpace(usage *DiskUsage) uint64 {
+	if c.FreeSpaceScope == FreeSpaceVolume && (usage.FreeTotal != 0 || usage.FreeForCaller != 0) {
+		return usage.FreeTotal
+	}
+	return usage.Free
+}
+
+// percentBase returns the used and total sizes the percent constraints are
+// computed on (see UsageBase)
+func (c *CleaningConfig) percentBase(usage *DiskUsage) (used, total uint64) {
+	if c.UsageBase == UsageBaseUsable {
+		reserved := usage.reservedSize()
+		return usage.Used - reserved, usage.Total - reserved
+	}
+	return usage.Used, usage.Total
+}
+
+// usedPercent returns the used percentage the percent constraints are
+// compared with (see UsageBase)
+func (c *CleaningConfig) usedPercent(usage *DiskUsage) float64 {
+	if c.UsageBase != UsageBaseUsable || usage.reservedSize() == 0 {
+		return usage.UsedPercent
+	}
+	used, total := c.percentBase(usage)
+	if total == 0 {
+		return 0
+	}
+	return float64(used) / float64(total) * 100
+}
+
+// getDiskUsage returns the disk usage of path from provider, or
+// ErrInvalidDiskUsage if the reported values cannot be right
+func getDiskUsage(provider DiskInfoProvider, path string) (*DiskUsage, error) {
+	usage, err := provider.GetDiskUsage(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := usage.Validate(); err != nil {
+		return nil, err
+	}
+	return usage, nil
 }
 
 // DiskInfoProvider is an interface for getting disk information
@@ -14,9 +111,84 @@ type DiskInfoProvider interface {
 	GetBlockSize(path string) (int64, error)
 }
 
+// FileSystemTypeProvider is implemented by DiskInfoProviders that can detect
+// the file system of a path. DefaultDiskInfoProvider implements it.
+type FileSystemTypeProvider interface {
+	GetFileSystemInfo(path string) (FileSystemInfo, error)
+}
+
+// AllocatedSizeProvider is implemented by DiskInfoProviders that can report
+// the space allocated to a file (see SizeModeAllocated).
+// DefaultDiskInfoProvider implements it.
+type AllocatedSizeProvider interface {
+	GetAllocatedSize(path string, info os.FileInfo) (int64, error)
+}
+
+// FileSystemInfo describes the file system of the target directory
+type FileSystemInfo struct {
+	Type    string // File system type, e.g. "ext4", "nfs" or "NTFS"; empty if unknown
+	Network bool   // True for network file systems such as NFS and SMB
+}
+
 // DefaultDiskInfoProvider is the default implementation of DiskInfoProvider
 type DefaultDiskInfoProvider struct{}
 
+// networkFileSystems are the file system types treated as network file systems
+var networkFileSystems = map[string]bool{
+	"nfs":    true,
+	"smb":    true,
+	"smb2":   true,
+	"cifs":   true,
+	"smbfs":  true,
+	"afpfs":  true,
+	"webdav": true,
+	"ceph":   true,
+	"gpfs":   true,
+	"lustre": true,
+	"afs":    true,
+}
+
+// isNetworkFileSystem reports whether a file system type is a network file system
+func isNetworkFileSystem(name string) bool {
+	return networkFileSystems[name]
+}
+
+// detectFileSystem returns the file system of path if the provider can detect
+// it. Detection failures leave the file system unknown.
+func detectFileSystem(provider DiskInfoProvider, path string) FileSystemInfo {
+	detector, ok := provider.(FileSystemTypeProvider)
+	if !ok {
+		return FileSystemInfo{}
+	}
+	info, err := detector.GetFileSystemInfo(path)
+	if err != nil {
+		return FileSystemInfo{}
+	}
+	return info
+}
+
+// StaticDiskInfoProvider reports fixed disk information instead of querying
+// the file system, e.g. to plan a file listing of another machine with
+// PlanFromIndex, or on platforms without disk information such as js/wasm
+type StaticDiskInfoProvider struct {
+	Usage     *DiskUsage // nil reports ErrDiskInfoUnsupported, so only MaxSize applies
+	BlockSize int64      // 0 accounts apparent sizes
+}
+
+// GetDiskUsage returns the configured disk usage
+func (p *StaticDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error) {
+	if p.Usage == nil {
+		return nil, ErrDiskInfoUnsupported
+	}
+	usage := *p.Usage
+	return &usage, nil
+}
+
+// GetBlockSize returns the configured block size
+func (p *StaticDiskInfoProvider) GetBlockSize(path string) (int64, error) {
+	return p.BlockSize, nil
+}
+
 // calculateBlockSize calculates the actual block size used by a file
 func calculateBlockSize(fileSize int64, blockSize int64) int64 {
 	if blockSize <= 0 {
@@ -52,9 +224,35 @@ func GetDiskFreeSpace(dirPath string) (int64, error) {
 //	provider := &CustomDiskInfoProvider{}
 //	freeSpace, err := GetDiskFreeSpaceWithProvider("/backup", provider)
 func GetDiskFreeSpaceWithProvider(dirPath string, provider DiskInfoProvider) (int64, error) {
-	usage, err := provider.GetDiskUsage(dirPath)
+	usage, err := getDiskUsage(provider, dirPath)
 	if err != nil {
 		return 0, err
 	}
 	return int64(usage.Free), nil
 }
+
+// NeedsCleaning reports whether cleaning dirPath with config would delete
+// files to free space, along with the current disk usage. With
+// StartFreeSpace or StartUsagePercent it implements hysteresis: it reports
+// true only below the start level, and cleaning then frees space up to
+// MinFreeSpace or MaxUsagePercent.
+//
+//	needed, usage, err := NeedsCleaning("/backup", config)
+//	if err == nil && needed {
+//	    // Perform cleanup
+//	}
+//
+// Only the disk usage is queried: unlike NewCleaner it neither reads
+// ReferencedList nor reports warnings, so config can still be used for the
+// run.
+func NeedsCleaning(dirPath string, config CleaningConfig) (bool, DiskUsage, error) {
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return false, DiskUsage{}, err
+	}
+	usage, err := getDiskUsage(config.DiskInfo, dirPath)
+	if err != nil {
+		return false, DiskUsage{}, err
+	}
+	return config.hasMaxAge() || needsCleaning(usage, &config), *usage, nil
+}
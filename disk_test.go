@@ -1,8 +1,15 @@
 package gobackupcleaner
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultDiskInfoProvider(t *testing.T) {
@@ -30,6 +37,9 @@ func TestDefaultDiskInfoProvider(t *testing.T) {
 	if usage.UsedPercent < 0 || usage.UsedPercent > 100 {
 		t.Errorf("UsedPercent should be between 0 and 100, got %f", usage.UsedPercent)
 	}
+	if runtime.GOOS != "windows" && usage.Total != usage.TotalBlocks*usage.FragmentSize {
+		t.Errorf("Total should be counted in fragments: %d != %d * %d", usage.Total, usage.TotalBlocks, usage.FragmentSize)
+	}
 
 	// Test block size
 	blockSize, err := provider.GetBlockSize(".")
@@ -122,3 +132,322 @@ func TestDiskInfoProviderWithInvalidPath(t *testing.T) {
 		t.Error("Expected error for non-existent path")
 	}
 }
+
+func TestGetFileSystemInfo(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		t.Skip("file system detection is not supported on this platform")
+	}
+	info, err := (&DefaultDiskInfoProvider{}).GetFileSystemInfo(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Type == "" {
+		t.Error("Expected a file system type")
+	}
+}
+
+// networkDiskInfoProvider reports an NFS file system
+type networkDiskInfoProvider struct {
+	failingDiskInfoProvider
+}
+
+func (n *networkDiskInfoProvider) GetFileSystemInfo(path string) (FileSystemInfo, error) {
+	return FileSystemInfo{Type: "nfs", Network: true}, nil
+}
+
+func TestNetworkTuning(t *testing.T) {
+	for _, noTuning := range []bool{false, true} {
+		tmpDir := t.TempDir()
+		for i, name := range []string{"old.bak", "new.bak"} {
+			modTime := time.Now().Add(-time.Duration(2-i) * time.Hour)
+			if err := createTestFile(t, filepath.Join(tmpDir, name), 100, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var start StartInfo
+		maxSize := int64(100)
+		report, err := CleanBackup(tmpDir, CleaningConfig{
+			MaxSize:         &maxSize,
+			TimeWindow:      time.Minute,
+			NoNetworkTuning: noTuning,
+			DiskInfo:        &networkDiskInfoProvider{},
+			Callbacks:       Callbacks{OnStart: func(info StartInfo) { start = info }},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.FileSystem.Type != "nfs" || !start.FileSystem.Network {
+			t.Errorf("Expected the file system to be reported, got %+v / %+v", report.FileSystem, start.FileSystem)
+		}
+
+		// Apparent sizes fit one file into MaxSize, 4096 byte blocks do not
+		want := 1
+		if noTuning {
+			want = 2
+		}
+		if report.DeletedFiles != want {
+			t.Errorf("NoNetworkTuning=%t: expected %d deleted files, got %d", noTuning, want, report.DeletedFiles)
+		}
+		if !noTuning && len(report.DeleteWorkers) > networkMaxConcurrency {
+			t.Errorf("Expected at most %d workers, got %d", networkMaxConcurrency, len(report.DeleteWorkers))
+		}
+	}
+}
+
+// TestNeedsCleaningBeforeRun tests that checking a configuration leaves its
+// referenced list and warnings to the run
+func TestNeedsCleaningBeforeRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a.pack", "b.pack"} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 100, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var warnings int
+	config := CleaningConfig{
+		MaxSize:        int64Ptr(800),
+		ReferencedList: strings.NewReader("a.pack\n"),
+		DiskInfo:       &StaticDiskInfoProvider{Usage: &DiskUsage{Total: 1000, Used: 850, Free: 150, UsedPercent: 85}},
+		Callbacks:      Callbacks{OnWarning: func(ConfigWarning) { warnings++ }},
+	}
+	needed, _, err := NeedsCleaning(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !needed {
+		t.Fatal("Expected cleaning to be needed")
+	}
+	if warnings != 0 {
+		t.Errorf("Expected no warnings from NeedsCleaning, got %d", warnings)
+	}
+
+	if _, err := CleanBackup(tmpDir, config); err != nil {
+		t.Fatal(err)
+	}
+	if want := len(config.Lint()); warnings != want {
+		t.Errorf("Expected the %d warnings once, got %d", want, warnings)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "a.pack")); err != nil {
+		t.Errorf("Expected the referenced a.pack to remain: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "b.pack")); !os.IsNotExist(err) {
+		t.Error("Expected the unlisted b.pack to be deleted")
+	}
+}
+
+func TestNeedsCleaning(t *testing.T) {
+	tmpDir := t.TempDir()
+	diskInfo := &StaticDiskInfoProvider{
+		Usage:     &DiskUsage{Total: 1000, Used: 850, Free: 150, UsedPercent: 85},
+		BlockSize: 4096,
+	}
+	tests := []struct {
+		name   string
+		config CleaningConfig
+		want   bool
+	}{
+		{"Below MinFreeSpace", CleaningConfig{MinFreeSpace: int64Ptr(200)}, true},
+		{"Above MinFreeSpace", CleaningConfig{MinFreeSpace: int64Ptr(100)}, false},
+		{"Between start and stop levels", CleaningConfig{MinFreeSpace: int64Ptr(200), StartFreeSpace: int64Ptr(100)}, false},
+		{"Below start level", CleaningConfig{MinFreeSpace: int64Ptr(300), StartFreeSpace: int64Ptr(200)}, true},
+		{"Above MaxUsagePercent", CleaningConfig{MaxUsagePercent: float64Ptr(80)}, true},
+		{"Below StartUsagePercent", CleaningConfig{MaxUsagePercent: float64Ptr(80), StartUsagePercent: float64Ptr(90)}, false},
+		{"Above MaxSize", CleaningConfig{MaxSize: int64Ptr(800)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.DiskInfo = diskInfo
+			needed, usage, err := NeedsCleaning(tmpDir, tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if needed != tt.want {
+				t.Errorf("Expected %t, got %t", tt.want, needed)
+			}
+			if usage.Free != 150 {
+				t.Errorf("Expected the disk usage, got %+v", usage)
+			}
+		})
+	}
+
+	// Between the levels nothing is deleted, below the start level cleaning
+	// frees space up to MinFreeSpace
+	for i, name := range []string{"old.bak", "new.bak"} {
+		modTime := time.Now().Truncate(time.Hour).Add(-time.Duration(2-i) * time.Hour)
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 100, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MinFreeSpace:   int64Ptr(200),
+		StartFreeSpace: int64Ptr(100),
+		TimeWindow:     time.Hour,
+		DiskInfo:       diskInfo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 0 {
+		t.Errorf("Expected no deletion above the start level, got %d", report.DeletedFiles)
+	}
+	report, err = CleanBackup(tmpDir, CleaningConfig{
+		MinFreeSpace:   int64Ptr(300),
+		StartFreeSpace: int64Ptr(200),
+		TimeWindow:     time.Hour,
+		DiskInfo:       diskInfo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 {
+		t.Errorf("Expected 1 deleted file below the start level, got %d", report.DeletedFiles)
+	}
+}
+
+func TestTargetFreeSpaceAfterClean(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 4; i++ {
+		modTime := now.Add(-time.Duration(4-i) * time.Hour)
+		if err := createTestFile(t, filepath.Join(tmpDir, fmt.Sprintf("backup%d.bak", i)), 4096, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	diskInfo := &StaticDiskInfoProvider{
+		Usage:     &DiskUsage{Total: 100000, Used: 96000, Free: 4000, UsedPercent: 96},
+		BlockSize: 4096,
+	}
+
+	// The constraint alone needs one file, the target three
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MinFreeSpace:              int64Ptr(8000),
+		TargetFreeSpaceAfterClean: int64Ptr(16000),
+		TimeWindow:                time.Hour,
+		DiskInfo:                  diskInfo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 3 {
+		t.Errorf("Expected 3 deleted files, got %d", report.DeletedFiles)
+	}
+}
+
+func TestDiskUsageValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage DiskUsage
+		valid bool
+	}{
+		{"Consistent", DiskUsage{Total: 1000, Used: 850, Free: 150, UsedPercent: 85}, true},
+		{"Empty", DiskUsage{}, true},
+		{"Beyond int64", DiskUsage{Total: math.MaxUint64, Used: 1 << 63, Free: 1 << 62, UsedPercent: 50}, false},
+		{"More used than total", DiskUsage{Total: 1000, Used: 2000, UsedPercent: 100}, false},
+		{"More free than total", DiskUsage{Total: 1000, Free: 2000}, false},
+		{"Percentage out of range", DiskUsage{Total: 1000, Used: 500, Free: 500, UsedPercent: 150}, false},
+		{"Percentage not a number", DiskUsage{Total: 1000, Used: 500, Free: 500, UsedPercent: math.NaN()}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.usage.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Expected valid usage, got %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidDiskUsage) {
+				t.Errorf("Expected ErrInvalidDiskUsage, got %v", err)
+			}
+		})
+	}
+
+	// A corrupted usage fails the run instead of computing a nonsense target,
+	// even when MaxSize could apply without it
+	tmpDir := t.TempDir()
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.bak"), 100, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:  int64Ptr(0),
+		DiskInfo: &StaticDiskInfoProvider{Usage: &DiskUsage{Total: 1000, Used: math.MaxUint64, UsedPercent: 100}},
+	})
+	if !errors.Is(err, ErrInvalidDiskUsage) {
+		t.Errorf("Expected ErrInvalidDiskUsage, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "old.bak")); err != nil {
+		t.Errorf("Expected old.bak to remain: %v", err)
+	}
+}
+
+// TestUsageBaseUsable tests that percent constraints exclude the blocks
+// reserved for root with UsageBaseUsable
+func TestUsageBaseUsable(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	// 100GB volume with 5GB reserved for root and 10GB available, df shows 85/95
+	usage := &DiskUsage{
+		Total:           100 * gb,
+		Free:            10 * gb,
+		Used:            90 * gb,
+		UsedPercent:     90,
+		FragmentSize:    4096,
+		TotalBlocks:     100 * gb / 4096,
+		FreeBlocks:      15 * gb / 4096,
+		AvailableBlocks: 10 * gb / 4096,
+	}
+
+	total := CleaningConfig{MaxUsagePercent: float64Ptr(89.5)}
+	usable := CleaningConfig{MaxUsagePercent: float64Ptr(89.5), UsageBase: UsageBaseUsable}
+	if !needsCleaning(usage, &total) {
+		t.Error("Expected 90% of the total size to breach 89.5%")
+	}
+	if needsCleaning(usage, &usable) {
+		t.Errorf("Expected %.2f%% of the usable space not to breach 89.5%%", usable.usedPercent(usage))
+	}
+
+	total.MaxUsagePercent, usable.MaxUsagePercent = float64Ptr(80), float64Ptr(80)
+	if size := calculateTargetSize(usage, &total); size != 10*gb {
+		t.Errorf("Expected 10GB to free of the total size, got %d", size)
+	}
+	if size := calculateTargetSize(usage, &usable); size != 9*gb {
+		t.Errorf("Expected 9GB to free of the usable space, got %d", size)
+	}
+
+	// Without block counts there is nothing reserved to exclude
+	usage.FreeBlocks, usage.AvailableBlocks = 0, 0
+	if percent := usable.usedPercent(usage); percent != 90 {
+		t.Errorf("Expected 90%% without block counts, got %v", percent)
+	}
+
+	report, err := CleanBackup(t.TempDir(), CleaningConfig{
+		MaxUsagePercent: float64Ptr(95),
+		UsageBase:       UsageBaseUsable,
+		DiskInfo:        &StaticDiskInfoProvider{Usage: usage},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.UsageBase != UsageBaseUsable {
+		t.Errorf("Expected the report to record the usage base, got %v", report.UsageBase)
+	}
+}
+
+// TestFreeSpaceScope tests that free space constraints compare the free
+// space of the caller or of the whole volume
+func TestFreeSpaceScope(t *testing.T) {
+	// A quota leaves the caller 100 bytes of the 400 free on the volume
+	usage := &DiskUsage{Total: 1000, Used: 600, Free: 100, UsedPercent: 60, FreeForCaller: 100, FreeTotal: 400}
+
+	caller := CleaningConfig{MinFreeSpace: int64Ptr(300)}
+	volume := CleaningConfig{MinFreeSpace: int64Ptr(300), FreeSpaceScope: FreeSpaceVolume}
+	if !needsCleaning(usage, &caller) || calculateTargetSize(usage, &caller) != 200 {
+		t.Error("Expected the quota of the caller to breach MinFreeSpace by 200 bytes")
+	}
+	if needsCleaning(usage, &volume) || calculateTargetSize(usage, &volume) != 0 {
+		t.Error("Expected the free space of the volume not to breach MinFreeSpace")
+	}
+
+	// Providers without the split are taken by Free
+	usage.FreeForCaller, usage.FreeTotal = 0, 0
+	if !needsCleaning(usage, &volume) {
+		t.Error("Expected Free to be used without FreeTotal")
+	}
+}
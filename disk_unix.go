@@ -1,23 +1,27 @@
-//go:build !windows
-// +build !windows
+//go:build !windows && !js && !wasip1
+// +build !windows,!js,!wasip1
 
 package gobackupcleaner
 
 import (
 	"errors"
-	"syscall"
 )
 
 // GetDiskUsage returns disk usage information for the given path
 func (d *DefaultDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error) {
-	var stat syscall.Statfs_t
-	err := syscall.Statfs(path, &stat)
+	stat, err := statfs(path)
 	if err != nil {
 		return nil, err
 	}
+	return usageFromStatfs(stat)
+}
 
-	total := stat.Blocks * uint64(stat.Bsize)
-	free := stat.Bavail * uint64(stat.Bsize)
+// usageFromStatfs computes the disk usage from statfs values
+func usageFromStatfs(stat statfsResult) (*DiskUsage, error) {
+	// Block counts are in units of the fragment size per POSIX
+	total := stat.blocks * stat.fragmentSize
+	free := stat.availableBlocks * stat.fragmentSize
+	volumeFree := stat.freeBlocks * stat.fragmentSize
 	used := total - free
 
 	if total == 0 {
@@ -27,19 +31,43 @@ func (d *DefaultDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error)
 	usedPercent := float64(used) / float64(total) * 100
 
 	return &DiskUsage{
-		Total:       total,
-		Free:        free,
-		Used:        used,
-		UsedPercent: usedPercent,
+		Total:           total,
+		Free:            free,
+		Used:            used,
+		UsedPercent:     usedPercent,
+		FreeForCaller:   free,
+		FreeTotal:       volumeFree,
+		FragmentSize:    stat.fragmentSize,
+		TotalBlocks:     stat.blocks,
+		FreeBlocks:      stat.freeBlocks,
+		AvailableBlocks: stat.availableBlocks,
 	}, nil
 }
 
-// GetBlockSize returns the block size for the given path
+// GetBlockSize returns the block size for the given path, the fragment size
+// in which the file system allocates space
 func (d *DefaultDiskInfoProvider) GetBlockSize(path string) (int64, error) {
-	var stat syscall.Statfs_t
-	err := syscall.Statfs(path, &stat)
+	stat, err := statfs(path)
 	if err != nil {
 		return 0, err
 	}
-	return int64(stat.Bsize), nil
-}
\ No newline at end of file
+	return int64(stat.fragmentSize), nil
+}
+
+// statfsResult holds the values of statfs in the units of POSIX statvfs:
+// the block counts are in units of fragmentSize (f_frsize)
+type statfsResult struct {
+	fragmentSize    uint64
+	blocks          uint64
+	freeBlocks      uint64 // Including the blocks reserved for root
+	availableBlocks uint64 // Available to unprivileged users
+}
+
+// blockCount converts a block count to uint64. Some platforms report
+// negative available blocks when the reserved blocks are in use.
+func blockCount[T int32 | int64 | uint32 | uint64](v T) uint64 {
+	if v < 0 {
+		return 0
+	}
+	return uint64(v)
+}
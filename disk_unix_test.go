@@ -0,0 +1,35 @@
+//go:build !windows && !js && !wasip1
+// +build !windows,!js,!wasip1
+
+package gobackupcleaner
+
+import "testing"
+
+func TestUsageFromStatfs(t *testing.T) {
+	// 1000 fragments of 1024 bytes, 100 of them reserved for root
+	usage, err := usageFromStatfs(statfsResult{
+		fragmentSize:    1024,
+		blocks:          1000,
+		freeBlocks:      400,
+		availableBlocks: 300,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total != 1024000 || usage.Free != 307200 || usage.Used != 716800 || usage.UsedPercent != 70 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+	if usage.FragmentSize != 1024 || usage.FreeBlocks != 400 || usage.AvailableBlocks != 300 {
+		t.Errorf("Unexpected raw fields %+v", usage)
+	}
+	if usage.FreeForCaller != 307200 || usage.FreeTotal != 409600 {
+		t.Errorf("Unexpected free space of the caller and the volume %+v", usage)
+	}
+
+	if _, err := usageFromStatfs(statfsResult{fragmentSize: 4096}); err == nil {
+		t.Error("Expected an error for an empty file system")
+	}
+	if blockCount(int64(-5)) != 0 {
+		t.Error("Expected negative block counts to be clamped")
+	}
+}
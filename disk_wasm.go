@@ -0,0 +1,24 @@
+//go:build js || wasip1
+// +build js wasip1
+
+package gobackupcleaner
+
+import "os"
+
+// WebAssembly has no disk information. Plan against a file listing with
+// Cleaner.PlanFromIndex and a StaticDiskInfoProvider, or with MaxSize.
+
+// GetDiskUsage is not available on WebAssembly
+func (d *DefaultDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error) {
+	return nil, ErrDiskInfoUnsupported
+}
+
+// GetBlockSize is not available on WebAssembly
+func (d *DefaultDiskInfoProvider) GetBlockSize(path string) (int64, error) {
+	return 0, ErrDiskInfoUnsupported
+}
+
+// GetAllocatedSize is not available on WebAssembly
+func (d *DefaultDiskInfoProvider) GetAllocatedSize(path string, info os.FileInfo) (int64, error) {
+	return 0, ErrDiskInfoUnsupported
+}
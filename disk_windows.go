@@ -5,7 +5,6 @@ package gobackupcleaner
 
 import (
 	"errors"
-	"path/filepath"
 	"syscall"
 	"unsafe"
 )
@@ -19,24 +18,25 @@ var (
 	procGetDiskFreeSpace    = kernel32.NewProc("GetDiskFreeSpaceW")
 )
 
-// GetDiskUsage returns disk usage information for the given path
+// GetDiskUsage returns disk usage information for the given path, of the
+// volume backing it (see volumeRoot)
 func (d *DefaultDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error) {
-	absPath, err := filepath.Abs(path)
+	// Non-existent paths fail
+	root, err := volumeRoot(path)
 	if err != nil {
 		return nil, err
 	}
 
-	// For non-existent paths, we should use the path itself to check, not just the volume
-	// Try to get disk info using the path first, then fall back to volume
+	// freeBytesAvailable is limited by the quota of the caller, totalFreeBytes
+	// is the free space of the volume.
 	var freeBytesAvailable, totalBytes, totalFreeBytes uint64
 
 	// Convert path to UTF16 for Windows API
-	pathPtr, err := syscall.UTF16PtrFromString(absPath)
+	pathPtr, err := syscall.UTF16PtrFromString(root)
 	if err != nil {
 		return nil, err
 	}
 
-	// First try with the actual path
 	ret, _, err := procGetDiskFreeSpaceEx.Call(
 		uintptr(unsafe.Pointer(pathPtr)),
 		uintptr(unsafe.Pointer(&freeBytesAvailable)),
@@ -45,7 +45,6 @@ func (d *DefaultDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error)
 	)
 
 	if ret == 0 {
-		// If the path doesn't exist, this should fail
 		return nil, err
 	}
 
@@ -58,29 +57,31 @@ func (d *DefaultDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error)
 	usedPercent := float64(used) / float64(totalBytes) * 100
 
 	return &DiskUsage{
-		Total:       totalBytes,
-		Free:        freeBytesAvailable,
-		Used:        used,
-		UsedPercent: usedPercent,
+		Total:         totalBytes,
+		Free:          freeBytesAvailable,
+		Used:          used,
+		UsedPercent:   usedPercent,
+		FreeForCaller: freeBytesAvailable,
+		FreeTotal:     totalFreeBytes,
 	}, nil
 }
 
-// GetBlockSize returns the block size for the given path
+// GetBlockSize returns the block size for the given path, the cluster size
+// of the volume backing it (see volumeRoot)
 func (d *DefaultDiskInfoProvider) GetBlockSize(path string) (int64, error) {
-	absPath, err := filepath.Abs(path)
+	root, err := volumeRoot(path)
 	if err != nil {
 		return 0, err
 	}
 
 	// Convert path to UTF16 for Windows API
-	pathPtr, err := syscall.UTF16PtrFromString(absPath)
+	pathPtr, err := syscall.UTF16PtrFromString(root)
 	if err != nil {
 		return 0, err
 	}
 
 	var sectorsPerCluster, bytesPerSector, numberOfFreeClusters, totalNumberOfClusters uint32
 
-	// First try with the actual path
 	ret, _, err := procGetDiskFreeSpace.Call(
 		uintptr(unsafe.Pointer(pathPtr)),
 		uintptr(unsafe.Pointer(&sectorsPerCluster)),
@@ -90,7 +91,6 @@ func (d *DefaultDiskInfoProvider) GetBlockSize(path string) (int64, error) {
 	)
 
 	if ret == 0 {
-		// If the path doesn't exist, this should fail
 		return 0, err
 	}
 
@@ -0,0 +1,152 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// CachingDiskInfoProvider caches the disk usage, block size and file system
+// reported by another provider for TTL, as statfs on some network mounts
+// takes hundreds of milliseconds. Failures are cached too, for TTL doubling
+// with each consecutive failure of a path up to MaxBackoff, so an unreachable
+// mount is not queried on every check. It is safe for concurrent use.
+type CachingDiskInfoProvider struct {
+	Provider   DiskInfoProvider
+	TTL        time.Duration
+	MaxBackoff time.Duration // Longest time a failure is cached (default: 16 * TTL)
+
+	mu          sync.Mutex
+	usages      map[string]*diskCacheEntry
+	blockSizes  map[string]*diskCacheEntry
+	fileSystems map[string]*diskCacheEntry
+	now         func() time.Time
+}
+
+// diskCacheEntry is a cached result of the wrapped provider
+type diskCacheEntry struct {
+	value    any
+	err      error
+	expires  time.Time
+	failures int // Consecutive failures
+}
+
+// NewCachingDiskInfoProvider returns a provider caching the results of
+// provider for ttl
+func NewCachingDiskInfoProvider(provider DiskInfoProvider, ttl time.Duration) *CachingDiskInfoProvider {
+	return &CachingDiskInfoProvider{Provider: provider, TTL: ttl}
+}
+
+// GetDiskUsage returns the cached disk usage of path
+func (p *CachingDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error) {
+	value, err := p.get(&p.usages, path, func() (any, error) {
+		return p.Provider.GetDiskUsage(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Callers may modify the usage
+	usage := *value.(*DiskUsage)
+	return &usage, nil
+}
+
+// GetBlockSize returns the cached block size of path
+func (p *CachingDiskInfoProvider) GetBlockSize(path string) (int64, error) {
+	value, err := p.get(&p.blockSizes, path, func() (any, error) {
+		return p.Provider.GetBlockSize(path)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value.(int64), nil
+}
+
+// GetFileSystemInfo returns the cached file system of path if the wrapped
+// provider can detect it
+func (p *CachingDiskInfoProvider) GetFileSystemInfo(path string) (FileSystemInfo, error) {
+	detector, ok := p.Provider.(FileSystemTypeProvider)
+	if !ok {
+		return FileSystemInfo{}, ErrDiskInfoUnsupported
+	}
+	value, err := p.get(&p.fileSystems, path, func() (any, error) {
+		return detector.GetFileSystemInfo(path)
+	})
+	if err != nil {
+		return FileSystemInfo{}, err
+	}
+	return value.(FileSystemInfo), nil
+}
+
+// GetAllocatedSize passes through to the wrapped provider, as it is queried
+// once per file
+func (p *CachingDiskInfoProvider) GetAllocatedSize(path string, info os.FileInfo) (int64, error) {
+	provider, ok := p.Provider.(AllocatedSizeProvider)
+	if !ok {
+		return 0, ErrDiskInfoUnsupported
+	}
+	return provider.GetAllocatedSize(path, info)
+}
+
+// Invalidate drops the cached disk usage, e.g. after files were deleted.
+// Block sizes and file systems do not change and stay cached.
+func (p *CachingDiskInfoProvider) Invalidate() {
+	p.mu.Lock()
+	p.usages = nil
+	p.mu.Unlock()
+}
+
+// get returns the cached result for path, querying the wrapped provider
+// when it expired. The lock is held while querying so concurrent callers
+// wait for one query instead of each stat-ing the volume.
+func (p *CachingDiskInfoProvider) get(cache *map[string]*diskCacheEntry, path string, query func() (any, error)) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.now != nil {
+		now = p.now()
+	}
+	entry, ok := (*cache)[path]
+	if ok && now.Before(entry.expires) {
+		return entry.value, entry.err
+	}
+	if *cache == nil {
+		*cache = make(map[string]*diskCacheEntry)
+	}
+
+	value, err := query()
+	if err != nil {
+		failures := 1
+		if ok && entry.err != nil {
+			failures = entry.failures + 1
+		}
+		(*cache)[path] = &diskCacheEntry{err: err, expires: now.Add(p.backoff(failures)), failures: failures}
+		return nil, err
+	}
+	(*cache)[path] = &diskCacheEntry{value: value, expires: now.Add(p.TTL)}
+	return value, nil
+}
+
+// backoff returns how long a path failing for the given number of
+// consecutive times is not queried again
+func (p *CachingDiskInfoProvider) backoff(failures int) time.Duration {
+	limit := p.MaxBackoff
+	if limit <= 0 {
+		limit = 16 * p.TTL
+	}
+	delay := p.TTL
+	for i := 1; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// invalidateDiskUsage drops the disk usage cached by a CachingDiskInfoProvider
+func invalidateDiskUsage(config *CleaningConfig) {
+	if cache, ok := config.DiskInfo.(*CachingDiskInfoProvider); ok {
+		cache.Invalidate()
+	}
+}
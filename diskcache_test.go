@@ -0,0 +1,125 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// flakyDiskInfoProvider counts the disk usage queries and fails while err is set
+type flakyDiskInfoProvider struct {
+	StaticDiskInfoProvider
+	usageCalls int
+	err        error
+}
+
+func (p *flakyDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error) {
+	p.usageCalls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.StaticDiskInfoProvider.GetDiskUsage(path)
+}
+
+func TestCachingDiskInfoProvider(t *testing.T) {
+	inner := &flakyDiskInfoProvider{StaticDiskInfoProvider: StaticDiskInfoProvider{Usage: &DiskUsage{Total: 100, Free: 40}}}
+	cache := NewCachingDiskInfoProvider(inner, time.Minute)
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		usage, err := cache.GetDiskUsage("/backup")
+		if err != nil || usage.Free != 40 {
+			t.Fatalf("GetDiskUsage = %+v, %v", usage, err)
+		}
+		usage.Free = 0
+	}
+	if inner.usageCalls != 1 {
+		t.Errorf("Expected one query within the TTL, got %d", inner.usageCalls)
+	}
+
+	now = now.Add(time.Minute)
+	cache.GetDiskUsage("/backup")
+	if inner.usageCalls != 2 {
+		t.Errorf("Expected a query after the TTL, got %d", inner.usageCalls)
+	}
+	cache.Invalidate()
+	cache.GetDiskUsage("/backup")
+	if inner.usageCalls != 3 {
+		t.Errorf("Expected a query after Invalidate, got %d", inner.usageCalls)
+	}
+
+	// Failures are retried after TTL, 2 * TTL, 4 * TTL
+	inner.err = errors.New("mount unreachable")
+	now = now.Add(time.Minute)
+	for i, wait := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		calls := inner.usageCalls
+		if _, err := cache.GetDiskUsage("/backup"); err == nil {
+			t.Fatal("Expected the failure to be reported")
+		}
+		now = now.Add(wait - time.Second)
+		if _, err := cache.GetDiskUsage("/backup"); err == nil || inner.usageCalls != calls+1 {
+			t.Fatalf("failure %d: expected the cached failure, got %d queries", i+1, inner.usageCalls-calls)
+		}
+		now = now.Add(time.Second)
+	}
+}
+
+func TestCachingDiskInfoProviderBackoffLimit(t *testing.T) {
+	cache := &CachingDiskInfoProvider{TTL: time.Minute, MaxBackoff: 3 * time.Minute}
+	for failures, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 3 * time.Minute, 10: 3 * time.Minute} {
+		if got := cache.backoff(failures); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+func TestCleanerDiskInfoCacheTTL(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, age := range map[string]time.Duration{"old.tar": 72 * time.Hour, "new.tar": 24 * time.Hour} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 4096, time.Now().Add(-age).Truncate(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inner := &flakyDiskInfoProvider{StaticDiskInfoProvider: StaticDiskInfoProvider{Usage: &DiskUsage{Total: 1 << 30, Free: 1 << 29}}}
+	cleaner, err := NewCleaner(CleaningConfig{
+		MinFreeSpace:     int64Ptr(4096),
+		TimeWindow:       time.Hour,
+		DiskInfo:         inner,
+		DiskInfoCacheTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A scheduler's check and the runs share one query while nothing is deleted
+	if _, _, err := cleaner.NeedsCleaning(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := cleaner.Clean(context.Background(), tmpDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if inner.usageCalls != 1 {
+		t.Errorf("Expected one disk usage query, got %d", inner.usageCalls)
+	}
+
+	// A run that deletes files drops the cached usage
+	inner.Usage = &DiskUsage{Total: 1 << 30, Free: 1024}
+	cleaner.config.DiskInfo.(*CachingDiskInfoProvider).Invalidate()
+	report, err := cleaner.Clean(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 {
+		t.Fatalf("Expected the file to be deleted, got %d files", report.DeletedFiles)
+	}
+	calls := inner.usageCalls
+	cleaner.NeedsCleaning(tmpDir)
+	if inner.usageCalls != calls+1 {
+		t.Errorf("Expected the usage to be queried again after the deletion")
+	}
+}
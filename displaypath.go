@@ -0,0 +1,104 @@
+package gobackupcleaner
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// pathEllipsis replaces the middle of truncated paths
+const pathEllipsis = "…"
+
+// TruncatePath shortens a path to at most width terminal columns for display,
+// replacing its middle with "…" so that both the root and the file name stay
+// visible. Wide characters (CJK, emoji) count as two columns and combining
+// marks as none, and characters are never split. Paths that fit, and widths
+// below 1, return the path unchanged.
+func TruncatePath(path string, width int) string {
+	if width < 1 || StringWidth(path) <= width {
+		return path
+	}
+	if width == 1 {
+		return pathEllipsis
+	}
+
+	// The file name is the more useful end, so it gets two thirds
+	avail := width - 1
+	headWidth := avail / 3
+	tailWidth := avail - headWidth
+
+	head, used := 0, 0
+	for i, r := range path {
+		w := runeWidth(r)
+		if used+w > headWidth {
+			head = i
+			break
+		}
+		used += w
+	}
+	// Give the columns the head could not use to the tail
+	tailWidth += headWidth - used
+
+	tail, used := len(path), 0
+	for tail > head {
+		r, size := utf8.DecodeLastRuneInString(path[:tail])
+		w := runeWidth(r)
+		if used+w > tailWidth {
+			break
+		}
+		used += w
+		tail -= size
+	}
+	// A combining mark must not start the tail without its base character
+	for tail < len(path) {
+		r, size := utf8.DecodeRuneInString(path[tail:])
+		if runeWidth(r) != 0 {
+			break
+		}
+		tail += size
+	}
+	return path[:head] + pathEllipsis + path[tail:]
+}
+
+// StringWidth returns the number of terminal columns a string occupies
+func StringWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// runeWidth returns the number of terminal columns of a character: 0 for
+// combining and zero-width characters, 2 for East Asian wide and fullwidth
+// characters and emoji, 1 otherwise
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf), r == 0:
+		return 0
+	case r >= 0x1100 && r <= 0x115f, // Hangul Jamo
+		r >= 0x2e80 && r <= 0x303e, // CJK radicals, punctuation
+		r >= 0x3041 && r <= 0x33ff, // Kana, CJK compatibility
+		r >= 0x3400 && r <= 0x4dbf, // CJK extension A
+		r >= 0x4e00 && r <= 0x9fff, // CJK unified ideographs
+		r >= 0xa000 && r <= 0xa4cf, // Yi
+		r >= 0xac00 && r <= 0xd7a3, // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff, // CJK compatibility ideographs
+		r >= 0xfe30 && r <= 0xfe4f, // CJK compatibility forms
+		r >= 0xff00 && r <= 0xff60, // Fullwidth forms
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f, // Emoji
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd: // CJK extensions B and later
+		return 2
+	}
+	return 1
+}
+
+// displayPath returns the path delivered to callbacks for display, truncated
+// to DisplayPathWidth, or "" if the option is not set
+func (c *CleaningConfig) displayPath(path string) string {
+	if c.DisplayPathWidth <= 0 {
+		return ""
+	}
+	return TruncatePath(path, c.DisplayPathWidth)
+}
@@ -0,0 +1,68 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTruncatePath(t *testing.T) {
+	tests := []struct {
+		path  string
+		width int
+		want  string
+	}{
+		{"/backup/a.tar", 20, "/backup/a.tar"},
+		{"/backup/a.tar", 0, "/backup/a.tar"},
+		{"/backup/hosts/web01/2024/01/a.tar", 16, "/back…4/01/a.tar"},
+		{"/backup/hosts/web01/2024/01/a.tar", 1, "…"},
+		// Wide characters take two columns and are never split
+		{"/バックアップ/ホスト/ファイル.tar", 16, "/バッ…ァイル.tar"},
+		// A combining mark stays with its base character
+		{"/backup/cafe\u0301.tar", 7, "/b….tar"},
+	}
+	for _, tt := range tests {
+		got := TruncatePath(tt.path, tt.width)
+		if got != tt.want {
+			t.Errorf("TruncatePath(%q, %d) = %q, want %q", tt.path, tt.width, got, tt.want)
+		}
+		if tt.width > 0 && StringWidth(got) > tt.width {
+			t.Errorf("TruncatePath(%q, %d) = %q is %d columns wide", tt.path, tt.width, got, StringWidth(got))
+		}
+	}
+}
+
+func TestDisplayPathWidth(t *testing.T) {
+	tmpDir := t.TempDir()
+	deep := filepath.Join(tmpDir, strings.Repeat("nested-directory/", 10))
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(deep, "backup.tar"), 4096, time.Now().Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []FileDeletedInfo
+	_, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:          int64Ptr(1),
+		DisplayPathWidth: 40,
+		DiskInfo:         &failingDiskInfoProvider{},
+		Callbacks: Callbacks{
+			OnFileDeleted: func(info FileDeletedInfo) { files = append(files, info) },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 deleted file, got %d", len(files))
+	}
+	if files[0].Path != filepath.Join(deep, "backup.tar") {
+		t.Errorf("Expected the full path, got %s", files[0].Path)
+	}
+	if StringWidth(files[0].DisplayPath) > 40 || !strings.HasSuffix(files[0].DisplayPath, "backup.tar") {
+		t.Errorf("Expected a truncated path ending with the file name, got %s", files[0].DisplayPath)
+	}
+}
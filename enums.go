@@ -0,0 +1,248 @@
+package gobackupcleaner
+
+import "fmt"
+
+// DeleteMode selects how files are deleted
+type DeleteMode int
+
+const (
+	// DeleteModeRemove removes files (default)
+	DeleteModeRemove DeleteMode = iota
+	// DeleteModeTombstone renames files to "<name>.deleted-<timestamp>" instead
+	// of removing them (see PurgeTombstones)
+	DeleteModeTombstone
+)
+
+var deleteModeNames = []string{"remove", "tombstone"}
+
+// SymlinkPolicy selects how symbolic links are handled. Links are never followed.
+type SymlinkPolicy int
+
+const (
+	// SymlinkSkip ignores symbolic links (default)
+	SymlinkSkip SymlinkPolicy = iota
+	// SymlinkDelete treats symbolic links like files, deleting the links
+	// themselves by their own modification time
+	SymlinkDelete
+)
+
+var symlinkPolicyNames = []string{"skip", "delete"}
+
+// SizeMode selects how the space used by a file is accounted
+type SizeMode int
+
+const (
+	// SizeModeBlock rounds file sizes up to the file system block size,
+	// matching the space actually freed (default)
+	SizeModeBlock SizeMode = iota
+	// SizeModeApparent uses file sizes as reported, e.g. for quotas that
+	// count apparent sizes
+	SizeModeApparent
+	// SizeModeAllocated uses the space the file system allocated to each file
+	// (st_blocks on Unix, the compressed size on Windows), so sparse and
+	// NTFS-compressed files count the space they really free. Providers that
+	// do not implement AllocatedSizeProvider fall back to SizeModeBlock.
+	SizeModeAllocated
+)
+
+var sizeModeNames = []string{"block", "apparent", "allocated"}
+
+// UsageBase selects the size MaxUsagePercent and the other percent
+// constraints are computed on
+type UsageBase int
+
+const (
+	// UsageBaseTotal computes percents of the total size, counting the
+	// blocks reserved for root as used (default)
+	UsageBaseTotal UsageBase = iota
+	// UsageBaseUsable computes percents of the space available to
+	// unprivileged users, used plus available, matching df. On ext4 the
+	// reserved blocks otherwise stop cleaning about 5% earlier.
+	UsageBaseUsable
+)
+
+var usageBaseNames = []string{"total", "usable"}
+
+// FreeSpaceScope selects the free space MinFreeSpace and the other free
+// space constraints are compared with
+type FreeSpaceScope int
+
+const (
+	// FreeSpaceCaller uses the free space available to the caller, limited
+	// by its quota on Windows (default)
+	FreeSpaceCaller FreeSpaceScope = iota
+	// FreeSpaceVolume uses the free space of the whole volume, e.g. when the
+	// backup service account has a quota but the volume must stay healthy
+	FreeSpaceVolume
+)
+
+var freeSpaceScopeNames = []string{"caller", "volume"}
+
+// EvictionStrategy selects which files age-based deletion takes
+type EvictionStrategy int
+
+const (
+	// EvictionOldestFirst deletes the oldest files until the target is met (default)
+	EvictionOldestFirst EvictionStrategy = iota
+	// EvictionAgeWeighted deletes files picked at random, each with a
+	// probability weighted by its age, until the target is met. Older files
+	// are more likely to go, giving a smoother retention tail than a hard
+	// cutoff, e.g. for cache-like staging areas.
+	EvictionAgeWeighted
+	// EvictionRestoreTestedFirst deletes the backups successfully restore
+	// tested since they were last modified first, oldest first, then the
+	// others, oldest first (see RestoreTested)
+	EvictionRestoreTestedFirst
+)
+
+var evictionStrategyNames = []string{"oldest-first", "age-weighted", "restore-tested-first"}
+
+// ExportFormat selects the file format of ScanResult.Export
+type ExportFormat int
+
+const (
+	// ExportCSV writes one row per file with a header row
+	ExportCSV ExportFormat = iota
+	// ExportNcdu writes the directory tree in ncdu's JSON export format,
+	// to browse it with "ncdu -f <file>"
+	ExportNcdu
+)
+
+var exportFormatNames = []string{"csv", "ncdu"}
+
+var ruleActionNames = []string{"age-based", "delete", "keep", "protect"}
+
+var alertMetricNames = []string{"freed-size", "deleted-files", "scan-duration", "retention"}
+
+func (m DeleteMode) String() string    { return enumString(deleteModeNames, int(m)) }
+func (p SymlinkPolicy) String() string { return enumString(symlinkPolicyNames, int(p)) }
+func (m SizeMode) String() string      { return enumString(sizeModeNames, int(m)) }
+func (b UsageBase) String() string     { return enumString(usageBaseNames, int(b)) }
+func (a RuleAction) String() string    { return enumString(ruleActionNames, int(a)) }
+func (f ExportFormat) String() string  { return enumString(exportFormatNames, int(f)) }
+func (m AlertMetric) String() string   { return enumString(alertMetricNames, int(m)) }
+
+func (s EvictionStrategy) String() string { return enumString(evictionStrategyNames, int(s)) }
+func (s FreeSpaceScope) String() string   { return enumString(freeSpaceScopeNames, int(s)) }
+
+// MarshalText implements encoding.TextMarshaler
+func (m DeleteMode) MarshalText() ([]byte, error) {
+	return enumMarshal(deleteModeNames, int(m), "delete mode")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (m *DeleteMode) UnmarshalText(text []byte) error {
+	return enumUnmarshal(deleteModeNames, text, "delete mode", (*int)(m))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (p SymlinkPolicy) MarshalText() ([]byte, error) {
+	return enumMarshal(symlinkPolicyNames, int(p), "symlink policy")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (p *SymlinkPolicy) UnmarshalText(text []byte) error {
+	return enumUnmarshal(symlinkPolicyNames, text, "symlink policy", (*int)(p))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (m SizeMode) MarshalText() ([]byte, error) {
+	return enumMarshal(sizeModeNames, int(m), "size mode")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (m *SizeMode) UnmarshalText(text []byte) error {
+	return enumUnmarshal(sizeModeNames, text, "size mode", (*int)(m))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (b UsageBase) MarshalText() ([]byte, error) {
+	return enumMarshal(usageBaseNames, int(b), "usage base")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (b *UsageBase) UnmarshalText(text []byte) error {
+	return enumUnmarshal(usageBaseNames, text, "usage base", (*int)(b))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s FreeSpaceScope) MarshalText() ([]byte, error) {
+	return enumMarshal(freeSpaceScopeNames, int(s), "free space scope")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *FreeSpaceScope) UnmarshalText(text []byte) error {
+	return enumUnmarshal(freeSpaceScopeNames, text, "free space scope", (*int)(s))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s EvictionStrategy) MarshalText() ([]byte, error) {
+	return enumMarshal(evictionStrategyNames, int(s), "eviction strategy")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *EvictionStrategy) UnmarshalText(text []byte) error {
+	return enumUnmarshal(evictionStrategyNames, text, "eviction strategy", (*int)(s))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (a RuleAction) MarshalText() ([]byte, error) {
+	return enumMarshal(ruleActionNames, int(a), "rule action")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (a *RuleAction) UnmarshalText(text []byte) error {
+	return enumUnmarshal(ruleActionNames, text, "rule action", (*int)(a))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (f ExportFormat) MarshalText() ([]byte, error) {
+	return enumMarshal(exportFormatNames, int(f), "export format")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (f *ExportFormat) UnmarshalText(text []byte) error {
+	return enumUnmarshal(exportFormatNames, text, "export format", (*int)(f))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (m AlertMetric) MarshalText() ([]byte, error) {
+	return enumMarshal(alertMetricNames, int(m), "alert metric")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (m *AlertMetric) UnmarshalText(text []byte) error {
+	return enumUnmarshal(alertMetricNames, text, "alert metric", (*int)(m))
+}
+
+// enumString returns the name of an enum value
+func enumString(names []string, v int) string {
+	if v < 0 || v >= len(names) {
+		return fmt.Sprintf("unknown(%d)", v)
+	}
+	return names[v]
+}
+
+// enumMarshal returns the name of an enum value, failing for unknown values
+func enumMarshal(names []string, v int, kind string) ([]byte, error) {
+	if v < 0 || v >= len(names) {
+		return nil, fmt.Errorf("invalid %s %d", kind, v)
+	}
+	return []byte(names[v]), nil
+}
+
+// enumUnmarshal parses the name of an enum value
+func enumUnmarshal(names []string, text []byte, kind string, v *int) error {
+	for i, name := range names {
+		if string(text) == name {
+			*v = i
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid %s %q", kind, text)
+}
+
+// validEnum reports whether an enum value is known
+func validEnum(names []string, v int) bool {
+	return v >= 0 && v < len(names)
+}
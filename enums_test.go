@@ -0,0 +1,96 @@
+package gobackupcleaner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnumJSON(t *testing.T) {
+	type policy struct {
+		DeleteMode DeleteMode
+		Symlinks   SymlinkPolicy
+		SizeMode   SizeMode
+		Action     RuleAction
+	}
+	in := policy{DeleteModeTombstone, SymlinkDelete, SizeModeApparent, RuleProtect}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"DeleteMode":"tombstone","Symlinks":"delete","SizeMode":"apparent","Action":"protect"}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	var out policy
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("Expected %+v after round trip, got %+v", in, out)
+	}
+
+	if err := json.Unmarshal([]byte(`{"SizeMode":"blocks"}`), &out); err == nil {
+		t.Error("Expected an unknown size mode to fail")
+	}
+	if _, err := json.Marshal(policy{DeleteMode: 5}); err == nil {
+		t.Error("Expected an unknown delete mode to fail to marshal")
+	}
+	if s := DeleteMode(5).String(); s != "unknown(5)" {
+		t.Errorf("Unexpected string for unknown value: %s", s)
+	}
+}
+
+// TestSymlinkDelete tests that symlinks are deleted themselves without following them
+func TestSymlinkDelete(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-symlink-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+	outsideDir, err := os.MkdirTemp("", "backup-cleaner-symlink-target-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(outsideDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	target := filepath.Join(outsideDir, "target.dat")
+	if err := createTestFile(t, target, 1024, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(tmpDir, "link.dat")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	maxSize := int64(0)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:    &maxSize,
+		TimeWindow: time.Hour,
+		Symlinks:   SymlinkDelete,
+		DiskInfo:   &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 {
+		t.Errorf("Expected the symlink to be deleted, deleted %d files", report.DeletedFiles)
+	}
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Error("Expected the symlink to be deleted")
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("Expected the link target to remain: %v", err)
+	}
+}
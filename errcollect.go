@@ -0,0 +1,72 @@
+package gobackupcleaner
+
+import "sync"
+
+// errorBufferSize is the number of worker errors buffered for the OnError
+// callback. Errors arriving while the buffer is full are dropped.
+const errorBufferSize = 1024
+
+// errorCollector passes the errors of scan and delete workers to the OnError
+// callback from a goroutine of its own, so a slow callback does not stall the
+// workers. Errors arriving while errorBufferSize errors are pending are only
+// counted. The first error is kept even if it was dropped.
+type errorCollector struct {
+	errorType ErrorType
+	onError   func(ErrorInfo)
+	errs      chan error
+	done      chan struct{}
+
+	mu      sync.Mutex
+	first   error
+	dropped int
+}
+
+// newErrorCollector starts reporting the collected errors as errorType
+func newErrorCollector(errorType ErrorType, onError func(ErrorInfo)) *errorCollector {
+	c := &errorCollector{
+		errorType: errorType,
+		onError:   onError,
+		errs:      make(chan error, errorBufferSize),
+		done:      make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		for err := range c.errs {
+			callSafe(c.onError, ErrorInfo{
+				Type:  c.errorType,
+				Error: err,
+			})
+		}
+	}()
+	return c
+}
+
+// add collects err without blocking
+func (c *errorCollector) add(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	if c.first == nil {
+		c.first = err
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.errs <- err:
+	default:
+		c.mu.Lock()
+		c.dropped++
+		c.mu.Unlock()
+	}
+}
+
+// close waits until the pending errors were reported and returns the first
+// error and the number of errors dropped. No error may be added afterwards.
+func (c *errorCollector) close() (first error, dropped int) {
+	close(c.errs)
+	<-c.done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.first, c.dropped
+}
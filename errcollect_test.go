@@ -0,0 +1,48 @@
+package gobackupcleaner
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestErrorCollectorDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	var reported []error
+	c := newErrorCollector(ErrorTypeDelete, func(info ErrorInfo) {
+		<-release
+		if info.Type != ErrorTypeDelete {
+			t.Errorf("Expected delete errors, got %s", info.Type)
+		}
+		reported = append(reported, info.Error)
+	})
+
+	// The callback blocks until released, so all but errorBufferSize + 1
+	// errors must be dropped instead of blocking the workers
+	total := errorBufferSize * 3
+	first := errors.New("first")
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		c.add(first)
+		c.add(nil)
+		for i := 1; i < total; i++ {
+			c.add(fmt.Errorf("error %d", i))
+		}
+	}()
+	select {
+	case <-added:
+	case <-time.After(10 * time.Second):
+		t.Fatal("add blocked behind a slow callback")
+	}
+	close(release)
+
+	err, dropped := c.close()
+	if err != first {
+		t.Errorf("Expected the first error, got %v", err)
+	}
+	if dropped == 0 || len(reported)+dropped != total {
+		t.Errorf("Expected %d errors reported or dropped, got %d reported and %d dropped", total, len(reported), dropped)
+	}
+}
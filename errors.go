@@ -14,4 +14,45 @@ var (
 
 	// ErrInsufficientSpace is returned when enough space cannot be freed
 	ErrInsufficientSpace = errors.New("cannot free enough space")
+
+	// ErrInvalidIndex is returned when a file index passed to CleanFromIndex is invalid
+	ErrInvalidIndex = errors.New("invalid file index")
+
+	// ErrDiskInfoUnsupported is returned by DefaultDiskInfoProvider on
+	// platforms where disk information is not available
+	ErrDiskInfoUnsupported = errors.New("disk information not available on this platform")
+
+	// ErrContentIDUnsupported is returned by a ContentIDProvider that cannot
+	// identify the content of a file
+	ErrContentIDUnsupported = errors.New("content identifier not available")
+
+	// ErrEmptyReferencedList is returned when the referenced list is empty,
+	// which would make every file eligible for deletion
+	ErrEmptyReferencedList = errors.New("referenced list is empty")
+
+	// ErrNotDeleted is reported by VerifyAfterClean for a deleted file that
+	// is still present after the run
+	ErrNotDeleted = errors.New("file still present after deletion")
+
+	// ErrWatchdogTimeout is returned when the workers of a run made no
+	// progress for WatchdogTimeout
+	ErrWatchdogTimeout = errors.New("no progress within the watchdog timeout")
+
+	// ErrInvalidDiskUsage is returned when a DiskInfoProvider reports disk
+	// usage that cannot be right, e.g. sizes beyond the range of int64 from
+	// corrupted statfs values or more space used than the volume has
+	ErrInvalidDiskUsage = errors.New("invalid disk usage")
+
+	// ErrPlanMismatch is returned when a plan is executed by a Cleaner with a
+	// configuration other than the one the plan was computed with
+	ErrPlanMismatch = errors.New("plan was computed with another configuration")
+
+	// ErrPlanNotExecutable is returned by CleaningPlan.Execute for plans not
+	// computed by a Cleaner in this process, e.g. decoded from JSON; execute
+	// them with Cleaner.Execute
+	ErrPlanNotExecutable = errors.New("plan has no cleaner to execute it")
+
+	// ErrXattrUnsupported is returned when extended attributes (alternate
+	// data streams on Windows) cannot be read on this platform
+	ErrXattrUnsupported = errors.New("extended attributes not available on this platform")
 )
\ No newline at end of file
@@ -0,0 +1,222 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EstimateOptions controls the sampling of Estimate
+type EstimateOptions struct {
+	// SampleRate is the fraction of subdirectories visited at each level
+	// (default: 0.1). At least one subdirectory is always visited.
+	SampleRate float64
+	// Seed makes the sample reproducible. 0 uses the current time.
+	Seed int64
+}
+
+// CleaningEstimate is an estimate of what a cleaning run would delete,
+// extrapolated from a sample of the directory tree
+type CleaningEstimate struct {
+	DirPath    string
+	TargetSize int64 // Size to be deleted in bytes (-1 when computed from MaxSize only)
+
+	// Sample information
+	SampledDirs  int           // Number of directories read
+	SampledFiles int           // Number of files stat'ed
+	Duration     time.Duration // Time spent sampling
+
+	// Extrapolated totals
+	EstimatedTotalFiles int64
+	EstimatedTotalSize  int64 // Block-aligned size in bytes
+
+	// Recommendation
+	RecommendedThreshold time.Time // Files older than this would be deleted
+	EstimatedFiles       int64     // Estimated number of files to delete
+	EstimatedSize        int64     // Estimated block-aligned size to delete
+}
+
+// sampledSlot holds the extrapolated number of files of a time slot
+type sampledSlot struct {
+	slot  *timeSlot
+	files float64
+}
+
+// estimator walks a sample of the directory tree
+type estimator struct {
+	config    *CleaningConfig
+	blockSize int64
+	rate      float64
+	rand      *rand.Rand
+	slots     map[time.Time]*sampledSlot
+	dirs      int
+	files     int
+}
+
+// Estimate stats a random sample of the directory tree and extrapolates the
+// age and size distribution to recommend a time threshold within seconds,
+// without scanning every file. At each level only SampleRate of the
+// subdirectories are visited and their files are weighted accordingly, so the
+// estimate is accurate when backups are spread evenly across directories.
+// Nothing is deleted.
+func Estimate(dirPath string, config CleaningConfig, opts EstimateOptions) (*CleaningEstimate, error) {
+	return EstimateContext(context.Background(), dirPath, config, opts)
+}
+
+// EstimateContext is like Estimate, but stops sampling with the context
+// error once ctx is done
+func EstimateContext(ctx context.Context, dirPath string, config CleaningConfig, opts EstimateOptions) (*CleaningEstimate, error) {
+	startTime := time.Now()
+
+	config.setDefaults()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if opts.SampleRate == 0 {
+		opts.SampleRate = 0.1
+	}
+	if opts.SampleRate < 0 || opts.SampleRate > 1 {
+		return nil, ErrInvalidConfig
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	if err := checkDir(config.fs(), dirPath); err != nil {
+		return nil, err
+	}
+	targetSize, _, err := resolveTarget(dirPath, &config)
+	if err != nil {
+		return nil, err
+	}
+	blockSize, err := config.blockSize(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &estimator{
+		config:    &config,
+		blockSize: config.accountingBlockSize(blockSize),
+		rate:      opts.SampleRate,
+		rand:      rand.New(rand.NewSource(opts.Seed)),
+		slots:     make(map[time.Time]*sampledSlot),
+	}
+	if err := e.sample(ctx, dirPath, 1); err != nil {
+		return nil, err
+	}
+
+	estimate := &CleaningEstimate{
+		DirPath:      dirPath,
+		TargetSize:   targetSize,
+		SampledDirs:  e.dirs,
+		SampledFiles: e.files,
+	}
+
+	slots := make([]*timeSlot, 0, len(e.slots))
+	var totalFiles float64
+	for _, s := range e.slots {
+		slots = append(slots, s.slot)
+		totalFiles += s.files
+		estimate.EstimatedTotalSize += s.slot.totalBlockSize
+	}
+	sortTimeSlots(slots)
+	estimate.EstimatedTotalFiles = int64(math.Round(totalFiles))
+
+	var threshold time.Time
+	if targetSize == -1 && config.MaxSize != nil {
+		threshold, _, estimate.EstimatedSize = calculateThresholdForMaxSize(slots, *config.MaxSize)
+	} else if targetSize > 0 {
+		threshold, _, estimate.EstimatedSize = calculateThreshold(slots, targetSize)
+	}
+	estimate.RecommendedThreshold = threshold
+
+	// Slot file counts are extrapolated, so count them here
+	var files float64
+	for _, s := range e.slots {
+		if s.slot.time.Before(threshold) {
+			files += s.files
+		}
+	}
+	estimate.EstimatedFiles = int64(math.Round(files))
+	estimate.Duration = time.Since(startTime)
+
+	return estimate, nil
+}
+
+// sample reads a directory and visits a random subset of its subdirectories.
+// weight is the number of directories this one stands for.
+func (e *estimator) sample(ctx context.Context, path string, weight float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entries, err := e.config.fs().ReadDir(path)
+	if err != nil {
+		if e.dirs == 0 {
+			return err
+		}
+		// Skip unreadable directories below the root
+		callSafe(e.config.Callbacks.OnError, ErrorInfo{
+			Type:  ErrorTypeScan,
+			Path:  path,
+			Error: err,
+		})
+		return nil
+	}
+	e.dirs++
+
+	var subdirs []string
+	for _, entry := range entries {
+		fullPath := filepath.Join(path, entry.Name())
+		if isTombstone(fullPath) || isSillyRename(entry.Name()) {
+			continue
+		}
+		if entry.IsDir() {
+			subdirs = append(subdirs, fullPath)
+			continue
+		}
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		e.files++
+		e.addFile(info.ModTime(), info.Size(), weight)
+	}
+
+	if len(subdirs) == 0 {
+		return nil
+	}
+	n := len(subdirs)
+	k := int(math.Ceil(float64(n) * e.rate))
+	if k < 1 {
+		k = 1
+	}
+	subWeight := weight * float64(n) / float64(k)
+	for _, i := range e.rand.Perm(n)[:k] {
+		if err := e.sample(ctx, subdirs[i], subWeight); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFile adds a weighted file to its time slot
+func (e *estimator) addFile(modTime time.Time, size int64, weight float64) {
+	slotTime := modTime.Truncate(e.config.TimeWindow)
+	s, exists := e.slots[slotTime]
+	if !exists {
+		s = &sampledSlot{slot: &timeSlot{time: slotTime}}
+		e.slots[slotTime] = s
+	}
+	s.files += weight
+	s.slot.totalSize += int64(float64(size) * weight)
+	s.slot.totalBlockSize += int64(float64(calculateBlockSize(size, e.blockSize)) * weight)
+}
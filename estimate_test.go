@@ -0,0 +1,65 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestEstimate tests that a sampled estimate extrapolates evenly spread backups
+func TestEstimate(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-estimate-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	// 10 directories with an old and a recent backup each
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		dir := filepath.Join(tmpDir, fmt.Sprintf("host%02d", i))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(t, filepath.Join(dir, "old.dat"), 1024*1024, now.Add(-72*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(t, filepath.Join(dir, "recent.dat"), 1024*1024, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	maxSize := int64(10 * 1024 * 1024)
+	estimate, err := Estimate(tmpDir, CleaningConfig{
+		MaxSize:    &maxSize,
+		TimeWindow: time.Hour,
+		DiskInfo:   &failingDiskInfoProvider{},
+	}, EstimateOptions{SampleRate: 0.2, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if estimate.SampledDirs != 3 || estimate.SampledFiles != 4 {
+		t.Errorf("Expected 3 directories and 4 files to be sampled, got %d and %d", estimate.SampledDirs, estimate.SampledFiles)
+	}
+	if estimate.EstimatedTotalFiles != 20 || estimate.EstimatedTotalSize != 20*1024*1024 {
+		t.Errorf("Expected 20 files of 20MB in total, got %d files of %d bytes", estimate.EstimatedTotalFiles, estimate.EstimatedTotalSize)
+	}
+	if estimate.EstimatedFiles != 10 || estimate.EstimatedSize != 10*1024*1024 {
+		t.Errorf("Expected 10 files of 10MB to be deleted, got %d files of %d bytes", estimate.EstimatedFiles, estimate.EstimatedSize)
+	}
+	if !estimate.RecommendedThreshold.After(now.Add(-72*time.Hour)) || estimate.RecommendedThreshold.After(now.Add(-time.Hour)) {
+		t.Errorf("Expected a threshold between the old and recent backups, got %v", estimate.RecommendedThreshold)
+	}
+
+	// Nothing was deleted
+	if _, err := os.Stat(filepath.Join(tmpDir, "host00", "old.dat")); err != nil {
+		t.Errorf("Expected old.dat to remain: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package gobackupcleaner
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// evictionSeed returns EvictionSeed, or a random seed if it is 0
+func (c *CleaningConfig) evictionSeed() int64 {
+	if c.EvictionSeed != 0 {
+		return c.EvictionSeed
+	}
+	return rand.New(rand.NewSource(time.Now().UnixNano())).Int63() | 1
+}
+
+// selectEvicted picks the files of the slots age-based deletion takes with
+// an Eviction other than EvictionOldestFirst (see pickInOrder)
+func (c *CleaningConfig) selectEvicted(slots []*timeSlot, target int64, now time.Time, seed int64) (time.Time, int, int64, map[string]struct{}) {
+	if c.Eviction == EvictionRestoreTestedFirst {
+		return selectRestoreTestedFirst(slots, target, func(fi fileInfo) bool {
+			return c.RestoreTested.isTested(c.fs(), fi)
+		})
+	}
+	return selectAgeWeighted(slots, target, now, seed)
+}
+
+// slotFiles returns the files of the slots sorted by path, as files are
+// collected concurrently and selections must be reproducible
+func slotFiles(slots []*timeSlot) []fileInfo {
+	var files []fileInfo
+	for _, slot := range slots {
+		files = append(files, slot.files...)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files
+}
+
+// selectAgeWeighted picks files of the slots at random until their block
+// size reaches target, each file with a probability weighted by its age, so
+// older files are more likely to go but the newest ones are not all kept
+func selectAgeWeighted(slots []*timeSlot, target int64, now time.Time, seed int64) (time.Time, int, int64, map[string]struct{}) {
+	files := slotFiles(slots)
+
+	// Weighted sampling without replacement (Efraimidis-Spirakis): the files
+	// with the largest log(u)/weight are picked first
+	rng := rand.New(rand.NewSource(seed))
+	keys := make([]float64, len(files))
+	for i, fi := range files {
+		weight := math.Max(now.Sub(fi.modTime).Seconds(), 1)
+		keys[i] = math.Log(1-rng.Float64()) / weight
+	}
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return keys[order[a]] > keys[order[b]] })
+	return pickInOrder(files, order, target)
+}
+
+// selectRestoreTestedFirst picks the restore-tested files of the slots,
+// oldest first, then the other files, oldest first, until their block size
+// reaches target
+func selectRestoreTestedFirst(slots []*timeSlot, target int64, isTested func(fileInfo) bool) (time.Time, int, int64, map[string]struct{}) {
+	files := slotFiles(slots)
+	tested := make([]bool, len(files))
+	order := make([]int, len(files))
+	for i, fi := range files {
+		tested[i] = isTested(fi)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		if tested[i] != tested[j] {
+			return tested[i]
+		}
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	return pickInOrder(files, order, target)
+}
+
+// pickInOrder picks files in the given order until their block size reaches
+// target. It returns the threshold after the newest picked file, the number
+// and block size of the picked files, and the files older than the threshold
+// that were not picked and must be kept.
+func pickInOrder(files []fileInfo, order []int, target int64) (time.Time, int, int64, map[string]struct{}) {
+	picked := make([]bool, len(files))
+	var count int
+	var size int64
+	var threshold time.Time
+	for _, i := range order {
+		if size >= target {
+			break
+		}
+		picked[i] = true
+		count++
+		size += files[i].blockSize
+		if after := files[i].modTime.Add(time.Nanosecond); after.After(threshold) {
+			threshold = after
+		}
+	}
+
+	kept := make(map[string]struct{})
+	for i, fi := range files {
+		if !picked[i] && fi.modTime.Before(threshold) {
+			kept[fi.path] = struct{}{}
+		}
+	}
+	return threshold, count, size, kept
+}
+
+// withoutPaths returns the candidates whose paths are not in paths
+func withoutPaths(candidates []PlanFile, paths map[string]struct{}) []PlanFile {
+	filtered := candidates[:0]
+	for _, candidate := range candidates {
+		if _, ok := paths[candidate.Path]; !ok {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,97 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAgeWeightedEviction(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i := 1; i <= 20; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("backup-%02d.tar", i))
+		if err := createTestFile(t, path, 4096, now.Add(-time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := CleaningConfig{
+		MaxSize:      int64Ptr(10 * 4096),
+		TimeWindow:   time.Hour,
+		Eviction:     EvictionAgeWeighted,
+		EvictionSeed: 42,
+		DiskInfo:     &failingDiskInfoProvider{},
+	}
+	cleaner, err := NewCleaner(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := cleaner.Plan(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cleaner.Plan(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Candidates) != 10 || first.EvictionSeed != 42 {
+		t.Fatalf("Expected 10 candidates with seed 42, got %d with %d", len(first.Candidates), first.EvictionSeed)
+	}
+	if !reflect.DeepEqual(first.Candidates, second.Candidates) {
+		t.Error("Expected the same seed to pick the same files")
+	}
+	var newer int
+	for _, candidate := range first.Candidates {
+		if now.Sub(candidate.ModTime) <= 10*time.Hour {
+			newer++
+		}
+	}
+	if newer == 0 {
+		t.Error("Expected some of the newer half to be picked, got the oldest files only")
+	}
+
+	report, err := cleaner.Clean(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 10 || report.EvictionSeed != 42 {
+		t.Errorf("Expected 10 deletions with seed 42, got %d with %d", report.DeletedFiles, report.EvictionSeed)
+	}
+	for _, candidate := range first.Candidates {
+		if _, err := os.Stat(candidate.Path); !os.IsNotExist(err) {
+			t.Errorf("Expected planned %s to be deleted, got %v", candidate.Path, err)
+		}
+	}
+}
+
+func TestSelectAgeWeightedFavorsOlder(t *testing.T) {
+	now := time.Now()
+	var files []fileInfo
+	for i := 1; i <= 10; i++ {
+		files = append(files, fileInfo{path: fmt.Sprintf("f%02d", i), blockSize: 1, modTime: now.Add(-time.Duration(i) * 24 * time.Hour)})
+	}
+	slots := []*timeSlot{{files: files}}
+
+	// Over many seeds the oldest file is picked far more often than the newest
+	var oldest, newest int
+	for seed := int64(1); seed <= 500; seed++ {
+		threshold, count, _, kept := selectAgeWeighted(slots, 3, now, seed)
+		if count != 3 {
+			t.Fatalf("Expected 3 picked files, got %d", count)
+		}
+		if _, ok := kept["f10"]; !ok && files[9].modTime.Before(threshold) {
+			oldest++
+		}
+		if _, ok := kept["f01"]; !ok && files[0].modTime.Before(threshold) {
+			newest++
+		}
+	}
+	if oldest <= 2*newest {
+		t.Errorf("Expected the oldest file to be picked more often, got %d vs %d", oldest, newest)
+	}
+}
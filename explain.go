@@ -0,0 +1,189 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// explainKeptSlots is the number of kept time slots listed by Explain after
+// the selected ones
+const explainKeptSlots = 3
+
+// planTrace records the inputs of the deletion decision of a plan (see Explain)
+type planTrace struct {
+	config CleaningConfig
+	usage  *DiskUsage // nil when disk usage is unavailable
+
+	priorityFiles     int // Files deleted ahead of age-based deletion
+	priorityBlockSize int64
+	keptBlockSize     int64
+	ageTarget         int64 // Size to free by age, after priority files
+	slots             []traceSlot
+}
+
+// traceSlot summarizes one time slot, oldest first
+type traceSlot struct {
+	time      time.Time
+	files     int
+	blockSize int64
+}
+
+// newTraceSlots summarizes the time slots of a plan
+func newTraceSlots(slots []*timeSlot) []traceSlot {
+	trace := make([]traceSlot, len(slots))
+	for i, slot := range slots {
+		trace[i] = traceSlot{time: slot.time, files: slot.count(), blockSize: slot.totalBlockSize}
+	}
+	return trace
+}
+
+// Explain returns a human-readable trace of the deletion decision: the
+// constraints evaluated, the computed target, the cumulative size of each
+// time slot, the protections applied and the final threshold. Plans not
+// computed in this process, e.g. decoded from JSON, only explain their result.
+func (p *CleaningPlan) Explain() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plan for %s at %s\n", p.DirPath, p.CreatedAt.Format(time.RFC3339))
+	if t := p.trace; t != nil {
+		t.explainConstraints(&b)
+	}
+
+	switch {
+	case p.TargetSize == 0:
+		b.WriteString("Target: nothing to free, no file is deleted\n")
+		return b.String()
+	case p.TargetSize == -1:
+		b.WriteString("Target: disk usage unavailable, the scanned files must fit into MaxSize\n")
+	default:
+		fmt.Fprintf(&b, "Target: free %s\n", formatSize(p.TargetSize))
+	}
+	fmt.Fprintf(&b, "Scanned: %d files, %s", p.ScannedFiles, formatSize(p.TotalSize))
+	if p.PartialScan {
+		b.WriteString(" (partial scan, stopped at its time budget)")
+	}
+	b.WriteString("\n")
+
+	if p.KeptFiles > 0 {
+		fmt.Fprintf(&b, "Protected: %d files kept by rules and overrides", p.KeptFiles)
+		b.WriteString(":\n")
+		for _, count := range p.Protections {
+			fmt.Fprintf(&b, "  %s: %d files, %s\n", count.Reason, count.Files, formatSize(count.BlockSize))
+		}
+	}
+	for _, repo := range p.Repositories {
+		fmt.Fprintf(&b, "Repository left to its tool: %s (%s)\n", repo.Path, repo.Kind)
+	}
+	if t := p.trace; t != nil && t.priorityFiles > 0 {
+		fmt.Fprintf(&b, "Deleted ahead of age: %d files, %s\n", t.priorityFiles, formatSize(t.priorityBlockSize))
+	}
+
+	if len(p.Volumes) > 0 {
+		b.WriteString("Volumes (own targets):\n")
+		for _, volume := range p.Volumes {
+			fmt.Fprintf(&b, "  %s: %s to free, threshold %s\n", volume.Path, formatSize(volume.TargetSize), formatThreshold(volume.Threshold))
+		}
+	} else if len(p.Prefixes) > 0 {
+		b.WriteString("Prefixes (fair share):\n")
+		for _, prefix := range p.Prefixes {
+			fmt.Fprintf(&b, "  %s: %s of %s, threshold %s", prefix.Name, formatSize(prefix.ShareSize), formatSize(prefix.TotalSize), formatThreshold(prefix.Threshold))
+			if !prefix.RetainedFrom.IsZero() {
+				fmt.Fprintf(&b, ", retained from %s", prefix.RetainedFrom.Format(time.RFC3339))
+			}
+			b.WriteString("\n")
+		}
+	} else if t := p.trace; t != nil && len(t.slots) > 0 {
+		fmt.Fprintf(&b, "Time slots (oldest first), %s to free by age:\n", formatSize(max(t.ageTarget, 0)))
+		var cumulative int64
+		kept := 0
+		for i, slot := range t.slots {
+			cumulative += slot.blockSize
+			mark := "selected"
+			if !slot.time.Before(p.TimeThreshold) {
+				mark = "kept"
+				if kept++; kept > explainKeptSlots {
+					fmt.Fprintf(&b, "  ... %d newer slots kept\n", len(t.slots)-i)
+					break
+				}
+			}
+			fmt.Fprintf(&b, "  %s  %d files  %s  cumulative %s  %s\n", slot.time.Format(time.RFC3339), slot.files, formatSize(slot.blockSize), formatSize(cumulative), mark)
+		}
+	}
+
+	fmt.Fprintf(&b, "Threshold: %s\n", formatThreshold(p.TimeThreshold))
+	fmt.Fprintf(&b, "Result: %d files, %s", p.EstimatedFiles, formatSize(p.EstimatedSize))
+	if p.TargetSize > 0 && p.EstimatedSize < p.TargetSize {
+		fmt.Fprintf(&b, ", %s short of the target", formatSize(p.TargetSize-p.EstimatedSize))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// explainConstraints writes the disk usage and each capacity constraint
+func (t *planTrace) explainConstraints(b *strings.Builder) {
+	c := &t.config
+	if t.usage == nil {
+		b.WriteString("Disk usage: unavailable\n")
+	} else {
+		fmt.Fprintf(b, "Disk usage: %s of %s used (%.1f%%), %s free\n",
+			formatSize(int64(t.usage.Used)), formatSize(int64(t.usage.Total)), t.usage.UsedPercent, formatSize(int64(t.usage.Free)))
+	}
+	b.WriteString("Constraints:\n")
+	if c.MinFreeSpace != nil {
+		fmt.Fprintf(b, "  MinFreeSpace %s", formatSize(*c.MinFreeSpace))
+		if c.StartFreeSpace != nil {
+			fmt.Fprintf(b, " (starts below %s)", formatSize(*c.StartFreeSpace))
+		}
+		if c.TargetFreeSpaceAfterClean != nil {
+			fmt.Fprintf(b, " (frees up to %s)", formatSize(*c.TargetFreeSpaceAfterClean))
+		}
+		if t.usage != nil {
+			free := int64(c.freeSpace(t.usage))
+			fmt.Fprintf(b, ": %s free, %s", formatSize(free), breached(free < *c.MinFreeSpace))
+		}
+		b.WriteString("\n")
+	}
+	if c.MaxUsagePercent != nil {
+		fmt.Fprintf(b, "  MaxUsagePercent %.1f%%", *c.MaxUsagePercent)
+		if c.StartUsagePercent != nil {
+			fmt.Fprintf(b, " (starts above %.1f%%)", *c.StartUsagePercent)
+		}
+		if c.TargetUsagePercentAfterClean != nil {
+			fmt.Fprintf(b, " (frees down to %.1f%%)", *c.TargetUsagePercentAfterClean)
+		}
+		if t.usage != nil {
+			percent := c.usedPercent(t.usage)
+			base := ""
+			if c.UsageBase == UsageBaseUsable {
+				base = " of usable space"
+			}
+			fmt.Fprintf(b, ": %.1f%%%s used, %s", percent, base, breached(percent > *c.MaxUsagePercent))
+		}
+		b.WriteString("\n")
+	}
+	if c.MaxSize != nil {
+		fmt.Fprintf(b, "  MaxSize %s", formatSize(*c.MaxSize))
+		if t.usage != nil {
+			fmt.Fprintf(b, ": %s used, %s", formatSize(int64(t.usage.Used)), breached(int64(t.usage.Used) > *c.MaxSize))
+		} else if t.keptBlockSize > 0 {
+			fmt.Fprintf(b, ", %s of it taken by protected files", formatSize(t.keptBlockSize))
+		}
+		b.WriteString("\n")
+	}
+}
+
+// breached describes the state of a constraint
+func breached(b bool) string {
+	if b {
+		return "breached"
+	}
+	return "met"
+}
+
+// formatThreshold describes a deletion threshold
+func formatThreshold(threshold time.Time) string {
+	if threshold.IsZero() {
+		return "none, no file is deleted by age"
+	}
+	return "files modified before " + threshold.Format(time.RFC3339)
+}
@@ -0,0 +1,70 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanExplain(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 8; i++ {
+		modTime := now.Add(-time.Duration(8-i) * time.Hour)
+		if err := createTestFile(t, filepath.Join(tmpDir, fmt.Sprintf("backup%d.bak", i)), 4096, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleaner, err := NewCleaner(CleaningConfig{
+		MinFreeSpace: int64Ptr(8000),
+		TimeWindow:   time.Hour,
+		DiskInfo: &StaticDiskInfoProvider{
+			Usage:     &DiskUsage{Total: 100000, Used: 96000, Free: 4000, UsedPercent: 96},
+			BlockSize: 4096,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cleaner.Plan(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explanation := plan.Explain()
+	for _, want := range []string{
+		"MinFreeSpace 7.8KB: 3.9KB free, breached",
+		"Target: free 3.9KB",
+		"Scanned: 8 files",
+		"cumulative 4.0KB  selected",
+		"cumulative 8.0KB  kept",
+		"... 4 newer slots kept",
+		"Threshold: files modified before",
+		"Result: 1 files, 4.0KB",
+	} {
+		if !strings.Contains(explanation, want) {
+			t.Errorf("Expected %q in the explanation:\n%s", want, explanation)
+		}
+	}
+}
+
+func TestPlanExplainNothingToFree(t *testing.T) {
+	cleaner, err := NewCleaner(CleaningConfig{
+		MinFreeSpace: int64Ptr(1000),
+		DiskInfo:     &StaticDiskInfoProvider{Usage: &DiskUsage{Total: 10000, Used: 5000, Free: 5000, UsedPercent: 50}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cleaner.Plan(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	explanation := plan.Explain()
+	if !strings.Contains(explanation, "met") || !strings.Contains(explanation, "nothing to free") {
+		t.Errorf("Unexpected explanation:\n%s", explanation)
+	}
+}
@@ -0,0 +1,47 @@
+package gobackupcleaner
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvHeader is the header row of CSV exports
+var csvHeader = []string{"path", "size", "block_size", "mod_time", "is_dir", "category"}
+
+// Export writes the scanned files in the given format, e.g. to analyze the age
+// and size distribution of backups in BI tools
+func (r *ScanResult) Export(w io.Writer, format ExportFormat) error {
+	switch format {
+	case ExportCSV:
+		return r.exportCSV(w)
+	case ExportNcdu:
+		return r.exportNcdu(w)
+	}
+	return fmt.Errorf("invalid export format %d", format)
+}
+
+// exportCSV writes one row per file. Times are RFC 3339 in UTC.
+func (r *ScanResult) exportCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, f := range r.Files {
+		record := []string{
+			f.Path,
+			strconv.FormatInt(f.Size, 10),
+			strconv.FormatInt(f.BlockSize, 10),
+			f.ModTime.UTC().Format(time.RFC3339Nano),
+			strconv.FormatBool(f.IsDir),
+			f.Category,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
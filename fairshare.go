@@ -0,0 +1,196 @@
+package gobackupcleaner
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// PrefixShare describes how an immediate subdirectory of the target directory
+// takes part in a FairShare run
+type PrefixShare struct {
+	Name         string    // Subdirectory name, "." for the files directly in the target directory
+	TotalSize    int64     // Block-aligned size of the files subject to age-based deletion
+	ShareSize    int64     // Block-aligned size the prefix was asked to free
+	Threshold    time.Time // Files older than this are deleted by age
+	RetainedFrom time.Time // Files from this time on are kept by the minimum retention (zero if none)
+
+	// Deleted files of the prefix, including priority files (only set in reports)
+	DeletedFiles int
+	DeletedSize  int64
+}
+
+// prefixSlots holds the time slots of the files below one prefix, the
+// immediate subdirectory of the target directory (see FairShare)
+type prefixSlots struct {
+	name           string
+	slots          []*timeSlot // Sorted oldest first
+	totalBlockSize int64
+	retainedFrom   time.Time // Files from this time on are kept, zero if none
+	deletable      int64     // Block-aligned size of the files older than retainedFrom
+}
+
+// groupSlotsByPrefix splits the time slots by prefix. Files directly in the
+// target directory form the prefix ".".
+func groupSlotsByPrefix(rootPath string, slots []*timeSlot) []*prefixSlots {
+	byName := make(map[string]*prefixSlots)
+	var prefixes []*prefixSlots
+	for _, slot := range slots {
+		// Slots are sorted, so the slots of each prefix are sorted too
+		current := make(map[string]*timeSlot)
+		for _, fi := range slot.files {
+			name := topLevelDir(rootPath, fi.path, fi.isDir)
+			p, ok := byName[name]
+			if !ok {
+				p = &prefixSlots{name: name}
+				byName[name] = p
+				prefixes = append(prefixes, p)
+			}
+			ps, ok := current[name]
+			if !ok {
+				ps = &timeSlot{time: slot.time}
+				current[name] = ps
+				p.slots = append(p.slots, ps)
+			}
+			ps.files = append(ps.files, fi)
+			ps.totalSize += fi.size
+			ps.totalBlockSize += fi.blockSize
+			p.totalBlockSize += fi.blockSize
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return prefixes[i].name < prefixes[j].name
+	})
+	return prefixes
+}
+
+// applyMinRetention computes the files each prefix keeps regardless of its
+// share: the newest keepLatestN files and the files newer than keepWithin
+func applyMinRetention(prefixes []*prefixSlots, keepLatestN int, keepWithin time.Duration, now time.Time) {
+	for _, p := range prefixes {
+		if keepWithin > 0 {
+			p.retainedFrom = now.Add(-keepWithin)
+		}
+		if keepLatestN > 0 {
+			var modTimes []time.Time
+			for _, slot := range p.slots {
+				for _, fi := range slot.files {
+					modTimes = append(modTimes, fi.modTime)
+				}
+			}
+			sort.Slice(modTimes, func(i, j int) bool {
+				return modTimes[i].After(modTimes[j])
+			})
+			n := keepLatestN
+			if n > len(modTimes) {
+				n = len(modTimes)
+			}
+			if n > 0 && (p.retainedFrom.IsZero() || modTimes[n-1].Before(p.retainedFrom)) {
+				p.retainedFrom = modTimes[n-1]
+			}
+		}
+
+		p.deletable = 0
+		for _, slot := range p.slots {
+			for _, fi := range slot.files {
+				if p.retainedFrom.IsZero() || fi.modTime.Before(p.retainedFrom) {
+					p.deletable += fi.blockSize
+				}
+			}
+		}
+	}
+}
+
+// fairShareThresholds splits targetSize across the prefixes in proportion to
+// their size and calculates a threshold per prefix, so a prefix with many old
+// files does not absorb the entire target. A prefix that cannot free its share
+// without touching its minimum retention frees what it can, and the rest is
+// split across the other prefixes.
+func fairShareThresholds(prefixes []*prefixSlots, targetSize int64) ([]PrefixShare, int, int64) {
+	shares := make(map[string]int64, len(prefixes))
+	active := make([]*prefixSlots, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.deletable > 0 {
+			active = append(active, p)
+		}
+	}
+	remaining := targetSize
+	for remaining > 0 && len(active) > 0 {
+		var total int64
+		for _, p := range active {
+			total += p.totalBlockSize
+		}
+		// Prefixes without enough deletable files give up everything they can
+		var next []*prefixSlots
+		var capped bool
+		for _, p := range active {
+			share := int64(math.Ceil(float64(remaining) * float64(p.totalBlockSize) / float64(total)))
+			if share >= p.deletable {
+				shares[p.name] = p.deletable
+				remaining -= p.deletable
+				capped = true
+			} else {
+				next = append(next, p)
+			}
+		}
+		if !capped {
+			for _, p := range active {
+				shares[p.name] = int64(math.Ceil(float64(remaining) * float64(p.totalBlockSize) / float64(total)))
+			}
+			break
+		}
+		active = next
+	}
+
+	result := make([]PrefixShare, 0, len(prefixes))
+	var files int
+	var size int64
+	for _, p := range prefixes {
+		ps := PrefixShare{
+			Name:         p.name,
+			TotalSize:    p.totalBlockSize,
+			ShareSize:    shares[p.name],
+			RetainedFrom: p.retainedFrom,
+		}
+		if ps.ShareSize > 0 {
+			// A zero threshold means no file is deleted by age
+			ps.Threshold, _, _ = calculateThreshold(p.slots, ps.ShareSize)
+			if !p.retainedFrom.IsZero() && p.retainedFrom.Before(ps.Threshold) {
+				ps.Threshold = p.retainedFrom
+			}
+		}
+		for _, slot := range p.slots {
+			for _, fi := range slot.files {
+				if fi.modTime.Before(ps.Threshold) {
+					files++
+					size += fi.blockSize
+				}
+			}
+		}
+		result = append(result, ps)
+	}
+	return result, files, size
+}
+
+// prefixThresholds returns the thresholds of the prefixes by name
+func prefixThresholds(shares []PrefixShare) map[string]time.Time {
+	if shares == nil {
+		return nil
+	}
+	thresholds := make(map[string]time.Time, len(shares))
+	for _, ps := range shares {
+		thresholds[ps.Name] = ps.Threshold
+	}
+	return thresholds
+}
+
+// fairShareCandidates returns the priority files and the files of each prefix
+// that are older than the threshold of the prefix
+func fairShareCandidates(prefixes []*prefixSlots, priority []fileInfo, thresholds map[string]time.Time) []PlanFile {
+	candidates := collectCandidates(nil, priority, time.Time{})
+	for _, p := range prefixes {
+		candidates = append(candidates, collectCandidates(p.slots, nil, thresholds[p.name])...)
+	}
+	sortPlanFiles(candidates)
+	return candidates
+}
@@ -0,0 +1,159 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createHostFiles creates n hourly files below dir, the newest one at newest
+func createHostFiles(t *testing.T, dir string, n int, newest time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("%02d.bak", i))
+		if err := createTestFile(t, path, 4096, newest.Add(-time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// countFiles counts the regular files in dir
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestFairShare(t *testing.T) {
+	// Aligned to the time window, so each slot is deleted completely
+	now := time.Now().Truncate(time.Hour)
+	for _, fairShare := range []bool{false, true} {
+		t.Run(fmt.Sprintf("FairShare=%t", fairShare), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			// host-a only has old files, which would absorb the entire target
+			createHostFiles(t, filepath.Join(tmpDir, "host-a"), 10, now.Add(-100*time.Hour))
+			createHostFiles(t, filepath.Join(tmpDir, "host-b"), 10, now.Add(-time.Hour))
+
+			maxSize := int64(10 * 4096)
+			report, err := CleanBackup(tmpDir, CleaningConfig{
+				MaxSize:    &maxSize,
+				TimeWindow: time.Hour,
+				FairShare:  fairShare,
+				DiskInfo:   &failingDiskInfoProvider{},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hostA, hostB := countFiles(t, filepath.Join(tmpDir, "host-a")), countFiles(t, filepath.Join(tmpDir, "host-b"))
+			if report.DeletedFiles != 10 {
+				t.Errorf("Expected 10 deleted files, got %d", report.DeletedFiles)
+			}
+			if !fairShare {
+				if hostA != 0 || hostB != 10 {
+					t.Errorf("Expected only host-a files to be deleted, %d and %d remain", hostA, hostB)
+				}
+				return
+			}
+			if hostA != 5 || hostB != 5 {
+				t.Errorf("Expected 5 files to remain per host, %d and %d remain", hostA, hostB)
+			}
+			if len(report.Prefixes) != 2 || !report.TimeThreshold.IsZero() {
+				t.Fatalf("Unexpected prefixes %+v / %v", report.Prefixes, report.TimeThreshold)
+			}
+			for _, ps := range report.Prefixes {
+				if ps.DeletedFiles != 5 || ps.ShareSize != 5*4096 {
+					t.Errorf("Unexpected share of %s: %+v", ps.Name, ps)
+				}
+			}
+		})
+	}
+}
+
+func TestFairShareMinRetention(t *testing.T) {
+	now := time.Now().Truncate(time.Hour)
+	tmpDir := t.TempDir()
+	// host-a is quiet: it only has 3 old backups
+	createHostFiles(t, filepath.Join(tmpDir, "host-a"), 3, now.Add(-100*time.Hour))
+	createHostFiles(t, filepath.Join(tmpDir, "host-b"), 17, now.Add(-time.Hour))
+
+	maxSize := int64(10 * 4096)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:              &maxSize,
+		TimeWindow:           time.Hour,
+		FairShare:            true,
+		FairShareKeepLatestN: 3,
+		DiskInfo:             &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// host-a keeps its history, so host-b gives up all 10 files
+	hostA, hostB := countFiles(t, filepath.Join(tmpDir, "host-a")), countFiles(t, filepath.Join(tmpDir, "host-b"))
+	if hostA != 3 || hostB != 7 {
+		t.Errorf("Expected 3 and 7 files to remain, %d and %d remain", hostA, hostB)
+	}
+	if len(report.Prefixes) != 2 {
+		t.Fatalf("Unexpected prefixes %+v", report.Prefixes)
+	}
+	a, b := report.Prefixes[0], report.Prefixes[1]
+	if a.Name != "host-a" || a.DeletedFiles != 0 || a.ShareSize != 0 || !a.RetainedFrom.Equal(now.Add(-102*time.Hour)) {
+		t.Errorf("Unexpected host-a share %+v", a)
+	}
+	if b.Name != "host-b" || b.DeletedFiles != 10 || b.ShareSize != 10*4096 {
+		t.Errorf("Unexpected host-b share %+v", b)
+	}
+}
+
+func TestMaxDeletePerDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for _, host := range []string{"host1", "host2"} {
+		if err := os.Mkdir(filepath.Join(tmpDir, host), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]time.Duration{
+		"host1/a.tar": 96 * time.Hour,
+		"host1/b.tar": 72 * time.Hour,
+		"host1/c.tar": 48 * time.Hour,
+		"host2/a.tar": 48 * time.Hour,
+		"host2/b.tar": time.Hour,
+		"root.tar":    72 * time.Hour,
+	}
+	for name, age := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Everything older than an hour is due, but each host gives up at most 2 files
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:               int64Ptr(4096),
+		MaxDeletePerDirectory: 8192,
+		TimeWindow:            time.Hour,
+		DiskInfo:              &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 4 || report.DirectoryLimitedFiles != 1 {
+		t.Errorf("Expected 4 deletions and 1 file kept by the limit, got %d and %d", report.DeletedFiles, report.DirectoryLimitedFiles)
+	}
+	if report.ShortfallSize == 0 {
+		t.Error("Expected a shortfall as the limit kept files")
+	}
+	remaining := countFiles(t, tmpDir)
+	if remaining != 2 {
+		t.Errorf("Expected one file of host1 and the newest of host2 to remain, got %d files", remaining)
+	}
+}
@@ -0,0 +1,75 @@
+package gobackupcleaner
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// FileSystem is the file system a run scans and deletes from. Tests replace
+// it to simulate slow or failing storage (see the cleanertest package).
+// Implementations must be safe for concurrent use.
+type FileSystem interface {
+	Lstat(path string) (os.FileInfo, error)
+	Stat(path string) (os.FileInfo, error)
+	ReadDir(path string) ([]os.DirEntry, error) // Sorted by name
+	Open(path string) (io.ReadCloser, error)
+	Remove(path string) error
+	RemoveAll(path string) error
+	Rename(oldPath, newPath string) error
+	Chtimes(path string, atime, mtime time.Time) error // A zero time leaves it unchanged
+}
+
+// OSFileSystem is the FileSystem of the operating system
+type OSFileSystem struct {
+	NoAtime bool // Read directories and files without updating their access time
+}
+
+// Lstat returns the attributes of a file without following symlinks
+func (f OSFileSystem) Lstat(path string) (os.FileInfo, error) { return os.Lstat(path) }
+
+// Stat returns the attributes of a file, following symlinks
+func (f OSFileSystem) Stat(path string) (os.FileInfo, error) { return os.Stat(path) }
+
+// ReadDir reads a directory sorted by name
+func (f OSFileSystem) ReadDir(path string) ([]os.DirEntry, error) { return readDir(path, f.NoAtime) }
+
+// Open opens a file for reading
+func (f OSFileSystem) Open(path string) (io.ReadCloser, error) {
+	if f.NoAtime {
+		return openNoAtime(path)
+	}
+	return os.Open(path)
+}
+
+// Remove deletes a file or an empty directory
+func (f OSFileSystem) Remove(path string) error { return os.Remove(path) }
+
+// RemoveAll deletes a directory and everything below it
+func (f OSFileSystem) RemoveAll(path string) error { return os.RemoveAll(path) }
+
+// Rename moves a file or directory, replacing newPath if it is a file
+func (f OSFileSystem) Rename(oldPath, newPath string) error { return os.Rename(oldPath, newPath) }
+
+// Chtimes changes the access and modification times of a file
+func (f OSFileSystem) Chtimes(path string, atime, mtime time.Time) error {
+	return os.Chtimes(path, atime, mtime)
+}
+
+// fs returns the FileSystem of a run, the operating system's if FS is nil
+func (c *CleaningConfig) fs() FileSystem {
+	if c.FS == nil {
+		return OSFileSystem{NoAtime: c.NoAtime}
+	}
+	return c.FS
+}
+
+// readFile reads a whole file through fs
+func readFile(fs FileSystem, path string) ([]byte, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
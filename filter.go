@@ -0,0 +1,84 @@
+package gobackupcleaner
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// matchesFilterPattern reports whether a pattern of IncludePatterns or
+// ExcludePatterns matches a path relative to the target directory. Patterns
+// with a slash match the whole slash-separated path, others the name.
+func matchesFilterPattern(pattern, rel string) bool {
+	name := rel
+	if !strings.Contains(pattern, "/") {
+		name = rel[strings.LastIndex(rel, "/")+1:]
+	}
+	matched, _ := filepath.Match(pattern, name)
+	return matched
+}
+
+// filterPath returns the slash-separated path of path below rootPath, or
+// false for rootPath itself and paths outside of it
+func filterPath(rootPath, path string) (string, bool) {
+	rel, err := filepath.Rel(rootPath, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// isExcluded reports whether a path below rootPath matches ExcludePatterns.
+// Excluded directories are skipped with all their contents.
+func (c *CleaningConfig) isExcluded(rootPath, path string) bool {
+	if len(c.ExcludePatterns) == 0 {
+		return false
+	}
+	rel, ok := filterPath(rootPath, path)
+	if !ok {
+		return false
+	}
+	for _, pattern := range c.ExcludePatterns {
+		if matchesFilterPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIncluded reports whether a deletion unit below rootPath, a file or a
+// directory deleted as a whole, matches IncludePatterns
+func (c *CleaningConfig) isIncluded(rootPath, path string) bool {
+	if len(c.IncludePatterns) == 0 {
+		return true
+	}
+	rel, ok := filterPath(rootPath, path)
+	if !ok {
+		return false
+	}
+	for _, pattern := range c.IncludePatterns {
+		if matchesFilterPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFilteredOut reports whether a listed deletion unit, from an index or a
+// plan, is left alone because of IncludePatterns or ExcludePatterns. Unlike
+// during a scan, the excluded directories containing it were not skipped.
+func (c *CleaningConfig) isFilteredOut(rootPath, path string) bool {
+	if !c.isIncluded(rootPath, path) {
+		return true
+	}
+	if len(c.ExcludePatterns) == 0 {
+		return false
+	}
+	for p := path; ; p = filepath.Dir(p) {
+		if _, ok := filterPath(rootPath, p); !ok {
+			return false
+		}
+		if c.isExcluded(rootPath, p) {
+			return true
+		}
+	}
+}
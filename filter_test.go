@@ -0,0 +1,108 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestFilterPatterns tests that only included files outside excluded paths
+// are counted and deleted
+func TestFilterPatterns(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now()
+	files := map[string]time.Duration{
+		"a.tar.gz":                 96 * time.Hour,
+		"db-1.dump":                72 * time.Hour,
+		"notes.txt":                120 * time.Hour,
+		"host/important/b.tar.gz":  120 * time.Hour,
+		"host/daily/c.tar.gz":      48 * time.Hour,
+		"host/daily/c.tar.gz.sha1": 48 * time.Hour,
+	}
+	for name, age := range files {
+		if err := os.MkdirAll(filepath.Join(tmpDir, filepath.Dir(filepath.FromSlash(name))), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := createTestFile(t, filepath.Join(tmpDir, filepath.FromSlash(name)), 1024, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := CleaningConfig{
+		MaxSize:         int64Ptr(0),
+		TimeWindow:      time.Hour,
+		IncludePatterns: []string{"*.tar.gz", "db-*.dump"},
+		ExcludePatterns: []string{"*/important/*"},
+		DiskInfo:        &failingDiskInfoProvider{},
+	}
+	result, err := Scan(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 3 {
+		t.Errorf("Expected 3 scanned files, got %+v", result.Files)
+	}
+
+	report, err := CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 3 {
+		t.Errorf("Expected 3 deleted files, got %d", report.DeletedFiles)
+	}
+	for name := range files {
+		_, err := os.Stat(filepath.Join(tmpDir, filepath.FromSlash(name)))
+		switch name {
+		case "notes.txt", "host/important/b.tar.gz", "host/daily/c.tar.gz.sha1":
+			if err != nil {
+				t.Errorf("Expected %s to be left alone: %v", name, err)
+			}
+		default:
+			if !os.IsNotExist(err) {
+				t.Errorf("Expected %s to be deleted", name)
+			}
+		}
+	}
+}
+
+// TestFilterPatternsIndex tests that listed files are filtered like scanned ones
+func TestFilterPatternsIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	old := time.Now().Add(-72 * time.Hour)
+	index := []FileRecord{
+		{Path: "a.tar.gz", Size: 1024, ModTime: old},
+		{Path: "notes.txt", Size: 1024, ModTime: old},
+		{Path: "host/important/deep/b.tar.gz", Size: 1024, ModTime: old},
+	}
+	cleaner, err := NewCleaner(CleaningConfig{
+		MaxSize:         int64Ptr(0),
+		IncludePatterns: []string{"*.tar.gz"},
+		ExcludePatterns: []string{"*/important"},
+		DiskInfo:        &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cleaner.PlanFromIndex(context.Background(), tmpDir, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Candidates) != 1 || plan.Candidates[0].Path != filepath.Join(tmpDir, "a.tar.gz") {
+		t.Errorf("Expected only a.tar.gz as candidate, got %+v", plan.Candidates)
+	}
+}
+
+// TestFilterPatternsValidation tests that malformed patterns are rejected
+func TestFilterPatternsValidation(t *testing.T) {
+	for _, config := range []CleaningConfig{
+		{MaxSize: int64Ptr(0), IncludePatterns: []string{"["}},
+		{MaxSize: int64Ptr(0), ExcludePatterns: []string{""}},
+	} {
+		if _, err := NewCleaner(config); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig for %+v, got %v", config, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package gobackupcleaner
+
+import "syscall"
+
+// GetFileSystemInfo returns the file system type of the given path
+func (d *DefaultDiskInfoProvider) GetFileSystemInfo(path string) (FileSystemInfo, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return FileSystemInfo{}, err
+	}
+	var name []byte
+	for _, c := range stat.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return FileSystemInfo{Type: string(name), Network: isNetworkFileSystem(string(name))}, nil
+}
@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+package gobackupcleaner
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// fileSystemMagics maps the statfs f_type magic numbers of common file
+// systems to their names
+var fileSystemMagics = map[uint32]string{
+	0xEF53:     "ext4",
+	0x58465342: "xfs",
+	0x9123683E: "btrfs",
+	0x2FC12FC1: "zfs",
+	0x01021994: "tmpfs",
+	0x794C7630: "overlay",
+	0x4D44:     "vfat",
+	0x5346544E: "ntfs",
+	0xF2F52010: "f2fs",
+	0x2011BAB0: "exfat",
+	0x65735546: "fuse",
+	0x5DCA2DF5: "sdcardfs", // Android emulated storage before FUSE
+	0x6969:     "nfs",
+	0x517B:     "smb",
+	0xFF534D42: "cifs",
+	0xFE534D42: "smb2",
+	0x00C36400: "ceph",
+	0x47504653: "gpfs",
+	0x0BD00BD0: "lustre",
+	0x5346414F: "afs",
+}
+
+// GetFileSystemInfo returns the file system type of the given path
+func (d *DefaultDiskInfoProvider) GetFileSystemInfo(path string) (FileSystemInfo, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return FileSystemInfo{}, err
+	}
+	magic := uint32(stat.Type)
+	name, ok := fileSystemMagics[magic]
+	if !ok {
+		name = fmt.Sprintf("0x%x", magic)
+	}
+	return FileSystemInfo{Type: name, Network: isNetworkFileSystem(name)}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package gobackupcleaner
+
+// GetFileSystemInfo returns an unknown file system type, as it cannot be
+// detected on this platform
+func (d *DefaultDiskInfoProvider) GetFileSystemInfo(path string) (FileSystemInfo, error) {
+	return FileSystemInfo{}, nil
+}
@@ -0,0 +1,48 @@
+//go:build windows
+// +build windows
+
+package gobackupcleaner
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procGetDriveType         = kernel32.NewProc("GetDriveTypeW")
+	procGetVolumeInformation = kernel32.NewProc("GetVolumeInformationW")
+)
+
+// driveRemote is the GetDriveType result for network drives
+const driveRemote = 4
+
+// GetFileSystemInfo returns the file system type of the volume backing the
+// given path (see volumeRoot). Mapped network drives and UNC paths are
+// network file systems.
+func (d *DefaultDiskInfoProvider) GetFileSystemInfo(path string) (FileSystemInfo, error) {
+	root, err := volumeRoot(path)
+	if err != nil {
+		return FileSystemInfo{}, err
+	}
+	rootPtr, err := syscall.UTF16PtrFromString(root)
+	if err != nil {
+		return FileSystemInfo{}, err
+	}
+
+	driveType, _, _ := procGetDriveType.Call(uintptr(unsafe.Pointer(rootPtr)))
+
+	var nameBuf [syscall.MAX_PATH + 1]uint16
+	ret, _, err := procGetVolumeInformation.Call(
+		uintptr(unsafe.Pointer(rootPtr)),
+		0, 0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&nameBuf[0])),
+		uintptr(len(nameBuf)),
+	)
+	if ret == 0 {
+		return FileSystemInfo{}, err
+	}
+	return FileSystemInfo{
+		Type:    syscall.UTF16ToString(nameBuf[:]),
+		Network: driveType == driveRemote,
+	}, nil
+}
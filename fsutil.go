@@ -0,0 +1,55 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"sort"
+)
+
+// entryInfo returns the attributes of a directory entry with ReadDirPlus,
+// which NFS clients serve from the attributes READDIRPLUS returned with the
+// entries, or nil to Lstat the entry when it is processed. Entries that
+// cannot be read are left to the Lstat to report.
+func (c *CleaningConfig) entryInfo(entry os.DirEntry) os.FileInfo {
+	if !c.ReadDirPlus {
+		return nil
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// openNoAtime opens a file or directory for reading without updating its
+// access time where the platform supports it (O_NOATIME on Linux).
+// O_NOATIME is only permitted for the file owner, so it falls back to a
+// plain open when it is refused.
+func openNoAtime(path string) (*os.File, error) {
+	if noAtimeFlag != 0 {
+		f, err := os.OpenFile(path, os.O_RDONLY|noAtimeFlag, 0)
+		if err == nil || !os.IsPermission(err) {
+			return f, err
+		}
+	}
+	return os.Open(path)
+}
+
+// readDir reads a directory sorted by name like os.ReadDir.
+// When noAtime is set, the directory is opened without updating its access time.
+func readDir(path string, noAtime bool) ([]os.DirEntry, error) {
+	if !noAtime {
+		return os.ReadDir(path)
+	}
+
+	f, err := openNoAtime(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := f.ReadDir(-1)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, err
+}
@@ -0,0 +1,126 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadDirNoAtime(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-noatime-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	for _, name := range []string{"c.txt", "a.txt", "b.txt"} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 10, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, noAtime := range []bool{false, true} {
+		entries, err := readDir(tmpDir, noAtime)
+		if err != nil {
+			t.Fatalf("readDir(noAtime=%t) failed: %v", noAtime, err)
+		}
+		if len(entries) != 3 {
+			t.Fatalf("Expected 3 entries, got %d", len(entries))
+		}
+		for i, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			if entries[i].Name() != name {
+				t.Errorf("Expected entry %d to be %s, got %s (noAtime=%t)", i, name, entries[i].Name(), noAtime)
+			}
+		}
+	}
+
+	f, err := openNoAtime(filepath.Join(tmpDir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Logf("file close failed: %v", err)
+	}
+}
+
+// lstatLatencyFS delays every Lstat by latency, like a GETATTR round trip
+// to an NFS server whose attribute cache expired, and counts them
+type lstatLatencyFS struct {
+	OSFileSystem
+	latency time.Duration
+	lstats  atomic.Int64
+}
+
+func (f *lstatLatencyFS) Lstat(path string) (os.FileInfo, error) {
+	f.lstats.Add(1)
+	time.Sleep(f.latency)
+	return os.Lstat(path)
+}
+
+func TestReadDirPlus(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i, name := range []string{"a.tar", "b.tar", "c.tar", "d.tar"} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 4096, now.Add(-time.Duration(4-i)*24*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the root directory is Lstat, the files come with their directory
+	fs := &lstatLatencyFS{}
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:     int64Ptr(8192),
+		ReadDirPlus: true,
+		TimeWindow:  time.Hour,
+		Concurrency: 1,
+		DiskInfo:    &failingDiskInfoProvider{},
+		FS:          fs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 2 {
+		t.Errorf("Expected the 2 oldest files to be deleted, got %d", report.DeletedFiles)
+	}
+	if calls := fs.lstats.Load(); calls != 2 {
+		t.Errorf("Expected one Lstat per traversal, got %d", calls)
+	}
+}
+
+// BenchmarkScanLatency compares scanning with an Lstat per file against
+// ReadDirPlus when each Lstat costs a round trip
+func BenchmarkScanLatency(b *testing.B) {
+	tmpDir := b.TempDir()
+	now := time.Now()
+	for i := 0; i < 200; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("backup%03d.tar", i))
+		if err := createTestFile(b, path, 4096, now.Add(-time.Duration(i)*time.Hour)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	fs := &lstatLatencyFS{latency: 200 * time.Microsecond}
+
+	for _, readDirPlus := range []bool{false, true} {
+		name := "Lstat"
+		if readDirPlus {
+			name = "ReadDirPlus"
+		}
+		b.Run(name, func(b *testing.B) {
+			config := CleaningConfig{ReadDirPlus: readDirPlus, TimeWindow: time.Hour, FS: fs}
+			config.setDefaults()
+			for i := 0; i < b.N; i++ {
+				if err := newScanner(&config, nil, 4096).scan(context.Background(), tmpDir); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package gobackupcleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+)
+
+// defaultHistorySize is the number of runs kept per directory by a Runner
+const defaultHistorySize = 100
+
+// RunRecord summarizes one run of a Runner, so trends such as the bytes freed
+// per day or a drifting scan duration can be followed across runs
+type RunRecord struct {
+	RunID         string        `json:"run_id,omitempty"`
+	Dir           string        `json:"dir"`
+	Start         time.Time     `json:"start"`
+	ScanDuration  time.Duration `json:"scan_duration"`
+	TotalDuration time.Duration `json:"total_duration"`
+	ScannedFiles  int           `json:"scanned_files"`
+	DeletedFiles  int           `json:"deleted_files"`
+	FreedSize     int64         `json:"freed_size"` // Block-aligned size in bytes
+	Error         string        `json:"error,omitempty"`
+
+	// Retention is the age of the oldest backups left by a run that deleted
+	// files by age, the time between its start and TimeThreshold, 0 otherwise
+	Retention time.Duration `json:"retention,omitempty"`
+}
+
+// newRunRecord summarizes the report of a run started at start
+func newRunRecord(dir string, start time.Time, report CleaningReport, err error) RunRecord {
+	record := RunRecord{
+		RunID:         report.RunID,
+		Dir:           dir,
+		Start:         start,
+		ScanDuration:  report.ScanDuration,
+		TotalDuration: report.TotalDuration,
+		ScannedFiles:  report.ScannedFiles,
+		DeletedFiles:  report.DeletedFiles,
+		FreedSize:     report.FreedSize,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if report.DeletedFiles > 0 && !report.TimeThreshold.IsZero() {
+		record.Retention = start.Sub(report.TimeThreshold)
+	}
+	return record
+}
+
+// runHistory is a ring buffer of the last runs of a directory
+type runHistory struct {
+	records []RunRecord
+	next    int // Index overwritten by the next record once full
+	size    int
+}
+
+// add records a run, dropping the oldest one once size runs are kept
+func (h *runHistory) add(record RunRecord) {
+	if len(h.records) < h.size {
+		h.records = append(h.records, record)
+		return
+	}
+	h.records[h.next] = record
+	h.next = (h.next + 1) % h.size
+}
+
+// list returns the runs, the oldest first
+func (h *runHistory) list() []RunRecord {
+	records := make([]RunRecord, 0, len(h.records))
+	records = append(records, h.records[h.next:]...)
+	return append(records, h.records[:h.next]...)
+}
+
+// History returns the recorded runs of all directories sorted by start, the
+// oldest first. Each directory keeps its last HistorySize runs.
+func (r *Runner) History() []RunRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.historyLocked()
+}
+
+// historyLocked returns the recorded runs while r.mu is held
+func (r *Runner) historyLocked() []RunRecord {
+	var records []RunRecord
+	for _, t := range r.targets {
+		records = append(records, t.history.list()...)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Start.Before(records[j].Start)
+	})
+	return records
+}
+
+// loadHistory restores the runs persisted to HistoryFile. A missing file
+// starts an empty history; runs of directories without a policy are dropped.
+func (r *Runner) loadHistory() error {
+	if r.config.HistoryFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(r.config.HistoryFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var records []RunRecord
+	if err := json.Unmarshal(content, &records); err != nil {
+		return err
+	}
+	targets := make(map[string]*runnerTarget, len(r.targets))
+	for _, t := range r.targets {
+		targets[t.dir] = t
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Start.Before(records[j].Start)
+	})
+	for _, record := range records {
+		if t, ok := targets[record.Dir]; ok {
+			t.history.add(record)
+		}
+	}
+	return nil
+}
+
+// saveHistory persists records, the snapshot seq of the runs, to
+// HistoryFile without holding r.mu. A snapshot older than the one last
+// written by a concurrent run is dropped.
+func (r *Runner) saveHistory(records []RunRecord, seq uint64) error {
+	if r.config.HistoryFile == "" {
+		return nil
+	}
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	if seq < r.historySaved {
+		return nil
+	}
+	content, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(r.config.HistoryFile, content); err != nil {
+		return err
+	}
+	r.historySaved = seq
+	return nil
+}
+
+// HistoryTrend summarizes the runs of a history
+type HistoryTrend struct {
+	Runs        int
+	Failed      int           // Runs that returned an error
+	Span        time.Duration // Time between the first and the last start
+	FreedSize   int64         // Total block-aligned size freed
+	FreedPerDay float64       // Bytes freed per day over Span
+
+	// Change of the scan duration per day, fitted by least squares over the
+	// successful runs, e.g. as the tree grows
+	ScanDurationDrift time.Duration
+}
+
+// SummarizeHistory returns the trend of records, e.g. the runs of one
+// directory returned by Runner.History
+func SummarizeHistory(records []RunRecord) HistoryTrend {
+	var trend HistoryTrend
+	if len(records) == 0 {
+		return trend
+	}
+	first, last := records[0].Start, records[0].Start
+	var n, sumX, sumY, sumXY, sumXX float64
+	for _, record := range records {
+		trend.Runs++
+		trend.FreedSize += record.FreedSize
+		if record.Start.Before(first) {
+			first = record.Start
+		}
+		if record.Start.After(last) {
+			last = record.Start
+		}
+		if record.Error != "" {
+			trend.Failed++
+			continue
+		}
+		x := record.Start.Sub(records[0].Start).Hours() / 24
+		y := float64(record.ScanDuration)
+		n++
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	trend.Span = last.Sub(first)
+	if days := trend.Span.Hours() / 24; days > 0 {
+		trend.FreedPerDay = float64(trend.FreedSize) / days
+	}
+	if d := n*sumXX - sumX*sumX; n >= 2 && d != 0 {
+		trend.ScanDurationDrift = time.Duration((n*sumXY - sumX*sumY) / d)
+	}
+	return trend
+}
@@ -0,0 +1,103 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunHistoryRing(t *testing.T) {
+	h := runHistory{size: 3}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		h.add(RunRecord{Start: start.Add(time.Duration(i) * time.Hour), DeletedFiles: i})
+	}
+	records := h.list()
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	for i, record := range records {
+		if record.DeletedFiles != i+2 {
+			t.Errorf("record %d: expected run %d, got %d", i, i+2, record.DeletedFiles)
+		}
+	}
+}
+
+func TestSummarizeHistory(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []RunRecord{
+		{Start: start, ScanDuration: 10 * time.Second, FreedSize: 100},
+		{Start: start.Add(24 * time.Hour), ScanDuration: 12 * time.Second, FreedSize: 200},
+		{Start: start.Add(36 * time.Hour), Error: "directory not found"},
+		{Start: start.Add(48 * time.Hour), ScanDuration: 14 * time.Second, FreedSize: 300},
+	}
+	trend := SummarizeHistory(records)
+	if trend.Runs != 4 || trend.Failed != 1 || trend.Span != 48*time.Hour || trend.FreedSize != 600 {
+		t.Errorf("Unexpected trend %+v", trend)
+	}
+	if trend.FreedPerDay != 300 {
+		t.Errorf("Expected 300 bytes freed per day, got %v", trend.FreedPerDay)
+	}
+	if trend.ScanDurationDrift != 2*time.Second {
+		t.Errorf("Expected a drift of 2s per day, got %v", trend.ScanDurationDrift)
+	}
+	if trend := SummarizeHistory(nil); trend != (HistoryTrend{}) {
+		t.Errorf("Expected an empty trend, got %+v", trend)
+	}
+}
+
+func TestRunnerHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "backup")
+	createHostFiles(t, dir, 4, time.Now().Truncate(time.Hour))
+	historyFile := filepath.Join(tmpDir, "history.json")
+	config := RunnerConfig{
+		Policies: map[string]RunnerPolicy{
+			dir: {
+				Interval: 20 * time.Millisecond,
+				Config: CleaningConfig{
+					MaxSize:    int64Ptr(2 * 4096),
+					TimeWindow: time.Hour,
+					DiskInfo:   &failingDiskInfoProvider{},
+				},
+			},
+		},
+		HistorySize: 2,
+		HistoryFile: historyFile,
+	}
+
+	runner, err := NewRunner(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for runner.Status()[0].Runs < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Runs did not complete: %+v", runner.Status())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	history := runner.History()
+	if len(history) != 2 || history[0].Dir != dir || !history[0].Start.Before(history[1].Start) {
+		t.Fatalf("Expected the last 2 runs, oldest first, got %+v", history)
+	}
+	if status := runner.Status()[0]; status.HistoryError != nil {
+		t.Errorf("Expected the history to be saved, got %v", status.HistoryError)
+	}
+
+	// A new Runner restores the persisted history
+	restored, err := NewRunner(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.History(); len(got) != 2 || !got[1].Start.Equal(history[1].Start) {
+		t.Errorf("Expected the history to be restored, got %+v", got)
+	}
+}
@@ -0,0 +1,79 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+)
+
+// FileRecord is a file of a precomputed index passed to CleanFromIndex
+type FileRecord struct {
+	Path    string    // Absolute, or relative to the target directory
+	Size    int64     // File size in bytes
+	ModTime time.Time // Must match the file, modified files are skipped
+	IsDir   bool      // Directory deleted as a whole, like an opaque directory (see MaxDepth)
+}
+
+// CleanFromIndex computes the threshold from a precomputed file index and
+// deletes the indexed files accordingly, without walking dirPath.
+// See Cleaner.CleanFromIndex.
+func CleanFromIndex(dirPath string, index []FileRecord, config CleaningConfig) (CleaningReport, error) {
+	cleaner, err := NewCleaner(config)
+	if err != nil {
+		return CleaningReport{}, err
+	}
+	return cleaner.CleanFromIndex(context.Background(), dirPath, index)
+}
+
+// validateIndex checks that all records are inside dirPath
+func validateIndex(dirPath string, index []FileRecord) error {
+	for _, r := range index {
+		if r.Path == "" || r.Size < 0 {
+			return ErrInvalidIndex
+		}
+		if rel, err := filepath.Rel(dirPath, indexPath(dirPath, r.Path)); err != nil || !filepath.IsLocal(rel) {
+			return ErrInvalidIndex
+		}
+	}
+	return nil
+}
+
+// indexPath returns the path of a record below rootPath
+func indexPath(rootPath, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(rootPath, path)
+}
+
+// load adds the records of an index as if they had been scanned.
+// Once ctx is done the remaining records are skipped.
+func (s *scanner) load(ctx context.Context, rootPath string, index []FileRecord) error {
+	s.classifier = newClassifier(s.config, s.run, rootPath, s.now)
+	for _, r := range index {
+		if ctx.Err() != nil {
+			return nil
+		}
+		path := indexPath(rootPath, r.Path)
+		if isTombstone(path) || s.run.isArtifact(path, r.IsDir) || s.config.isFilteredOut(rootPath, path) || (!r.IsDir && isSillyRename(filepath.Base(path))) {
+			continue
+		}
+
+		fi := fileInfo{
+			path:      path,
+			size:      r.Size,
+			blockSize: calculateBlockSize(r.Size, s.blockSize),
+			modTime:   r.ModTime,
+			isDir:     r.IsDir,
+		}
+		if r.IsDir {
+			fi.class = s.classifier.classifyDir(path, r.Size, r.ModTime)
+		} else {
+			fi.class = s.classifier.classifyFile(path, r.Size, r.ModTime)
+		}
+		s.addFile(fi)
+		s.config.Stats.addScanned()
+		s.release(fi)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanFromIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Second)
+	files := []struct {
+		name    string
+		modTime time.Time
+	}{
+		{"old1.bak", now.Add(-72 * time.Hour)},
+		{"old2.bak", now.Add(-48 * time.Hour)},
+		{"unindexed.bak", now.Add(-96 * time.Hour)},
+		{"recent.bak", now.Add(-time.Hour)},
+	}
+	for _, f := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, f.name), 1024*1024, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index := []FileRecord{
+		{Path: "old1.bak", Size: 1024 * 1024, ModTime: now.Add(-72 * time.Hour)},
+		// Modified since the index was built
+		{Path: "old2.bak", Size: 1024 * 1024, ModTime: now.Add(-50 * time.Hour)},
+		{Path: filepath.Join(tmpDir, "recent.bak"), Size: 1024 * 1024, ModTime: now.Add(-time.Hour)},
+	}
+
+	// Both old files exceed the limit, only the newest one fits
+	maxSize := int64(1024*1024 + 4096)
+	report, err := CleanFromIndex(tmpDir, index, CleaningConfig{
+		MaxSize:    &maxSize,
+		TimeWindow: time.Hour,
+		DiskInfo:   &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.ScannedFiles != 3 {
+		t.Errorf("Expected 3 indexed files, got %d", report.ScannedFiles)
+	}
+	if report.DeletedFiles != 1 {
+		t.Errorf("Expected 1 deleted file, got %d", report.DeletedFiles)
+	}
+	expected := map[string]bool{"old1.bak": false, "old2.bak": true, "unindexed.bak": true, "recent.bak": true}
+	for name, exists := range expected {
+		_, err := os.Stat(filepath.Join(tmpDir, name))
+		if exists != (err == nil) {
+			t.Errorf("%s: expected exists=%v", name, exists)
+		}
+	}
+}
+
+func TestCleanFromIndexInvalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	maxSize := int64(1024)
+	config := CleaningConfig{MaxSize: &maxSize, DiskInfo: &failingDiskInfoProvider{}}
+
+	invalid := [][]FileRecord{
+		{{Path: "", Size: 1}},
+		{{Path: "a.bak", Size: -1}},
+		{{Path: "../outside.bak", Size: 1}},
+		{{Path: "/elsewhere/a.bak", Size: 1}},
+	}
+	for _, index := range invalid {
+		if _, err := CleanFromIndex(tmpDir, index, config); !errors.Is(err, ErrInvalidIndex) {
+			t.Errorf("Expected ErrInvalidIndex for %+v, got %v", index, err)
+		}
+	}
+}
+
+func TestPlanFromIndexWithoutDirectory(t *testing.T) {
+	// A listing of another machine, planned without its files
+	dirPath := filepath.Join(t.TempDir(), "remote")
+	now := time.Now().Truncate(time.Hour)
+	index := []FileRecord{
+		{Path: "old.bak", Size: 1000, ModTime: now.Add(-48 * time.Hour)},
+		{Path: "new.bak", Size: 1000, ModTime: now.Add(-time.Hour)},
+	}
+
+	cleaner, err := NewCleaner(CleaningConfig{
+		MaxUsagePercent: float64Ptr(50),
+		TimeWindow:      time.Hour,
+		DiskInfo: &StaticDiskInfoProvider{
+			Usage:     &DiskUsage{Total: 4096, Used: 3000, Free: 1096, UsedPercent: 3000.0 / 4096 * 100},
+			BlockSize: 1024,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cleaner.PlanFromIndex(context.Background(), dirPath, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.ScannedFiles != 2 || plan.BlockSize != 1024 {
+		t.Errorf("Unexpected plan %+v", plan)
+	}
+	if len(plan.Candidates) != 1 || plan.Candidates[0].Path != filepath.Join(dirPath, "old.bak") {
+		t.Errorf("Expected old.bak to be the only candidate, got %+v", plan.Candidates)
+	}
+
+	// Deleting still requires the directory
+	if _, err := cleaner.CleanFromIndex(context.Background(), dirPath, index); !errors.Is(err, ErrDirectoryNotFound) {
+		t.Errorf("Expected ErrDirectoryNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"time"
+)
+
+// lintMaxTimeWindow is the TimeWindow above which Lint warns, as backups are
+// usually taken at least daily
+const lintMaxTimeWindow = 24 * time.Hour
+
+// ConfigWarning is a risky but valid setting reported by Lint
+type ConfigWarning struct {
+	Field   string // Setting the warning is about, e.g. "MaxSize"
+	Message string
+}
+
+func (w ConfigWarning) String() string {
+	return w.Field + ": " + w.Message
+}
+
+// Lint returns warnings for valid configurations that may delete more than
+// intended, e.g. a MaxSize without a free space constraint on a shared
+// volume or no protection of the newest backups. NewCleaner reports them
+// to OnWarning. Lint does not validate the configuration.
+func (c CleaningConfig) Lint() []ConfigWarning {
+	c.setDefaults()
+	var warnings []ConfigWarning
+	warn := func(field, format string, args ...any) {
+		warnings = append(warnings, ConfigWarning{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.MaxSize != nil && c.MinFreeSpace == nil && c.MaxUsagePercent == nil {
+		warn("MaxSize", "only bounds the size of the backups; on a volume shared with other data the free space can still run out, set MinFreeSpace or MaxUsagePercent as well")
+	}
+	if !c.protectsNewest() {
+		warn("Rules", "nothing protects the newest backups, so a target larger than the backups deletes all of them; add a RuleProtect rule with MaxAge or an override with KeepLatestN")
+	}
+	if c.TimeWindow > lintMaxTimeWindow {
+		warn("TimeWindow", "%v deletes all backups within that time together; it should be shorter than the interval between backups", c.TimeWindow)
+	}
+	for i, rule := range c.Rules {
+		if rule.Action == RuleDelete && rule.Match.isEmpty() {
+			warn("Rules", "rule %d deletes every file as it has no conditions", i)
+		}
+	}
+	return warnings
+}
+
+// protectsNewest reports whether some setting keeps the newest backups from
+// being deleted whatever the target
+func (c *CleaningConfig) protectsNewest() bool {
+	for _, rule := range c.Rules {
+		if rule.Action == RuleProtect || rule.Action == RuleKeep {
+			return true
+		}
+	}
+	for _, o := range c.Overrides {
+		if o.KeepLatestN > 0 {
+			return true
+		}
+	}
+	return c.FairShareKeepLatestN > 0 || c.FairShareKeepWithin > 0 ||
+		c.ReferencedListFile != "" || c.ReferencedList != nil
+}
+
+// isEmpty reports whether the match has no conditions and matches every file
+func (m RuleMatch) isEmpty() bool {
+	return m.Glob == "" && m.Regexp == "" && m.MinAge == 0 && m.MaxAge == 0 &&
+		m.MinSize == 0 && m.MaxSize == 0 && m.Condition == nil
+}
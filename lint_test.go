@@ -0,0 +1,85 @@
+package gobackupcleaner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLint(t *testing.T) {
+	protect := []Rule{{Match: RuleMatch{MaxAge: 7 * 24 * time.Hour}, Action: RuleProtect}}
+	tests := []struct {
+		name   string
+		config CleaningConfig
+		want   []string // Fields warned about
+	}{
+		{
+			name:   "Safe",
+			config: CleaningConfig{MinFreeSpace: int64Ptr(1 << 30), Rules: protect},
+		},
+		{
+			name:   "Preset",
+			config: PolicyKeep30Days(),
+		},
+		{
+			name:   "Usage preset",
+			config: PolicyKeepUnder80Percent(),
+		},
+		{
+			name:   "MaxSize alone",
+			config: CleaningConfig{MaxSize: int64Ptr(1 << 30), Rules: protect},
+			want:   []string{"MaxSize"},
+		},
+		{
+			name:   "No protection",
+			config: CleaningConfig{MinFreeSpace: int64Ptr(1 << 30)},
+			want:   []string{"Rules"},
+		},
+		{
+			name: "KeepLatestN protects",
+			config: CleaningConfig{
+				MinFreeSpace: int64Ptr(1 << 30),
+				Overrides:    []RetentionOverride{{Path: "db", KeepLatestN: 3}},
+			},
+		},
+		{
+			name:   "Large TimeWindow",
+			config: CleaningConfig{MinFreeSpace: int64Ptr(1 << 30), Rules: protect, TimeWindow: 48 * time.Hour},
+			want:   []string{"TimeWindow"},
+		},
+		{
+			name: "Unconditional delete rule",
+			config: CleaningConfig{
+				MinFreeSpace: int64Ptr(1 << 30),
+				Rules:        append([]Rule{{Action: RuleDelete}}, protect...),
+			},
+			want: []string{"Rules"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := tt.config.Lint()
+			if len(warnings) != len(tt.want) {
+				t.Fatalf("Expected warnings about %v, got %v", tt.want, warnings)
+			}
+			for i, field := range tt.want {
+				if warnings[i].Field != field || warnings[i].Message == "" {
+					t.Errorf("Expected a warning about %s, got %v", field, warnings[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewCleanerReportsWarnings(t *testing.T) {
+	var warnings []ConfigWarning
+	_, err := NewCleaner(CleaningConfig{
+		MaxSize:   int64Ptr(1 << 30),
+		Callbacks: Callbacks{OnWarning: func(w ConfigWarning) { warnings = append(warnings, w) }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("Expected the MaxSize and protection warnings, got %v", warnings)
+	}
+}
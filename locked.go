@@ -0,0 +1,12 @@
+package gobackupcleaner
+
+// rebootScheduler defers the deletion of locked files to the next reboot
+// (see DeferLockedDeletes)
+type rebootScheduler interface {
+	isLocked(err error) bool      // The deletion failed because another process has the file open
+	isScheduled(path string) bool // The deletion of path is already scheduled
+	schedule(path string) error   // Schedules the deletion of path at the next reboot
+}
+
+// rebootDeletes is the scheduler of the platform, replaced by tests
+var rebootDeletes rebootScheduler = &platformRebootScheduler{}
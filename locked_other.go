@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package gobackupcleaner
+
+import "errors"
+
+// platformRebootScheduler does nothing: open files can be deleted on this
+// platform
+type platformRebootScheduler struct{}
+
+// isLocked reports whether a deletion failed because the file is locked,
+// which never happens on this platform
+func (s *platformRebootScheduler) isLocked(err error) bool {
+	return false
+}
+
+// isScheduled reports whether the deletion of path is scheduled
+func (s *platformRebootScheduler) isScheduled(path string) bool {
+	return false
+}
+
+// schedule is not available on this platform
+func (s *platformRebootScheduler) schedule(path string) error {
+	return errors.ErrUnsupported
+}
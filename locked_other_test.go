@@ -0,0 +1,45 @@
+//go:build !windows
+// +build !windows
+
+package gobackupcleaner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDeferLockedDeletesUnsupported tests that DeferLockedDeletes has no
+// effect where open files can be deleted
+func TestDeferLockedDeletesUnsupported(t *testing.T) {
+	scheduler := &platformRebootScheduler{}
+	if scheduler.isLocked(&os.PathError{Op: "remove", Err: errFakeLocked}) || scheduler.isScheduled("/backup/a.tar") {
+		t.Error("Expected no locked or scheduled files")
+	}
+	if err := scheduler.schedule("/backup/a.tar"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Expected errors.ErrUnsupported, got %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	if err := createTestFile(t, filepath.Join(tmpDir, "locked.tar"), 4096, time.Now().Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var failures int
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:            int64Ptr(0),
+		DeferLockedDeletes: true,
+		FS:                 lockedFS{locked: "locked.tar"},
+		DiskInfo:           &StaticDiskInfoProvider{BlockSize: 4096},
+		Callbacks: Callbacks{
+			OnError: func(info ErrorInfo) { failures++ },
+		},
+	})
+	if !errors.Is(err, errFakeLocked) {
+		t.Errorf("Expected the run to fail with the deletion error, got %v", err)
+	}
+	if report.DeferredDeletes != 0 || report.DeferredDeleteSize != 0 || failures != 1 {
+		t.Errorf("Expected the failure to be reported instead of deferred, got %d deferred and %d failures", report.DeferredDeletes, failures)
+	}
+}
@@ -0,0 +1,91 @@
+package gobackupcleaner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// errFakeLocked stands for a sharing violation
+var errFakeLocked = errors.New("locked by another process")
+
+// fakeRebootScheduler counts the deletions scheduled at reboot per path
+type fakeRebootScheduler struct {
+	mu        sync.Mutex
+	scheduled map[string]int
+}
+
+func (s *fakeRebootScheduler) isLocked(err error) bool { return errors.Is(err, errFakeLocked) }
+
+func (s *fakeRebootScheduler) isScheduled(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scheduled[path] > 0
+}
+
+func (s *fakeRebootScheduler) schedule(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scheduled[path]++
+	return nil
+}
+
+// lockedFS fails to remove the files named locked
+type lockedFS struct {
+	OSFileSystem
+	locked string
+}
+
+func (f lockedFS) Remove(path string) error {
+	if filepath.Base(path) == f.locked {
+		return &os.PathError{Op: "remove", Path: path, Err: errFakeLocked}
+	}
+	return os.Remove(path)
+}
+
+// TestDeferLockedDeletes tests that a locked file is scheduled once and
+// counted by the run that scheduled it only
+func TestDeferLockedDeletes(t *testing.T) {
+	scheduler := &fakeRebootScheduler{scheduled: make(map[string]int)}
+	saved := rebootDeletes
+	rebootDeletes = scheduler
+	defer func() { rebootDeletes = saved }()
+
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for _, name := range []string{"locked.tar", "other.tar"} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 4096, now.Add(-48*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := CleaningConfig{
+		MaxSize:            int64Ptr(0),
+		DeferLockedDeletes: true,
+		FS:                 lockedFS{locked: "locked.tar"},
+		DiskInfo:           &StaticDiskInfoProvider{BlockSize: 4096},
+	}
+
+	report, err := CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 || report.DeferredDeletes != 1 || report.DeferredDeleteSize != 4096 {
+		t.Errorf("Expected 1 deleted and 1 deferred file, got %d deleted and %d deferred (%d bytes)",
+			report.DeletedFiles, report.DeferredDeletes, report.DeferredDeleteSize)
+	}
+
+	// The file is still locked on the next run
+	report, err = CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeferredDeletes != 0 || report.DeferredDeleteSize != 0 {
+		t.Errorf("Expected the scheduled file not to be counted again, got %d (%d bytes)", report.DeferredDeletes, report.DeferredDeleteSize)
+	}
+	if n := scheduler.scheduled[filepath.Join(tmpDir, "locked.tar")]; n != 1 {
+		t.Errorf("Expected the deletion to be scheduled once, got %d", n)
+	}
+}
@@ -0,0 +1,128 @@
+//go:build windows
+// +build windows
+
+package gobackupcleaner
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+const (
+	errorSharingViolation    syscall.Errno = 32  // ERROR_SHARING_VIOLATION
+	errorLockViolation       syscall.Errno = 33  // ERROR_LOCK_VIOLATION
+	moveFileDelayUntilReboot               = 0x4 // MOVEFILE_DELAY_UNTIL_REBOOT
+)
+
+// sessionManagerKey holds PendingFileRenameOperations, where MoveFileEx
+// records the deletions scheduled at the next reboot
+const sessionManagerKey = `SYSTEM\CurrentControlSet\Control\Session Manager`
+
+var procMoveFileEx = kernel32.NewProc("MoveFileExW")
+
+// platformRebootScheduler schedules deletions with MoveFileEx
+type platformRebootScheduler struct {
+	scheduled sync.Map // Paths scheduled by this process, in case the registry cannot be read
+}
+
+// isLocked reports whether a deletion failed because another process has
+// the file open without sharing deletion
+func (s *platformRebootScheduler) isLocked(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorLockViolation)
+}
+
+// isScheduled reports whether the deletion of path is already pending, by
+// this process or recorded in PendingFileRenameOperations
+func (s *platformRebootScheduler) isScheduled(path string) bool {
+	key := rebootKey(path)
+	if _, ok := s.scheduled.Load(key); ok {
+		return true
+	}
+	operations, err := pendingRenameOperations()
+	if err != nil {
+		return false
+	}
+	_, ok := pendingDeletes(operations)[key]
+	return ok
+}
+
+// schedule schedules the deletion of a file at the next reboot. It requires
+// administrator rights.
+func (s *platformRebootScheduler) schedule(path string) error {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	ret, _, err := procMoveFileEx.Call(uintptr(unsafe.Pointer(pathPtr)), 0, moveFileDelayUntilReboot)
+	if ret == 0 {
+		return err
+	}
+	s.scheduled.Store(rebootKey(path), struct{}{})
+	return nil
+}
+
+// rebootKey returns the absolute path in the case-insensitive form paths
+// are compared in
+func rebootKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return strings.ToLower(filepath.Clean(path))
+}
+
+// pendingRenameOperations reads PendingFileRenameOperations, nil if no
+// operation is pending
+func pendingRenameOperations() ([]uint16, error) {
+	keyName, err := syscall.UTF16PtrFromString(sessionManagerKey)
+	if err != nil {
+		return nil, err
+	}
+	var key syscall.Handle
+	if err := syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE, keyName, 0, syscall.KEY_QUERY_VALUE, &key); err != nil {
+		return nil, err
+	}
+	defer syscall.RegCloseKey(key)
+
+	valueName, err := syscall.UTF16PtrFromString("PendingFileRenameOperations")
+	if err != nil {
+		return nil, err
+	}
+	var valueType, size uint32
+	if err := syscall.RegQueryValueEx(key, valueName, nil, &valueType, nil, &size); err != nil {
+		if errors.Is(err, syscall.ERROR_FILE_NOT_FOUND) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size < 2 {
+		return nil, nil
+	}
+	buf := make([]uint16, size/2)
+	if err := syscall.RegQueryValueEx(key, valueName, nil, &valueType, (*byte)(unsafe.Pointer(&buf[0])), &size); err != nil {
+		return nil, err
+	}
+	return buf[:size/2], nil
+}
+
+// pendingDeletes returns the keys of the files a PendingFileRenameOperations
+// value deletes. The value holds pairs of NUL-terminated source and
+// destination paths; deletions have an empty destination.
+func pendingDeletes(operations []uint16) map[string]struct{} {
+	fields := strings.Split(string(utf16.Decode(operations)), "\x00")
+	deletes := make(map[string]struct{})
+	for i := 0; i+1 < len(fields); i += 2 {
+		source, destination := fields[i], fields[i+1]
+		if source == "" || destination != "" {
+			continue
+		}
+		// Sources are NT paths such as \??\C:\backup\file
+		source = strings.TrimPrefix(source, `\??\`)
+		deletes[rebootKey(source)] = struct{}{}
+	}
+	return deletes
+}
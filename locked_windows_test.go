@@ -0,0 +1,36 @@
+//go:build windows
+// +build windows
+
+package gobackupcleaner
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestPendingDeletes(t *testing.T) {
+	// A deletion, a rename and the terminating empty string
+	value := `\??\C:\Backup\Old.tar` + "\x00\x00" + `\??\C:\a.tmp` + "\x00" + `\??\C:\b.tmp` + "\x00\x00"
+	deletes := pendingDeletes(utf16.Encode([]rune(value)))
+	if len(deletes) != 1 {
+		t.Fatalf("Expected 1 pending deletion, got %v", deletes)
+	}
+	if _, ok := deletes[rebootKey(`c:\backup\old.tar`)]; !ok {
+		t.Errorf("Expected the deletion to match case-insensitively, got %v", deletes)
+	}
+	if len(pendingDeletes(nil)) != 0 {
+		t.Error("Expected no pending deletion in an empty value")
+	}
+}
+
+func TestIsLocked(t *testing.T) {
+	scheduler := &platformRebootScheduler{}
+	if !scheduler.isLocked(&os.PathError{Op: "remove", Err: syscall.Errno(32)}) {
+		t.Error("Expected a sharing violation to be locked")
+	}
+	if scheduler.isLocked(&os.PathError{Op: "remove", Err: syscall.ERROR_ACCESS_DENIED}) {
+		t.Error("Expected access denied not to be locked")
+	}
+}
@@ -0,0 +1,204 @@
+package gobackupcleaner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestEntry represents a single line of the hash manifest
+type manifestEntry struct {
+	hash    string
+	size    int64
+	modTime int64 // Unix nanoseconds
+	path    string
+}
+
+// ManifestResult contains the result of a manifest update
+type ManifestResult struct {
+	Files       int           // Number of files in the manifest
+	HashedFiles int           // Number of files hashed in this run (others were reused)
+	Duration    time.Duration // Time spent updating the manifest
+}
+
+// writeManifest computes the content identifiers (SHA-256 hashes by default,
+// see ContentIDs) of all files remaining under dirPath and writes them to the
+// manifest. Hashes are reused from an existing manifest when the size and
+// modification time of a file are unchanged.
+//
+// Each line of the manifest has the form:
+//
+//	<hash>\t<size>\t<mtime unix nanoseconds>\t<path relative to dirPath>
+func writeManifest(dirPath string, config *CleaningConfig) (ManifestResult, error) {
+	startTime := time.Now()
+	manifestPath, err := filepath.Abs(config.ManifestPath)
+	if err != nil {
+		return ManifestResult{}, err
+	}
+
+	previous, err := readManifest(config.fs(), manifestPath)
+	if err != nil {
+		return ManifestResult{}, err
+	}
+
+	// Collect the remaining files
+	var files []manifestEntry
+	err = filepath.WalkDir(dirPath, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || isTombstone(path) {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && abs == manifestPath {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, manifestEntry{
+			size:    info.Size(),
+			modTime: info.ModTime().UnixNano(),
+			path:    filepath.ToSlash(rel),
+		})
+		return nil
+	})
+	if err != nil {
+		return ManifestResult{}, err
+	}
+
+	// Reuse unchanged hashes and hash the rest in parallel
+	var toHash []int
+	for i := range files {
+		if prev, ok := previous[files[i].path]; ok && prev.size == files[i].size && prev.modTime == files[i].modTime && reusableContentID(config.ContentIDs, prev.hash) {
+			files[i].hash = prev.hash
+		} else {
+			toHash = append(toHash, i)
+		}
+	}
+
+	indexChan := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < config.ActualWorkerCount(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexChan {
+				path := filepath.Join(dirPath, filepath.FromSlash(files[idx].path))
+				hash, err := storedContentID(config.ContentIDs, path)
+				if err != nil {
+					callSafe(config.Callbacks.OnError, ErrorInfo{
+						Type:  ErrorTypeManifest,
+						Path:  path,
+						Error: err,
+					})
+					continue
+				}
+				files[idx].hash = hash
+			}
+		}()
+	}
+	for _, idx := range toHash {
+		indexChan <- idx
+	}
+	close(indexChan)
+	wg.Wait()
+
+	// Drop files that could not be hashed
+	entries := files[:0]
+	for _, f := range files {
+		if f.hash != "" {
+			entries = append(entries, f)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].path < entries[j].path
+	})
+
+	if err := saveManifest(manifestPath, entries); err != nil {
+		return ManifestResult{}, err
+	}
+
+	return ManifestResult{
+		Files:       len(entries),
+		HashedFiles: len(toHash),
+		Duration:    time.Since(startTime),
+	}, nil
+}
+
+// readManifest reads an existing manifest. A missing manifest is not an error.
+func readManifest(fs FileSystem, path string) (map[string]manifestEntry, error) {
+	entries := make(map[string]manifestEntry)
+
+	f, err := fs.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 4)
+		if len(fields) != 4 {
+			// Ignore malformed lines, they will be rehashed
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		modTime, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries[fields[3]] = manifestEntry{
+			hash:    fields[0],
+			size:    size,
+			modTime: modTime,
+			path:    fields[3],
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// saveManifest writes the manifest atomically via a temporary file
+func saveManifest(path string, entries []manifestEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", e.hash, e.size, e.modTime, e.path); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,145 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestManifestGeneration tests that the manifest lists surviving files and is updated incrementally
+func TestManifestGeneration(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-manifest-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.txt"), 1024*1024, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(tmpDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "sub", "recent.txt"), 1024*1024, now); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestDir, err := os.MkdirTemp("", "backup-cleaner-manifest-out-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(manifestDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+	manifestPath := filepath.Join(manifestDir, "MANIFEST")
+	maxSize := int64(1024 * 1024)
+	config := CleaningConfig{
+		MaxSize:      &maxSize,
+		TimeWindow:   time.Hour,
+		ManifestPath: manifestPath,
+		DiskInfo:     &failingDiskInfoProvider{},
+	}
+
+	report, err := CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Manifest.Files != 1 || report.Manifest.HashedFiles != 1 {
+		t.Errorf("Expected 1 file hashed into the manifest, got %+v", report.Manifest)
+	}
+
+	entries, err := readManifest(OSFileSystem{}, manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := entries["sub/recent.txt"]
+	if !ok {
+		t.Fatalf("Expected sub/recent.txt in manifest, got %v", entries)
+	}
+	// SHA-256 of 1MB of zero bytes
+	expected := "30e14955ebf1352266dc2ff8067e68104607e750abb9d3b36582b8af909fcb58"
+	if entry.hash != expected {
+		t.Errorf("Expected hash %s, got %s", expected, entry.hash)
+	}
+	if _, ok := entries["old.txt"]; ok {
+		t.Error("Deleted file must not be in the manifest")
+	}
+
+	// A second run reuses the unchanged hash
+	report, err = CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Manifest.Files != 1 || report.Manifest.HashedFiles != 0 {
+		t.Errorf("Expected the manifest hash to be reused, got %+v", report.Manifest)
+	}
+}
+
+// countingContentIDProvider identifies files by their size and counts its calls
+type countingContentIDProvider struct {
+	calls int
+}
+
+func (p *countingContentIDProvider) Name() string { return "size" }
+
+func (p *countingContentIDProvider) ContentID(path string) (string, error) {
+	p.calls++
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(info.Size()), nil
+}
+
+// TestManifestContentIDProvider tests custom and disabled content identifiers
+func TestManifestContentIDProvider(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := createTestFile(t, filepath.Join(tmpDir, "a.bak"), 1000, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(tmpDir, "MANIFEST")
+	clean := func(provider ContentIDProvider) ManifestResult {
+		report, err := CleanBackup(tmpDir, CleaningConfig{
+			MaxSize:      int64Ptr(1 << 20),
+			ManifestPath: manifestPath,
+			ContentIDs:   provider,
+			DiskInfo:     &failingDiskInfoProvider{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report.Manifest
+	}
+	hash := func() string {
+		entries, err := readManifest(OSFileSystem{}, manifestPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries["a.bak"].hash
+	}
+
+	provider := &countingContentIDProvider{}
+	if result := clean(provider); result.HashedFiles != 1 || hash() != "size:1000" {
+		t.Errorf("Expected a size identifier, got %+v %q", result, hash())
+	}
+	if result := clean(provider); result.HashedFiles != 0 || provider.calls != 1 {
+		t.Errorf("Expected the identifier to be reused, got %+v", result)
+	}
+
+	// Identifiers of another algorithm are recomputed
+	if result := clean(&SHA256ContentIDProvider{}); result.HashedFiles != 1 || len(hash()) != 64 {
+		t.Errorf("Expected a SHA-256 hash, got %+v %q", result, hash())
+	}
+	if result := clean(&NoContentIDProvider{}); result.Files != 1 || hash() != "-" {
+		t.Errorf("Expected the file to be listed without hash, got %+v %q", result, hash())
+	}
+}
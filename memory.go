@@ -0,0 +1,33 @@
+package gobackupcleaner
+
+import "unsafe"
+
+// fileInfoMemory is the memory held by a scanned file besides its path
+const fileInfoMemory = int64(unsafe.Sizeof(fileInfo{}))
+
+// count returns the number of files in the slot, including those dropped
+// in counting mode
+func (t *timeSlot) count() int {
+	return len(t.files) + t.dropped
+}
+
+// trackMemory accounts the memory of a scanned file and degrades to counting
+// mode once the scanner exceeds MaxMemoryBytes. The caller holds s.mu.
+func (s *scanner) trackMemory(fi fileInfo) {
+	if s.maxMemory <= 0 || s.countOnly {
+		return
+	}
+	s.memory += fileInfoMemory + int64(len(fi.path))
+	if s.memory <= s.maxMemory {
+		return
+	}
+
+	// The time slots keep their totals, deletion walks the tree again
+	s.countOnly = true
+	for _, slot := range s.timeSlots.slots {
+		slot.dropped += len(slot.files)
+		slot.files = nil
+	}
+	s.collect = false
+	s.all = nil
+}
@@ -0,0 +1,66 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaxMemoryBytes(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("backup%02d.tar", i))
+		if err := createTestFile(t, path, 4096, now.Add(-time.Duration(20-i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := CleaningConfig{
+		MaxSize:    int64Ptr(10 * 4096),
+		TimeWindow: time.Hour,
+		DiskInfo:   &failingDiskInfoProvider{},
+	}
+
+	// The same files are deleted with and without the per-file lists
+	cleaner, err := NewCleaner(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := cleaner.Plan(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MaxMemoryBytes = 4 * fileInfoMemory
+	cleaner, err = NewCleaner(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	degraded, err := cleaner.Plan(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.MemoryDegraded || !degraded.MemoryDegraded {
+		t.Fatalf("Expected only the limited scan to degrade, got %t and %t", full.MemoryDegraded, degraded.MemoryDegraded)
+	}
+	if !degraded.TimeThreshold.Equal(full.TimeThreshold) || degraded.EstimatedFiles != full.EstimatedFiles || degraded.ScannedFiles != 20 {
+		t.Errorf("Expected the same decision, got %v/%d vs %v/%d", degraded.TimeThreshold, degraded.EstimatedFiles, full.TimeThreshold, full.EstimatedFiles)
+	}
+	if len(degraded.Candidates) != 0 {
+		t.Errorf("Expected no per-file candidates, got %d", len(degraded.Candidates))
+	}
+
+	report, err := CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.MemoryDegraded || report.DeletedFiles != 10 {
+		t.Errorf("Expected 10 files deleted by a degraded scan, got %d, degraded %t", report.DeletedFiles, report.MemoryDegraded)
+	}
+	entries, _ := os.ReadDir(tmpDir)
+	if len(entries) != 10 {
+		t.Errorf("Expected 10 files left, got %d", len(entries))
+	}
+}
@@ -0,0 +1,141 @@
+// Package mobile exposes the cleaner with types supported by gomobile bind,
+// so Android and iOS apps can prune their local backup caches:
+//
+//	gomobile bind -target=android github.com/ideamans/go-backup-cleaner/mobile
+//
+// Android and iOS build as linux and darwin respectively, so disk information
+// comes from statfs. With scoped storage an app can only stat its own
+// directories, so pass a directory the app owns, such as Context.getFilesDir()
+// or getExternalFilesDir() on Android and the Caches or Application Support
+// directory on iOS.
+package mobile
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cleaner "github.com/ideamans/go-backup-cleaner"
+)
+
+// Options are the cleaning options. Capacity constraints of 0 are unset, at
+// least one is required.
+type Options struct {
+	MinFreeSpace      int64   // Minimum free space in bytes (recommended)
+	MaxUsagePercent   float64 // Maximum disk usage percentage (0-100)
+	MaxSize           int64   // Maximum used disk size in bytes
+	TimeWindowSeconds int64   // Time interval for file aggregation (default: 5 minutes)
+	MaxConcurrency    int     // Number of concurrent deletions (default: CPU count)
+	RemoveEmptyDirs   bool    // Whether to remove emptied directories
+}
+
+// Result summarizes a cleaning run
+type Result struct {
+	ScannedFiles     int
+	DeletedFiles     int
+	DeletedSize      int64 // Actual file size in bytes
+	DeletedBlockSize int64 // Block-aligned size in bytes
+	DeletedDirs      int
+	Errors           int // Number of files that could not be deleted
+	DurationMillis   int64
+}
+
+// Usage is the disk usage of a directory
+type Usage struct {
+	Total       int64
+	Free        int64
+	Used        int64
+	UsedPercent float64
+}
+
+// Task is a cleaning run that can be canceled from another thread, e.g. when
+// the operating system ends the app's background time
+type Task struct {
+	dir    string
+	config cleaner.CleaningConfig
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// NewTask creates a cleaning task for dir
+func NewTask(dir string, options *Options) *Task {
+	if options == nil {
+		options = &Options{}
+	}
+	config := cleaner.CleaningConfig{
+		TimeWindow:      time.Duration(options.TimeWindowSeconds) * time.Second,
+		MaxConcurrency:  options.MaxConcurrency,
+		RemoveEmptyDirs: options.RemoveEmptyDirs,
+	}
+	if options.MinFreeSpace > 0 {
+		config.MinFreeSpace = &options.MinFreeSpace
+	}
+	if options.MaxUsagePercent > 0 {
+		config.MaxUsagePercent = &options.MaxUsagePercent
+	}
+	if options.MaxSize > 0 {
+		config.MaxSize = &options.MaxSize
+	}
+	return &Task{dir: dir, config: config}
+}
+
+// Run cleans the directory. A canceled run returns the files deleted so far
+// along with the cancellation error.
+func (t *Task) Run() (*Result, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	t.mu.Lock()
+	t.cancel = cancel
+	t.mu.Unlock()
+
+	var errors int32
+	config := t.config
+	config.Callbacks.OnError = func(cleaner.ErrorInfo) { atomic.AddInt32(&errors, 1) }
+	c, err := cleaner.NewCleaner(config)
+	if err != nil {
+		return nil, err
+	}
+	report, err := c.Clean(ctx, t.dir)
+	return &Result{
+		ScannedFiles:     report.ScannedFiles,
+		DeletedFiles:     report.DeletedFiles,
+		DeletedSize:      report.DeletedSize,
+		DeletedBlockSize: report.DeletedBlockSize,
+		DeletedDirs:      report.DeletedDirs,
+		Errors:           int(atomic.LoadInt32(&errors)),
+		DurationMillis:   report.TotalDuration.Milliseconds(),
+	}, err
+}
+
+// Cancel stops a running task
+func (t *Task) Cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+// Clean cleans dir with the given options
+func Clean(dir string, options *Options) (*Result, error) {
+	return NewTask(dir, options).Run()
+}
+
+// GetUsage returns the disk usage of the file system containing dir
+func GetUsage(dir string) (*Usage, error) {
+	usage, err := (&cleaner.DefaultDiskInfoProvider{}).GetDiskUsage(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := usage.Validate(); err != nil {
+		return nil, err
+	}
+	return &Usage{
+		Total:       int64(usage.Total),
+		Free:        int64(usage.Free),
+		Used:        int64(usage.Used),
+		UsedPercent: usage.UsedPercent,
+	}, nil
+}
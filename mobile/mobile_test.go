@@ -0,0 +1,55 @@
+package mobile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClean(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i, name := range []string{"old.bak", "mid.bak", "new.bak"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, make([]byte, 4096), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-time.Duration(3-i) * time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Any file system has a byte free, nothing is deleted
+	result, err := Clean(tmpDir, &Options{MinFreeSpace: 1, TimeWindowSeconds: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DeletedFiles != 0 || result.Errors != 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Expected 3 files to remain, got %d", len(entries))
+	}
+}
+
+func TestCleanWithoutConstraint(t *testing.T) {
+	if _, err := Clean(t.TempDir(), nil); err == nil {
+		t.Error("Expected an error without a capacity constraint")
+	}
+}
+
+func TestGetUsage(t *testing.T) {
+	usage, err := GetUsage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total <= 0 || usage.Free > usage.Total {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+}
@@ -0,0 +1,109 @@
+package gobackupcleaner
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ncduEntry is the information object of a file or directory in ncdu's format
+type ncduEntry struct {
+	Name  string `json:"name"`
+	ASize int64  `json:"asize,omitempty"` // Apparent size
+	DSize int64  `json:"dsize,omitempty"` // Disk usage
+	MTime int64  `json:"mtime,omitempty"`
+}
+
+// ncduDir is a directory of the exported tree
+type ncduDir struct {
+	entry ncduEntry
+	files []ncduEntry
+	dirs  []*ncduDir
+	index map[string]*ncduDir
+}
+
+// dir returns the subdirectory with the given name, creating it if needed
+func (d *ncduDir) dir(name string) *ncduDir {
+	if sub, ok := d.index[name]; ok {
+		return sub
+	}
+	sub := &ncduDir{entry: ncduEntry{Name: name}, index: make(map[string]*ncduDir)}
+	d.index[name] = sub
+	d.dirs = append(d.dirs, sub)
+	return sub
+}
+
+// exportNcdu writes the directory tree in ncdu's JSON export format (version 1.2).
+// Directories are arrays whose first element describes the directory itself;
+// opaque directories carry their total size and have no children.
+func (r *ScanResult) exportNcdu(w io.Writer) error {
+	rootName := r.DirPath
+	if abs, err := filepath.Abs(r.DirPath); err == nil {
+		rootName = abs
+	}
+	root := &ncduDir{entry: ncduEntry{Name: rootName}, index: make(map[string]*ncduDir)}
+
+	for _, f := range r.Files {
+		parts := strings.Split(f.Path, "/")
+		d := root
+		for _, name := range parts[:len(parts)-1] {
+			d = d.dir(name)
+		}
+		entry := ncduEntry{
+			Name:  parts[len(parts)-1],
+			ASize: f.Size,
+			DSize: f.BlockSize,
+			MTime: f.ModTime.Unix(),
+		}
+		if f.IsDir {
+			d.dir(entry.Name).entry = entry
+		} else {
+			d.files = append(d.files, entry)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	header, err := json.Marshal(map[string]any{
+		"progname":  "go-backup-cleaner",
+		"timestamp": r.ScannedAt.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString("[1,2,")
+	bw.Write(header)
+	bw.WriteString(",\n")
+	if err := writeNcduDir(bw, root); err != nil {
+		return err
+	}
+	bw.WriteString("]\n")
+	return bw.Flush()
+}
+
+// writeNcduDir writes a directory and its contents as a JSON array
+func writeNcduDir(w *bufio.Writer, d *ncduDir) error {
+	data, err := json.Marshal(d.entry)
+	if err != nil {
+		return err
+	}
+	w.WriteByte('[')
+	w.Write(data)
+	for _, f := range d.files {
+		data, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		w.WriteString(",\n")
+		w.Write(data)
+	}
+	for _, sub := range d.dirs {
+		w.WriteString(",\n")
+		if err := writeNcduDir(w, sub); err != nil {
+			return err
+		}
+	}
+	w.WriteByte(']')
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build linux
+// +build linux
+
+package gobackupcleaner
+
+import "syscall"
+
+// noAtimeFlag is the open flag that prevents access time updates
+const noAtimeFlag = syscall.O_NOATIME
@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package gobackupcleaner
+
+// noAtimeFlag is not available on this platform
+const noAtimeFlag = 0
@@ -0,0 +1,56 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bundleExtensions are the extensions of macOS disk image bundles, such as
+// the Time Machine backups on network volumes. Deleting single band files
+// out of a bundle corrupts the whole image.
+var bundleExtensions = []string{".sparsebundle", ".backupbundle"}
+
+// isBundle reports whether a directory is a disk image bundle
+func isBundle(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, bundleExt := range bundleExtensions {
+		if ext == bundleExt {
+			return true
+		}
+	}
+	return false
+}
+
+// isOpaqueDir reports whether a directory at the given depth is deleted as
+// a whole: below MaxDepth, a temp directory, a snapshot, a bundle or
+// matching OpaqueDirPatterns
+func (c *CleaningConfig) isOpaqueDir(path string, depth int, run *runState) bool {
+	return c.isOpaqueDepth(depth) || c.isTempDir(path) || run.isSnapshot(path) || isBundle(path) || c.matchesOpaquePattern(path)
+}
+
+// matchesOpaquePattern reports whether a directory name matches one of
+// OpaqueDirPatterns
+func (c *CleaningConfig) matchesOpaquePattern(path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range c.OpaqueDirPatterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeOpaque summarizes an opaque directory, with the accounting of
+// loadSnapshots for snapshots. Bundles are as old as their own modification
+// time, as the image updates only some of its bands.
+func (c *CleaningConfig) summarizeOpaque(path string, info os.FileInfo, space spaceFunc, run *runState) (dirSummary, error) {
+	if run.isSnapshot(path) {
+		return run.snapshots[path], nil
+	}
+	summary, err := summarizeDir(path, space, c.fs())
+	if err == nil && isBundle(path) {
+		summary.modTime = info.ModTime()
+	}
+	return summary, err
+}
@@ -0,0 +1,113 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsBundle(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/tm/MacBook.sparsebundle": true,
+		"/tm/MacBook.backupbundle": true,
+		"/tm/Disk.SparseBundle":    true,
+		"/tm/sparsebundle":         false,
+		"/tm/MacBook.dmg":          false,
+	} {
+		if got := isBundle(path); got != want {
+			t.Errorf("isBundle(%q) = %t, want %t", path, got, want)
+		}
+	}
+}
+
+func TestBundleIsOpaque(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	bundle := filepath.Join(tmpDir, "MacBook.sparsebundle")
+	if err := os.MkdirAll(filepath.Join(bundle, "bands"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Old bands next to a band rewritten yesterday
+	for name, age := range map[string]time.Duration{"bands/0": 400 * time.Hour, "bands/1": 400 * time.Hour, "bands/2": 24 * time.Hour, "Info.plist": 400 * time.Hour} {
+		if err := createTestFile(t, filepath.Join(bundle, name), 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundleTime := now.Add(-72 * time.Hour)
+	if err := os.Chtimes(bundle, bundleTime, bundleTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "new.tar"), 4096, now); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Scan(tmpDir, CleaningConfig{DiskInfo: &failingDiskInfoProvider{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 2 || result.Files[0].Path != "MacBook.sparsebundle" || !result.Files[0].IsDir {
+		t.Fatalf("Expected the bundle as one unit, got %+v", result.Files)
+	}
+	if bundle := result.Files[0]; bundle.BlockSize != 4*4096 || !bundle.ModTime.Equal(bundleTime) {
+		t.Errorf("Expected the bundle to total its bands and keep its own mtime, got %+v", bundle)
+	}
+
+	// The bundle is deleted as a whole, never band by band
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:    int64Ptr(8192),
+		TimeWindow: time.Hour,
+		DiskInfo:   &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 4 {
+		t.Errorf("Expected the 4 files of the bundle to be deleted, got %d", report.DeletedFiles)
+	}
+	if _, err := os.Stat(bundle); !os.IsNotExist(err) {
+		t.Errorf("Expected the bundle to be deleted, got %v", err)
+	}
+}
+
+func TestOpaqueDirPatterns(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	chunks := filepath.Join(tmpDir, "job.vbk.d")
+	if err := os.MkdirAll(filepath.Join(chunks, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Old chunks next to a chunk written yesterday
+	for name, age := range map[string]time.Duration{"data/0": 400 * time.Hour, "data/1": 400 * time.Hour, "data/2": 24 * time.Hour} {
+		if err := createTestFile(t, filepath.Join(chunks, name), 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "new.tar"), 4096, now); err != nil {
+		t.Fatal(err)
+	}
+
+	config := CleaningConfig{
+		OpaqueDirPatterns: []string{"*.vbk.d", "*.chunks"},
+		DiskInfo:          &failingDiskInfoProvider{},
+	}
+	result, err := Scan(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 2 || result.Files[0].Path != "job.vbk.d" || !result.Files[0].IsDir {
+		t.Fatalf("Expected the chunk directory as one unit, got %+v", result.Files)
+	}
+	if unit := result.Files[0]; unit.BlockSize != 3*4096 || !unit.ModTime.Equal(now.Add(-24*time.Hour)) {
+		t.Errorf("Expected the chunk directory to total its chunks and take the newest mtime, got %+v", unit)
+	}
+
+	// Without the pattern the old chunks are deleted one by one
+	result, err = Scan(tmpDir, CleaningConfig{DiskInfo: &failingDiskInfoProvider{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 4 {
+		t.Errorf("Expected the chunks to be scanned separately without the pattern, got %+v", result.Files)
+	}
+}
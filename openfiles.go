@@ -0,0 +1,34 @@
+package gobackupcleaner
+
+import "os"
+
+// openFileReason is the protection reason of files kept by SkipOpenFiles
+const openFileReason = "open by a process"
+
+// fileID identifies a file independently of the path it was opened by
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// loadOpenFiles lists the files open by any process when SkipOpenFiles is
+// set, once per run
+func (c *CleaningConfig) loadOpenFiles() (map[fileID]struct{}, error) {
+	if !c.SkipOpenFiles {
+		return nil, nil
+	}
+	return listOpenFiles()
+}
+
+// isOpenFile reports whether a scanned file was open when the run started
+func (r *runState) isOpenFile(info os.FileInfo) bool {
+	if r == nil || r.openFiles == nil {
+		return false
+	}
+	id, ok := fileIDOf(info)
+	if !ok {
+		return false
+	}
+	_, open := r.openFiles[id]
+	return open
+}
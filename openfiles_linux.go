@@ -0,0 +1,62 @@
+//go:build linux
+// +build linux
+
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// listOpenFiles returns the files open by the processes visible in /proc,
+// like fuser. The descriptors of processes of other users are only visible
+// to root.
+func listOpenFiles() (map[fileID]struct{}, error) {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[fileID]struct{})
+	for _, proc := range procs {
+		if !proc.IsDir() || !isPID(proc.Name()) {
+			continue
+		}
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			// Exited, or owned by another user
+			continue
+		}
+		for _, fd := range fds {
+			// Stat follows the descriptor to the open file
+			info, err := os.Stat(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if id, ok := fileIDOf(info); ok {
+				files[id] = struct{}{}
+			}
+		}
+	}
+	return files, nil
+}
+
+// isPID reports whether a /proc entry is a process
+func isPID(name string) bool {
+	for _, c := range name {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// fileIDOf returns the device and inode of a file
+func fileIDOf(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
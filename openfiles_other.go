@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package gobackupcleaner
+
+import "os"
+
+// listOpenFiles is not available on this platform, SkipOpenFiles is ignored
+func listOpenFiles() (map[fileID]struct{}, error) {
+	return nil, nil
+}
+
+// fileIDOf is not needed without listOpenFiles
+func fileIDOf(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,47 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSkipOpenFiles(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("open files are only detected on Linux")
+	}
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for name, age := range map[string]time.Duration{"uploading.tar": 96 * time.Hour, "old.tar": 72 * time.Hour, "new.tar": 24 * time.Hour} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Still being written by another process
+	f, err := os.OpenFile(filepath.Join(tmpDir, "uploading.tar"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:       int64Ptr(8192),
+		TimeWindow:    time.Hour,
+		SkipOpenFiles: true,
+		DiskInfo:      &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "uploading.tar")); err != nil {
+		t.Errorf("Expected the open file to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "old.tar")); !os.IsNotExist(err) {
+		t.Errorf("Expected the next oldest file to be deleted instead")
+	}
+	if report.KeptFiles != 1 || len(report.Protections) != 1 || report.Protections[0].Reason != openFileReason {
+		t.Errorf("Expected the open file to be kept as open, got %d files, %+v", report.KeptFiles, report.Protections)
+	}
+}
@@ -0,0 +1,194 @@
+package gobackupcleaner
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RetentionOverride overrides the retention of the files below a subdirectory.
+// It is layered over the global configuration: files not covered by any
+// override, or not affected by it, are still subject to age-based deletion.
+type RetentionOverride struct {
+	Path        string        // Directory relative to the target directory (e.g. "db/")
+	KeepLatestN int           // Never delete the newest N files below Path (0 disables)
+	MaxAge      time.Duration // Delete files older than this regardless of free space (0 disables)
+}
+
+// resolvedOverride is an override with its absolute directory
+type resolvedOverride struct {
+	RetentionOverride
+	dir string
+}
+
+// resolveOverrides converts the overrides to absolute directories below rootPath
+func resolveOverrides(overrides []RetentionOverride, rootPath string) []resolvedOverride {
+	resolved := make([]resolvedOverride, 0, len(overrides))
+	for _, o := range overrides {
+		resolved = append(resolved, resolvedOverride{
+			RetentionOverride: o,
+			dir:               filepath.Join(rootPath, filepath.Clean(o.Path)),
+		})
+	}
+	return resolved
+}
+
+// override returns the index of the override with the longest path that
+// contains path, or -1 if none applies
+func (c *classifier) override(path string) int {
+	match := -1
+	for i, o := range c.overrides {
+		if !strings.HasPrefix(path, o.dir+string(filepath.Separator)) {
+			continue
+		}
+		if match < 0 || len(o.dir) > len(c.overrides[match].dir) {
+			match = i
+		}
+	}
+	return match
+}
+
+// isExpired reports whether a file is older than the MaxAge of its override,
+// or of the configuration if its override sets none
+func (c *classifier) isExpired(path string, modTime time.Time) bool {
+	maxAge := c.config.MaxAge
+	if i := c.override(path); i >= 0 && c.overrides[i].MaxAge > 0 {
+		maxAge = c.overrides[i].MaxAge
+	}
+	return maxAge > 0 && c.now.Sub(modTime) > maxAge
+}
+
+// hasMaxAge reports whether files expire, by MaxAge or the MaxAge of an
+// override, so runs delete files even while the constraints are met
+func (c *CleaningConfig) hasMaxAge() bool {
+	if c.MaxAge > 0 {
+		return true
+	}
+	for _, o := range c.Overrides {
+		if o.MaxAge > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// expiredFiles returns the expired files among the priority files
+func expiredFiles(files []fileInfo) []fileInfo {
+	var expired []fileInfo
+	for _, fi := range files {
+		if fi.class == classExpired {
+			expired = append(expired, fi)
+		}
+	}
+	return expired
+}
+
+// latestGroup holds files of which the newest keep are protected
+type latestGroup struct {
+	keep   int
+	reason string
+	files  []fileInfo
+}
+
+// protectLatest removes the newest KeepLatestN files of each override, the
+// newest MinKeepFiles files and the newest MinKeepPerDir files of each
+// directory from the scanned files so they are not deleted, and returns
+// their paths
+func (s *scanner) protectLatest() map[string]struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Group the files by override, the whole tree and directory
+	groups := make(map[string]*latestGroup)
+	add := func(key string, keep int, reason string, fi fileInfo) {
+		g := groups[key]
+		if g == nil {
+			g = &latestGroup{keep: keep, reason: reason}
+			groups[key] = g
+		}
+		g.files = append(g.files, fi)
+	}
+	collect := func(fi fileInfo) {
+		if i := s.classifier.override(fi.path); i >= 0 && s.classifier.overrides[i].KeepLatestN > 0 {
+			o := s.classifier.overrides[i]
+			add("override "+o.dir, o.KeepLatestN, "KeepLatestN "+o.Path, fi)
+		}
+		// Files deleted first must not stand in for the backups
+		if fi.class != classNormal && fi.class != classExpired {
+			return
+		}
+		if s.config.MinKeepFiles > 0 {
+			add("tree", s.config.MinKeepFiles, "MinKeepFiles", fi)
+		}
+		if s.config.MinKeepPerDir > 0 {
+			add("dir "+filepath.Dir(fi.path), s.config.MinKeepPerDir, "MinKeepPerDir", fi)
+		}
+	}
+	for _, slot := range s.timeSlots.slots {
+		for _, fi := range slot.files {
+			collect(fi)
+		}
+	}
+	for _, fi := range s.priority {
+		collect(fi)
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	// Files kept by several groups count for the first in order
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	protected := make(map[string]struct{})
+	for _, key := range keys {
+		g := groups[key]
+		files := g.files
+		sort.Slice(files, func(a, b int) bool {
+			return files[a].modTime.After(files[b].modTime)
+		})
+		keep := min(g.keep, len(files))
+		for _, fi := range files[:keep] {
+			if _, ok := protected[fi.path]; ok {
+				continue
+			}
+			protected[fi.path] = struct{}{}
+			s.keptLatestFiles++
+			s.keep(fi, g.reason)
+		}
+	}
+
+	// Rebuild the time slots and priority files without the protected files
+	sorted := s.timeSlots.sorted()
+	slots := sorted[:0]
+	for _, slot := range sorted {
+		files := slot.files[:0]
+		slot.totalSize = 0
+		slot.totalBlockSize = 0
+		for _, fi := range slot.files {
+			if _, ok := protected[fi.path]; ok {
+				continue
+			}
+			files = append(files, fi)
+			slot.totalSize += fi.size
+			slot.totalBlockSize += fi.blockSize
+		}
+		slot.files = files
+		if len(files) > 0 {
+			slots = append(slots, slot)
+		}
+	}
+	s.timeSlots.retain(slots)
+	priority := s.priority[:0]
+	for _, fi := range s.priority {
+		if _, ok := protected[fi.path]; !ok {
+			priority = append(priority, fi)
+		}
+	}
+	s.priority = priority
+
+	return protected
+}
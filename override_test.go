@@ -0,0 +1,351 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOverrideLongestPrefix(t *testing.T) {
+	config := CleaningConfig{
+		Overrides: []RetentionOverride{
+			{Path: "db/", KeepLatestN: 14},
+			{Path: "db/archive", MaxAge: 24 * time.Hour},
+			{Path: "logs/", MaxAge: 7 * 24 * time.Hour},
+		},
+	}
+	c := newClassifier(&config, nil, "/backup", time.Now())
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"/backup/db/daily.dump", 0},
+		{"/backup/db/archive/2024.dump", 1},
+		{"/backup/logs/app.log", 2},
+		{"/backup/dbx/other.dump", -1},
+		{"/backup/root.txt", -1},
+	}
+	for _, tt := range tests {
+		if got := c.override(tt.path); got != tt.expected {
+			t.Errorf("override(%q) = %d, want %d", tt.path, got, tt.expected)
+		}
+	}
+}
+
+// TestRetentionOverrides tests KeepLatestN and MaxAge overrides layered over the global policy
+func TestRetentionOverrides(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-override-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	for _, dir := range []string{"db", "logs"} {
+		if err := os.Mkdir(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Five old database dumps, one per day
+	for i := 1; i <= 5; i++ {
+		path := filepath.Join(tmpDir, "db", fmt.Sprintf("dump%d.sql", i))
+		if err := createTestFile(t, path, 1024*1024, now.Add(-time.Duration(10-i)*24*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "logs", "old.log"), 1024, now.Add(-10*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "logs", "recent.log"), 1024, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The limit only leaves room for the kept dumps and the recent log
+	maxSize := int64(2*1024*1024 + 8192)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:    &maxSize,
+		TimeWindow: time.Hour,
+		Overrides: []RetentionOverride{
+			{Path: "db/", KeepLatestN: 2},
+			{Path: "logs/", MaxAge: 7 * 24 * time.Hour},
+		},
+		DiskInfo: &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.KeptLatestFiles != 2 {
+		t.Errorf("Expected 2 kept files, got %d", report.KeptLatestFiles)
+	}
+	if len(report.Protections) != 1 || report.Protections[0].Reason != "KeepLatestN db/" || report.Protections[0].Files != 2 {
+		t.Errorf("Unexpected protections %+v", report.Protections)
+	}
+	if report.DeletedExpiredFiles != 1 {
+		t.Errorf("Expected 1 expired file, got %d", report.DeletedExpiredFiles)
+	}
+	for _, name := range []string{"dump4.sql", "dump5.sql"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, "db", name)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+	}
+	for _, name := range []string{"dump1.sql", "dump2.sql", "dump3.sql"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, "db", name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "logs", "old.log")); !os.IsNotExist(err) {
+		t.Error("Expected old.log to be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "logs", "recent.log")); err != nil {
+		t.Errorf("Expected recent.log to remain: %v", err)
+	}
+}
+
+// TestMaxAge tests that files older than MaxAge are deleted even while the
+// capacity constraints are met, and nothing else is
+func TestMaxAge(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "db"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	day := 24 * time.Hour
+	files := map[string]time.Duration{
+		"old.tar":    40 * day,
+		"recent.tar": day,
+		"db/old.sql": 40 * day, // Its override keeps files for 90 days
+	}
+	for name, age := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 1024, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Broken files are only deleted first once cleaning is needed
+	if err := createTestFile(t, filepath.Join(tmpDir, "empty.tar"), 0, now.Add(-day)); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MinFreeSpace:      int64Ptr(100),
+		MaxAge:            30 * day,
+		DeleteBrokenFirst: true,
+		Overrides:         []RetentionOverride{{Path: "db", MaxAge: 90 * day}},
+		DiskInfo: &StaticDiskInfoProvider{
+			Usage: &DiskUsage{Total: 1000, Used: 100, Free: 900, UsedPercent: 10},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 || report.DeletedExpiredFiles != 1 {
+		t.Errorf("Expected only the expired file to be deleted, got %d (%d expired)", report.DeletedFiles, report.DeletedExpiredFiles)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "old.tar")); !os.IsNotExist(err) {
+		t.Error("Expected old.tar to be deleted")
+	}
+	for _, name := range []string{"recent.tar", "db/old.sql", "empty.tar"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+	}
+
+	if _, err := NewCleaner(CleaningConfig{MinFreeSpace: int64Ptr(100), MaxAge: -day}); err == nil {
+		t.Error("Expected a negative MaxAge to be rejected")
+	}
+}
+
+// TestMaxAgeBeforePriorityClasses tests that expired files are deleted
+// while the constraints are met even if they are expendable or unlisted,
+// and that referenced files are kept
+func TestMaxAgeBeforePriorityClasses(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Now()
+	diskInfo := &StaticDiskInfoProvider{Usage: &DiskUsage{Total: 1000, Used: 100, Free: 900, UsedPercent: 10}}
+
+	t.Run("ExpendableDirs", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(tmpDir, "cache"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, age := range map[string]time.Duration{"cache/old.tar": 40 * day, "cache/recent.tar": day} {
+			if err := createTestFile(t, filepath.Join(tmpDir, name), 1024, now.Add(-age)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		report, err := CleanBackup(tmpDir, CleaningConfig{
+			MinFreeSpace:   int64Ptr(100),
+			MaxAge:         30 * day,
+			ExpendableDirs: []string{"cache"},
+			DiskInfo:       diskInfo,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.DeletedFiles != 1 || report.DeletedExpiredFiles != 1 {
+			t.Errorf("Expected the expired expendable file to be deleted, got %d (%d expired)", report.DeletedFiles, report.DeletedExpiredFiles)
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "cache", "recent.tar")); err != nil {
+			t.Errorf("Expected recent.tar to be kept: %v", err)
+		}
+	})
+
+	t.Run("ReferencedList", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		for _, name := range []string{"referenced.pack", "unlisted.pack", "recent.pack"} {
+			age := 40 * day
+			if name == "recent.pack" {
+				age = day
+			}
+			if err := createTestFile(t, filepath.Join(tmpDir, name), 1024, now.Add(-age)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		report, err := CleanBackup(tmpDir, CleaningConfig{
+			MinFreeSpace:   int64Ptr(100),
+			MaxAge:         30 * day,
+			ReferencedList: strings.NewReader("referenced.pack\n"),
+			DiskInfo:       diskInfo,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.DeletedFiles != 1 {
+			t.Errorf("Expected only the expired unlisted file to be deleted, got %d", report.DeletedFiles)
+		}
+		if _, err := os.Stat(filepath.Join(tmpDir, "unlisted.pack")); !os.IsNotExist(err) {
+			t.Error("Expected unlisted.pack to be deleted")
+		}
+		for _, name := range []string{"referenced.pack", "recent.pack"} {
+			if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+				t.Errorf("Expected %s to be kept: %v", name, err)
+			}
+		}
+	})
+}
+
+// TestMaxAgeRuleKeep tests that files kept by a rule are not deleted by MaxAge
+func TestMaxAgeRuleKeep(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for _, name := range []string{"index.manifest", "old.tar"} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 1024, now.Add(-60*24*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MinFreeSpace: int64Ptr(100),
+		MaxAge:       30 * 24 * time.Hour,
+		Rules:        []Rule{{Match: RuleMatch{Glob: "*.manifest"}, Action: RuleKeep}},
+		DiskInfo:     &StaticDiskInfoProvider{Usage: &DiskUsage{Total: 1000, Used: 100, Free: 900, UsedPercent: 10}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 || report.DeletedExpiredFiles != 1 {
+		t.Errorf("Expected only the expired backup to be deleted, got %d (%d expired)", report.DeletedFiles, report.DeletedExpiredFiles)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "index.manifest")); err != nil {
+		t.Errorf("Expected the kept manifest to survive: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "old.tar")); !os.IsNotExist(err) {
+		t.Error("Expected old.tar to be deleted")
+	}
+}
+
+// TestMinKeepFilesSkipsBrokenFiles tests that a broken file newer than the
+// backups does not count toward MinKeepFiles
+func TestMinKeepFilesSkipsBrokenFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	files := []struct {
+		name string
+		size int64
+		age  time.Duration
+	}{
+		{"backup0.tar", 1024, 3 * time.Hour},
+		{"backup1.tar", 1024, 2 * time.Hour},
+		{"truncated.tar", 0, time.Hour},
+	}
+	for _, f := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, f.name), f.size, now.Add(-f.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MinFreeSpace:      int64Ptr(1 << 40),
+		TimeWindow:        time.Minute,
+		MinKeepFiles:      1,
+		DeleteBrokenFirst: true,
+		DiskInfo:          &mockDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.KeptLatestFiles != 1 {
+		t.Errorf("Expected 1 kept file, got %d", report.KeptLatestFiles)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "backup1.tar")); err != nil {
+		t.Errorf("Expected the newest backup to be kept: %v", err)
+	}
+	for _, name := range []string{"backup0.tar", "truncated.tar"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+}
+
+// TestMinKeepFiles tests that the newest files survive a target that cannot
+// be reached without them
+func TestMinKeepFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for _, dir := range []string{"host1", "host2"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 4; i++ {
+			// host1 holds the newer backups
+			age := time.Duration(i+1) * time.Hour
+			if dir == "host2" {
+				age += 24 * time.Hour
+			}
+			if err := createTestFile(t, filepath.Join(tmpDir, dir, fmt.Sprintf("backup%d.tar", i)), 1024, now.Add(-age)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The target frees more than all the files
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MinFreeSpace:  int64Ptr(1 << 40),
+		TimeWindow:    time.Minute,
+		MinKeepFiles:  3,
+		MinKeepPerDir: 1,
+		DiskInfo:      &mockDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.KeptLatestFiles != 4 || report.DeletedFiles != 4 {
+		t.Errorf("Expected 4 kept and 4 deleted files, got %d kept and %d deleted", report.KeptLatestFiles, report.DeletedFiles)
+	}
+	for _, name := range []string{"host1/backup0.tar", "host1/backup1.tar", "host1/backup2.tar", "host2/backup0.tar"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+	}
+
+	if _, err := NewCleaner(CleaningConfig{MinFreeSpace: int64Ptr(100), MinKeepFiles: 1, MaxMemoryBytes: 1 << 20}); err == nil {
+		t.Error("Expected MinKeepFiles with MaxMemoryBytes to be rejected")
+	}
+}
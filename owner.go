@@ -0,0 +1,204 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+)
+
+// OwnerUsage is the space used and freed per file owner (see OwnerReport)
+type OwnerUsage struct {
+	Owner        string // User ID
+	Name         string // User name, empty if it cannot be resolved
+	ScannedFiles int
+	ScannedSize  int64 // Block-aligned size in bytes
+	DeletedFiles int
+	DeletedSize  int64 // Block-aligned size in bytes
+	Quota        int64 // From OwnerQuotas, 0 if none
+}
+
+// tracksOwners reports whether the owners of the files are recorded
+func (c *CleaningConfig) tracksOwners() bool {
+	return c.OwnerReport || len(c.OwnerQuotas) > 0
+}
+
+// resolveOwnerQuotas converts the keys of OwnerQuotas, user IDs or names, to
+// user IDs
+func (c *CleaningConfig) resolveOwnerQuotas() (map[uint32]int64, error) {
+	if len(c.OwnerQuotas) == 0 {
+		return nil, nil
+	}
+	quotas := make(map[uint32]int64, len(c.OwnerQuotas))
+	for owner, quota := range c.OwnerQuotas {
+		uid, err := strconv.ParseUint(owner, 10, 32)
+		if err != nil {
+			u, lookupErr := user.Lookup(owner)
+			if lookupErr != nil {
+				return nil, fmt.Errorf("owner quota %q: %w", owner, lookupErr)
+			}
+			if uid, err = strconv.ParseUint(u.Uid, 10, 32); err != nil {
+				return nil, fmt.Errorf("owner quota %q: user ID %q is not numeric", owner, u.Uid)
+			}
+		}
+		quotas[uint32(uid)] = quota
+	}
+	return quotas, nil
+}
+
+// addOwner counts a scanned file or opaque directory toward its owner
+func (s *scanner) addOwner(info os.FileInfo, fi *fileInfo) {
+	uid, ok := ownerOf(info)
+	if !ok {
+		return
+	}
+	fi.owner = uid
+	s.ownersMu.Lock()
+	defer s.ownersMu.Unlock()
+	if s.owners == nil {
+		s.owners = make(map[uint32]classStats)
+	}
+	stats := s.owners[uid]
+	stats.files++
+	stats.size += fi.blockSize
+	s.owners[uid] = stats
+}
+
+// applyOwnerQuotas moves the oldest files of each owner above its quota
+// from age-based deletion to the files deleted ahead of it, until the owner
+// is within its quota, and returns their paths. Kept files count toward the
+// quota but are not deleted.
+func (s *scanner) applyOwnerQuotas(quotas map[uint32]int64) map[string]struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ownersMu.Lock()
+	defer s.ownersMu.Unlock()
+
+	excess := make(map[uint32]int64)
+	for uid, quota := range quotas {
+		if used := s.owners[uid].size; used > quota {
+			excess[uid] = used - quota
+		}
+	}
+	if len(excess) == 0 {
+		return nil
+	}
+
+	var files []fileInfo
+	for _, slot := range s.timeSlots.slots {
+		for _, fi := range slot.files {
+			if excess[fi.owner] > 0 {
+				files = append(files, fi)
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.Before(files[j].modTime)
+		}
+		return files[i].path < files[j].path
+	})
+	overQuota := make(map[string]struct{})
+	for _, fi := range files {
+		if excess[fi.owner] <= 0 {
+			continue
+		}
+		excess[fi.owner] -= fi.blockSize
+		overQuota[fi.path] = struct{}{}
+	}
+
+	// Move the files out of their slots, dropping slots left empty
+	sorted := s.timeSlots.sorted()
+	slots := sorted[:0]
+	for _, slot := range sorted {
+		files := slot.files[:0]
+		for _, fi := range slot.files {
+			if _, ok := overQuota[fi.path]; !ok {
+				files = append(files, fi)
+				continue
+			}
+			slot.totalSize -= fi.size
+			slot.totalBlockSize -= fi.blockSize
+			fi.class = classOverQuota
+			s.priority = append(s.priority, fi)
+		}
+		slot.files = files
+		if len(files) > 0 {
+			slots = append(slots, slot)
+		}
+	}
+	s.timeSlots.retain(slots)
+	return overQuota
+}
+
+// getOwners returns the scanned files and sizes per owner
+func (s *scanner) getOwners() map[uint32]classStats {
+	s.ownersMu.Lock()
+	defer s.ownersMu.Unlock()
+	owners := make(map[uint32]classStats, len(s.owners))
+	for uid, stats := range s.owners {
+		owners[uid] = stats
+	}
+	return owners
+}
+
+// quotaClass returns classOverQuota for a file selected by the owner quotas
+func (d *deleter) quotaClass(path string, class fileClass) fileClass {
+	if class == classNormal {
+		if _, ok := d.overQuota[path]; ok {
+			return classOverQuota
+		}
+	}
+	return class
+}
+
+// recordOwner counts a deleted file or opaque directory toward its owner
+func (d *deleter) recordOwner(info os.FileInfo, blockSize int64) {
+	if !d.config.tracksOwners() {
+		return
+	}
+	uid, ok := ownerOf(info)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ownerDeleted == nil {
+		d.ownerDeleted = make(map[uint32]classStats)
+	}
+	stats := d.ownerDeleted[uid]
+	stats.files++
+	stats.size += blockSize
+	d.ownerDeleted[uid] = stats
+}
+
+// ownerReport combines the scanned and deleted files per owner, sorted by
+// user ID
+func ownerReport(scanned, deleted map[uint32]classStats, quotas map[uint32]int64) []OwnerUsage {
+	if len(scanned) == 0 {
+		return nil
+	}
+	uids := make([]uint32, 0, len(scanned))
+	for uid := range scanned {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	usage := make([]OwnerUsage, 0, len(uids))
+	for _, uid := range uids {
+		owner := strconv.FormatUint(uint64(uid), 10)
+		u := OwnerUsage{
+			Owner:        owner,
+			ScannedFiles: scanned[uid].files,
+			ScannedSize:  scanned[uid].size,
+			DeletedFiles: deleted[uid].files,
+			DeletedSize:  deleted[uid].size,
+			Quota:        quotas[uid],
+		}
+		if account, err := user.LookupId(owner); err == nil {
+			u.Name = account.Username
+		}
+		usage = append(usage, u)
+	}
+	return usage
+}
@@ -0,0 +1,65 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestOwnerQuotas(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file owners are not available on Windows")
+	}
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i, age := range []time.Duration{96 * time.Hour, 72 * time.Hour, 48 * time.Hour, time.Hour} {
+		path := filepath.Join(tmpDir, "dump"+strconv.Itoa(i)+".sql")
+		if err := createTestFile(t, path, 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The files fit into MaxSize, but their owner may only keep two of them
+	uid := strconv.Itoa(os.Getuid())
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:     int64Ptr(1 << 20),
+		OwnerQuotas: map[string]int64{uid: 8192},
+		TimeWindow:  time.Hour,
+		DiskInfo:    &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 2 || report.DeletedOverQuotaFiles != 2 {
+		t.Errorf("Expected the 2 oldest files to be deleted over quota, got %d and %d", report.DeletedFiles, report.DeletedOverQuotaFiles)
+	}
+	for _, name := range []string{"dump0.sql", "dump1.sql"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+
+	if len(report.Owners) != 1 {
+		t.Fatalf("Expected 1 owner, got %+v", report.Owners)
+	}
+	owner := report.Owners[0]
+	if owner.Owner != uid || owner.ScannedFiles != 4 || owner.DeletedFiles != 2 || owner.DeletedSize != 8192 || owner.Quota != 8192 {
+		t.Errorf("Unexpected owner usage %+v", owner)
+	}
+}
+
+func TestOwnerQuotasValidation(t *testing.T) {
+	config := CleaningConfig{MaxSize: int64Ptr(1 << 20), OwnerQuotas: map[string]int64{"0": -1}}
+	if _, err := NewCleaner(config); err != ErrInvalidConfig {
+		t.Errorf("Expected ErrInvalidConfig for a negative quota, got %v", err)
+	}
+
+	config.OwnerQuotas = map[string]int64{"no-such-user-backup-cleaner": 1}
+	config.DiskInfo = &failingDiskInfoProvider{}
+	if _, err := CleanBackup(t.TempDir(), config); err == nil {
+		t.Error("Expected an error for an unknown owner")
+	}
+}
@@ -0,0 +1,188 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pipelineCheckInterval is the number of scanned files between checks for
+// time slots that became certain to be deleted
+const pipelineCheckInterval = 256
+
+// pipeline deletes files while the scan is still running (see Pipeline).
+// Files are released to the delete workers as soon as they are certain to be
+// deleted whatever the rest of the scan finds:
+//
+//   - priority files are deleted regardless of the threshold
+//   - in MaxSize-only mode the threshold only moves to newer files as more
+//     files are found, so once the files in a slot and newer ones exceed
+//     MaxSize, all older slots are certain to be deleted
+//
+// With a target computed from disk usage the threshold moves to older files
+// as more files are found, and in FairShare mode each prefix has its own
+// threshold, so age-based deletion waits for the full scan.
+// Files below KeepLatestN overrides, or all files with MinKeepFiles or
+// MinKeepPerDir, are never released early, as the newest files are only
+// known after the scan.
+type pipeline struct {
+	ctx      context.Context
+	deleter  *deleter
+	maxSize  int64 // Size limit in MaxSize-only mode, -1 if slots cannot be released early
+	window   time.Duration
+	work     chan PlanFile // Bounded, so scanning blocks while deletion falls behind
+	wg       sync.WaitGroup
+	errMu    sync.Mutex
+	firstErr error
+
+	// Guarded by the scanner mutex
+	released map[slotKey]struct{} // Slots certain to be deleted
+	added    int                  // Files added since the last check
+	files    int                  // Number of released files
+}
+
+// newPipeline starts the delete workers of a pipeline
+func newPipeline(ctx context.Context, config *CleaningConfig, d *deleter, targetSize int64) *pipeline {
+	p := &pipeline{
+		ctx:      ctx,
+		deleter:  d,
+		maxSize:  -1,
+		window:   config.TimeWindow,
+		work:     make(chan PlanFile, d.workerCount*2),
+		released: make(map[slotKey]struct{}),
+	}
+	if targetSize == -1 && config.MaxSize != nil && !config.FairShare {
+		p.maxSize = *config.MaxSize
+	}
+
+	config.Stats.addWorkers(d.workerCount)
+	for i := 0; i < d.workerCount; i++ {
+		p.wg.Add(1)
+		go p.worker(&d.workerStats[i])
+	}
+	return p
+}
+
+// worker deletes released files
+func (p *pipeline) worker(stats *WorkerStats) {
+	defer p.wg.Done()
+	for file := range p.work {
+		if p.ctx.Err() != nil {
+			continue
+		}
+		start := time.Now()
+		// Released files are deleted only if they were not modified since the scan
+		if err := p.deleter.deleteCandidate(p.ctx, file, file.ModTime.Add(time.Nanosecond)); err != nil {
+			p.errMu.Lock()
+			if p.firstErr == nil {
+				p.firstErr = err
+			}
+			p.errMu.Unlock()
+			callSafe(p.deleter.config.Callbacks.OnError, ErrorInfo{
+				Type:  ErrorTypeDelete,
+				Path:  file.Path,
+				Error: err,
+			})
+		}
+		stats.Tasks++
+		stats.BusyTime += time.Since(start)
+	}
+}
+
+// submit queues released files, blocking while the delete workers are busy
+func (p *pipeline) submit(files []fileInfo) {
+	for _, fi := range files {
+		select {
+		case p.work <- newPlanFile(fi):
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// close waits for the queued files to be deleted and returns the first error
+func (p *pipeline) close() error {
+	close(p.work)
+	p.wg.Wait()
+	p.deleter.config.Stats.addWorkers(-p.deleter.workerCount)
+	return p.firstErr
+}
+
+// release hands a scanned file, and the files that became certain to be
+// deleted with it, to the pipeline
+func (s *scanner) release(fi fileInfo) {
+	if s.pipeline == nil {
+		return
+	}
+	s.mu.Lock()
+	files := s.releasable(fi)
+	s.pipeline.files += len(files)
+	s.mu.Unlock()
+	s.pipeline.submit(files)
+}
+
+// releasable returns the files that are certain to be deleted after fi was
+// added. The scanner mutex must be held.
+func (s *scanner) releasable(fi fileInfo) []fileInfo {
+	p := s.pipeline
+	if fi.class.isKept() || s.keepsLatest(fi.path) {
+		return nil
+	}
+	if fi.class != classNormal {
+		return []fileInfo{fi}
+	}
+	if p.maxSize < 0 {
+		return nil
+	}
+	if _, ok := p.released[slotKeyOf(fi.modTime.Truncate(p.window))]; ok {
+		return []fileInfo{fi}
+	}
+	p.added++
+	if p.added < pipelineCheckInterval {
+		return nil
+	}
+	p.added = 0
+
+	// Find the newest slot that is certain to be deleted. Kept files stay,
+	// so they count toward MaxSize like newer files.
+	slots := s.timeSlots.sorted()
+	size := s.keptBlockSize
+	certain := -1
+	for i := len(slots) - 1; i >= 0; i-- {
+		size += slots[i].totalBlockSize
+		if size > p.maxSize {
+			certain = i
+			break
+		}
+	}
+	if certain < 0 {
+		return nil
+	}
+
+	// Release the slots older than that one. Its own files may lie beyond
+	// the final threshold (see calculateThresholdForMaxSize).
+	var files []fileInfo
+	for _, slot := range slots[:certain] {
+		key := slotKeyOf(slot.time)
+		if _, ok := p.released[key]; ok {
+			continue
+		}
+		p.released[key] = struct{}{}
+		for _, f := range slot.files {
+			if !s.keepsLatest(f.path) {
+				files = append(files, f)
+			}
+		}
+	}
+	return files
+}
+
+// keepsLatest reports whether the newest files are kept among those of a
+// path: with MinKeepFiles, MinKeepPerDir or below an override with KeepLatestN
+func (s *scanner) keepsLatest(path string) bool {
+	if s.config.MinKeepFiles > 0 || s.config.MinKeepPerDir > 0 {
+		return true
+	}
+	i := s.classifier.override(path)
+	return i >= 0 && s.classifier.overrides[i].KeepLatestN > 0
+}
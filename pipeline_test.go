@@ -0,0 +1,137 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// createPipelineTree creates files one every 10 minutes and a stale temp file
+func createPipelineTree(t *testing.T, dir string, now time.Time) {
+	t.Helper()
+	for i := 0; i < 600; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("d%02d", i%20))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(sub, fmt.Sprintf("f%03d.bak", i))
+		if err := createTestFile(t, path, 4096, now.Add(-time.Duration(i+1)*10*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createTestFile(t, filepath.Join(dir, "upload.part"), 4096, now.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// remainingFiles lists the files below dir relative to dir
+func remainingFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestPipelineMatchesSequential(t *testing.T) {
+	now := time.Now()
+	sequentialDir := t.TempDir()
+	pipelinedDir := t.TempDir()
+	createPipelineTree(t, sequentialDir, now)
+	createPipelineTree(t, pipelinedDir, now)
+
+	maxSize := int64(100 * 4096)
+	config := CleaningConfig{
+		MaxSize:        &maxSize,
+		TimeWindow:     time.Hour,
+		CleanTempFiles: true,
+		DiskInfo:       &failingDiskInfoProvider{},
+	}
+
+	sequential, err := CleanBackup(sequentialDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var deletedBeforeScanComplete int
+	scanComplete := false
+	config.Pipeline = true
+	config.Callbacks.OnFileDeleted = func(FileDeletedInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !scanComplete {
+			deletedBeforeScanComplete++
+		}
+	}
+	config.Callbacks.OnScanComplete = func(ScanCompleteInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		scanComplete = true
+	}
+	pipelined, err := CleanBackup(pipelinedDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pipelined.DeletedFiles != sequential.DeletedFiles || pipelined.DeletedBlockSize != sequential.DeletedBlockSize {
+		t.Errorf("Pipelined run deleted %d files (%d bytes), sequential run %d files (%d bytes)",
+			pipelined.DeletedFiles, pipelined.DeletedBlockSize, sequential.DeletedFiles, sequential.DeletedBlockSize)
+	}
+	if pipelined.ReclaimedTempFiles != 1 {
+		t.Errorf("Expected the temp file to be reclaimed, got %d", pipelined.ReclaimedTempFiles)
+	}
+	if pipelined.PipelinedFiles == 0 || deletedBeforeScanComplete == 0 {
+		t.Errorf("Expected files to be deleted while scanning, got %d released and %d deleted",
+			pipelined.PipelinedFiles, deletedBeforeScanComplete)
+	}
+
+	seqFiles, pipeFiles := remainingFiles(t, sequentialDir), remainingFiles(t, pipelinedDir)
+	if fmt.Sprint(seqFiles) != fmt.Sprint(pipeFiles) {
+		t.Errorf("Remaining files differ: sequential %d, pipelined %d", len(seqFiles), len(pipeFiles))
+	}
+}
+
+func TestPipelineWaitsForDiskUsageThreshold(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i := 0; i < 300; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("f%03d.bak", i))
+		if err := createTestFile(t, path, 4096, now.Add(-time.Duration(i+1)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The threshold depends on all files, so nothing is released early
+	maxUsage := float64(70)
+	report, err := CleanBackup(dir, CleaningConfig{
+		MaxUsagePercent: &maxUsage,
+		Pipeline:        true,
+		DiskInfo:        &mockDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.PipelinedFiles != 0 {
+		t.Errorf("Expected no files released while scanning, got %d", report.PipelinedFiles)
+	}
+	if report.DeletedFiles == 0 {
+		t.Error("Expected files to be deleted after the scan")
+	}
+}
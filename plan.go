@@ -0,0 +1,238 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// CleaningPlan represents what a cleaning run would delete, computed without deleting anything
+type CleaningPlan struct {
+	DirPath   string    // Target directory
+	CreatedAt time.Time // When the plan was computed
+
+	// Policy attribution
+	ConfigFingerprint string
+	PolicyName        string
+	PolicyVersion     string
+
+	// Capacity and scan information
+	TargetSize   int64         // Size to be deleted in bytes (-1 when computed from MaxSize only)
+	ScannedFiles int           // Total number of scanned files
+	TotalSize    int64         // Total size of scanned files in bytes
+	BlockSize    int64         // File system block size
+	ScanDuration time.Duration // Time spent scanning files
+	PartialScan  bool          // True if the scan stopped at its time budget (see ScanBudgetRatio)
+
+	// MemoryDegraded is true if the scan exceeded MaxMemoryBytes and dropped
+	// its per-file lists, so Candidates only lists the files deleted ahead of
+	// age-based deletion
+	MemoryDegraded bool
+
+	// File system of the target directory (see NoNetworkTuning)
+	FileSystem FileSystemInfo
+
+	// Files kept out of the deletion by rules and overrides, regardless of age
+	KeptFiles       int
+	KeptLatestFiles int // Kept by the KeepLatestN of an override, MinKeepFiles or MinKeepPerDir
+
+	// Kept files per reason, the largest first
+	Protections []ProtectionCount
+
+	// Repositories left out of the deletion in RepositoryMode, sorted by path
+	Repositories []Repository
+
+	// Deletion decision
+	TimeThreshold  time.Time  // Files older than this will be deleted
+	EstimatedFiles int        // Estimated number of files to delete
+	EstimatedSize  int64      // Estimated block-aligned size to delete
+	Candidates     []PlanFile // Files that would be deleted, sorted by path
+
+	// Per-prefix shares and thresholds in FairShare mode, sorted by name
+	Prefixes []PrefixShare
+
+	// Per-volume targets and thresholds with PerVolumeTargets when the tree
+	// spans mount points, sorted by path
+	Volumes []VolumeShare
+
+	// Seed of the selection with EvictionAgeWeighted, 0 otherwise
+	EvictionSeed int64
+
+	needsDeletion bool
+	expiredOnly   bool                // Only expired files are deleted, the constraints are met (see MaxAge)
+	cleaner       *Cleaner            // Cleaner that computed the plan (see Execute)
+	protected     map[string]struct{} // Paths kept by KeepLatestN overrides or not picked by EvictionAgeWeighted
+	deleter       *deleter            // Deleter started during the scan (see Pipeline)
+	sizes         *blockSizes         // Block sizes of the file systems below DirPath
+	run           *runState           // State loaded when the plan was computed
+	pipelined     int                 // Number of files released during the scan
+	scanned       []fileInfo          // All scanned files, collected for DirectoryReport
+	scanWorkers   []WorkerStats
+	scanTimings   OperationTimings
+	trace         *planTrace // Inputs of the deletion decision (see Explain)
+	volumes       *volumeSet // Volumes of the tree with PerVolumeTargets, nil if one
+	target        int64      // TargetSize resolved from the scan when -1 (see CleaningReport.TargetSize)
+
+	// .nfsXXXX files found by the scan, so only those left by this run's
+	// deletions count against the freed space
+	sillyRenamed map[string]struct{}
+
+	droppedErrors int // Scan errors not passed to OnError
+
+	// Scanned files per owner, the quotas by user ID and the files above
+	// them (see OwnerQuotas)
+	owners      map[uint32]classStats
+	ownerQuotas map[uint32]int64
+	overQuota   map[string]struct{}
+}
+
+// ProtectionCount counts the files kept out of the deletion for one reason,
+// so operators can see which protection prevents the target from being met
+type ProtectionCount struct {
+	Reason    string // e.g. "rule 0 (protect *.manifest)" or "KeepLatestN db/"
+	Files     int
+	Size      int64
+	BlockSize int64
+}
+
+// PlanFile represents a single deletion candidate in a plan
+type PlanFile struct {
+	Path      string
+	Size      int64
+	BlockSize int64
+	ModTime   time.Time
+	IsDir     bool // True for opaque directories deleted as a whole (see MaxDepth)
+}
+
+// PlanDifference describes how the deletion candidates changed between two plans
+type PlanDifference struct {
+	Added     []PlanFile // Files that newly became candidates
+	Removed   []PlanFile // Files that stopped being candidates
+	Unchanged int        // Number of files that are candidates in both plans
+}
+
+// Plan scans the directory and computes which files would be deleted,
+// without deleting anything. Callbacks for the scan phase are invoked
+// as they would be by CleanBackup.
+func Plan(dirPath string, config CleaningConfig) (*CleaningPlan, error) {
+	cleaner, err := NewCleaner(config)
+	if err != nil {
+		return nil, err
+	}
+	return cleaner.Plan(context.Background(), dirPath)
+}
+
+// Execute deletes the candidates of a plan, e.g. after it was reviewed or
+// persisted, without scanning again. Candidates that changed since the plan
+// was computed are skipped: files with another modification time, opaque
+// directories with newer files, and files now kept by a rule, the
+// referenced list or SkipOpenFiles. The plan must have been computed with
+// the configuration of the Cleaner.
+func (c *Cleaner) Execute(ctx context.Context, plan *CleaningPlan) (CleaningReport, error) {
+	if plan.ConfigFingerprint != c.config.Fingerprint() {
+		return CleaningReport{}, ErrPlanMismatch
+	}
+	if err := checkDir(c.config.fs(), plan.DirPath); err != nil {
+		return CleaningReport{}, err
+	}
+	p := *plan
+	p.needsDeletion = len(p.Candidates) > 0
+	p.deleter = nil
+	// The referenced list and the open files are read again, as for a run
+	run, err := loadRunState(p.DirPath, &c.config, c.config.accountingBlockSize(p.BlockSize))
+	if err != nil {
+		return CleaningReport{}, err
+	}
+	p.run = run
+	if p.target == 0 {
+		p.target = max(p.TargetSize, 0)
+	}
+	// The space freed is reconciled with the usage before the deletion
+	usage, err := getDiskUsage(c.config.DiskInfo, p.DirPath)
+	if err != nil {
+		usage = nil
+	}
+	p.trace = &planTrace{config: c.config, usage: usage}
+	return cleanBackup(ctx, p.DirPath, c.config, nil, &p)
+}
+
+// Execute deletes the candidates of the plan with the Cleaner that computed
+// it (see Cleaner.Execute)
+func (p *CleaningPlan) Execute(ctx context.Context) (CleaningReport, error) {
+	if p.cleaner == nil {
+		return CleaningReport{}, ErrPlanNotExecutable
+	}
+	return p.cleaner.Execute(ctx, p)
+}
+
+// PlanDiff compares two plans and reports which files newly became deletion
+// candidates and which stopped being candidates. Either plan may be nil,
+// which is treated as a plan without candidates. This is useful to review the
+// effect of a policy change before rolling it out.
+func PlanDiff(oldPlan, newPlan *CleaningPlan) PlanDifference {
+	oldFiles := make(map[string]PlanFile)
+	if oldPlan != nil {
+		for _, f := range oldPlan.Candidates {
+			oldFiles[f.Path] = f
+		}
+	}
+
+	var diff PlanDifference
+	if newPlan != nil {
+		for _, f := range newPlan.Candidates {
+			if _, exists := oldFiles[f.Path]; exists {
+				diff.Unchanged++
+				delete(oldFiles, f.Path)
+			} else {
+				diff.Added = append(diff.Added, f)
+			}
+		}
+	}
+	for _, f := range oldFiles {
+		diff.Removed = append(diff.Removed, f)
+	}
+
+	sortPlanFiles(diff.Added)
+	sortPlanFiles(diff.Removed)
+	return diff
+}
+
+// collectCandidates returns the priority files and the files in the slots
+// that are older than the threshold
+func collectCandidates(slots []*timeSlot, priority []fileInfo, threshold time.Time) []PlanFile {
+	var candidates []PlanFile
+	for _, fi := range priority {
+		candidates = append(candidates, newPlanFile(fi))
+	}
+	for _, slot := range slots {
+		if !slot.time.Before(threshold) {
+			// Slots are sorted oldest first, so no later slot can qualify
+			break
+		}
+		for _, fi := range slot.files {
+			if fi.modTime.Before(threshold) {
+				candidates = append(candidates, newPlanFile(fi))
+			}
+		}
+	}
+	sortPlanFiles(candidates)
+	return candidates
+}
+
+// newPlanFile converts scanned file information to a plan file
+func newPlanFile(fi fileInfo) PlanFile {
+	return PlanFile{
+		Path:      fi.path,
+		Size:      fi.size,
+		BlockSize: fi.blockSize,
+		ModTime:   fi.modTime,
+		IsDir:     fi.isDir,
+	}
+}
+
+// sortPlanFiles sorts plan files by path
+func sortPlanFiles(files []PlanFile) {
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+}
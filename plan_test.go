@@ -0,0 +1,290 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestPlanDoesNotDelete tests that Plan computes candidates without deleting them
+func TestPlanDoesNotDelete(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-plan-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	files := []string{"old.txt", "recent.txt"}
+	if err := createTestFile(t, filepath.Join(tmpDir, files[0]), 1024, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, files[1]), 1024, now.Add(-1*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	maxUsage := float64(70)
+	plan, err := Plan(tmpDir, CleaningConfig{
+		MaxUsagePercent: &maxUsage,
+		TimeWindow:      time.Hour,
+		DiskInfo:        &mockDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.ScannedFiles != 2 {
+		t.Errorf("Expected 2 scanned files, got %d", plan.ScannedFiles)
+	}
+	if len(plan.Candidates) == 0 {
+		t.Error("Expected some deletion candidates")
+	}
+	for _, fname := range files {
+		if _, err := os.Stat(filepath.Join(tmpDir, fname)); err != nil {
+			t.Errorf("Plan must not delete files, %s is missing: %v", fname, err)
+		}
+	}
+}
+
+// TestPlanExecute tests that executing a plan deletes its candidates unless
+// they changed since the plan was computed
+func TestPlanExecute(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	now := time.Now()
+	for i, age := range []time.Duration{96 * time.Hour, 72 * time.Hour, time.Hour} {
+		path := filepath.Join(tmpDir, fmt.Sprintf("file%d.txt", i))
+		if err := createTestFile(t, path, 1024, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	maxUsage := float64(70)
+	config := CleaningConfig{
+		MaxUsagePercent: &maxUsage,
+		TimeWindow:      time.Hour,
+		DiskInfo:        &mockDiskInfoProvider{},
+	}
+	cleaner, err := NewCleaner(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cleaner.Plan(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Candidates) != 2 {
+		t.Fatalf("Expected 2 candidates, got %+v", plan.Candidates)
+	}
+
+	// A candidate touched after the review must survive
+	changed := filepath.Join(tmpDir, "file1.txt")
+	if err := os.Chtimes(changed, now, now.Add(-80*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := plan.Execute(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 {
+		t.Errorf("Expected 1 deleted file, got %d", report.DeletedFiles)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "file0.txt")); !os.IsNotExist(err) {
+		t.Error("Expected file0.txt to be deleted")
+	}
+	for _, name := range []string{"file1.txt", "file2.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to survive: %v", name, err)
+		}
+	}
+}
+
+// TestPlanExecuteOpenFiles tests that candidates opened by a process after
+// the plan was computed are kept with SkipOpenFiles
+func TestPlanExecuteOpenFiles(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("open files are only detected on Linux")
+	}
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for name, age := range map[string]time.Duration{"uploading.tar": 96 * time.Hour, "old.tar": 72 * time.Hour, "new.tar": 24 * time.Hour} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleaner, err := NewCleaner(CleaningConfig{
+		MaxSize:       int64Ptr(8192),
+		TimeWindow:    time.Hour,
+		SkipOpenFiles: true,
+		DiskInfo:      &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cleaner.Plan(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Candidates) != 1 || filepath.Base(plan.Candidates[0].Path) != "uploading.tar" {
+		t.Fatalf("Expected uploading.tar to be the only candidate, got %+v", plan.Candidates)
+	}
+
+	// Reopened by another process after the review
+	f, err := os.OpenFile(filepath.Join(tmpDir, "uploading.tar"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report, err := plan.Execute(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 0 {
+		t.Errorf("Expected no deleted files, got %d", report.DeletedFiles)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "uploading.tar")); err != nil {
+		t.Errorf("Expected the open file to be kept: %v", err)
+	}
+}
+
+// TestPlanExecuteReferencedList tests that the referenced list file is read
+// again on execution, keeping candidates referenced since the plan
+func TestPlanExecuteReferencedList(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a.pack", "b.pack", "c.pack"} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 1000, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listPath := filepath.Join(t.TempDir(), "referenced.txt")
+	if err := os.WriteFile(listPath, []byte("a.pack\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cleaner, err := NewCleaner(CleaningConfig{
+		MaxSize:            int64Ptr(1 << 20),
+		ReferencedListFile: listPath,
+		DiskInfo:           &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := cleaner.Plan(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Candidates) != 2 {
+		t.Fatalf("Expected b.pack and c.pack to be candidates, got %+v", plan.Candidates)
+	}
+
+	// The backup software referenced b.pack after the review
+	if err := os.WriteFile(listPath, []byte("a.pack\nb.pack\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := plan.Execute(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 {
+		t.Errorf("Expected 1 deleted file, got %d", report.DeletedFiles)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "c.pack")); !os.IsNotExist(err) {
+		t.Error("Expected c.pack to be deleted")
+	}
+	for _, name := range []string{"a.pack", "b.pack"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to remain: %v", name, err)
+		}
+	}
+}
+
+// TestPlanExecuteRejected tests that plans are not executed with another
+// configuration or without a cleaner
+func TestPlanExecuteRejected(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.txt"), 1024, time.Now().Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	maxUsage := float64(70)
+	plan, err := Plan(tmpDir, CleaningConfig{
+		MaxUsagePercent: &maxUsage,
+		DiskInfo:        &mockDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherUsage := float64(50)
+	other, err := NewCleaner(CleaningConfig{
+		MaxUsagePercent: &otherUsage,
+		DiskInfo:        &mockDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Execute(context.Background(), plan); !errors.Is(err, ErrPlanMismatch) {
+		t.Errorf("Expected ErrPlanMismatch, got %v", err)
+	}
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded CleaningPlan
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoded.Execute(context.Background()); !errors.Is(err, ErrPlanNotExecutable) {
+		t.Errorf("Expected ErrPlanNotExecutable, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "old.txt")); err != nil {
+		t.Errorf("Rejected plans must not delete files: %v", err)
+	}
+}
+
+// TestPlanDiff tests the comparison of deletion candidates between two plans
+func TestPlanDiff(t *testing.T) {
+	oldPlan := &CleaningPlan{
+		Candidates: []PlanFile{
+			{Path: "a.txt"},
+			{Path: "b.txt"},
+		},
+	}
+	newPlan := &CleaningPlan{
+		Candidates: []PlanFile{
+			{Path: "b.txt"},
+			{Path: "d.txt"},
+			{Path: "c.txt"},
+		},
+	}
+
+	diff := PlanDiff(oldPlan, newPlan)
+	if diff.Unchanged != 1 {
+		t.Errorf("Expected 1 unchanged candidate, got %d", diff.Unchanged)
+	}
+	if len(diff.Added) != 2 || diff.Added[0].Path != "c.txt" || diff.Added[1].Path != "d.txt" {
+		t.Errorf("Expected added [c.txt d.txt], got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Path != "a.txt" {
+		t.Errorf("Expected removed [a.txt], got %+v", diff.Removed)
+	}
+
+	// A nil plan is treated as having no candidates
+	diff = PlanDiff(nil, newPlan)
+	if len(diff.Added) != 3 || len(diff.Removed) != 0 {
+		t.Errorf("Expected 3 added and 0 removed against nil plan, got %d and %d", len(diff.Added), len(diff.Removed))
+	}
+}
@@ -0,0 +1,55 @@
+package gobackupcleaner
+
+import "time"
+
+// Ready-made policies. Each returns a complete configuration that can be
+// passed to NewCleaner as is, or adjusted first, e.g.
+//
+//	config := PolicyKeepUnder80Percent()
+//	config.MaxDuration = time.Hour
+//	cleaner, err := NewCleaner(config)
+//
+// PolicyName and PolicyVersion identify the preset in reports; change them
+// when adjusting a preset so deletions are attributed to your policy.
+
+// PolicyKeepUnder80Percent keeps the disk usage of the volume under 80%.
+// Once it is exceeded, the oldest backups are deleted until usage is down
+// to 75%, so scheduled runs do not clean again at every small growth.
+// Backups from the last day are never deleted. Leftover temp files and
+// broken backups are deleted first.
+func PolicyKeepUnder80Percent() CleaningConfig {
+	maxUsage, targetUsage := 80.0, 75.0
+	return CleaningConfig{
+		MaxUsagePercent:              &maxUsage,
+		TargetUsagePercentAfterClean: &targetUsage,
+		RemoveEmptyDirs:              true,
+		DeleteBrokenFirst:            true,
+		CleanTempFiles:               true,
+		Rules: []Rule{
+			{Match: RuleMatch{MaxAge: 24 * time.Hour}, Action: RuleProtect},
+		},
+		PolicyName:    "keep-under-80-percent",
+		PolicyVersion: "1",
+	}
+}
+
+// PolicyKeep30Days never deletes backups modified within the last 30 days,
+// and deletes older ones, the oldest first, while the disk usage of the
+// volume exceeds 90%, down to 85%. If the last 30 days alone exceed the
+// limit, the run deletes what it can and the usage stays above it.
+// Leftover temp files and broken backups are deleted first.
+func PolicyKeep30Days() CleaningConfig {
+	maxUsage, targetUsage := 90.0, 85.0
+	return CleaningConfig{
+		MaxUsagePercent:              &maxUsage,
+		TargetUsagePercentAfterClean: &targetUsage,
+		RemoveEmptyDirs:              true,
+		DeleteBrokenFirst:            true,
+		CleanTempFiles:               true,
+		Rules: []Rule{
+			{Match: RuleMatch{MaxAge: 30 * 24 * time.Hour}, Action: RuleProtect},
+		},
+		PolicyName:    "keep-30-days",
+		PolicyVersion: "1",
+	}
+}
@@ -0,0 +1,57 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPolicyPresetsValidate(t *testing.T) {
+	for name, config := range map[string]CleaningConfig{
+		"PolicyKeepUnder80Percent": PolicyKeepUnder80Percent(),
+		"PolicyKeep30Days":         PolicyKeep30Days(),
+	} {
+		if err := config.validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if config.PolicyName == "" {
+			t.Errorf("%s: expected a policy name", name)
+		}
+	}
+}
+
+func TestPolicyKeep30Days(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for name, age := range map[string]time.Duration{
+		"old1.tar":   60 * 24 * time.Hour,
+		"old2.tar":   45 * 24 * time.Hour,
+		"recent.tar": 10 * 24 * time.Hour,
+		"today.tar":  time.Hour,
+	} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Far above 90% usage: everything older than 30 days goes, nothing newer
+	config := PolicyKeep30Days()
+	config.TimeWindow = time.Hour
+	config.DiskInfo = &StaticDiskInfoProvider{
+		Usage:     &DiskUsage{Total: 100 * 4096, Used: 99 * 4096, Free: 4096, UsedPercent: 99},
+		BlockSize: 4096,
+	}
+	report, err := CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 2 || report.PolicyName != "keep-30-days" {
+		t.Errorf("Expected the 2 files older than 30 days to be deleted, got %d (%s)", report.DeletedFiles, report.PolicyName)
+	}
+	for _, name := range []string{"recent.tar", "today.tar"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package gobackupcleaner
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Phases recorded by ProfileMemory
+const (
+	PhaseScan   = "scan"
+	PhaseDelete = "delete"
+)
+
+// memorySampleInterval is how often the heap is sampled for its peak
+const memorySampleInterval = 20 * time.Millisecond
+
+// PhaseMemory records the allocations of one phase of a run (see ProfileMemory)
+type PhaseMemory struct {
+	Phase      string // PhaseScan or PhaseDelete
+	Allocs     uint64 // Number of heap objects allocated
+	AllocBytes uint64 // Bytes allocated
+	PeakHeap   uint64 // Highest heap in use, sampled
+	Sys        uint64 // Memory obtained from the OS at the end of the phase, an upper bound of the RSS
+}
+
+// memoryProfiler samples the memory statistics of a phase
+type memoryProfiler struct {
+	phase string
+	start runtime.MemStats
+	peak  atomic.Uint64
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// startPhaseMemory starts recording a phase, or returns nil if disabled
+func startPhaseMemory(enabled bool, phase string) *memoryProfiler {
+	if !enabled {
+		return nil
+	}
+	p := &memoryProfiler{phase: phase, stop: make(chan struct{}), done: make(chan struct{})}
+	runtime.ReadMemStats(&p.start)
+	p.peak.Store(p.start.HeapInuse)
+	go p.sample()
+	return p
+}
+
+// sample records the peak heap until the phase ends
+func (p *memoryProfiler) sample() {
+	defer close(p.done)
+	ticker := time.NewTicker(memorySampleInterval)
+	defer ticker.Stop()
+	var stats runtime.MemStats
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			runtime.ReadMemStats(&stats)
+			p.record(stats.HeapInuse)
+		}
+	}
+}
+
+// record raises the peak to heap
+func (p *memoryProfiler) record(heap uint64) {
+	for {
+		peak := p.peak.Load()
+		if heap <= peak || p.peak.CompareAndSwap(peak, heap) {
+			return
+		}
+	}
+}
+
+// end stops recording and appends the phase to profile. A nil profiler
+// leaves profile unchanged.
+func (p *memoryProfiler) end(profile []PhaseMemory) []PhaseMemory {
+	if p == nil {
+		return profile
+	}
+	close(p.stop)
+	<-p.done
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	p.record(stats.HeapInuse)
+	return append(profile, PhaseMemory{
+		Phase:      p.phase,
+		Allocs:     stats.Mallocs - p.start.Mallocs,
+		AllocBytes: stats.TotalAlloc - p.start.TotalAlloc,
+		PeakHeap:   p.peak.Load(),
+		Sys:        stats.Sys,
+	})
+}
@@ -0,0 +1,47 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProfileMemory(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 10; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("backup%d.tar", i))
+		if err := createTestFile(t, path, 4096, now.Add(-time.Duration(10-i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := CleaningConfig{
+		MaxSize:    int64Ptr(5 * 4096),
+		TimeWindow: time.Hour,
+		DiskInfo:   &failingDiskInfoProvider{},
+	}
+
+	report, err := CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.MemoryProfile != nil {
+		t.Errorf("Expected no profile unless enabled, got %+v", report.MemoryProfile)
+	}
+
+	config.MaxSize = int64Ptr(2 * 4096)
+	config.ProfileMemory = true
+	report, err = CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.MemoryProfile) != 2 || report.MemoryProfile[0].Phase != PhaseScan || report.MemoryProfile[1].Phase != PhaseDelete {
+		t.Fatalf("Expected the scan and delete phases, got %+v", report.MemoryProfile)
+	}
+	for _, phase := range report.MemoryProfile {
+		if phase.Allocs == 0 || phase.AllocBytes == 0 || phase.PeakHeap == 0 || phase.Sys < phase.PeakHeap {
+			t.Errorf("Expected allocations to be recorded, got %+v", phase)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package gobackupcleaner
+
+import "math"
+
+// DeleteProgress relates the deletions of a run so far to the estimates of
+// its plan, for progress bars. Workers delete concurrently, so consecutive
+// OnFileDeleted callbacks may report the same or skip values.
+type DeleteProgress struct {
+	DeletedFiles     int
+	DeletedBlockSize int64
+	EstimatedFiles   int   // Plan.EstimatedFiles, 0 for files deleted during the scan (see Pipeline)
+	EstimatedSize    int64 // Plan.EstimatedSize, 0 for files deleted during the scan
+	Complete         bool  // True once the deletion finished (see CompleteInfo)
+}
+
+// Percent returns the completion in percent, by block-aligned size or by
+// files if no size was estimated. The estimates may be exceeded or fall
+// short, so it stays below 100 until Complete, and returns 100 then.
+func (p DeleteProgress) Percent() float64 {
+	if p.Complete {
+		return 100
+	}
+	var percent float64
+	switch {
+	case p.EstimatedSize > 0:
+		percent = float64(p.DeletedBlockSize) / float64(p.EstimatedSize) * 100
+	case p.EstimatedFiles > 0:
+		percent = float64(p.DeletedFiles) / float64(p.EstimatedFiles) * 100
+	}
+	return math.Min(percent, 99)
+}
+
+// progress returns the deletions so far against the plan's estimates
+func (d *deleter) progress() DeleteProgress {
+	files, _, blocks := d.getStats()
+	return DeleteProgress{
+		DeletedFiles:     files,
+		DeletedBlockSize: blocks,
+		EstimatedFiles:   d.estimatedFiles,
+		EstimatedSize:    d.estimatedSize,
+	}
+}
@@ -0,0 +1,65 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeleteProgressPercent(t *testing.T) {
+	for _, tt := range []struct {
+		progress DeleteProgress
+		want     float64
+	}{
+		{DeleteProgress{DeletedBlockSize: 25, EstimatedSize: 100, DeletedFiles: 9, EstimatedFiles: 10}, 25},
+		{DeleteProgress{DeletedFiles: 1, EstimatedFiles: 4}, 25},
+		{DeleteProgress{DeletedBlockSize: 150, EstimatedSize: 100}, 99},
+		{DeleteProgress{DeletedFiles: 3}, 0},
+		{DeleteProgress{DeletedBlockSize: 50, EstimatedSize: 100, Complete: true}, 100},
+	} {
+		if got := tt.progress.Percent(); got != tt.want {
+			t.Errorf("%+v: Percent() = %v, want %v", tt.progress, got, tt.want)
+		}
+	}
+}
+
+func TestDeleteProgressCallbacks(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 4; i++ {
+		if err := createTestFile(t, filepath.Join(tmpDir, fmt.Sprintf("old%d.tar", i)), 4096, now.Add(-time.Duration(72+i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "new.tar"), 4096, now); err != nil {
+		t.Fatal(err)
+	}
+
+	var percents []float64
+	var final DeleteProgress
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:        int64Ptr(4096),
+		TimeWindow:     time.Hour,
+		Concurrency:    1,
+		MaxConcurrency: 1,
+		DiskInfo:       &failingDiskInfoProvider{},
+		Callbacks: Callbacks{
+			OnFileDeleted: func(info FileDeletedInfo) { percents = append(percents, info.Progress.Percent()) },
+			OnComplete:    func(info CompleteInfo) { final = info.Progress },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 4 {
+		t.Fatalf("Expected 4 deleted files, got %d", report.DeletedFiles)
+	}
+	want := []float64{25, 50, 75, 99}
+	if fmt.Sprint(percents) != fmt.Sprint(want) {
+		t.Errorf("Expected progress %v, got %v", want, percents)
+	}
+	if !final.Complete || final.Percent() != 100 || final.DeletedFiles != 4 || final.EstimatedFiles != 4 || final.EstimatedSize != 4*4096 {
+		t.Errorf("Expected the final progress to match the estimates, got %+v", final)
+	}
+}
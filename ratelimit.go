@@ -0,0 +1,67 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the rate of deletions. It is safe for concurrent use, so
+// one RateLimiter can be shared by concurrent runs, even of different
+// Cleaners, which then collectively respect its limits (see
+// CleaningConfig.RateLimiter).
+type RateLimiter struct {
+	deletesPerSecond float64
+	bytesPerSecond   int64
+
+	mu   sync.Mutex
+	next time.Time // Time from which the next deletion may start
+}
+
+// NewRateLimiter creates a RateLimiter allowing at most deletesPerSecond
+// deletions and bytesPerSecond deleted bytes per second. 0 means no limit.
+func NewRateLimiter(deletesPerSecond float64, bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{
+		deletesPerSecond: deletesPerSecond,
+		bytesPerSecond:   bytesPerSecond,
+	}
+}
+
+// wait blocks until a deletion of size bytes may start. Deletions are spaced
+// by the time their count and size take at the limited rate, in the order
+// they arrive. It returns the context error if ctx is done first.
+func (l *RateLimiter) wait(ctx context.Context, size int64) error {
+	if l == nil || (l.deletesPerSecond <= 0 && l.bytesPerSecond <= 0) {
+		return nil
+	}
+	var cost time.Duration
+	if l.deletesPerSecond > 0 {
+		cost = time.Duration(float64(time.Second) / l.deletesPerSecond)
+	}
+	if l.bytesPerSecond > 0 {
+		if c := time.Duration(float64(size) / float64(l.bytesPerSecond) * float64(time.Second)); c > cost {
+			cost = c
+		}
+	}
+
+	l.mu.Lock()
+	start := time.Now()
+	if l.next.After(start) {
+		start = l.next
+	}
+	l.next = start.Add(cost)
+	l.mu.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,81 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterShared(t *testing.T) {
+	tmpDir := t.TempDir()
+	limiter := NewRateLimiter(100, 0)
+	maxSize := int64(2 * 4096)
+
+	// Two Cleaners delete 6 files each, so 12 deletions take at least 110ms
+	var cleaners []*Cleaner
+	for _, name := range []string{"a", "b"} {
+		createHostFiles(t, filepath.Join(tmpDir, name), 8, time.Now().Truncate(time.Hour))
+		cleaner, err := NewCleaner(CleaningConfig{
+			MaxSize:     &maxSize,
+			TimeWindow:  time.Hour,
+			RateLimiter: limiter,
+			DiskInfo:    &failingDiskInfoProvider{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cleaners = append(cleaners, cleaner)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(cleaner *Cleaner, dir string) {
+			defer wg.Done()
+			report, err := cleaner.Clean(context.Background(), dir)
+			if err != nil || report.DeletedFiles != 6 {
+				t.Errorf("Unexpected result for %s: %d deleted, %v", dir, report.DeletedFiles, err)
+			}
+		}(cleaners[i], filepath.Join(tmpDir, name))
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 110*time.Millisecond {
+		t.Errorf("Expected the runs to share the limit, took %v", elapsed)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	limiter := NewRateLimiter(0, 1000)
+	ctx := context.Background()
+
+	// The first deletion starts immediately and delays the next one by 50ms
+	start := time.Now()
+	if err := limiter.wait(ctx, 50); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.wait(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected to wait for the size of the first deletion, waited %v", elapsed)
+	}
+
+	if err := limiter.wait(ctx, 10000); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.wait(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to be canceled, got %v", err)
+	}
+
+	var unlimited *RateLimiter
+	if err := unlimited.wait(ctx, 1<<30); err != nil {
+		t.Errorf("Expected a nil limiter not to wait, got %v", err)
+	}
+}
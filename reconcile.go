@@ -0,0 +1,98 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Reconciliation compares the space a run accounted as freed with the change
+// of the free space of the volume, and breaks the difference down into its
+// usual causes, as df rarely matches DeletedSize exactly
+type Reconciliation struct {
+	DeletedSize      int64 // Sum of the apparent sizes of the deleted files
+	DeletedBlockSize int64 // Space accounted as freed, block-aligned
+
+	// Increase of the free space reported by DiskInfo between the start and
+	// the end of the run, and its difference to DeletedBlockSize. Only set
+	// when DiskMeasured, i.e. disk usage was available before and after.
+	DiskMeasured  bool
+	DiskFreedSize int64
+	Difference    int64
+
+	// Space accounted as freed that the volume did not get back
+	HardLinkedSize int64 // Deleted files with other hard links, freed only with their last link
+	SparseSize     int64 // Accounted beyond the blocks allocated to sparse or compressed files
+	PendingSize    int64 // Silly-renamed and deferred files, freed once closed or at reboot
+
+	// Difference not explained by the above, e.g. other processes writing to
+	// or deleting from the volume during the run, when DiskMeasured
+	UnexplainedSize int64
+
+	Explanation string // Human-readable summary of the causes
+}
+
+// recordReconciliation tracks the space of a deleted file the volume may not
+// get back: hard-linked files, and sparse or compressed files allocating
+// less than accounted
+func (d *deleter) recordReconciliation(path string, info os.FileInfo, blockSize int64) {
+	if _, nlink, ok := linksOf(info); ok && nlink > 1 {
+		d.hardLinkedSize.Add(blockSize)
+		return
+	}
+	if d.config.SizeMode == SizeModeAllocated {
+		return
+	}
+	if provider, ok := d.config.DiskInfo.(AllocatedSizeProvider); ok {
+		if allocated, err := provider.GetAllocatedSize(path, info); err == nil && allocated < blockSize {
+			d.sparseSize.Add(blockSize - allocated)
+		}
+	}
+}
+
+// reconcile builds the reconciliation of a report from the disk usage before
+// and after the run, either nil if unknown
+func (r *CleaningReport) reconcile(d *deleter, before, after *DiskUsage) Reconciliation {
+	rec := Reconciliation{
+		DeletedSize:      r.DeletedSize,
+		DeletedBlockSize: r.DeletedBlockSize,
+		HardLinkedSize:   d.hardLinkedSize.Load(),
+		SparseSize:       d.sparseSize.Load(),
+		PendingSize:      r.SillyRenamedSize + r.DeferredDeleteSize,
+	}
+	if before != nil && after != nil {
+		rec.DiskMeasured = true
+		rec.DiskFreedSize = int64(after.Free) - int64(before.Free)
+		rec.Difference = rec.DiskFreedSize - rec.DeletedBlockSize
+		rec.UnexplainedSize = rec.Difference + rec.HardLinkedSize + rec.SparseSize + rec.PendingSize
+	}
+	rec.Explanation = rec.explain()
+	return rec
+}
+
+// explain summarizes the causes of the difference
+func (rec *Reconciliation) explain() string {
+	var causes []string
+	if rec.HardLinkedSize > 0 {
+		causes = append(causes, fmt.Sprintf("%s of hard-linked files is freed only with their last link", formatSize(rec.HardLinkedSize)))
+	}
+	if rec.SparseSize > 0 {
+		causes = append(causes, fmt.Sprintf("%s was accounted beyond the blocks allocated to sparse or compressed files", formatSize(rec.SparseSize)))
+	}
+	if rec.PendingSize > 0 {
+		causes = append(causes, fmt.Sprintf("%s of files still open or deferred is freed once closed or at reboot", formatSize(rec.PendingSize)))
+	}
+	switch {
+	case rec.UnexplainedSize > 0:
+		causes = append(causes, fmt.Sprintf("%s more was freed, likely by other processes during the run", formatSize(rec.UnexplainedSize)))
+	case rec.UnexplainedSize < 0:
+		causes = append(causes, fmt.Sprintf("%s less was freed, likely written by other processes during the run", formatSize(-rec.UnexplainedSize)))
+	}
+	if len(causes) == 0 {
+		if rec.DiskMeasured {
+			return "The freed space matches the deleted files"
+		}
+		return "Disk usage is not available to compare the deleted files to"
+	}
+	return strings.Join(causes, "; ")
+}
@@ -0,0 +1,117 @@
+//go:build !windows
+// +build !windows
+
+package gobackupcleaner
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// treeDiskInfoProvider reports a volume of total bytes whose used space is
+// the block-aligned size of the files below dirs, counting hard links once
+type treeDiskInfoProvider struct {
+	dirs  []string
+	total uint64
+}
+
+func (p *treeDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error) {
+	var used uint64
+	seen := make(map[fileID]bool)
+	for _, dir := range p.dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.Type().IsRegular() {
+				return err
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if id, _, ok := linksOf(info); ok {
+				if seen[id] {
+					return nil
+				}
+				seen[id] = true
+			}
+			used += uint64(calculateBlockSize(info.Size(), 4096))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &DiskUsage{Total: p.total, Used: used, Free: p.total - used, UsedPercent: float64(used) / float64(p.total) * 100}, nil
+}
+
+func (p *treeDiskInfoProvider) GetBlockSize(path string) (int64, error) {
+	return 4096, nil
+}
+
+func TestReconciliation(t *testing.T) {
+	tmpDir := t.TempDir()
+	otherDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for name, file := range map[string]struct {
+		size int64
+		age  time.Duration
+	}{
+		"a.tar": {8192, 72 * time.Hour},
+		"b.tar": {4096, 48 * time.Hour},
+		"c.tar": {4096, time.Hour},
+	} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), file.size, now.Add(-file.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b.tar is also linked from outside, so deleting it frees nothing
+	if err := os.Link(filepath.Join(tmpDir, "b.tar"), filepath.Join(otherDir, "b.tar")); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MinFreeSpace: int64Ptr(19 * 4096),
+		TimeWindow:   time.Hour,
+		DiskInfo:     &treeDiskInfoProvider{dirs: []string{tmpDir, otherDir}, total: 20 * 4096},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := report.Reconciliation
+	if report.DeletedFiles != 2 || rec == nil {
+		t.Fatalf("Expected a.tar and b.tar to be deleted and reconciled, got %d files, %+v", report.DeletedFiles, rec)
+	}
+	if !rec.DiskMeasured || rec.DeletedBlockSize != 3*4096 || rec.DiskFreedSize != 2*4096 || rec.Difference != -4096 {
+		t.Errorf("Expected 12 KiB accounted and 8 KiB freed, got %+v", rec)
+	}
+	if rec.HardLinkedSize != 4096 || rec.UnexplainedSize != 0 {
+		t.Errorf("Expected the difference to be explained by the hard link, got %+v", rec)
+	}
+	if !strings.Contains(rec.Explanation, "hard-linked") {
+		t.Errorf("Expected the hard link in the explanation, got %q", rec.Explanation)
+	}
+}
+
+func TestReconciliationWithoutDiskUsage(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i, age := range []time.Duration{72 * time.Hour, time.Hour} {
+		if err := createTestFile(t, filepath.Join(tmpDir, string(rune('a'+i))+".tar"), 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:    int64Ptr(4096),
+		TimeWindow: time.Hour,
+		DiskInfo:   &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := report.Reconciliation; rec == nil || rec.DiskMeasured || rec.DeletedBlockSize != 4096 {
+		t.Errorf("Expected an unmeasured reconciliation of 4 KiB, got %+v", rec)
+	}
+}
@@ -0,0 +1,99 @@
+package gobackupcleaner
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// referenceSet holds the files still referenced by the backup software
+// (see ReferencedListFile)
+type referenceSet struct {
+	files map[string]struct{} // Absolute paths of the referenced files
+	dirs  map[string]struct{} // Directories containing referenced files
+}
+
+// contains reports whether a file is referenced, or for a directory deleted
+// as a whole, whether it contains a referenced file
+func (r *referenceSet) contains(path string, isDir bool) bool {
+	if _, ok := r.files[path]; ok {
+		return true
+	}
+	if isDir {
+		_, ok := r.dirs[path]
+		return ok
+	}
+	return false
+}
+
+// readReferences reads a referenced list: one path per line, empty lines and
+// lines starting with "#" ignored
+func readReferences(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	return paths, scanner.Err()
+}
+
+// readReferencedList reads ReferencedList, so reused Cleaners do not
+// consume the reader on their first run
+func (c *CleaningConfig) readReferencedList() error {
+	if c.ReferencedList == nil {
+		return nil
+	}
+	paths, err := readReferences(c.ReferencedList)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return ErrEmptyReferencedList
+	}
+	c.referencedPaths = paths
+	c.ReferencedList = nil
+	return nil
+}
+
+// loadReferences resolves the referenced list of a run against rootPath. The
+// list of ReferencedList was read when the Cleaner was created, the file of
+// ReferencedListFile is read on every run as the backup software updates it.
+func (c *CleaningConfig) loadReferences(rootPath string) (*referenceSet, error) {
+	paths := c.referencedPaths
+	if c.ReferencedListFile != "" {
+		f, err := os.Open(c.ReferencedListFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if paths, err = readReferences(f); err != nil {
+			return nil, err
+		}
+		// A truncated list would make every file eligible
+		if len(paths) == 0 {
+			return nil, ErrEmptyReferencedList
+		}
+	} else if paths == nil {
+		return nil, nil
+	}
+
+	refs := &referenceSet{
+		files: make(map[string]struct{}, len(paths)),
+		dirs:  make(map[string]struct{}),
+	}
+	root := filepath.Clean(rootPath)
+	for _, p := range paths {
+		path := indexPath(rootPath, filepath.FromSlash(p))
+		refs.files[path] = struct{}{}
+		for dir := filepath.Dir(path); len(dir) > len(root); dir = filepath.Dir(dir) {
+			refs.dirs[dir] = struct{}{}
+		}
+	}
+	return refs, nil
+}
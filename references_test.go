@@ -0,0 +1,150 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReferencedList(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	files := []struct {
+		name    string
+		modTime time.Time
+	}{
+		{"old-referenced.pack", now.Add(-72 * time.Hour)},
+		{"recent-unreferenced.pack", now.Add(-time.Hour)},
+		{"recent-referenced.pack", now.Add(-time.Hour)},
+		{"index.manifest", now.Add(-72 * time.Hour)},
+	}
+	for _, f := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, f.name), 1000, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listPath := filepath.Join(t.TempDir(), "referenced.txt")
+	list := "# packs still in use\nold-referenced.pack\n\n" + filepath.Join(tmpDir, "recent-referenced.pack") + "\n"
+	if err := os.WriteFile(listPath, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The limit is met once the unreferenced pack is gone
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:            int64Ptr(1 << 20),
+		ReferencedListFile: listPath,
+		Rules:              []Rule{{Match: RuleMatch{Glob: "*.manifest"}, Action: RuleProtect}},
+		DiskInfo:           &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedUnlistedFiles != 1 || report.DeletedFiles != 1 {
+		t.Errorf("Expected only the unreferenced file to be deleted, got %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "recent-unreferenced.pack")); !os.IsNotExist(err) {
+		t.Error("Expected recent-unreferenced.pack to be deleted")
+	}
+	for _, name := range []string{"old-referenced.pack", "recent-referenced.pack", "index.manifest"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to remain: %v", name, err)
+		}
+	}
+	var referenced int
+	for _, count := range report.Protections {
+		if count.Reason == "referenced list" {
+			referenced = count.Files
+		}
+	}
+	if referenced != 2 {
+		t.Errorf("Expected 2 files protected by the referenced list, got %+v", report.Protections)
+	}
+}
+
+func TestReferencedListReader(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a.pack", "b.pack"} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 1000, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleaner, err := NewCleaner(CleaningConfig{
+		MaxSize:        int64Ptr(1 << 20),
+		ReferencedList: strings.NewReader("a.pack\n"),
+		DiskInfo:       &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The list is read once, so every run sees it
+	for i := 0; i < 2; i++ {
+		plan, err := cleaner.Plan(context.Background(), tmpDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plan.Candidates) != 1 || filepath.Base(plan.Candidates[0].Path) != "b.pack" {
+			t.Errorf("Run %d: expected b.pack to be the only candidate, got %+v", i, plan.Candidates)
+		}
+	}
+}
+
+func TestReferencedListConcurrentRuns(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	for _, dir := range dirs {
+		for _, name := range []string{"a.pack", "b.pack"} {
+			if err := createTestFile(t, filepath.Join(dir, name), 1000, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cleaner, err := NewCleaner(CleaningConfig{
+		MaxSize:        int64Ptr(1 << 20),
+		ReferencedList: strings.NewReader("a.pack\n"),
+		DiskInfo:       &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each run resolves the list against its own directory
+	plans := make([]*CleaningPlan, len(dirs))
+	errs := make([]error, len(dirs))
+	var wg sync.WaitGroup
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plans[i], errs[i] = cleaner.Plan(context.Background(), dir)
+		}()
+	}
+	wg.Wait()
+	for i, dir := range dirs {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if len(plans[i].Candidates) != 1 || plans[i].Candidates[0].Path != filepath.Join(dir, "b.pack") {
+			t.Errorf("Expected %s to be the only candidate, got %+v", filepath.Join(dir, "b.pack"), plans[i].Candidates)
+		}
+	}
+}
+
+func TestReferencedListInvalid(t *testing.T) {
+	maxSize := int64Ptr(1024)
+	if _, err := NewCleaner(CleaningConfig{MaxSize: maxSize, ReferencedList: strings.NewReader("# nothing\n")}); !errors.Is(err, ErrEmptyReferencedList) {
+		t.Errorf("Expected ErrEmptyReferencedList, got %v", err)
+	}
+	listPath := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(listPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CleanBackup(t.TempDir(), CleaningConfig{MaxSize: maxSize, ReferencedListFile: listPath, DiskInfo: &failingDiskInfoProvider{}}); !errors.Is(err, ErrEmptyReferencedList) {
+		t.Errorf("Expected ErrEmptyReferencedList, got %v", err)
+	}
+	if _, err := NewCleaner(CleaningConfig{MaxSize: maxSize, ReferencedListFile: listPath, ReferencedList: strings.NewReader("a\n")}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+}
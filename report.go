@@ -10,13 +10,164 @@ type CleaningReport struct {
 	DeletedBlockSize int64 // Block-aligned size in bytes
 	DeletedDirs      int   // Number of deleted directories
 
+	// Whether the objective was achieved: the block-aligned size the run had
+	// to free (resolved from the scan when only MaxSize applies without disk
+	// usage), the size actually freed, and the remaining gap, 0 once achieved
+	TargetSize    int64
+	FreedSize     int64
+	ShortfallSize int64
+
+	// Broken files deleted ahead of age-based deletion (see DeleteBrokenFirst)
+	DeletedBrokenFiles int
+	DeletedBrokenSize  int64
+
+	// Files deleted from ExpendableDirs ahead of age-based deletion
+	DeletedExpendableFiles int
+	DeletedExpendableSize  int64
+
+	// Files older than the MaxAge of their override, deleted regardless of free space
+	DeletedExpiredFiles int
+	DeletedExpiredSize  int64
+
+	// Files deleted by RuleDelete rules ahead of age-based deletion
+	DeletedByRuleFiles int
+	DeletedByRuleSize  int64
+
+	// Files missing from the referenced list, deleted ahead of age-based deletion
+	DeletedUnlistedFiles int
+	DeletedUnlistedSize  int64
+
+	// Oldest files of owners above their quota, deleted ahead of age-based
+	// deletion (see OwnerQuotas)
+	DeletedOverQuotaFiles int
+	DeletedOverQuotaSize  int64
+
+	// Space scanned and deleted per file owner, sorted by user ID, with
+	// OwnerReport or OwnerQuotas
+	Owners []OwnerUsage
+
+	// Files kept out of the deletion by rules and overrides
+	KeptFiles       int
+	KeptLatestFiles int // Kept by the KeepLatestN of an override, MinKeepFiles or MinKeepPerDir
+
+	// Files and opaque directories kept as their immediate subdirectory
+	// reached MaxDeletePerDirectory
+	DirectoryLimitedFiles int
+
+	// Kept files per reason, the largest first
+	Protections []ProtectionCount
+
+	// Repositories left out of the deletion in RepositoryMode, and those
+	// RepositoryPruner freed space in before the scan, sorted by path
+	Repositories       []Repository
+	PrunedRepositories []Repository
+
+	// Temp files reclaimed ahead of age-based deletion (see CleanTempFiles)
+	ReclaimedTempFiles int
+	ReclaimedTempBytes int64
+
+	// Usage of each immediate subdirectory before and after cleaning, sorted
+	// by name, when DirectoryReport is set
+	Directories []DirectoryUsage
+
+	// Removed directory paths, collected when MaxRemovedDirPaths is set
+	RemovedDirs          []string
+	RemovedDirsTruncated bool // True if more directories were removed than collected
+
+	// Deleted files still taking space after the run, when VerifyAfterClean
+	// is set, sorted by path
+	Discrepancies []Discrepancy
+
+	// .nfsXXXX files NFS left behind for deleted files that were still open.
+	// Their space is freed only once closed, so it is not part of FreedSize.
+	SillyRenamedFiles int
+	SillyRenamedSize  int64 // Block-aligned size in bytes
+
+	// Locked files scheduled for deletion at the next reboot by this run
+	// instead (see DeferLockedDeletes). Files scheduled by an earlier run are
+	// not counted again. Their space is not part of FreedSize.
+	DeferredDeletes    int
+	DeferredDeleteSize int64 // Block-aligned size in bytes
+
+	// Errors not passed to OnError because the callback fell too far behind
+	DroppedErrors int
+
+	// Seed of the EvictionAgeWeighted selection, to reproduce the run
+	EvictionSeed int64
+
 	// Processing time
+	TimedOut       bool          // True if MaxDuration was reached and the run is partial
+	PartialScan    bool          // True if the scan stopped at its budget and only scanned files were deleted
+	PipelinedFiles int           // Number of files released for deletion while scanning (see Pipeline)
+	MemoryDegraded bool          // True if the scan exceeded MaxMemoryBytes and only counted files
 	ScanDuration   time.Duration // Time spent scanning files
 	DeleteDuration time.Duration // Time spent deleting files
 	TotalDuration  time.Duration // Total processing time
 
 	// Other information
 	ScannedFiles  int       // Total number of scanned files
-	TimeThreshold time.Time // Time threshold for deletion
+	TimeThreshold time.Time // Time threshold for deletion (zero in FairShare mode)
 	BlockSize     int64     // File system block size
-}
\ No newline at end of file
+
+	// File system of the target directory. Network file systems are cleaned
+	// with tuned defaults (see NoNetworkTuning).
+	FileSystem FileSystemInfo
+
+	// Size the percent constraints were computed on (see CleaningConfig.UsageBase)
+	UsageBase UsageBase
+
+	// Per-prefix shares, thresholds and deletions in FairShare mode, sorted by name
+	Prefixes []PrefixShare
+
+	// Per-volume targets, thresholds and freed sizes with PerVolumeTargets
+	// when the tree spans mount points, sorted by path
+	Volumes []VolumeShare
+
+	// Allocations and peak heap per phase, when ProfileMemory is set
+	MemoryProfile []PhaseMemory
+
+	// Worker statistics, to diagnose whether a run is CPU-, syscall- or storage-bound
+	ScanWorkers   []WorkerStats    // Per-worker statistics of the scan phase
+	DeleteWorkers []WorkerStats    // Per-worker statistics of the delete phase
+	Timings       OperationTimings // Time spent in file system calls, summed across workers
+
+	// Hash manifest of the remaining files, updated when ManifestPath is set
+	Manifest ManifestResult
+
+	// Policy attribution
+	ConfigFingerprint string // Hash of the effective configuration (see CleaningConfig.Fingerprint)
+	PolicyName        string // Policy name from the configuration
+	PolicyVersion     string // Policy version from the configuration
+
+	// Comparison of the space accounted as freed with the change of the free
+	// space of the volume, set when files were deleted
+	Reconciliation *Reconciliation
+
+	// RunID identifies the run in callbacks, spans and Runner history, to
+	// correlate it across systems (see WithRunID)
+	RunID string
+}
+
+// WorkerStats contains statistics of a single worker
+type WorkerStats struct {
+	Tasks    int           // Number of tasks taken from the queue
+	BusyTime time.Duration // Time spent processing tasks
+}
+
+// OperationTimings breaks down the time spent in file system calls.
+// Durations are summed across workers, so they can exceed the wall-clock time.
+type OperationTimings struct {
+	StatTime     time.Duration
+	StatCalls    int
+	ReadDirTime  time.Duration
+	ReadDirCalls int
+	UnlinkTime   time.Duration
+	UnlinkCalls  int
+}
+
+// setTarget records the size to free and how much of it is still missing
+func (r *CleaningReport) setTarget(target int64) {
+	r.TargetSize = target
+	r.FreedSize = max(r.DeletedBlockSize-r.SillyRenamedSize, 0)
+	r.ShortfallSize = max(target-r.FreedSize, 0)
+}
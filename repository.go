@@ -0,0 +1,132 @@
+package gobackupcleaner
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sort"
+)
+
+// Repository kinds recognized in RepositoryMode
+const (
+	RepositoryRestic = "restic"
+	RepositoryBorg   = "borg"
+	RepositoryKopia  = "kopia"
+)
+
+// Repository is a deduplicating backup repository found below the target
+// directory. Its packs are shared between snapshots, so deleting single files
+// by age corrupts it; only the backup tool itself can free space in it.
+type Repository struct {
+	Path string // Path of the repository directory
+	Kind string // RepositoryRestic, RepositoryBorg or RepositoryKopia
+}
+
+// RepositoryPruner frees space in a repository, typically by running the
+// prune command of the backup tool (e.g. "restic forget --prune").
+type RepositoryPruner interface {
+	Prune(ctx context.Context, repo Repository) error
+}
+
+// detectRepository reports whether a directory is the root of a restic, borg
+// or kopia repository
+func detectRepository(fs FileSystem, path string) (string, bool) {
+	if fileExists(fs, filepath.Join(path, "kopia.repository.f")) {
+		return RepositoryKopia, true
+	}
+	config := filepath.Join(path, "config")
+	if !fileExists(fs, config) || !dirExists(fs, filepath.Join(path, "data")) {
+		return "", false
+	}
+	if dirExists(fs, filepath.Join(path, "index")) && dirExists(fs, filepath.Join(path, "snapshots")) && dirExists(fs, filepath.Join(path, "keys")) {
+		return RepositoryRestic, true
+	}
+	// The borg config is a small INI file, restic's is encrypted
+	content, err := readFile(fs, config)
+	if err == nil && bytes.Contains(content, []byte("[repository]")) {
+		return RepositoryBorg, true
+	}
+	return "", false
+}
+
+// fileExists reports whether path is a regular file
+func fileExists(fs FileSystem, path string) bool {
+	info, err := fs.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// dirExists reports whether path is a directory
+func dirExists(fs FileSystem, path string) bool {
+	info, err := fs.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// repositoryAt reports whether a scanned directory is a repository left out
+// of the deletion (see RepositoryMode)
+func (c *CleaningConfig) repositoryAt(path string) (Repository, bool) {
+	if !c.RepositoryMode {
+		return Repository{}, false
+	}
+	kind, ok := detectRepository(c.fs(), path)
+	return Repository{Path: path, Kind: kind}, ok
+}
+
+// findRepositories returns the repositories at the target directory and its
+// immediate subdirectories, sorted by path
+func findRepositories(fs FileSystem, dirPath string) []Repository {
+	if kind, ok := detectRepository(fs, dirPath); ok {
+		return []Repository{{Path: dirPath, Kind: kind}}
+	}
+	entries, err := fs.ReadDir(dirPath)
+	if err != nil {
+		return nil
+	}
+	var repos []Repository
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dirPath, entry.Name())
+		if kind, ok := detectRepository(fs, path); ok {
+			repos = append(repos, Repository{Path: path, Kind: kind})
+		}
+	}
+	return repos
+}
+
+// pruneRepositories lets RepositoryPruner free space in the repositories
+// before the plain files are scanned, and returns the pruned repositories.
+// Pruning is expensive, so it only runs when the disk usage shows a shortfall.
+// Failures are reported via OnError, the plain files are cleaned regardless.
+func pruneRepositories(ctx context.Context, dirPath string, config *CleaningConfig) []Repository {
+	if !config.RepositoryMode || config.RepositoryPruner == nil {
+		return nil
+	}
+	if targetSize, _, err := resolveTarget(dirPath, config); err != nil || targetSize <= 0 {
+		return nil
+	}
+
+	var pruned []Repository
+	for _, repo := range findRepositories(config.fs(), dirPath) {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := config.RepositoryPruner.Prune(ctx, repo); err != nil {
+			callSafe(config.Callbacks.OnError, ErrorInfo{
+				Type:  ErrorTypePrune,
+				Path:  repo.Path,
+				Error: err,
+			})
+			continue
+		}
+		pruned = append(pruned, repo)
+	}
+	return pruned
+}
+
+// sortRepositories sorts repositories by path
+func sortRepositories(repos []Repository) {
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Path < repos[j].Path
+	})
+}
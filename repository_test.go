@@ -0,0 +1,172 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// createRepositories creates a restic and a borg repository and a plain file
+// next to them, all old enough to be deleted
+func createRepositories(t *testing.T, tmpDir string) {
+	t.Helper()
+	old := time.Now().Add(-72 * time.Hour)
+	files := map[string]string{
+		"restic/config":         "encrypted",
+		"restic/data/00/0a1b":   "pack",
+		"restic/index/1c2d":     "index",
+		"restic/snapshots/3e4f": "snapshot",
+		"restic/keys/5a6b":      "key",
+		"borg/config":           "[repository]\nversion = 1\n",
+		"borg/data/0/1":         "segment",
+		"plain/backup.tar":      "archive",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDetectRepository(t *testing.T) {
+	tmpDir := t.TempDir()
+	createRepositories(t, tmpDir)
+	if err := os.MkdirAll(filepath.Join(tmpDir, "kopia"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "kopia", "kopia.repository.f"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir  string
+		kind string
+	}{
+		{"restic", RepositoryRestic},
+		{"borg", RepositoryBorg},
+		{"kopia", RepositoryKopia},
+		{"plain", ""},
+		{"restic/data", ""},
+	}
+	for _, tt := range tests {
+		kind, ok := detectRepository(OSFileSystem{}, filepath.Join(tmpDir, filepath.FromSlash(tt.dir)))
+		if kind != tt.kind || ok != (tt.kind != "") {
+			t.Errorf("detectRepository(%s) = %q, %t, want %q", tt.dir, kind, ok, tt.kind)
+		}
+	}
+}
+
+func TestRepositoryMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	createRepositories(t, tmpDir)
+
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:        int64Ptr(1),
+		RepositoryMode: true,
+		DiskInfo:       &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "plain", "backup.tar")); !os.IsNotExist(err) {
+		t.Error("Expected the plain file to be deleted")
+	}
+	for _, name := range []string{"restic/data/00/0a1b", "restic/config", "borg/data/0/1"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("Expected %s to remain: %v", name, err)
+		}
+	}
+	if len(report.Repositories) != 2 || report.Repositories[0].Kind != RepositoryBorg || report.Repositories[1].Kind != RepositoryRestic {
+		t.Errorf("Expected the borg and restic repositories, got %+v", report.Repositories)
+	}
+
+	plan, err := Plan(tmpDir, CleaningConfig{
+		MaxSize:        int64Ptr(1),
+		RepositoryMode: true,
+		DiskInfo:       &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation := plan.Explain(); !strings.Contains(explanation, "(restic)") {
+		t.Errorf("Expected the repositories in the explanation, got:\n%s", explanation)
+	}
+}
+
+// recordingPruner records the pruned repositories and fails for borg
+type recordingPruner struct {
+	mu     sync.Mutex
+	pruned []Repository
+}
+
+func (p *recordingPruner) Prune(ctx context.Context, repo Repository) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pruned = append(p.pruned, repo)
+	if repo.Kind == RepositoryBorg {
+		return errors.New("lock held")
+	}
+	return nil
+}
+
+func TestRepositoryPruner(t *testing.T) {
+	tmpDir := t.TempDir()
+	createRepositories(t, tmpDir)
+
+	diskInfo := &StaticDiskInfoProvider{Usage: &DiskUsage{
+		Total:       100 << 30,
+		Used:        90 << 30,
+		Free:        10 << 30,
+		UsedPercent: 90,
+	}}
+	pruner := &recordingPruner{}
+	var errs []ErrorInfo
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxUsagePercent:  float64Ptr(80),
+		RepositoryMode:   true,
+		RepositoryPruner: pruner,
+		DiskInfo:         diskInfo,
+		Callbacks: Callbacks{
+			OnError: func(info ErrorInfo) { errs = append(errs, info) },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruner.pruned) != 2 {
+		t.Errorf("Expected both repositories to be pruned, got %+v", pruner.pruned)
+	}
+	if len(report.PrunedRepositories) != 1 || report.PrunedRepositories[0].Kind != RepositoryRestic {
+		t.Errorf("Expected only the restic repository to be reported as pruned, got %+v", report.PrunedRepositories)
+	}
+	if len(errs) != 1 || errs[0].Type != ErrorTypePrune {
+		t.Errorf("Expected the borg failure to be reported, got %+v", errs)
+	}
+
+	// No pruning without a need to clean
+	pruner = &recordingPruner{}
+	_, err = CleanBackup(tmpDir, CleaningConfig{
+		MaxUsagePercent:  float64Ptr(95),
+		RepositoryMode:   true,
+		RepositoryPruner: pruner,
+		DiskInfo:         diskInfo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruner.pruned) != 0 {
+		t.Errorf("Expected no pruning, got %+v", pruner.pruned)
+	}
+}
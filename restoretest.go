@@ -0,0 +1,65 @@
+package gobackupcleaner
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RestoreTestSource locates the time a backup was last successfully restored
+// or verified, as recorded by the restore-testing tooling. The time is
+// written in RFC 3339 or as Unix seconds. A backup counts as restore tested
+// if the time is not before its modification time.
+type RestoreTestSource struct {
+	// Xattr is the extended attribute holding the time on Linux, e.g.
+	// "user.restore_tested", and the alternate data stream on Windows.
+	// It is not read on other platforms.
+	Xattr string
+	// SidecarSuffix names a file next to the backup holding the time, e.g.
+	// ".verified" for "db.tar.verified". An empty sidecar stands for its own
+	// modification time. Sidecars are cleaned by age like other files.
+	SidecarSuffix string
+}
+
+// lastTested returns the time the file at path was last restore tested,
+// false if it is not recorded
+func (s RestoreTestSource) lastTested(fs FileSystem, path string) (time.Time, bool) {
+	if s.Xattr != "" {
+		if value, err := readXattr(path, s.Xattr); err == nil {
+			if t, ok := parseTestedTime(value); ok {
+				return t, true
+			}
+		}
+	}
+	if s.SidecarSuffix != "" {
+		sidecar := path + s.SidecarSuffix
+		if value, err := readFile(fs, sidecar); err == nil {
+			if len(strings.TrimSpace(string(value))) > 0 {
+				return parseTestedTime(value)
+			}
+			if info, err := fs.Stat(sidecar); err == nil {
+				return info.ModTime(), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// isTested reports whether a scanned file was restore tested since it was
+// last modified
+func (s RestoreTestSource) isTested(fs FileSystem, fi fileInfo) bool {
+	t, ok := s.lastTested(fs, fi.path)
+	return ok && !t.Before(fi.modTime)
+}
+
+// parseTestedTime parses a time in RFC 3339 or Unix seconds
+func parseTestedTime(value []byte) (time.Time, bool) {
+	text := strings.TrimSpace(string(value))
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t, true
+	}
+	if seconds, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return time.Unix(seconds, 0), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,69 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseTestedTime(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, value := range []string{"2024-05-01T12:00:00Z\n", " " + strconv.FormatInt(want.Unix(), 10) + " "} {
+		if got, ok := parseTestedTime([]byte(value)); !ok || !got.Equal(want) {
+			t.Errorf("parseTestedTime(%q) = %v, %t", value, got, ok)
+		}
+	}
+	if _, ok := parseTestedTime([]byte("yesterday")); ok {
+		t.Error("Expected an invalid time to be rejected")
+	}
+}
+
+func TestRestoreTestedFirst(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for name, age := range map[string]time.Duration{
+		"old6.tar": 6 * time.Hour,
+		"old5.tar": 5 * time.Hour,
+		"mid4.tar": 4 * time.Hour,
+		"new2.tar": 2 * time.Hour,
+		"new1.tar": time.Hour,
+	} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// new2.tar was restore tested after it was written, old5.tar before
+	for name, tested := range map[string]time.Time{
+		"new2.tar.verified": now.Add(-time.Hour),
+		"old5.tar.verified": now.Add(-6 * time.Hour),
+	} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(tested.Format(time.RFC3339)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:       int64Ptr(5 * 4096),
+		TimeWindow:    time.Hour,
+		Eviction:      EvictionRestoreTestedFirst,
+		RestoreTested: RestoreTestSource{SidecarSuffix: ".verified"},
+		DiskInfo:      &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 2 {
+		t.Errorf("Expected 2 deletions, got %d", report.DeletedFiles)
+	}
+	for name, deleted := range map[string]bool{"new2.tar": true, "old6.tar": true, "old5.tar": false, "mid4.tar": false, "new1.tar": false} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); os.IsNotExist(err) != deleted {
+			t.Errorf("Expected %s deleted=%t, got %v", name, deleted, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package gobackupcleaner
+
+import (
+	"sort"
+	"time"
+)
+
+// RetentionInventory counts the backups of a directory per day, week and
+// month and how far back they cover without gaps, to help choose KeepLatestN
+// or age limits. Periods are in local time, weeks start on Monday.
+// Temporary and broken files are not counted as backups.
+type RetentionInventory struct {
+	DirPath    string
+	AnalyzedAt time.Time
+	Files      int
+	TotalSize  int64
+	Oldest     time.Time // Modification time of the oldest backup, zero if there are none
+	Newest     time.Time // Modification time of the newest backup
+
+	// Periods with at least one backup, the newest first
+	Days   []RetentionPeriod
+	Weeks  []RetentionPeriod
+	Months []RetentionPeriod
+
+	// Consecutive periods with backups, counted back from the period of the
+	// newest backup. CoveredSince is the start of the oldest covered day.
+	CoveredDays   int
+	CoveredWeeks  int
+	CoveredMonths int
+	CoveredSince  time.Time
+}
+
+// RetentionPeriod counts the backups modified within one day, week or month
+type RetentionPeriod struct {
+	Start time.Time
+	Files int
+	Size  int64
+}
+
+// AnalyzeRetention scans dirPath and returns its retention inventory without
+// deleting anything. Like Scan, the capacity settings are not used, while
+// settings such as MaxDepth and Rules decide what a backup is.
+func AnalyzeRetention(dirPath string, config CleaningConfig) (*RetentionInventory, error) {
+	result, err := Scan(dirPath, config)
+	if err != nil {
+		return nil, err
+	}
+	inventory := result.Retention()
+	return &inventory, nil
+}
+
+// Retention returns the retention inventory of the scanned files
+func (r *ScanResult) Retention() RetentionInventory {
+	inventory := RetentionInventory{DirPath: r.DirPath, AnalyzedAt: r.ScannedAt}
+	days := make(map[time.Time]*RetentionPeriod)
+	weeks := make(map[time.Time]*RetentionPeriod)
+	months := make(map[time.Time]*RetentionPeriod)
+	for _, file := range r.Files {
+		if file.Category == classTemp.String() || file.Category == classBroken.String() {
+			continue
+		}
+		inventory.Files++
+		inventory.TotalSize += file.Size
+		if inventory.Oldest.IsZero() || file.ModTime.Before(inventory.Oldest) {
+			inventory.Oldest = file.ModTime
+		}
+		if file.ModTime.After(inventory.Newest) {
+			inventory.Newest = file.ModTime
+		}
+		day := startOfDay(file.ModTime.Local())
+		addToPeriod(days, day, file)
+		addToPeriod(weeks, day.AddDate(0, 0, -(int(day.Weekday())+6)%7), file)
+		addToPeriod(months, day.AddDate(0, 0, 1-day.Day()), file)
+	}
+	if inventory.Files == 0 {
+		return inventory
+	}
+
+	inventory.Days = sortedPeriods(days)
+	inventory.Weeks = sortedPeriods(weeks)
+	inventory.Months = sortedPeriods(months)
+	inventory.CoveredDays = coveredPeriods(inventory.Days, func(t time.Time) time.Time { return t.AddDate(0, 0, -1) })
+	inventory.CoveredWeeks = coveredPeriods(inventory.Weeks, func(t time.Time) time.Time { return t.AddDate(0, 0, -7) })
+	inventory.CoveredMonths = coveredPeriods(inventory.Months, func(t time.Time) time.Time { return t.AddDate(0, -1, 0) })
+	inventory.CoveredSince = inventory.Days[inventory.CoveredDays-1].Start
+	return inventory
+}
+
+// startOfDay returns midnight of the day of t in its location
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// addToPeriod counts file in the period starting at start
+func addToPeriod(periods map[time.Time]*RetentionPeriod, start time.Time, file ScannedFile) {
+	period, ok := periods[start]
+	if !ok {
+		period = &RetentionPeriod{Start: start}
+		periods[start] = period
+	}
+	period.Files++
+	period.Size += file.Size
+}
+
+// sortedPeriods returns the periods, the newest first
+func sortedPeriods(periods map[time.Time]*RetentionPeriod) []RetentionPeriod {
+	sorted := make([]RetentionPeriod, 0, len(periods))
+	for _, period := range periods {
+		sorted = append(sorted, *period)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.After(sorted[j].Start)
+	})
+	return sorted
+}
+
+// coveredPeriods counts the periods, the newest first, that follow each other
+// without a gap, previous returning the start of the period before one
+func coveredPeriods(periods []RetentionPeriod, previous func(time.Time) time.Time) int {
+	covered := 1
+	for covered < len(periods) && periods[covered].Start.Equal(previous(periods[covered-1].Start)) {
+		covered++
+	}
+	return covered
+}
@@ -0,0 +1,64 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeRetention(t *testing.T) {
+	tmpDir := t.TempDir()
+	newest := time.Now().Add(-time.Minute).Truncate(time.Second)
+	for i, days := range []int{0, 0, 1, 2, 4, 20} {
+		if err := createTestFile(t, filepath.Join(tmpDir, fmt.Sprintf("backup%d.tar", i)), 1024, newest.AddDate(0, 0, -days)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Not a backup, so the gap 3 days ago remains
+	if err := createTestFile(t, filepath.Join(tmpDir, "upload.tmp"), 1024, newest.AddDate(0, 0, -3)); err != nil {
+		t.Fatal(err)
+	}
+
+	inventory, err := AnalyzeRetention(tmpDir, CleaningConfig{CleanTempFiles: true, DiskInfo: &failingDiskInfoProvider{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inventory.Files != 6 || inventory.TotalSize != 6*1024 {
+		t.Errorf("Expected 6 backups, got %d (%d bytes)", inventory.Files, inventory.TotalSize)
+	}
+	if !inventory.Newest.Equal(newest) || !inventory.Oldest.Equal(newest.AddDate(0, 0, -20)) {
+		t.Errorf("Unexpected range %v - %v", inventory.Oldest, inventory.Newest)
+	}
+	if len(inventory.Days) != 5 || inventory.Days[0].Files != 2 || !inventory.Days[0].Start.Equal(startOfDay(newest.Local())) {
+		t.Errorf("Unexpected days %+v", inventory.Days)
+	}
+	if inventory.CoveredDays != 3 || !inventory.CoveredSince.Equal(startOfDay(newest.AddDate(0, 0, -2).Local())) {
+		t.Errorf("Expected 3 covered days since %v, got %d since %v", startOfDay(newest.AddDate(0, 0, -2).Local()), inventory.CoveredDays, inventory.CoveredSince)
+	}
+	for name, periods := range map[string][]RetentionPeriod{"weeks": inventory.Weeks, "months": inventory.Months} {
+		files := 0
+		for _, period := range periods {
+			files += period.Files
+		}
+		if files != 6 {
+			t.Errorf("Expected 6 backups over the %s, got %d", name, files)
+		}
+	}
+	if inventory.Weeks[0].Start.Weekday() != time.Monday || inventory.Months[0].Start.Day() != 1 {
+		t.Errorf("Expected weeks to start on Monday and months on the 1st, got %v and %v", inventory.Weeks[0].Start, inventory.Months[0].Start)
+	}
+	if inventory.CoveredWeeks < 1 || inventory.CoveredMonths < 1 {
+		t.Errorf("Expected the newest week and month to be covered, got %d and %d", inventory.CoveredWeeks, inventory.CoveredMonths)
+	}
+}
+
+func TestCoveredPeriods(t *testing.T) {
+	month := func(m time.Month) RetentionPeriod {
+		return RetentionPeriod{Start: time.Date(2024, m, 1, 0, 0, 0, 0, time.UTC)}
+	}
+	periods := []RetentionPeriod{month(3), month(2), month(1), month(11)}
+	if got := coveredPeriods(periods, func(t time.Time) time.Time { return t.AddDate(0, -1, 0) }); got != 3 {
+		t.Errorf("Expected 3 covered months, got %d", got)
+	}
+}
@@ -0,0 +1,447 @@
+// Package ruleexpr compiles rule conditions written as expressions, so
+// policies loaded from configuration files can be expressed without
+// recompiling Go code.
+//
+// An expression combines comparisons with &&, || and !, for example:
+//
+//	age > 30d && size > 1GB && !match("*.manifest")
+//
+// The following values are available:
+//
+//	age    duration since the last modification (e.g. 90m, 12h, 30d, 2w)
+//	size   file size in bytes (e.g. 512KB, 1.5GB; units are binary)
+//	name   file name
+//	path   path relative to the target directory with "/" separators
+//
+// and the following functions:
+//
+//	match("glob")    glob against the name, or the path if the glob contains "/"
+//	regex("pattern") regular expression against the path
+//
+// Durations and sizes can be compared with <, <=, >, >=, == and !=,
+// strings with == and !=.
+package ruleexpr
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	cleaner "github.com/ideamans/go-backup-cleaner"
+)
+
+// Expr is a compiled expression. It implements cleaner.RuleCondition.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses and type-checks an expression
+func Compile(src string) (*Expr, error) {
+	p := &parser{lexer: newLexer(src)}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	if root.typ() != typeBool {
+		return nil, fmt.Errorf("ruleexpr: expression %q is not a condition", src)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// MustCompile is like Compile but panics if the expression is invalid
+func MustCompile(src string) *Expr {
+	e, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Match evaluates the expression for a file
+func (e *Expr) Match(f cleaner.RuleFile) bool {
+	return e.root.eval(&f).b
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// valueType is the static type of an expression
+type valueType int
+
+const (
+	typeBool valueType = iota
+	typeNumber
+	typeDuration
+	typeSize
+	typeString
+)
+
+func (t valueType) String() string {
+	return [...]string{"bool", "number", "duration", "size", "string"}[t]
+}
+
+// value is the result of evaluating a node
+type value struct {
+	b   bool
+	num float64
+	str string
+}
+
+// node is a node of the expression tree
+type node interface {
+	typ() valueType
+	eval(f *cleaner.RuleFile) value
+}
+
+type literal struct {
+	t valueType
+	v value
+}
+
+func (n *literal) typ() valueType               { return n.t }
+func (n *literal) eval(*cleaner.RuleFile) value { return n.v }
+
+type variable struct {
+	name string
+	t    valueType
+}
+
+func (n *variable) typ() valueType { return n.t }
+func (n *variable) eval(f *cleaner.RuleFile) value {
+	switch n.name {
+	case "age":
+		return value{num: float64(f.Age)}
+	case "size":
+		return value{num: float64(f.Size)}
+	case "name":
+		return value{str: path.Base(f.Path)}
+	default:
+		return value{str: f.Path}
+	}
+}
+
+type not struct{ x node }
+
+func (n *not) typ() valueType { return typeBool }
+func (n *not) eval(f *cleaner.RuleFile) value {
+	return value{b: !n.x.eval(f).b}
+}
+
+type logical struct {
+	op   string
+	x, y node
+}
+
+func (n *logical) typ() valueType { return typeBool }
+func (n *logical) eval(f *cleaner.RuleFile) value {
+	if n.op == "&&" {
+		return value{b: n.x.eval(f).b && n.y.eval(f).b}
+	}
+	return value{b: n.x.eval(f).b || n.y.eval(f).b}
+}
+
+type comparison struct {
+	op   string
+	x, y node
+}
+
+func (n *comparison) typ() valueType { return typeBool }
+func (n *comparison) eval(f *cleaner.RuleFile) value {
+	x, y := n.x.eval(f), n.y.eval(f)
+	if n.x.typ() == typeString {
+		if n.op == "==" {
+			return value{b: x.str == y.str}
+		}
+		return value{b: x.str != y.str}
+	}
+	var b bool
+	switch n.op {
+	case "<":
+		b = x.num < y.num
+	case "<=":
+		b = x.num <= y.num
+	case ">":
+		b = x.num > y.num
+	case ">=":
+		b = x.num >= y.num
+	case "==":
+		b = x.num == y.num
+	case "!=":
+		b = x.num != y.num
+	}
+	return value{b: b}
+}
+
+type globMatch struct{ pattern string }
+
+func (n *globMatch) typ() valueType { return typeBool }
+func (n *globMatch) eval(f *cleaner.RuleFile) value {
+	name := f.Path
+	if !strings.Contains(n.pattern, "/") {
+		name = path.Base(f.Path)
+	}
+	matched, _ := path.Match(n.pattern, name)
+	return value{b: matched}
+}
+
+type regexMatch struct{ re *regexp.Regexp }
+
+func (n *regexMatch) typ() valueType { return typeBool }
+func (n *regexMatch) eval(f *cleaner.RuleFile) value {
+	return value{b: n.re.MatchString(f.Path)}
+}
+
+// variables are the values available in expressions
+var variables = map[string]valueType{
+	"age":  typeDuration,
+	"size": typeSize,
+	"name": typeString,
+	"path": typeString,
+}
+
+// parser is a recursive descent parser
+type parser struct {
+	lexer *lexer
+	tok   token
+}
+
+func (p *parser) next() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("ruleexpr: %s at offset %d in %q", fmt.Sprintf(format, args...), p.tok.pos, p.lexer.src)
+}
+
+// parseOr parses x || y
+func (p *parser) parseOr() (node, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && p.tok.text == "||" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if x, err = p.logical("||", x, y); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+// parseAnd parses x && y
+func (p *parser) parseAnd() (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && p.tok.text == "&&" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x, err = p.logical("&&", x, y); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+func (p *parser) logical(op string, x, y node) (node, error) {
+	if x.typ() != typeBool || y.typ() != typeBool {
+		return nil, p.errorf("%s requires conditions, got %s and %s", op, x.typ(), y.typ())
+	}
+	return &logical{op: op, x: x, y: y}, nil
+}
+
+// parseUnary parses !x and comparisons
+func (p *parser) parseUnary() (node, error) {
+	if p.tok.kind == tokOp && p.tok.text == "!" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x.typ() != typeBool {
+			return nil, p.errorf("! requires a condition, got %s", x.typ())
+		}
+		return &not{x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses x op y
+func (p *parser) parseComparison() (node, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp || !isComparison(p.tok.text) {
+		return x, nil
+	}
+	op := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	y, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	xt, yt := x.typ(), y.typ()
+	switch {
+	case xt == typeBool || yt == typeBool:
+		return nil, p.errorf("cannot compare conditions with %s", op)
+	case xt == typeString || yt == typeString:
+		if xt != yt {
+			return nil, p.errorf("cannot compare %s with %s", xt, yt)
+		}
+		if op != "==" && op != "!=" {
+			return nil, p.errorf("strings can only be compared with == and !=")
+		}
+	case xt != yt && xt != typeNumber && yt != typeNumber:
+		return nil, p.errorf("cannot compare %s with %s", xt, yt)
+	}
+	return &comparison{op: op, x: x, y: y}, nil
+}
+
+// parsePrimary parses literals, variables, function calls and parentheses
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokLParen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected )")
+		}
+		return x, p.next()
+
+	case tokNumber:
+		n, err := parseNumber(tok.text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return n, p.next()
+
+	case tokString:
+		return &literal{t: typeString, v: value{str: tok.text}}, p.next()
+
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		switch tok.text {
+		case "true", "false":
+			return &literal{t: typeBool, v: value{b: tok.text == "true"}}, nil
+		case "match", "regex":
+			return p.parseCall(tok.text)
+		}
+		t, ok := variables[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("ruleexpr: unknown identifier %q in %q", tok.text, p.lexer.src)
+		}
+		return &variable{name: tok.text, t: t}, nil
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+// parseCall parses the argument of match() and regex()
+func (p *parser) parseCall(name string) (node, error) {
+	if p.tok.kind != tokLParen {
+		return nil, p.errorf("expected ( after %s", name)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokString {
+		return nil, p.errorf("%s requires a string argument", name)
+	}
+	arg := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokRParen {
+		return nil, p.errorf("expected )")
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	if name == "match" {
+		if _, err := path.Match(arg, ""); err != nil {
+			return nil, fmt.Errorf("ruleexpr: invalid glob %q: %w", arg, err)
+		}
+		return &globMatch{pattern: arg}, nil
+	}
+	re, err := regexp.Compile(arg)
+	if err != nil {
+		return nil, fmt.Errorf("ruleexpr: invalid regex %q: %w", arg, err)
+	}
+	return &regexMatch{re: re}, nil
+}
+
+// parseNumber parses a number with an optional duration or size unit.
+// Size units start with an upper case letter (KB, MB, GB, ...).
+func parseNumber(text string) (node, error) {
+	i := strings.IndexFunc(text, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		var f float64
+		if _, err := fmt.Sscanf(text, "%g", &f); err != nil {
+			return nil, fmt.Errorf("invalid number %q", text)
+		}
+		return &literal{t: typeNumber, v: value{num: f}}, nil
+	}
+	if text[i] >= 'A' && text[i] <= 'Z' {
+		size, err := cleaner.ParseSize(text)
+		if err != nil {
+			return nil, err
+		}
+		return &literal{t: typeSize, v: value{num: float64(size)}}, nil
+	}
+	age, err := cleaner.ParseAge(text)
+	if err != nil {
+		return nil, err
+	}
+	return &literal{t: typeDuration, v: value{num: float64(age)}}, nil
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "<", "<=", ">", ">=", "==", "!=":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package ruleexpr
+
+import (
+	"testing"
+	"time"
+
+	cleaner "github.com/ideamans/go-backup-cleaner"
+)
+
+func TestMatch(t *testing.T) {
+	day := 24 * time.Hour
+	oldLarge := cleaner.RuleFile{Path: "db/full.tar.gz", Size: 2 << 30, Age: 40 * day}
+	oldManifest := cleaner.RuleFile{Path: "db/full.manifest", Size: 2 << 30, Age: 40 * day}
+	recentSmall := cleaner.RuleFile{Path: "logs/app.log", Size: 1024, Age: time.Hour}
+
+	tests := []struct {
+		expr     string
+		file     cleaner.RuleFile
+		expected bool
+	}{
+		{`age > 30d && size > 1GB && !match("*.manifest")`, oldLarge, true},
+		{`age > 30d && size > 1GB && !match("*.manifest")`, oldManifest, false},
+		{`age > 30d && size > 1GB && !match("*.manifest")`, recentSmall, false},
+		{`age < 2h || size >= 1.5GB`, recentSmall, true},
+		{`!(age < 2h)`, recentSmall, false},
+		{`match("logs/*.log")`, recentSmall, true},
+		{`match("logs/*.log")`, oldLarge, false},
+		{`regex("^db/.*\\.tar\\.gz$")`, oldLarge, true},
+		{`name == "app.log" && path != "app.log"`, recentSmall, true},
+		{`size > 0 && age >= 1w`, oldLarge, true},
+		{`true`, recentSmall, true},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got := e.Match(tt.file); got != tt.expected {
+			t.Errorf("%q on %s = %v, want %v", tt.expr, tt.file.Path, got, tt.expected)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	invalid := []string{
+		``,
+		`age`,
+		`age > 1GB`,
+		`size > 30d`,
+		`name > "a"`,
+		`age > 30d &&`,
+		`owner == "root"`,
+		`match(name)`,
+		`regex("(")`,
+		`(age > 1d`,
+		`"unterminated`,
+		`age > 30d # comment`,
+		`size > 10XB`,
+	}
+	for _, src := range invalid {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("Expected Compile(%q) to fail", src)
+		}
+	}
+}
+
+func TestExprAsRuleCondition(t *testing.T) {
+	rule := cleaner.Rule{
+		Match:  cleaner.RuleMatch{Condition: MustCompile(`age > 30d`)},
+		Action: cleaner.RuleDelete,
+	}
+	if rule.Match.Condition.String() != "age > 30d" {
+		t.Errorf("Unexpected condition string %q", rule.Match.Condition.String())
+	}
+}
@@ -0,0 +1,194 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RuleAction is the action taken for files matched by a rule
+type RuleAction int
+
+const (
+	// RuleAgeBased applies the normal policy. It can be used to exempt files
+	// from the rules that follow.
+	RuleAgeBased RuleAction = iota
+	// RuleDelete deletes the files before any age-based deletion,
+	// counting their freed bytes toward the target
+	RuleDelete
+	// RuleKeep keeps the files out of age-based deletion. Cleanup policies
+	// such as CleanTempFiles and DeleteBrokenFirst still apply.
+	RuleKeep
+	// RuleProtect never deletes the files
+	RuleProtect
+)
+
+// Rule applies an action to the files matched by all of its conditions
+type Rule struct {
+	Match  RuleMatch
+	Action RuleAction
+}
+
+// RuleMatch holds the conditions of a rule. Zero values are ignored,
+// so an empty RuleMatch matches every file.
+type RuleMatch struct {
+	// Glob is matched against the file name, or against the path relative
+	// to the target directory (with "/" separators) if it contains a "/"
+	Glob string
+	// Regexp is matched against the path relative to the target directory
+	Regexp string
+
+	MinAge  time.Duration // Matches files at least this old
+	MaxAge  time.Duration // Matches files at most this old
+	MinSize int64         // Matches files of at least this many bytes
+	MaxSize int64         // Matches files of at most this many bytes
+
+	// Condition is a custom condition, e.g. an expression compiled by the
+	// ruleexpr subpackage
+	Condition RuleCondition
+}
+
+// RuleCondition is a custom condition of a rule
+type RuleCondition interface {
+	Match(f RuleFile) bool
+	// String returns a canonical representation used in the config fingerprint
+	String() string
+}
+
+// RuleFile describes a file evaluated by a RuleCondition
+type RuleFile struct {
+	Path    string // Path relative to the target directory with "/" separators
+	Size    int64
+	ModTime time.Time
+	Age     time.Duration // Age at the start of the run
+}
+
+// compiledRule is a rule with its regular expression compiled
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+// compileRules compiles the rules. The configuration must be validated.
+func compileRules(rules []Rule) []compiledRule {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		cr := compiledRule{Rule: rule}
+		if rule.Match.Regexp != "" {
+			cr.re = regexp.MustCompile(rule.Match.Regexp)
+		}
+		compiled = append(compiled, cr)
+	}
+	return compiled
+}
+
+// validate checks if the rule is valid
+func (r Rule) validate() error {
+	if !validEnum(ruleActionNames, int(r.Action)) {
+		return ErrInvalidConfig
+	}
+	m := r.Match
+	if _, err := path.Match(m.Glob, ""); err != nil {
+		return ErrInvalidConfig
+	}
+	if _, err := regexp.Compile(m.Regexp); err != nil {
+		return ErrInvalidConfig
+	}
+	if m.MinAge < 0 || m.MaxAge < 0 || m.MinSize < 0 || m.MaxSize < 0 {
+		return ErrInvalidConfig
+	}
+	return nil
+}
+
+// ruleAction returns the action of the first rule matching the file,
+// or RuleAgeBased if no rule matches
+func (c *classifier) ruleAction(filePath string, size int64, modTime time.Time) RuleAction {
+	if i := c.matchRule(filePath, size, modTime); i >= 0 {
+		return c.rules[i].Action
+	}
+	return RuleAgeBased
+}
+
+// matchRule returns the index of the first rule matching the file, or -1
+func (c *classifier) matchRule(filePath string, size int64, modTime time.Time) int {
+	if len(c.rules) == 0 {
+		return -1
+	}
+	rel, err := filepath.Rel(c.root, filePath)
+	if err != nil {
+		return -1
+	}
+	rel = filepath.ToSlash(rel)
+	age := c.now.Sub(modTime)
+
+	for i, rule := range c.rules {
+		if rule.matches(rel, size, modTime, age) {
+			return i
+		}
+	}
+	return -1
+}
+
+// reason describes the rule as a protection reason, e.g. "rule 1 (keep *.manifest)"
+func (r *compiledRule) reason(i int) string {
+	var conditions []string
+	m := r.Match
+	if m.Glob != "" {
+		conditions = append(conditions, m.Glob)
+	}
+	if m.Regexp != "" {
+		conditions = append(conditions, "regexp "+m.Regexp)
+	}
+	if m.MinAge > 0 {
+		conditions = append(conditions, "age>="+m.MinAge.String())
+	}
+	if m.MaxAge > 0 {
+		conditions = append(conditions, "age<="+m.MaxAge.String())
+	}
+	if m.MinSize > 0 {
+		conditions = append(conditions, "size>="+formatSize(m.MinSize))
+	}
+	if m.MaxSize > 0 {
+		conditions = append(conditions, "size<="+formatSize(m.MaxSize))
+	}
+	if m.Condition != nil {
+		conditions = append(conditions, m.Condition.String())
+	}
+	return fmt.Sprintf("rule %d (%s)", i, strings.Join(append([]string{r.Action.String()}, conditions...), " "))
+}
+
+// matches reports whether a file satisfies all conditions of the rule
+func (r *compiledRule) matches(rel string, size int64, modTime time.Time, age time.Duration) bool {
+	m := r.Match
+	if m.Glob != "" {
+		name := rel
+		if !strings.Contains(m.Glob, "/") {
+			name = path.Base(rel)
+		}
+		if matched, _ := path.Match(m.Glob, name); !matched {
+			return false
+		}
+	}
+	if r.re != nil && !r.re.MatchString(rel) {
+		return false
+	}
+	if m.MinAge > 0 && age < m.MinAge {
+		return false
+	}
+	if m.MaxAge > 0 && age > m.MaxAge {
+		return false
+	}
+	if m.MinSize > 0 && size < m.MinSize {
+		return false
+	}
+	if m.MaxSize > 0 && size > m.MaxSize {
+		return false
+	}
+	if m.Condition != nil && !m.Condition.Match(RuleFile{Path: rel, Size: size, ModTime: modTime, Age: age}) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRuleAction(t *testing.T) {
+	now := time.Now()
+	config := CleaningConfig{
+		Rules: []Rule{
+			{Match: RuleMatch{Glob: "*.manifest"}, Action: RuleProtect},
+			{Match: RuleMatch{Glob: "db/keep/*"}, Action: RuleAgeBased},
+			{Match: RuleMatch{Regexp: `^db/`, MinAge: 30 * 24 * time.Hour}, Action: RuleDelete},
+			{Match: RuleMatch{MinSize: 1024 * 1024 * 1024}, Action: RuleKeep},
+		},
+	}
+	c := newClassifier(&config, nil, "/backup", now)
+
+	tests := []struct {
+		name     string
+		path     string
+		size     int64
+		age      time.Duration
+		expected RuleAction
+	}{
+		{"Protected by name", "/backup/db/full.manifest", 10, 60 * 24 * time.Hour, RuleProtect},
+		{"Exempted by an earlier rule", "/backup/db/keep/old.sql", 10, 60 * 24 * time.Hour, RuleAgeBased},
+		{"Old database dump", "/backup/db/old.sql", 10, 60 * 24 * time.Hour, RuleDelete},
+		{"Recent database dump", "/backup/db/new.sql", 10, time.Hour, RuleAgeBased},
+		{"Large file", "/backup/images/disk.img", 2 * 1024 * 1024 * 1024, time.Hour, RuleKeep},
+		{"No matching rule", "/backup/images/small.img", 10, time.Hour, RuleAgeBased},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.ruleAction(tt.path, tt.size, now.Add(-tt.age)); got != tt.expected {
+				t.Errorf("ruleAction(%q) = %d, want %d", tt.path, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestRules tests that rules are applied before the capacity algorithm
+func TestRules(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-rules-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	if err := os.Mkdir(filepath.Join(tmpDir, "db"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := []struct {
+		name    string
+		modTime time.Time
+	}{
+		{"backup.manifest", now.Add(-72 * time.Hour)},
+		{"image.iso", now},
+		{filepath.Join("db", "old.sql"), now.Add(-72 * time.Hour)},
+		{"old.dat", now.Add(-72 * time.Hour)},
+		{"recent.dat", now},
+	}
+	for _, f := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, f.name), 1024*1024, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the kept and protected files fit into the limit
+	maxSize := int64(2 * 1024 * 1024)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:    &maxSize,
+		TimeWindow: time.Hour,
+		Rules: []Rule{
+			{Match: RuleMatch{Glob: "*.manifest"}, Action: RuleProtect},
+			{Match: RuleMatch{Glob: "*.iso"}, Action: RuleDelete},
+			{Match: RuleMatch{Regexp: `^db/`}, Action: RuleKeep},
+		},
+		DiskInfo: &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.KeptFiles != 2 {
+		t.Errorf("Expected 2 kept files, got %d", report.KeptFiles)
+	}
+	if report.DeletedByRuleFiles != 1 {
+		t.Errorf("Expected 1 file deleted by rule, got %d", report.DeletedByRuleFiles)
+	}
+	reasons := make(map[string]int)
+	for _, count := range report.Protections {
+		reasons[count.Reason] = count.Files
+	}
+	if len(reasons) != 2 || reasons["rule 0 (protect *.manifest)"] != 1 || reasons["rule 2 (keep regexp ^db/)"] != 1 {
+		t.Errorf("Unexpected protections %+v", report.Protections)
+	}
+	for _, name := range []string{"backup.manifest", filepath.Join("db", "old.sql")} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected %s to remain: %v", name, err)
+		}
+	}
+	for _, name := range []string{"image.iso", "old.dat", "recent.dat"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be deleted", name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// runIDKey is the context key of WithRunID
+type runIDKey struct{}
+
+// WithRunID returns a context that makes the cleaning run started with it use
+// id as its RunID instead of a generated one, e.g. the ID of the job that
+// triggered it
+func WithRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, id)
+}
+
+// runIDFrom returns the run ID set with WithRunID, or a new random one
+func runIDFrom(ctx context.Context) string {
+	if id, ok := ctx.Value(runIDKey{}).(string); ok && id != "" {
+		return id
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// withRunID returns the callbacks with RunID set in the info they receive
+func (c Callbacks) withRunID(id string) Callbacks {
+	if fn := c.OnStart; fn != nil {
+		c.OnStart = func(info StartInfo) { info.RunID = id; fn(info) }
+	}
+	if fn := c.OnScanComplete; fn != nil {
+		c.OnScanComplete = func(info ScanCompleteInfo) { info.RunID = id; fn(info) }
+	}
+	if fn := c.OnDeleteStart; fn != nil {
+		c.OnDeleteStart = func(info DeleteStartInfo) { info.RunID = id; fn(info) }
+	}
+	if fn := c.OnFileDeleted; fn != nil {
+		c.OnFileDeleted = func(info FileDeletedInfo) { info.RunID = id; fn(info) }
+	}
+	if fn := c.OnDirDeleted; fn != nil {
+		c.OnDirDeleted = func(info DirDeletedInfo) { info.RunID = id; fn(info) }
+	}
+	if fn := c.OnComplete; fn != nil {
+		c.OnComplete = func(info CompleteInfo) { info.RunID = id; fn(info) }
+	}
+	if fn := c.OnError; fn != nil {
+		c.OnError = func(info ErrorInfo) { info.RunID = id; fn(info) }
+	}
+	return c
+}
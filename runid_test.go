@@ -0,0 +1,72 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunID(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, time.Hour} {
+		if err := createTestFile(t, filepath.Join(tmpDir, string(rune('a'+i))+".tar"), 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	var ids []string
+	record := func(id string) {
+		mu.Lock()
+		defer mu.Unlock()
+		ids = append(ids, id)
+	}
+	cleaner, err := NewCleaner(CleaningConfig{
+		MaxSize:    int64Ptr(4096),
+		TimeWindow: time.Hour,
+		DiskInfo:   &failingDiskInfoProvider{},
+		Callbacks: Callbacks{
+			OnStart:        func(info StartInfo) { record(info.RunID) },
+			OnScanComplete: func(info ScanCompleteInfo) { record(info.RunID) },
+			OnDeleteStart:  func(info DeleteStartInfo) { record(info.RunID) },
+			OnFileDeleted:  func(info FileDeletedInfo) { record(info.RunID) },
+			OnComplete:     func(info CompleteInfo) { record(info.RunID) },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := cleaner.Clean(WithRunID(context.Background(), "job-42"), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RunID != "job-42" {
+		t.Errorf("Expected the given run ID in the report, got %q", report.RunID)
+	}
+	if len(ids) != 6 {
+		t.Fatalf("Expected 6 callbacks, got %v", ids)
+	}
+	for _, id := range ids {
+		if id != "job-42" {
+			t.Errorf("Expected every callback to receive the run ID, got %v", ids)
+			break
+		}
+	}
+
+	// Runs without an ID get distinct generated ones
+	first, err := cleaner.Clean(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cleaner.Clean(context.Background(), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.RunID == "" || first.RunID == second.RunID {
+		t.Errorf("Expected distinct generated run IDs, got %q and %q", first.RunID, second.RunID)
+	}
+}
@@ -0,0 +1,297 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RunnerPolicy is the cleaning policy of one directory managed by a Runner
+type RunnerPolicy struct {
+	Config   CleaningConfig
+	Interval time.Duration // Time between the starts of two runs
+
+	// Schedule is a cron expression used instead of Interval, e.g.
+	// "CRON_TZ=Asia/Tokyo 15 3 * * *" to run after the nightly backups
+	// (see ParseSchedule). Scheduled directories are not staggered.
+	Schedule string
+}
+
+// RunnerConfig represents the configuration of a Runner
+type RunnerConfig struct {
+	// Policies maps each directory to its cleaning policy
+	Policies map[string]RunnerPolicy
+
+	// MaxConcurrent is the number of directories cleaned at the same time,
+	// shared across all policies so the runs do not hammer the disks at once
+	// (default: 1)
+	MaxConcurrent int
+
+	// Stagger delays the first run of each directory, in order of path, by
+	// this much more than the previous one (default: the shortest interval
+	// divided by the number of directories)
+	Stagger time.Duration
+
+	// OnRunComplete is called after each run with the status of the directory
+	OnRunComplete func(status RunnerStatus)
+
+	// HistorySize is the number of runs kept per directory for History
+	// (default: 100)
+	HistorySize int
+
+	// HistoryFile persists the history as JSON after each run and restores it
+	// when the Runner is created, so trends survive restarts (optional)
+	HistoryFile string
+
+	// AlertRules are checked after each run against the history of the
+	// directory. Raised alerts are passed to OnAlert and posted as JSON to
+	// AlertWebhook, both optional.
+	AlertRules   []AlertRule
+	OnAlert      func(alert Alert)
+	AlertWebhook string
+}
+
+// RunnerStatus is the state of one directory managed by a Runner
+type RunnerStatus struct {
+	Dir        string
+	Running    bool
+	Runs       int
+	Skipped    int             // Runs skipped because the directory did not need cleaning
+	Deferred   int             // Runs postponed to the end of a blackout window
+	LastStart  time.Time       // Zero before the first run
+	LastReport *CleaningReport // nil before the first run completes
+	LastError  error
+	NextRun    time.Time
+
+	HistoryError error // Last failure to persist the history to HistoryFile
+	AlertError   error // Last failure to post an alert to AlertWebhook
+}
+
+// Runner cleans several directories periodically, each with its own policy,
+// within a global concurrency budget
+type Runner struct {
+	config  RunnerConfig
+	targets []*runnerTarget // Sorted by directory
+	slots   chan struct{}   // Concurrency budget
+
+	mu         sync.Mutex // Guards the status of the targets
+	historySeq uint64     // Number of history snapshots taken, guarded by mu
+
+	// Serializes the writes of HistoryFile, held without mu so a slow file
+	// does not block Status and the other targets
+	historyMu    sync.Mutex
+	historySaved uint64 // Snapshot last written, guarded by historyMu
+}
+
+// runnerTarget is a directory managed by a Runner
+type runnerTarget struct {
+	dir      string
+	cleaner  *Cleaner
+	interval time.Duration
+	schedule *Schedule // Used instead of interval when set
+	status   RunnerStatus
+	history  runHistory
+}
+
+// NewRunner validates the policies and creates a Runner
+func NewRunner(config RunnerConfig) (*Runner, error) {
+	if len(config.Policies) == 0 || config.MaxConcurrent < 0 || config.Stagger < 0 || config.HistorySize < 0 {
+		return nil, ErrInvalidConfig
+	}
+	if config.MaxConcurrent == 0 {
+		config.MaxConcurrent = 1
+	}
+	if config.HistorySize == 0 {
+		config.HistorySize = defaultHistorySize
+	}
+	for _, rule := range config.AlertRules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("alert rule %q: %w", rule.name(), err)
+		}
+	}
+
+	r := &Runner{
+		config: config,
+		slots:  make(chan struct{}, config.MaxConcurrent),
+	}
+	var shortest time.Duration
+	for dir, policy := range config.Policies {
+		var schedule *Schedule
+		if policy.Schedule != "" {
+			if policy.Interval != 0 {
+				return nil, fmt.Errorf("%s: %w", dir, ErrInvalidConfig)
+			}
+			var err error
+			if schedule, err = ParseSchedule(policy.Schedule); err != nil {
+				return nil, fmt.Errorf("%s: %w: %v", dir, ErrInvalidConfig, err)
+			}
+		} else if policy.Interval <= 0 {
+			return nil, fmt.Errorf("%s: %w", dir, ErrInvalidConfig)
+		}
+		cleaner, err := NewCleaner(policy.Config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		r.targets = append(r.targets, &runnerTarget{
+			dir:      dir,
+			cleaner:  cleaner,
+			interval: policy.Interval,
+			schedule: schedule,
+			status:   RunnerStatus{Dir: dir},
+			history:  runHistory{size: config.HistorySize},
+		})
+		if schedule == nil && (shortest == 0 || policy.Interval < shortest) {
+			shortest = policy.Interval
+		}
+	}
+	sort.Slice(r.targets, func(i, j int) bool {
+		return r.targets[i].dir < r.targets[j].dir
+	})
+	if r.config.Stagger == 0 {
+		r.config.Stagger = shortest / time.Duration(len(r.targets))
+	}
+	if err := r.loadHistory(); err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+	return r, nil
+}
+
+// Run cleans the directories on schedule until ctx is canceled, then waits
+// for the running cleanups to stop and returns the context error.
+// Run must not be called concurrently.
+func (r *Runner) Run(ctx context.Context) error {
+	start := time.Now()
+	var wg sync.WaitGroup
+	staggered := 0
+	for _, t := range r.targets {
+		next := start.Add(time.Duration(staggered) * r.config.Stagger)
+		if t.schedule != nil {
+			next = t.schedule.Next(start)
+		} else {
+			staggered++
+		}
+		wg.Add(1)
+		go func(t *runnerTarget, next time.Time) {
+			defer wg.Done()
+			r.loop(ctx, t, next)
+		}(t, next)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// Status returns the state of each directory, sorted by directory
+func (r *Runner) Status() []RunnerStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := make([]RunnerStatus, len(r.targets))
+	for i, t := range r.targets {
+		status[i] = t.status
+	}
+	return status
+}
+
+// loop runs the cleanups of one directory, the first one at next. A zero
+// next means the schedule never matches.
+func (r *Runner) loop(ctx context.Context, t *runnerTarget, next time.Time) {
+	for !next.IsZero() {
+		r.mu.Lock()
+		t.status.NextRun = next
+		r.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		if end, ok := blackoutEnd(t.cleaner.config.BlackoutWindows, time.Now()); ok {
+			r.mu.Lock()
+			t.status.Deferred++
+			r.mu.Unlock()
+			next = end
+			continue
+		}
+		// Directories that don't need cleaning leave the budget to the others.
+		// When disk usage is unavailable the run decides, e.g. from MaxSize.
+		if needed, _, err := t.cleaner.NeedsCleaning(t.dir); err == nil && !needed {
+			r.mu.Lock()
+			t.status.Skipped++
+			r.mu.Unlock()
+		} else if !r.run(ctx, t) {
+			return
+		}
+
+		// Runs missed while waiting for the budget are skipped
+		now := time.Now()
+		if t.schedule != nil {
+			next = t.schedule.Next(now)
+			continue
+		}
+		for !next.After(now) {
+			next = next.Add(t.interval)
+		}
+	}
+}
+
+// alert delivers the alerts raised by a run of t
+func (r *Runner) alert(t *runnerTarget, alerts []Alert) {
+	for _, alert := range alerts {
+		callSafe(r.config.OnAlert, alert)
+		if r.config.AlertWebhook == "" {
+			continue
+		}
+		err := postAlert(r.config.AlertWebhook, alert)
+		r.mu.Lock()
+		t.status.AlertError = err
+		r.mu.Unlock()
+	}
+}
+
+// run cleans the directory of t within the concurrency budget. It returns
+// false if ctx was canceled while waiting for the budget.
+func (r *Runner) run(ctx context.Context, t *runnerTarget) bool {
+	select {
+	case r.slots <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+
+	start := time.Now()
+	r.mu.Lock()
+	t.status.Running = true
+	t.status.LastStart = start
+	r.mu.Unlock()
+
+	report, err := t.cleaner.Clean(ctx, t.dir)
+	<-r.slots
+
+	r.mu.Lock()
+	t.status.Running = false
+	t.status.Runs++
+	t.status.LastReport = &report
+	t.status.LastError = err
+	record := newRunRecord(t.dir, start, report, err)
+	alerts := EvaluateAlerts(r.config.AlertRules, t.history.list(), record)
+	t.history.add(record)
+	var history []RunRecord
+	var seq uint64
+	if r.config.HistoryFile != "" {
+		r.historySeq++
+		history, seq = r.historyLocked(), r.historySeq
+	}
+	r.mu.Unlock()
+
+	historyErr := r.saveHistory(history, seq)
+	r.mu.Lock()
+	t.status.HistoryError = historyErr
+	status := t.status
+	r.mu.Unlock()
+	callSafe(r.config.OnRunComplete, status)
+	r.alert(t, alerts)
+
+	return true
+}
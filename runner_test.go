@@ -0,0 +1,207 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunner(t *testing.T) {
+	var running, maxRunning int32
+	var mu sync.Mutex
+	var order []string
+
+	tmpDir := t.TempDir()
+	policies := make(map[string]RunnerPolicy)
+	for _, name := range []string{"c", "a", "b"} {
+		dir := filepath.Join(tmpDir, name)
+		createHostFiles(t, dir, 4, time.Now().Truncate(time.Hour))
+		maxSize := int64(2 * 4096)
+		policies[dir] = RunnerPolicy{
+			Interval: 30 * time.Millisecond,
+			Config: CleaningConfig{
+				MaxSize:    &maxSize,
+				TimeWindow: time.Hour,
+				DiskInfo:   &failingDiskInfoProvider{},
+				Callbacks: Callbacks{
+					OnStart: func(info StartInfo) {
+						n := atomic.AddInt32(&running, 1)
+						for {
+							m := atomic.LoadInt32(&maxRunning)
+							if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+								break
+							}
+						}
+						mu.Lock()
+						order = append(order, filepath.Base(info.TargetDir))
+						mu.Unlock()
+						time.Sleep(5 * time.Millisecond)
+					},
+					OnComplete: func(info CompleteInfo) {
+						atomic.AddInt32(&running, -1)
+					},
+				},
+			},
+		}
+	}
+
+	runner, err := NewRunner(RunnerConfig{Policies: policies})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := runner.Status()
+		if status[0].Runs >= 2 && status[1].Runs >= 2 && status[2].Runs >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Runs did not complete: %+v", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	if maxRunning != 1 {
+		t.Errorf("Expected at most 1 concurrent run, got %d", maxRunning)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) < 3 || order[0] != "a" || order[1] != "b" || order[2] != "c" {
+		t.Errorf("Expected staggered first runs in order of path, got %v", order)
+	}
+	for _, status := range runner.Status() {
+		// The last run may have been canceled
+		if status.LastReport == nil || status.LastError != nil && !errors.Is(status.LastError, context.Canceled) {
+			t.Errorf("Unexpected status %+v", status)
+		}
+		if countFiles(t, status.Dir) != 2 {
+			t.Errorf("Expected 2 files to remain in %s", status.Dir)
+		}
+	}
+}
+
+func TestNewRunnerValidation(t *testing.T) {
+	maxSize := int64(1024)
+	tests := []struct {
+		name   string
+		config RunnerConfig
+	}{
+		{"No policies", RunnerConfig{}},
+		{"Zero interval", RunnerConfig{Policies: map[string]RunnerPolicy{
+			"/backup": {Config: CleaningConfig{MaxSize: &maxSize}},
+		}}},
+		{"Invalid cleaning config", RunnerConfig{Policies: map[string]RunnerPolicy{
+			"/backup": {Interval: time.Hour},
+		}}},
+		{"Negative MaxConcurrent", RunnerConfig{MaxConcurrent: -1, Policies: map[string]RunnerPolicy{
+			"/backup": {Config: CleaningConfig{MaxSize: &maxSize}, Interval: time.Hour},
+		}}},
+		{"Negative HistorySize", RunnerConfig{HistorySize: -1, Policies: map[string]RunnerPolicy{
+			"/backup": {Config: CleaningConfig{MaxSize: &maxSize}, Interval: time.Hour},
+		}}},
+		{"Alert rule without limit", RunnerConfig{AlertRules: []AlertRule{{Metric: AlertFreedSize}}, Policies: map[string]RunnerPolicy{
+			"/backup": {Config: CleaningConfig{MaxSize: &maxSize}, Interval: time.Hour},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRunner(tt.config); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestRunnerSkipsWithoutNeed(t *testing.T) {
+	dir := t.TempDir()
+	createHostFiles(t, dir, 2, time.Now().Truncate(time.Hour))
+	runner, err := NewRunner(RunnerConfig{Policies: map[string]RunnerPolicy{
+		dir: {
+			Interval: 10 * time.Millisecond,
+			Config: CleaningConfig{
+				MinFreeSpace: int64Ptr(100),
+				DiskInfo:     &StaticDiskInfoProvider{Usage: &DiskUsage{Total: 1000, Used: 500, Free: 500, UsedPercent: 50}},
+			},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runner.Status()[0].Skipped < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Runs were not skipped: %+v", runner.Status())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if status := runner.Status()[0]; status.Runs != 0 || countFiles(t, dir) != 2 {
+		t.Errorf("Expected no runs, got %+v", status)
+	}
+}
+
+// TestRunnerMaxAge tests that runs are not skipped while files expire, even
+// when the constraints are met
+func TestRunnerMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	createHostFiles(t, dir, 2, now)
+	if err := createTestFile(t, filepath.Join(dir, "expired.bak"), 4096, now.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	runner, err := NewRunner(RunnerConfig{Policies: map[string]RunnerPolicy{
+		dir: {
+			Interval: 10 * time.Millisecond,
+			Config: CleaningConfig{
+				MinFreeSpace: int64Ptr(100),
+				MaxAge:       24 * time.Hour,
+				DiskInfo:     &StaticDiskInfoProvider{Usage: &DiskUsage{Total: 1000, Used: 500, Free: 500, UsedPercent: 50}},
+			},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runner.Status()[0].Runs < 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a run: %+v", runner.Status())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if status := runner.Status()[0]; status.Skipped != 0 {
+		t.Errorf("Expected no skipped runs, got %+v", status)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "expired.bak")); !os.IsNotExist(err) {
+		t.Error("Expected expired.bak to be deleted")
+	}
+	if countFiles(t, dir) != 2 {
+		t.Errorf("Expected 2 files to be kept, got %d", countFiles(t, dir))
+	}
+}
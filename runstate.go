@@ -0,0 +1,32 @@
+package gobackupcleaner
+
+// runState holds what a run loads from the target directory before the scan.
+// It is kept out of CleaningConfig, so a configuration shared by Cleaners
+// and Runners stays read-only while they run.
+type runState struct {
+	references *referenceSet // Referenced files, nil without a referenced list
+	artifacts  *referenceSet // The cleaner's own files below the target directory
+
+	// Files open when the run started (see SkipOpenFiles)
+	openFiles map[fileID]struct{}
+
+	// Snapshot directories and the space freed by deleting each after the
+	// older ones, with the directory's mtime (see SnapshotLayout)
+	snapshots map[string]dirSummary
+}
+
+// loadRunState loads the state of a run of config in dirPath
+func loadRunState(dirPath string, config *CleaningConfig, blockSize int64) (*runState, error) {
+	run := &runState{artifacts: config.loadArtifacts(dirPath)}
+	var err error
+	if run.references, err = config.loadReferences(dirPath); err != nil {
+		return nil, err
+	}
+	if run.openFiles, err = config.loadOpenFiles(); err != nil {
+		return nil, err
+	}
+	if run.snapshots, err = config.loadSnapshots(dirPath, blockSize); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
@@ -0,0 +1,110 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ScanResult lists the files found below a directory, as seen by the cleaner
+type ScanResult struct {
+	DirPath      string
+	ScannedAt    time.Time     // When the scan started
+	BlockSize    int64         // File system block size
+	ScanDuration time.Duration // Time spent scanning files
+	PartialScan  bool          // True if the scan was interrupted by the context
+	Files        []ScannedFile // Sorted by path
+
+	TotalSize      int64 // Total size of the files in bytes
+	TotalBlockSize int64 // Total block-aligned size in bytes
+}
+
+// ScannedFile is a file, or an opaque directory (see MaxDepth), found by a scan
+type ScannedFile struct {
+	Path      string // Relative to the scanned directory with "/" separators
+	Size      int64
+	BlockSize int64
+	ModTime   time.Time
+	IsDir     bool
+
+	// Category is how the file is treated by the configured policies:
+	// "age-based", "broken", "temp", "expendable", "expired", "rule-delete",
+	// "kept" or "protected"
+	Category string
+}
+
+// Scan scans the directory and returns all files found, without computing a
+// threshold or deleting anything. The capacity settings are not used and may
+// be omitted.
+func Scan(dirPath string, config CleaningConfig) (*ScanResult, error) {
+	config.setDefaults()
+	if err := config.validateSettings(); err != nil {
+		return nil, err
+	}
+	if err := config.readReferencedList(); err != nil {
+		return nil, err
+	}
+	cleaner := &Cleaner{config: config}
+	return cleaner.Scan(context.Background(), dirPath)
+}
+
+// Scan scans dirPath and returns all files found. If ctx is canceled the files
+// scanned so far are returned with PartialScan set.
+func (c *Cleaner) Scan(ctx context.Context, dirPath string) (result *ScanResult, err error) {
+	config := c.config
+	ctx, span := startSpan(ctx, &config, SpanScan)
+	span.SetAttribute(AttrTargetDir, dirPath)
+	defer func() { span.End(err) }()
+
+	if err := checkDir(config.fs(), dirPath); err != nil {
+		return nil, err
+	}
+	blockSize, err := config.blockSize(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	run, err := loadRunState(dirPath, &config, config.accountingBlockSize(blockSize))
+	if err != nil {
+		return nil, err
+	}
+
+	result = &ScanResult{
+		DirPath:   dirPath,
+		ScannedAt: time.Now(),
+		BlockSize: blockSize,
+	}
+	scanner := newScanner(&config, run, config.accountingBlockSize(blockSize))
+	scanner.sizes = newBlockSizes(&config, dirPath, scanner.blockSize)
+	scanner.collect = true
+	if err := scanner.scan(ctx, dirPath); err != nil {
+		return nil, err
+	}
+	result.ScanDuration = time.Since(result.ScannedAt)
+	result.PartialScan = ctx.Err() != nil
+
+	result.Files = make([]ScannedFile, 0, len(scanner.all))
+	for _, fi := range scanner.all {
+		rel, err := filepath.Rel(dirPath, fi.path)
+		if err != nil {
+			rel = fi.path
+		}
+		result.Files = append(result.Files, ScannedFile{
+			Path:      filepath.ToSlash(rel),
+			Size:      fi.size,
+			BlockSize: fi.blockSize,
+			ModTime:   fi.modTime,
+			IsDir:     fi.isDir,
+			Category:  fi.class.String(),
+		})
+		result.TotalSize += fi.size
+		result.TotalBlockSize += fi.blockSize
+	}
+	sort.Slice(result.Files, func(i, j int) bool {
+		return result.Files[i].Path < result.Files[j].Path
+	})
+	span.SetAttribute(AttrScannedFiles, len(result.Files))
+	span.SetAttribute(AttrScannedBytes, result.TotalSize)
+
+	return result, nil
+}
@@ -0,0 +1,140 @@
+package gobackupcleaner
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "db"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := []struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}{
+		{"db/full.tar.gz", 8192, now.Add(-48 * time.Hour)},
+		{"db/upload.part", 100, now.Add(-48 * time.Hour)},
+		{"keep.me", 10, now},
+	}
+	for _, f := range files {
+		if err := createTestFile(t, filepath.Join(tmpDir, f.name), f.size, f.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// No capacity limit is needed to scan
+	result, err := Scan(tmpDir, CleaningConfig{
+		CleanTempFiles: true,
+		Rules:          []Rule{{Match: RuleMatch{Glob: "*.me"}, Action: RuleProtect}},
+		DiskInfo:       &mockDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		path     string
+		category string
+	}{
+		{"db/full.tar.gz", "age-based"},
+		{"db/upload.part", "temp"},
+		{"keep.me", "protected"},
+	}
+	if len(result.Files) != len(expected) {
+		t.Fatalf("Expected %d files, got %d", len(expected), len(result.Files))
+	}
+	for i, e := range expected {
+		if result.Files[i].Path != e.path || result.Files[i].Category != e.category {
+			t.Errorf("File %d: got %s (%s), want %s (%s)", i, result.Files[i].Path, result.Files[i].Category, e.path, e.category)
+		}
+	}
+	if result.TotalSize != 8192+100+10 {
+		t.Errorf("Unexpected total size %d", result.TotalSize)
+	}
+	if result.TotalBlockSize != 8192+4096+4096 {
+		t.Errorf("Unexpected total block size %d", result.TotalBlockSize)
+	}
+}
+
+func TestScanResultExportCSV(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	result := &ScanResult{Files: []ScannedFile{
+		{Path: "a, b.bak", Size: 10, BlockSize: 4096, ModTime: modTime, Category: "age-based"},
+		{Path: "set", Size: 20, BlockSize: 8192, ModTime: modTime, IsDir: true, Category: "kept"},
+	}}
+
+	var buf bytes.Buffer
+	if err := result.Export(&buf, ExportCSV); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected a header and 2 rows, got %d", len(records))
+	}
+	want := []string{"a, b.bak", "10", "4096", "2024-01-02T03:04:05Z", "false", "age-based"}
+	for i, v := range want {
+		if records[1][i] != v {
+			t.Errorf("Column %s: got %q, want %q", records[0][i], records[1][i], v)
+		}
+	}
+
+	if err := result.Export(&buf, ExportFormat(99)); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestScanResultExportNcdu(t *testing.T) {
+	modTime := time.Unix(1700000000, 0)
+	result := &ScanResult{DirPath: "/backup", ScannedAt: modTime, Files: []ScannedFile{
+		{Path: "db/a.bak", Size: 10, BlockSize: 4096, ModTime: modTime},
+		{Path: "db/sets/2024", Size: 20, BlockSize: 8192, ModTime: modTime, IsDir: true},
+		{Path: "top.bak", Size: 30, BlockSize: 4096, ModTime: modTime},
+	}}
+
+	var buf bytes.Buffer
+	if err := result.Export(&buf, ExportNcdu); err != nil {
+		t.Fatal(err)
+	}
+	var export []any
+	if err := json.Unmarshal(buf.Bytes(), &export); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(export) != 4 || export[0] != float64(1) || export[1] != float64(2) {
+		t.Fatalf("Unexpected header: %s", buf.String())
+	}
+
+	name := func(v any) string {
+		if dir, ok := v.([]any); ok {
+			v = dir[0]
+		}
+		return v.(map[string]any)["name"].(string)
+	}
+	root := export[3].([]any)
+	if name(root) != "/backup" || len(root) != 3 {
+		t.Fatalf("Unexpected root: %v", root)
+	}
+	if name(root[1]) != "top.bak" || name(root[2]) != "db" {
+		t.Errorf("Expected files before directories, got %v", root)
+	}
+	db := root[2].([]any)
+	if len(db) != 3 || name(db[1]) != "a.bak" || name(db[2]) != "sets" {
+		t.Fatalf("Unexpected db directory: %v", db)
+	}
+	set := db[2].([]any)[1].([]any)
+	info := set[0].(map[string]any)
+	if info["name"] != "2024" || info["dsize"] != float64(8192) || len(set) != 1 {
+		t.Errorf("Unexpected opaque directory: %v", set)
+	}
+}
@@ -1,8 +1,10 @@
 package gobackupcleaner
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
@@ -13,6 +15,9 @@ type fileInfo struct {
 	size      int64
 	blockSize int64
 	modTime   time.Time
+	isDir     bool      // Opaque directory aggregated as a single unit (see MaxDepth)
+	class     fileClass // Files other than classNormal are deleted before age-based deletion
+	owner     uint32    // User ID of the owner, recorded with OwnerReport and OwnerQuotas
 }
 
 // timeSlot represents files grouped by time interval
@@ -21,48 +26,155 @@ type timeSlot struct {
 	files          []fileInfo
 	totalSize      int64
 	totalBlockSize int64
+	dropped        int // Files dropped from files in counting mode (see MaxMemoryBytes)
+}
+
+// slotKey identifies the slot starting at an instant, whatever its location
+type slotKey struct {
+	sec  int64
+	nsec int
+}
+
+// slotKeyOf returns the key of the slot starting at t
+func slotKeyOf(t time.Time) slotKey {
+	return slotKey{t.Unix(), t.Nanosecond()}
+}
+
+// slotList holds time slots indexed by start time. New slots are appended
+// and the list is sorted when it is read, so a scan finding many distinct
+// slots does not shift the list for each of them.
+type slotList struct {
+	slots    []*timeSlot
+	byTime   map[slotKey]*timeSlot
+	unsorted bool // Slots were appended since the last sort
+}
+
+// get returns the slot starting at t, adding it if missing
+func (l *slotList) get(t time.Time) *timeSlot {
+	key := slotKeyOf(t)
+	if slot, ok := l.byTime[key]; ok {
+		return slot
+	}
+	if l.byTime == nil {
+		l.byTime = make(map[slotKey]*timeSlot)
+	}
+	slot := &timeSlot{time: t}
+	l.byTime[key] = slot
+	l.slots = append(l.slots, slot)
+	l.unsorted = true
+	return slot
+}
+
+// sorted returns the slots sorted by time (oldest first)
+func (l *slotList) sorted() []*timeSlot {
+	if l.unsorted {
+		sort.Slice(l.slots, func(i, j int) bool { return l.slots[i].time.Before(l.slots[j].time) })
+		l.unsorted = false
+	}
+	return l.slots
+}
+
+// retain replaces the slots with slots, a subset of them in sorted order
+func (l *slotList) retain(slots []*timeSlot) {
+	l.slots = slots
+	l.byTime = make(map[slotKey]*timeSlot, len(slots))
+	for _, slot := range slots {
+		l.byTime[slotKeyOf(slot.time)] = slot
+	}
+	l.unsorted = false
 }
 
 // scanTask represents a task for parallel scanning
 type scanTask struct {
-	path string
+	path  string
+	depth int         // Depth below the root directory (root is 0)
+	info  os.FileInfo // Attributes read with the directory (see ReadDirPlus), nil to Lstat
 }
 
 // scanner handles file scanning operations
 type scanner struct {
 	config      *CleaningConfig
 	blockSize   int64
+	sizes       *blockSizes // Block sizes of other file systems, nil if blockSize applies to all files
 	workerCount int
+	workerStats []WorkerStats
+	timings     opTimings
 	mu          sync.Mutex
-	timeSlots   map[time.Time]*timeSlot
+	timeSlots   slotList
+	files       int        // Number of scanned files
+	priority    []fileInfo // Files deleted regardless of the time threshold
+	classifier  *classifier
+	run         *runState  // State loaded when the run started, nil in tests
+	pipeline    *pipeline  // Deletes files during the scan (see Pipeline)
+	collect     bool       // Collect all files into all (see Scan)
+	all         []fileInfo // All scanned files, including kept files
+
+	// Files kept out of the deletion by rules and KeepLatestN overrides
+	keptFiles       int
+	keptSize        int64
+	keptBlockSize   int64
+	keptLatestFiles int // Kept by KeepLatestN overrides and MinKeep settings (see protectLatest)
+	now             time.Time
+
+	protections  map[string]*ProtectionCount // Kept files per reason (see keep)
+	repositories []Repository                // Repositories left out of the scan (see RepositoryMode)
+	volumes      map[uint64]string           // Mount points by device (see PerVolumeTargets)
+	sillyRenamed map[string]struct{}         // .nfsXXXX files present before the run
+
+	// Memory held by the per-file lists, which are dropped once it exceeds
+	// maxMemory (see MaxMemoryBytes)
+	maxMemory int64
+	memory    int64
+	countOnly bool
+
+	droppedErrors int       // Errors not passed to OnError (see errorCollector)
+	watchdog      *watchdog // Set by scan, nil if WatchdogTimeout is not set
+
+	// Scanned files per owner (see OwnerReport)
+	ownersMu sync.Mutex
+	owners   map[uint32]classStats
 }
 
 // newScanner creates a new scanner instance
-func newScanner(config *CleaningConfig, blockSize int64) *scanner {
+func newScanner(config *CleaningConfig, run *runState, blockSize int64) *scanner {
 	return &scanner{
 		config:      config,
+		run:         run,
 		blockSize:   blockSize,
 		workerCount: config.ActualWorkerCount(),
-		timeSlots:   make(map[time.Time]*timeSlot),
+		workerStats: make([]WorkerStats, config.ActualWorkerCount()),
+		now:         time.Now(),
 	}
 }
 
-// scan performs parallel file scanning
-func (s *scanner) scan(rootPath string) error {
+// scan performs parallel file scanning.
+// Once ctx is done the remaining paths are skipped and the scan is partial.
+func (s *scanner) scan(ctx context.Context, rootPath string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.classifier = newClassifier(s.config, s.run, rootPath, s.now)
+	s.watchdog = newWatchdog(s.config.WatchdogTimeout)
 	taskChan := make(chan scanTask, 100)
-	errChan := make(chan error, s.workerCount)
+	errs := newErrorCollector(ErrorTypeScan, s.config.Callbacks.OnError)
 	var wg sync.WaitGroup
 	var taskWg sync.WaitGroup
 
-	// Start workers
+	// Start workers, each accumulating its files in a shard of its own
+	shards := make([]*slotShard, s.workerCount)
+	s.config.Stats.addWorkers(s.workerCount)
+	defer s.config.Stats.addWorkers(-s.workerCount)
 	for i := 0; i < s.workerCount; i++ {
+		if s.shardable() {
+			shards[i] = &slotShard{}
+		}
 		wg.Add(1)
-		go s.worker(taskChan, errChan, &wg, &taskWg)
+		go s.worker(ctx, i, shards[i], taskChan, errs, &wg, &taskWg)
 	}
 
 	// Start with root directory
 	taskWg.Add(1)
-	taskChan <- scanTask{path: rootPath}
+	s.config.Stats.addQueued(1)
+	taskChan <- scanTask{path: rootPath, depth: 0}
 
 	// Close task channel when all tasks are done
 	go func() {
@@ -70,144 +182,397 @@ func (s *scanner) scan(rootPath string) error {
 		close(taskChan)
 	}()
 
-	// Wait for all workers to complete
+	// Wait for all workers to complete and the errors to be reported
+	var firstErr error
+	var dropped int
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		wg.Wait()
-		close(errChan)
+		firstErr, dropped = errs.close()
 	}()
-
-	// Collect errors
-	var firstErr error
-	for err := range errChan {
-		if firstErr == nil && err != nil {
-			firstErr = err
-		}
-		if s.config.Callbacks.OnError != nil {
-			s.config.Callbacks.OnError(ErrorInfo{
-				Type:  ErrorTypeScan,
-				Error: err,
-			})
-		}
+	if err := s.watchdog.wait(done); err != nil {
+		return err
 	}
+	s.droppedErrors += dropped
 
+	s.mergeShards(shards)
 	return firstErr
 }
 
 // worker processes scan tasks
-func (s *scanner) worker(taskChan chan scanTask, errChan chan error, wg *sync.WaitGroup, taskWg *sync.WaitGroup) {
+func (s *scanner) worker(ctx context.Context, id int, shard *slotShard, taskChan chan scanTask, errs *errorCollector, wg *sync.WaitGroup, taskWg *sync.WaitGroup) {
 	defer wg.Done()
 
+	stats := &s.workerStats[id]
 	for task := range taskChan {
-		if err := s.processPath(task.path, taskChan, taskWg); err != nil {
-			errChan <- err
-		}
+		s.config.Stats.addQueued(-1)
+		s.config.Stats.addBusy(1)
+		start := time.Now()
+		// A panic must not skip taskWg.Done, or the traversal never ends
+		errs.add(runTask(task.path, func() error {
+			return s.processPath(ctx, task, shard, taskChan, taskWg)
+		}))
+		stats.Tasks++
+		stats.BusyTime += time.Since(start)
+		s.config.Stats.addBusy(-1)
 		taskWg.Done()
 	}
 }
 
 // processPath processes a single path
-func (s *scanner) processPath(path string, taskChan chan scanTask, taskWg *sync.WaitGroup) error {
-	info, err := os.Lstat(path) // Use Lstat to detect symlinks
-	if err != nil {
-		return err
+func (s *scanner) processPath(ctx context.Context, task scanTask, shard *slotShard, taskChan chan scanTask, taskWg *sync.WaitGroup) error {
+	if ctx.Err() != nil {
+		return nil
 	}
+	s.watchdog.touch()
 
-	// Skip symlinks
-	if info.Mode()&os.ModeSymlink != 0 {
+	path, depth, info := task.path, task.depth, task.info
+	if info == nil {
+		statStart := time.Now()
+		var err error
+		info, err = s.config.fs().Lstat(path) // Use Lstat to detect symlinks
+		s.timings.addStat(statStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Skip files that were already soft-deleted, and symlinks unless they are deleted
+	if isTombstone(path) || (info.Mode()&os.ModeSymlink != 0 && s.config.Symlinks != SymlinkDelete) {
 		return nil
 	}
 
+	// Files and directories left alone by ExcludePatterns are not counted
+	if s.config.isExcluded(s.classifier.root, path) {
+		return nil
+	}
+
+	// NFS frees the space of silly-renamed files once they are closed,
+	// deleting them only renames them again
+	if !info.IsDir() && isSillyRename(info.Name()) {
+		s.mu.Lock()
+		if s.sillyRenamed == nil {
+			s.sillyRenamed = make(map[string]struct{})
+		}
+		s.sillyRenamed[path] = struct{}{}
+		s.mu.Unlock()
+		return nil
+	}
+
+	// Files inside repositories are shared between snapshots
 	if info.IsDir() {
-		entries, err := os.ReadDir(path)
+		if repo, ok := s.config.repositoryAt(path); ok {
+			s.mu.Lock()
+			s.repositories = append(s.repositories, repo)
+			s.mu.Unlock()
+			return nil
+		}
+	}
+
+	if info.IsDir() && s.config.PerVolumeTargets {
+		s.addVolume(path, info)
+	}
+
+	// Directories containing the cleaner's own files are descended into
+	if info.IsDir() && s.config.isOpaqueDir(path, depth, s.run) && !s.run.isArtifact(path, true) {
+		if !s.config.isIncluded(s.classifier.root, path) {
+			return nil
+		}
+		// Treat the whole directory as a single backup unit
+		summary, err := s.config.summarizeOpaque(path, info, s.spaceOf, s.run)
+		if err != nil {
+			return err
+		}
+		if summary.modTime.IsZero() {
+			summary.modTime = info.ModTime()
+		}
+		fi := fileInfo{
+			path:      path,
+			size:      summary.size,
+			blockSize: summary.blockSize,
+			modTime:   summary.modTime,
+			isDir:     true,
+			class:     s.classifier.classifyDir(path, summary.size, summary.modTime),
+		}
+		if s.config.tracksOwners() {
+			s.addOwner(info, &fi)
+		}
+		s.addFileTo(shard, fi)
+		s.config.Stats.addScanned()
+		s.release(fi)
+	} else if info.IsDir() {
+		readDirStart := time.Now()
+		entries, err := s.config.fs().ReadDir(path)
+		s.timings.addReadDir(readDirStart)
 		if err != nil {
 			return err
 		}
 
 		for _, entry := range entries {
-			fullPath := filepath.Join(path, entry.Name())
+			child := scanTask{path: filepath.Join(path, entry.Name()), depth: depth + 1, info: s.config.entryInfo(entry)}
 			taskWg.Add(1)
+			s.config.Stats.addQueued(1)
 			select {
-			case taskChan <- scanTask{path: fullPath}:
+			case taskChan <- child:
 			default:
 				// If channel is full, process synchronously
+				s.config.Stats.addQueued(-1)
 				taskWg.Done()
-				if err := s.processPath(fullPath, taskChan, taskWg); err != nil {
+				if err := s.processPath(ctx, child, shard, taskChan, taskWg); err != nil {
 					return err
 				}
 			}
 		}
-	} else if info.Mode().IsRegular() {
-		// Process regular file
+	} else if s.config.isDeletableFile(info) && !s.run.isArtifact(path, false) && s.config.isIncluded(s.classifier.root, path) {
+		// Process regular file (or symlink, see SymlinkDelete)
 		fi := fileInfo{
 			path:      path,
 			size:      info.Size(),
-			blockSize: calculateBlockSize(info.Size(), s.blockSize),
+			blockSize: s.spaceOf(path, info),
 			modTime:   info.ModTime(),
+			class:     s.classifier.classifyFile(path, info.Size(), info.ModTime()),
 		}
-		s.addFile(fi)
+		if s.config.tracksOwners() {
+			s.addOwner(info, &fi)
+		}
+		s.config.Stats.addScanned()
+		if s.run.isOpenFile(info) {
+			s.keepOpen(fi)
+			return nil
+		}
+		s.addFileTo(shard, fi)
+		s.release(fi)
 	}
 
 	return nil
 }
 
+// spaceOf returns the space accounted for a scanned file
+func (s *scanner) spaceOf(path string, info os.FileInfo) int64 {
+	blockSize := s.blockSize
+	if s.sizes != nil {
+		blockSize = s.sizes.of(path, info)
+	}
+	return s.config.fileSpace(path, info, blockSize)
+}
+
+// dirSummary holds aggregated information about an opaque directory
+type dirSummary struct {
+	files     int
+	size      int64
+	blockSize int64
+	modTime   time.Time // Newest modification time of the contained files
+}
+
+// summarizeDir walks a directory and aggregates the regular files below it.
+// Symlinks are not followed, consistent with the scanner.
+func summarizeDir(path string, space spaceFunc, fs FileSystem) (dirSummary, error) {
+	var summary dirSummary
+	err := summarizeDirInto(&summary, path, space, fs)
+	return summary, err
+}
+
+// summarizeDirInto recursively adds the files below path to summary
+func summarizeDirInto(summary *dirSummary, path string, space spaceFunc, fs FileSystem) error {
+	entries, err := fs.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		fullPath := filepath.Join(path, entry.Name())
+		if entry.IsDir() {
+			if err := summarizeDirInto(summary, fullPath, space, fs); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		summary.files++
+		summary.size += info.Size()
+		summary.blockSize += space(fullPath, info)
+		if info.ModTime().After(summary.modTime) {
+			summary.modTime = info.ModTime()
+		}
+	}
+	return nil
+}
+
+// keep counts a file kept out of the deletion for reason. The caller must hold mu.
+func (s *scanner) keep(fi fileInfo, reason string) {
+	s.keptFiles++
+	s.keptSize += fi.size
+	s.keptBlockSize += fi.blockSize
+
+	if s.protections == nil {
+		s.protections = make(map[string]*ProtectionCount)
+	}
+	count := s.protections[reason]
+	if count == nil {
+		count = &ProtectionCount{Reason: reason}
+		s.protections[reason] = count
+	}
+	count.Files++
+	count.Size += fi.size
+	count.BlockSize += fi.blockSize
+}
+
+// keepOpen keeps a file that is open by a process out of the deletion (see
+// SkipOpenFiles)
+func (s *scanner) keepOpen(fi fileInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files++
+	if s.collect {
+		s.all = append(s.all, fi)
+	}
+	s.keep(fi, openFileReason)
+}
+
+// protectionCounts returns the kept files per reason, the largest first
+func (s *scanner) protectionCounts() []ProtectionCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.protections) == 0 {
+		return nil
+	}
+	counts := make([]ProtectionCount, 0, len(s.protections))
+	for _, count := range s.protections {
+		counts = append(counts, *count)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].BlockSize != counts[j].BlockSize {
+			return counts[i].BlockSize > counts[j].BlockSize
+		}
+		return counts[i].Reason < counts[j].Reason
+	})
+	return counts
+}
+
+// getRepositories returns the repositories left out of the scan, sorted by path
+func (s *scanner) getRepositories() []Repository {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sortRepositories(s.repositories)
+	return s.repositories
+}
+
 // addFile adds a file to the appropriate time slot
 func (s *scanner) addFile(fi fileInfo) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Round time down to the nearest time window
-	slotTime := fi.modTime.Truncate(s.config.TimeWindow)
+	s.files++
+	if s.collect {
+		s.all = append(s.all, fi)
+	}
 
-	slot, exists := s.timeSlots[slotTime]
-	if !exists {
-		slot = &timeSlot{
-			time:  slotTime,
-			files: make([]fileInfo, 0),
+	if fi.class.isKept() {
+		reason := "rules"
+		if fi.class == classReferenced {
+			reason = "referenced list"
+		} else if i := s.classifier.matchRule(fi.path, fi.size, fi.modTime); i >= 0 {
+			reason = s.classifier.rules[i].reason(i)
 		}
-		s.timeSlots[slotTime] = slot
+		s.keep(fi, reason)
+		return
+	}
+	if fi.class != classNormal {
+		s.priority = append(s.priority, fi)
+		return
 	}
 
+	// Round time down to the nearest time window
+	slot := s.timeSlots.get(fi.modTime.Truncate(s.config.TimeWindow))
+	if s.countOnly {
+		slot.dropped++
+	} else {
+		slot.files = append(slot.files, fi)
+		s.trackMemory(fi)
+	}
+	slot.totalSize += fi.size
+	slot.totalBlockSize += fi.blockSize
+}
+
+// slotShard holds the files of age-based deletion found by one scan worker,
+// merged into the scanner once the scan ends so that workers do not contend
+// on its mutex for every file
+type slotShard struct {
+	timeSlots slotList
+	files     int
+}
+
+// shardable reports whether workers can accumulate their files in shards:
+// the pipeline and MaxMemoryBytes need the totals while scanning, and
+// collecting all files needs them in one list
+func (s *scanner) shardable() bool {
+	return s.pipeline == nil && s.maxMemory <= 0 && !s.collect
+}
+
+// addFileTo adds a file to the shard of a worker, or to the scanner if there
+// is none or the file is not subject to age-based deletion
+func (s *scanner) addFileTo(shard *slotShard, fi fileInfo) {
+	if shard == nil || fi.class != classNormal {
+		s.addFile(fi)
+		return
+	}
+	slot := shard.timeSlots.get(fi.modTime.Truncate(s.config.TimeWindow))
 	slot.files = append(slot.files, fi)
 	slot.totalSize += fi.size
 	slot.totalBlockSize += fi.blockSize
+	shard.files++
+}
+
+// mergeShards adds the files of the workers' shards to the scanner
+func (s *scanner) mergeShards(shards []*slotShard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		s.files += shard.files
+		for _, slot := range shard.timeSlots.slots {
+			merged := s.timeSlots.get(slot.time)
+			merged.files = append(merged.files, slot.files...)
+			merged.totalSize += slot.totalSize
+			merged.totalBlockSize += slot.totalBlockSize
+		}
+	}
 }
 
 // getTimeSlots returns time slots sorted by time (oldest first)
 func (s *scanner) getTimeSlots() []*timeSlot {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return append([]*timeSlot(nil), s.timeSlots.sorted()...)
+}
 
-	slots := make([]*timeSlot, 0, len(s.timeSlots))
-	for _, slot := range s.timeSlots {
-		slots = append(slots, slot)
-	}
-
-	// Sort by time (oldest first)
-	sortTimeSlots(slots)
-	return slots
+// getPriorityFiles returns the files to be deleted before age-based deletion
+func (s *scanner) getPriorityFiles() []fileInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.priority
 }
 
 // getTotalFiles returns the total number of scanned files
 func (s *scanner) getTotalFiles() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-
-	total := 0
-	for _, slot := range s.timeSlots {
-		total += len(slot.files)
-	}
-	return total
+	return s.files
 }
 
 // sortTimeSlots sorts time slots by time (oldest first)
 func sortTimeSlots(slots []*timeSlot) {
-	// Simple bubble sort for clarity (can be optimized if needed)
-	n := len(slots)
-	for i := 0; i < n-1; i++ {
-		for j := 0; j < n-i-1; j++ {
-			if slots[j].time.After(slots[j+1].time) {
-				slots[j], slots[j+1] = slots[j+1], slots[j]
-			}
-		}
-	}
-}
\ No newline at end of file
+	sort.Slice(slots, func(i, j int) bool { return slots[i].time.Before(slots[j].time) })
+}
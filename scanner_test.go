@@ -1,6 +1,9 @@
 package gobackupcleaner
 
 import (
+	"context"
+	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
@@ -55,8 +58,8 @@ func TestScanner(t *testing.T) {
 	}
 	config.setDefaults()
 
-	scanner := newScanner(&config, 4096)
-	_ = scanner.scan(tmpDir)
+	scanner := newScanner(&config, nil, 4096)
+	_ = scanner.scan(context.Background(), tmpDir)
 
 	// Verify results
 	totalFiles := scanner.getTotalFiles()
@@ -108,8 +111,8 @@ func TestScannerWithSymlinks(t *testing.T) {
 	}
 	config.setDefaults()
 
-	scanner := newScanner(&config, 4096)
-	_ = scanner.scan(tmpDir)
+	scanner := newScanner(&config, nil, 4096)
+	_ = scanner.scan(context.Background(), tmpDir)
 
 	// Should only count regular files, not symlinks
 	totalFiles := scanner.getTotalFiles()
@@ -154,8 +157,8 @@ func TestScannerWithPermissionError(t *testing.T) {
 	}
 	config.setDefaults()
 
-	scanner := newScanner(&config, 4096)
-	_ = scanner.scan(tmpDir)
+	scanner := newScanner(&config, nil, 4096)
+	_ = scanner.scan(context.Background(), tmpDir)
 
 	// Should continue despite permission error
 	totalFiles := scanner.getTotalFiles()
@@ -176,7 +179,7 @@ func TestTimeSlotAggregation(t *testing.T) {
 	}
 	config.setDefaults()
 
-	scanner := newScanner(&config, 4096)
+	scanner := newScanner(&config, nil, 4096)
 
 	// Add files with different timestamps
 	baseTime := time.Now().Truncate(time.Hour)
@@ -224,3 +227,93 @@ func TestTimeSlotAggregation(t *testing.T) {
 		t.Errorf("Expected 1 file in second slot, got %d", len(slots[1].files))
 	}
 }
+
+func TestSlotListSorted(t *testing.T) {
+	base := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	var slots slotList
+	for _, hours := range []int{5, 1, 3, 1, 0, 5, 4} {
+		slot := slots.get(base.Add(time.Duration(hours) * time.Hour))
+		slot.totalSize++
+	}
+	// The same instant in another location shares the slot
+	slots.get(base.Add(3*time.Hour).In(time.FixedZone("JST", 9*60*60))).totalSize++
+	sorted := slots.sorted()
+	if len(sorted) != 5 {
+		t.Fatalf("Expected 5 slots, got %d", len(sorted))
+	}
+	for i, slot := range sorted {
+		if i > 0 && !sorted[i-1].time.Before(slot.time) {
+			t.Errorf("Slots not sorted at %d: %v after %v", i, slot.time, sorted[i-1].time)
+		}
+	}
+	if sorted[1].totalSize != 2 || sorted[2].totalSize != 2 || sorted[4].totalSize != 2 {
+		t.Errorf("Expected repeated times to share their slot, got %d, %d and %d", sorted[1].totalSize, sorted[2].totalSize, sorted[4].totalSize)
+	}
+
+	// Slots added after a read are sorted in
+	slots.get(base.Add(2 * time.Hour))
+	if sorted = slots.sorted(); len(sorted) != 6 || !sorted[2].time.Equal(base.Add(2*time.Hour)) {
+		t.Errorf("Expected the new slot third, got %d slots", len(sorted))
+	}
+}
+
+func TestScannerShardsMatchSingleWorker(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 200; i++ {
+		dir := filepath.Join(tmpDir, fmt.Sprintf("host%d", i%8))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("backup%03d.tar", i))
+		if err := createTestFile(t, path, int64(100+i), now.Add(-time.Duration(i%17)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(workers int) []*timeSlot {
+		config := CleaningConfig{TimeWindow: time.Hour, Concurrency: workers, MaxConcurrency: workers}
+		config.setDefaults()
+		scanner := newScanner(&config, nil, 0)
+		if err := scanner.scan(context.Background(), tmpDir); err != nil {
+			t.Fatal(err)
+		}
+		if scanner.getTotalFiles() != 200 {
+			t.Fatalf("%d workers: expected 200 files, got %d", workers, scanner.getTotalFiles())
+		}
+		return scanner.getTimeSlots()
+	}
+	single, sharded := scan(1), scan(8)
+	if len(single) != 17 || len(sharded) != len(single) {
+		t.Fatalf("Expected 17 slots, got %d and %d", len(single), len(sharded))
+	}
+	for i := range single {
+		a, b := single[i], sharded[i]
+		if !a.time.Equal(b.time) || len(a.files) != len(b.files) || a.totalSize != b.totalSize || a.totalBlockSize != b.totalBlockSize {
+			t.Errorf("Slot %d differs: %v/%d/%d vs %v/%d/%d", i, a.time, len(a.files), a.totalSize, b.time, len(b.files), b.totalSize)
+		}
+	}
+}
+
+// BenchmarkSlotListManySlots measures grouping files into many distinct
+// slots, as with a short TimeWindow over a long history, found in random
+// order by the scan workers
+func BenchmarkSlotListManySlots(b *testing.B) {
+	const slotCount = 200000
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := make([]time.Time, slotCount)
+	for i, j := range rand.New(rand.NewSource(1)).Perm(slotCount) {
+		times[i] = base.Add(time.Duration(j) * time.Minute)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var slots slotList
+		for _, t := range times {
+			slots.get(t).totalSize++
+		}
+		if len(slots.sorted()) != slotCount {
+			b.Fatalf("Expected %d slots", slotCount)
+		}
+	}
+}
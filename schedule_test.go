@@ -0,0 +1,108 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	// A Wednesday
+	from := time.Date(2024, 1, 10, 3, 20, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"15 3 * * *", time.Date(2024, 1, 11, 3, 15, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 10, 3, 30, 0, 0, time.UTC)},
+		{"0 4-6 * * *", time.Date(2024, 1, 10, 4, 0, 0, 0, time.UTC)},
+		{"0 0 * * sat,sun", time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 feb *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day matches when both are restricted
+		{"0 12 15 * fri", time.Date(2024, 1, 12, 12, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=Asia/Tokyo 15 3 * * *", time.Date(2024, 1, 11, 3, 15, 0, 0, tokyo)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.expr, err)
+			continue
+		}
+		// Local schedules are compared in UTC to not depend on the machine
+		if s.location == time.Local {
+			s.location = time.UTC
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("ParseSchedule(%q).Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"CRON_TZ=Nowhere/City * * * * *",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) should fail", expr)
+		}
+	}
+}
+
+func TestRunnerSchedule(t *testing.T) {
+	tmpDir := t.TempDir()
+	config := CleaningConfig{MaxSize: int64Ptr(1 << 30), DiskInfo: &failingDiskInfoProvider{}}
+
+	if _, err := NewRunner(RunnerConfig{Policies: map[string]RunnerPolicy{
+		tmpDir: {Config: config, Schedule: "15 3 * * *", Interval: time.Hour},
+	}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig with both Schedule and Interval, got %v", err)
+	}
+	if _, err := NewRunner(RunnerConfig{Policies: map[string]RunnerPolicy{
+		tmpDir: {Config: config, Schedule: "15 3 * *"},
+	}}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for an invalid schedule, got %v", err)
+	}
+
+	runner, err := NewRunner(RunnerConfig{Policies: map[string]RunnerPolicy{
+		tmpDir: {Config: config, Schedule: "15 3 * * *"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	var next time.Time
+	for next.IsZero() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		next = runner.Status()[0].NextRun
+	}
+	cancel()
+	<-done
+	if next.Hour() != 3 || next.Minute() != 15 || time.Until(next) > 24*time.Hour {
+		t.Errorf("Expected the next run at the next 03:15, got %v", next)
+	}
+}
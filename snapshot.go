@@ -0,0 +1,117 @@
+package gobackupcleaner
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// snapshotDirPattern matches the rotation directories of rsnapshot, such as
+// hourly.0, daily.6 or weekly.1
+var snapshotDirPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*\.[0-9]+$`)
+
+// snapshotInode tracks the hard links of a file across the snapshots
+type snapshotInode struct {
+	nlink     uint64 // Links of the file, including those outside the snapshots
+	seen      uint64 // Links found in the snapshots
+	newest    int    // Index of the newest snapshot linking the file
+	size      int64
+	blockSize int64
+}
+
+// loadSnapshots finds the snapshot directories directly below dirPath with
+// SnapshotLayout and accounts each with the space freed by deleting it after
+// all older snapshots: a file is freed with the newest snapshot linking it,
+// and never if it is also linked outside the snapshots. The modification
+// time of a snapshot is the one of its directory, which rsnapshot sets when
+// the snapshot is taken.
+func (c *CleaningConfig) loadSnapshots(dirPath string, blockSize int64) (map[string]dirSummary, error) {
+	if !c.SnapshotLayout {
+		return nil, nil
+	}
+	entries, err := c.fs().ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	type snapshot struct {
+		path    string
+		summary dirSummary
+	}
+	var snapshots []*snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() || !snapshotDirPattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dirPath, entry.Name())
+		snapshots = append(snapshots, &snapshot{path: path, summary: dirSummary{modTime: info.ModTime()}})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		if !snapshots[i].summary.modTime.Equal(snapshots[j].summary.modTime) {
+			return snapshots[i].summary.modTime.Before(snapshots[j].summary.modTime)
+		}
+		return snapshots[i].path < snapshots[j].path
+	})
+
+	inodes := make(map[fileID]*snapshotInode)
+	for i, snap := range snapshots {
+		err := filepath.WalkDir(snap.path, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.Type().IsRegular() {
+				return err
+			}
+			info, err := entry.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			snap.summary.files++
+			space := c.fileSpace(path, info, blockSize)
+			id, nlink, ok := linksOf(info)
+			if !ok || nlink <= 1 {
+				snap.summary.size += info.Size()
+				snap.summary.blockSize += space
+				return nil
+			}
+			inode := inodes[id]
+			if inode == nil {
+				inode = &snapshotInode{nlink: nlink, size: info.Size(), blockSize: space}
+				inodes[id] = inode
+			}
+			inode.seen++
+			inode.newest = i
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, inode := range inodes {
+		if inode.seen >= inode.nlink {
+			summary := &snapshots[inode.newest].summary
+			summary.size += inode.size
+			summary.blockSize += inode.blockSize
+		}
+	}
+
+	summaries := make(map[string]dirSummary, len(snapshots))
+	for _, snap := range snapshots {
+		summaries[snap.path] = snap.summary
+	}
+	return summaries, nil
+}
+
+// isSnapshot reports whether path is a snapshot directory (see SnapshotLayout)
+func (r *runState) isSnapshot(path string) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.snapshots[path]
+	return ok
+}
@@ -0,0 +1,94 @@
+//go:build !windows
+// +build !windows
+
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createSnapshots creates an rsnapshot-style farm below root:
+//
+//	daily.2 (oldest): old.dat, mid.dat, shared.dat
+//	daily.1:          mid.dat, shared.dat (hard links)
+//	daily.0:          new.dat, shared.dat (hard link)
+func createSnapshots(t *testing.T, root string, now time.Time) {
+	t.Helper()
+	for _, dir := range []string{"daily.0", "daily.1", "daily.2"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]int64{"daily.2/old.dat": 4096, "daily.2/mid.dat": 4096, "daily.2/shared.dat": 8192, "daily.0/new.dat": 4096}
+	for name, size := range files {
+		if err := createTestFile(t, filepath.Join(root, name), size, now.Add(-96*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"daily.1/mid.dat":    "daily.2/mid.dat",
+		"daily.1/shared.dat": "daily.2/shared.dat",
+		"daily.0/shared.dat": "daily.2/shared.dat",
+	} {
+		if err := os.Link(filepath.Join(root, target), filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, dir := range []string{"daily.0", "daily.1", "daily.2"} {
+		modTime := now.Add(-time.Duration(i+1) * 24 * time.Hour)
+		if err := os.Chtimes(filepath.Join(root, dir), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSnapshotLayoutAccounting(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	createSnapshots(t, tmpDir, now)
+
+	result, err := Scan(tmpDir, CleaningConfig{SnapshotLayout: true, DiskInfo: &failingDiskInfoProvider{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"daily.0": 12288, "daily.1": 4096, "daily.2": 4096}
+	if len(result.Files) != len(want) {
+		t.Fatalf("Expected the snapshots as units, got %+v", result.Files)
+	}
+	for _, file := range result.Files {
+		if !file.IsDir || file.BlockSize != want[file.Path] {
+			t.Errorf("%s: expected %d bytes freed, got %d (dir %t)", file.Path, want[file.Path], file.BlockSize, file.IsDir)
+		}
+	}
+}
+
+func TestSnapshotLayoutClean(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	createSnapshots(t, tmpDir, now)
+	if err := createTestFile(t, filepath.Join(tmpDir, "rsnapshot.log"), 4096, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// 24KB in total, so the two oldest snapshots must go
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:        int64Ptr(16384),
+		TimeWindow:     time.Hour,
+		SnapshotLayout: true,
+		DiskInfo:       &failingDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedBlockSize != 8192 || report.DeletedFiles != 5 {
+		t.Errorf("Expected daily.2 and daily.1 (5 files, 8KB) to be deleted, got %d files, %d bytes", report.DeletedFiles, report.DeletedBlockSize)
+	}
+	for dir, exists := range map[string]bool{"daily.2": false, "daily.1": false, "daily.0": true, "daily.0/shared.dat": true, "rsnapshot.log": true} {
+		if _, err := os.Stat(filepath.Join(tmpDir, dir)); (err == nil) != exists {
+			t.Errorf("%s: expected exists=%t, got %v", dir, exists, err)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build aix
+// +build aix
+
+package gobackupcleaner
+
+import "syscall"
+
+// statfs returns the statfs values of path. f_bsize is the fundamental block
+// size the counts are in.
+func statfs(path string) (statfsResult, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return statfsResult{}, err
+	}
+	return statfsResult{
+		fragmentSize:    stat.Bsize,
+		blocks:          stat.Blocks,
+		freeBlocks:      stat.Bfree,
+		availableBlocks: stat.Bavail,
+	}, nil
+}
@@ -0,0 +1,22 @@
+//go:build darwin || freebsd || dragonfly
+// +build darwin freebsd dragonfly
+
+package gobackupcleaner
+
+import "syscall"
+
+// statfs returns the statfs values of path. On the BSDs f_bsize is the
+// fundamental block size the counts are in (f_iosize is the preferred I/O
+// size), so it matches f_frsize of statvfs.
+func statfs(path string) (statfsResult, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return statfsResult{}, err
+	}
+	return statfsResult{
+		fragmentSize:    blockCount(stat.Bsize),
+		blocks:          blockCount(stat.Blocks),
+		freeBlocks:      blockCount(stat.Bfree),
+		availableBlocks: blockCount(stat.Bavail),
+	}, nil
+}
@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+package gobackupcleaner
+
+import "syscall"
+
+// statfs returns the statfs values of path. f_frsize is the unit of the block
+// counts; f_bsize is only the preferred I/O size and differs on file systems
+// such as NFS. Kernels that do not report f_frsize use f_bsize.
+func statfs(path string) (statfsResult, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return statfsResult{}, err
+	}
+	fragmentSize := blockCount(stat.Frsize)
+	if fragmentSize == 0 {
+		fragmentSize = blockCount(stat.Bsize)
+	}
+	return statfsResult{
+		fragmentSize:    fragmentSize,
+		blocks:          stat.Blocks,
+		freeBlocks:      stat.Bfree,
+		availableBlocks: stat.Bavail,
+	}, nil
+}
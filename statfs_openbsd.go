@@ -0,0 +1,21 @@
+//go:build openbsd
+// +build openbsd
+
+package gobackupcleaner
+
+import "syscall"
+
+// statfs returns the statfs values of path. Like on the other BSDs f_bsize is
+// the fundamental block size the counts are in.
+func statfs(path string) (statfsResult, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return statfsResult{}, err
+	}
+	return statfsResult{
+		fragmentSize:    blockCount(stat.F_bsize),
+		blocks:          stat.F_blocks,
+		freeBlocks:      stat.F_bfree,
+		availableBlocks: blockCount(stat.F_bavail),
+	}, nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows && !linux && !darwin && !freebsd && !dragonfly && !openbsd && !aix && !js && !wasip1
+// +build !windows,!linux,!darwin,!freebsd,!dragonfly,!openbsd,!aix,!js,!wasip1
+
+package gobackupcleaner
+
+// statfs is not available on this platform (e.g. NetBSD and Solaris, whose
+// statvfs is not exposed by the syscall package). Set MaxSize and
+// BlockSizeOverride, or use a custom DiskInfoProvider.
+func statfs(path string) (statfsResult, error) {
+	return statfsResult{}, ErrDiskInfoUnsupported
+}
@@ -0,0 +1,94 @@
+package gobackupcleaner
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// Stats holds live counters of cleaning runs, updated atomically by the workers.
+// Assign the same Stats to CleaningConfig.Stats across runs to surface cleaner
+// internals in an embedding application's debug pages.
+//
+// FilesScanned, FilesDeleted and BytesDeleted are cumulative counters.
+// QueueDepth, BusyWorkers and Workers are gauges reflecting the current run.
+type Stats struct {
+	filesScanned atomic.Int64
+	filesDeleted atomic.Int64
+	bytesDeleted atomic.Int64
+	queueDepth   atomic.Int64
+	busyWorkers  atomic.Int64
+	workers      atomic.Int64
+}
+
+// StatsSnapshot is a point-in-time copy of Stats
+type StatsSnapshot struct {
+	FilesScanned int64
+	FilesDeleted int64
+	BytesDeleted int64 // Block-aligned bytes
+	QueueDepth   int64
+	BusyWorkers  int64
+	Workers      int64
+}
+
+// Utilization returns the fraction of workers currently busy (0-1)
+func (s StatsSnapshot) Utilization() float64 {
+	if s.Workers == 0 {
+		return 0
+	}
+	return float64(s.BusyWorkers) / float64(s.Workers)
+}
+
+// Snapshot returns the current values of all counters
+func (s *Stats) Snapshot() StatsSnapshot {
+	return StatsSnapshot{
+		FilesScanned: s.filesScanned.Load(),
+		FilesDeleted: s.filesDeleted.Load(),
+		BytesDeleted: s.bytesDeleted.Load(),
+		QueueDepth:   s.queueDepth.Load(),
+		BusyWorkers:  s.busyWorkers.Load(),
+		Workers:      s.workers.Load(),
+	}
+}
+
+// Publish exposes the counters as an expvar variable with the given name,
+// making them visible on /debug/vars. Like expvar.Publish, it panics if the
+// name is already registered.
+func (s *Stats) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return s.Snapshot()
+	}))
+}
+
+// The following helpers are safe to call on a nil *Stats
+
+func (s *Stats) addScanned() {
+	if s != nil {
+		s.filesScanned.Add(1)
+	}
+}
+
+func (s *Stats) addDeleted(files int64, blockSize int64) {
+	if s != nil {
+		s.filesDeleted.Add(files)
+		s.bytesDeleted.Add(blockSize)
+	}
+}
+
+func (s *Stats) addQueued(delta int64) {
+	if s != nil {
+		s.queueDepth.Add(delta)
+	}
+}
+
+func (s *Stats) addBusy(delta int64) {
+	if s != nil {
+		s.busyWorkers.Add(delta)
+	}
+}
+
+// addWorkers adds to the worker gauge, so runs sharing the Stats add up
+func (s *Stats) addWorkers(n int) {
+	if s != nil {
+		s.workers.Add(int64(n))
+	}
+}
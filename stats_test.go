@@ -0,0 +1,72 @@
+package gobackupcleaner
+
+import (
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestStatsCounters tests that live counters are updated during a run
+func TestStatsCounters(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-stats-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	for i, age := range []time.Duration{72 * time.Hour, 48 * time.Hour, time.Hour} {
+		path := filepath.Join(tmpDir, fmt.Sprintf("file%d.txt", i))
+		if err := createTestFile(t, path, 1024, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := &Stats{}
+	maxUsage := float64(70)
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxUsagePercent: &maxUsage,
+		DiskInfo:        &mockDiskInfoProvider{},
+		Stats:           stats,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := stats.Snapshot()
+	if snapshot.FilesScanned != 3 {
+		t.Errorf("Expected 3 scanned files, got %d", snapshot.FilesScanned)
+	}
+	if snapshot.FilesDeleted != int64(report.DeletedFiles) {
+		t.Errorf("Expected %d deleted files, got %d", report.DeletedFiles, snapshot.FilesDeleted)
+	}
+	if snapshot.BytesDeleted != report.DeletedBlockSize {
+		t.Errorf("Expected %d deleted bytes, got %d", report.DeletedBlockSize, snapshot.BytesDeleted)
+	}
+	// Gauges are reset once the run completes
+	if snapshot.QueueDepth != 0 || snapshot.BusyWorkers != 0 || snapshot.Workers != 0 {
+		t.Errorf("Expected gauges to be zero after the run, got %+v", snapshot)
+	}
+}
+
+// TestStatsPublish tests that stats can be published via expvar
+func TestStatsPublish(t *testing.T) {
+	stats := &Stats{}
+	stats.addScanned()
+	stats.Publish("backup_cleaner_test_stats")
+
+	v := expvar.Get("backup_cleaner_test_stats")
+	if v == nil {
+		t.Fatal("Expected stats to be published")
+	}
+	if got := v.String(); got == "" || got == "null" {
+		t.Errorf("Unexpected published value: %s", got)
+	}
+}
@@ -0,0 +1,58 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProtectionConflictError is returned with StrictPolicy when the files kept
+// out of the deletion make the capacity target unreachable. It wraps
+// ErrInsufficientSpace.
+type ProtectionConflictError struct {
+	TargetSize    int64             // Block-aligned size the run had to free
+	ReachableSize int64             // Block-aligned size the run could free
+	ShortfallSize int64             // Block-aligned size missing to meet the constraints
+	Protections   []ProtectionCount // Kept files per reason, the largest first
+}
+
+func (e *ProtectionConflictError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "protections make the capacity target unreachable: %s short of %s", formatSize(e.ShortfallSize), formatSize(e.TargetSize))
+	for i, count := range e.Protections {
+		sep := "; "
+		if i == 0 {
+			sep = " (kept by "
+		}
+		fmt.Fprintf(&b, "%s%s: %d files, %s", sep, count.Reason, count.Files, formatSize(count.BlockSize))
+	}
+	if len(e.Protections) > 0 {
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+func (e *ProtectionConflictError) Unwrap() error { return ErrInsufficientSpace }
+
+// checkStrict returns a ProtectionConflictError with StrictPolicy when the
+// plan cannot meet its target and files were kept out of the deletion.
+// keptBlockSize is the size of the kept files, which must fit into MaxSize
+// when the target is computed from the scan.
+func checkStrict(plan *CleaningPlan, config *CleaningConfig, keptBlockSize int64) error {
+	if !config.StrictPolicy || len(plan.Protections) == 0 || plan.PartialScan {
+		return nil
+	}
+	shortfall := plan.target - plan.EstimatedSize
+	if plan.TargetSize == -1 && config.MaxSize != nil {
+		// Everything else is deleted, yet the kept files alone exceed MaxSize
+		shortfall = max(shortfall, keptBlockSize-*config.MaxSize)
+	}
+	if shortfall <= 0 {
+		return nil
+	}
+	return &ProtectionConflictError{
+		TargetSize:    plan.target,
+		ReachableSize: plan.EstimatedSize,
+		ShortfallSize: shortfall,
+		Protections:   plan.Protections,
+	}
+}
@@ -0,0 +1,48 @@
+package gobackupcleaner
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStrictPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for _, name := range []string{"a.manifest", "b.manifest", "a.tar", "b.tar"} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 4096, now.Add(-48*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := CleaningConfig{
+		MaxSize:      int64Ptr(4096),
+		Rules:        []Rule{{Match: RuleMatch{Glob: "*.manifest"}, Action: RuleProtect}},
+		StrictPolicy: true,
+		TimeWindow:   time.Hour,
+		DiskInfo:     &failingDiskInfoProvider{},
+	}
+
+	// The protected manifests alone exceed MaxSize
+	_, err := CleanBackup(tmpDir, config)
+	var conflict *ProtectionConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatalf("Expected a ProtectionConflictError, got %v", err)
+	}
+	if conflict.ShortfallSize != 4096 || len(conflict.Protections) != 1 || conflict.Protections[0].Files != 2 {
+		t.Errorf("Unexpected conflict %+v", conflict)
+	}
+	if remaining := countFiles(t, tmpDir); remaining != 4 {
+		t.Errorf("Expected no file to be deleted, got %d files", remaining)
+	}
+
+	// Without StrictPolicy the run frees what it can
+	config.StrictPolicy = false
+	report, err := CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 2 {
+		t.Errorf("Expected the 2 unprotected files to be deleted, got %d", report.DeletedFiles)
+	}
+}
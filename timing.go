@@ -0,0 +1,58 @@
+package gobackupcleaner
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// opTimings accumulates time spent in file system operations across workers
+type opTimings struct {
+	statNanos    atomic.Int64
+	statCalls    atomic.Int64
+	readDirNanos atomic.Int64
+	readDirCalls atomic.Int64
+	unlinkNanos  atomic.Int64
+	unlinkCalls  atomic.Int64
+}
+
+// addStat records the duration of a stat call
+func (t *opTimings) addStat(start time.Time) {
+	t.statNanos.Add(int64(time.Since(start)))
+	t.statCalls.Add(1)
+}
+
+// addReadDir records the duration of a readdir call
+func (t *opTimings) addReadDir(start time.Time) {
+	t.readDirNanos.Add(int64(time.Since(start)))
+	t.readDirCalls.Add(1)
+}
+
+// addUnlink records the duration of an unlink call
+func (t *opTimings) addUnlink(start time.Time) {
+	t.unlinkNanos.Add(int64(time.Since(start)))
+	t.unlinkCalls.Add(1)
+}
+
+// snapshot returns the accumulated timings
+func (t *opTimings) snapshot() OperationTimings {
+	return OperationTimings{
+		StatTime:     time.Duration(t.statNanos.Load()),
+		StatCalls:    int(t.statCalls.Load()),
+		ReadDirTime:  time.Duration(t.readDirNanos.Load()),
+		ReadDirCalls: int(t.readDirCalls.Load()),
+		UnlinkTime:   time.Duration(t.unlinkNanos.Load()),
+		UnlinkCalls:  int(t.unlinkCalls.Load()),
+	}
+}
+
+// add returns the sum of two timing breakdowns
+func (o OperationTimings) add(other OperationTimings) OperationTimings {
+	return OperationTimings{
+		StatTime:     o.StatTime + other.StatTime,
+		StatCalls:    o.StatCalls + other.StatCalls,
+		ReadDirTime:  o.ReadDirTime + other.ReadDirTime,
+		ReadDirCalls: o.ReadDirCalls + other.ReadDirCalls,
+		UnlinkTime:   o.UnlinkTime + other.UnlinkTime,
+		UnlinkCalls:  o.UnlinkCalls + other.UnlinkCalls,
+	}
+}
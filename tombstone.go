@@ -0,0 +1,117 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tombstoneMarker is inserted between the original name and the deletion time
+const tombstoneMarker = ".deleted-"
+
+// tombstoneTimeFormat is the UTC timestamp format used in tombstone names
+const tombstoneTimeFormat = "20060102T150405Z"
+
+// PurgeResult contains the result of purging tombstones
+type PurgeResult struct {
+	PurgedFiles int   // Number of purged tombstones
+	PurgedSize  int64 // Total size of purged tombstones in bytes
+}
+
+// tombstonePath returns the name a soft-deleted file is renamed to
+func tombstonePath(path string, deletedAt time.Time) string {
+	return path + tombstoneMarker + deletedAt.UTC().Format(tombstoneTimeFormat)
+}
+
+// parseTombstone reports whether name is a tombstone and returns its deletion time
+func parseTombstone(name string) (time.Time, bool) {
+	i := strings.LastIndex(name, tombstoneMarker)
+	if i <= 0 {
+		return time.Time{}, false
+	}
+	deletedAt, err := time.Parse(tombstoneTimeFormat, name[i+len(tombstoneMarker):])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return deletedAt, true
+}
+
+// isTombstone reports whether the path is a soft-deleted file
+func isTombstone(path string) bool {
+	_, ok := parseTombstone(filepath.Base(path))
+	return ok
+}
+
+// PurgeTombstones permanently removes files that were soft-deleted (see DeleteModeTombstone)
+// more than olderThan ago. Use 0 to purge all tombstones.
+func PurgeTombstones(dirPath string, olderThan time.Duration) (PurgeResult, error) {
+	return PurgeTombstonesContext(context.Background(), dirPath, olderThan)
+}
+
+// PurgeTombstonesContext is like PurgeTombstones, but stops once ctx is done
+// and returns the tombstones purged so far with the context error
+func PurgeTombstonesContext(ctx context.Context, dirPath string, olderThan time.Duration) (PurgeResult, error) {
+	var result PurgeResult
+	err := purgeTombstones(ctx, OSFileSystem{}, dirPath, time.Now().Add(-olderThan), &result)
+	return result, err
+}
+
+// purgeTombstones removes the tombstones below dir soft-deleted before
+// cutoff through fs, adding them to result
+func purgeTombstones(ctx context.Context, fs FileSystem, dir string, cutoff time.Time, result *PurgeResult) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, entry.Name())
+		deletedAt, ok := parseTombstone(entry.Name())
+		if !ok || deletedAt.After(cutoff) {
+			if entry.IsDir() {
+				if err := purgeTombstones(ctx, fs, path, cutoff, result); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if entry.IsDir() {
+			// Soft-deleted opaque directory
+			summary, err := summarizeDir(path, apparentSize, fs)
+			if err != nil {
+				return err
+			}
+			if err := fs.RemoveAll(path); err != nil {
+				return err
+			}
+			result.PurgedFiles += summary.files
+			result.PurgedSize += summary.size
+			continue
+		}
+
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if err := fs.Remove(path); err != nil {
+			return err
+		}
+		result.PurgedFiles++
+		result.PurgedSize += info.Size()
+	}
+	return nil
+}
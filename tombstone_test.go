@@ -0,0 +1,217 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseTombstone(t *testing.T) {
+	deletedAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	path := tombstonePath("/backup/db.dump", deletedAt)
+	if path != "/backup/db.dump.deleted-20240501T123000Z" {
+		t.Errorf("Unexpected tombstone path: %s", path)
+	}
+
+	parsed, ok := parseTombstone(filepath.Base(path))
+	if !ok {
+		t.Fatal("Expected tombstone to be recognized")
+	}
+	if !parsed.Equal(deletedAt) {
+		t.Errorf("Expected deletion time %v, got %v", deletedAt, parsed)
+	}
+
+	for _, name := range []string{"db.dump", "db.deleted-yesterday", ".deleted-20240501T123000Z"} {
+		if _, ok := parseTombstone(name); ok {
+			t.Errorf("Expected %q not to be a tombstone", name)
+		}
+	}
+}
+
+// TestSoftDeleteAndPurge tests that soft-deleted files are renamed, skipped and purged
+func TestSoftDeleteAndPurge(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-tombstone-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.txt"), 1024*1024, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "recent.txt"), 1024*1024, now.Add(-1*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	maxSize := int64(1024 * 1024)
+	config := CleaningConfig{
+		MaxSize:    &maxSize,
+		TimeWindow: time.Hour,
+		DeleteMode: DeleteModeTombstone,
+		DiskInfo:   &failingDiskInfoProvider{},
+	}
+
+	report, err := CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 {
+		t.Fatalf("Expected 1 soft-deleted file, got %d", report.DeletedFiles)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tombstones int
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "old.txt"+tombstoneMarker) {
+			tombstones++
+		}
+	}
+	if tombstones != 1 {
+		t.Errorf("Expected old.txt to be renamed to a tombstone, entries: %v", entries)
+	}
+
+	// Tombstones are not scanned again
+	report, err = CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ScannedFiles != 1 || report.DeletedFiles != 0 {
+		t.Errorf("Expected only recent.txt to be scanned, scanned %d and deleted %d", report.ScannedFiles, report.DeletedFiles)
+	}
+
+	// Recent tombstones are kept by an age-limited purge
+	result, err := PurgeTombstones(tmpDir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.PurgedFiles != 0 {
+		t.Errorf("Expected no tombstones older than an hour, purged %d", result.PurgedFiles)
+	}
+
+	result, err = PurgeTombstones(tmpDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.PurgedFiles != 1 || result.PurgedSize != 1024*1024 {
+		t.Errorf("Expected 1 purged tombstone of 1MB, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "recent.txt")); err != nil {
+		t.Errorf("Expected recent.txt to remain: %v", err)
+	}
+}
+
+// TestPurgeTombstonesContextCanceled tests that a done context stops the purge
+func TestPurgeTombstonesContextCanceled(t *testing.T) {
+	tmpDir := t.TempDir()
+	name := tombstonePath("old.txt", time.Now().Add(-time.Hour))
+	if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := PurgeTombstonesContext(ctx, tmpDir, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if result.PurgedFiles != 0 {
+		t.Errorf("Expected nothing to be purged, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+		t.Errorf("Expected the tombstone to be kept: %v", err)
+	}
+}
+
+// recordingFS reads the real files but only records the changes, so a run
+// leaves the disk untouched
+type recordingFS struct {
+	OSFileSystem
+	mu      sync.Mutex
+	changes []string
+}
+
+func (f *recordingFS) record(change string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.changes = append(f.changes, change)
+	return nil
+}
+
+func (f *recordingFS) Remove(path string) error { return f.record("remove " + filepath.Base(path)) }
+
+func (f *recordingFS) RemoveAll(path string) error {
+	return f.record("removeall " + filepath.Base(path))
+}
+
+func (f *recordingFS) Rename(oldPath, newPath string) error {
+	return f.record("rename " + filepath.Base(oldPath) + " " + filepath.Base(newPath))
+}
+
+func (f *recordingFS) Chtimes(path string, atime, mtime time.Time) error {
+	return f.record("chtimes " + filepath.Base(path))
+}
+
+// TestTombstoneFileSystem tests that soft deletion and purging go through
+// the configured FileSystem
+func TestTombstoneFileSystem(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.txt"), 1024, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "recent.txt"), 1024, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := &recordingFS{}
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:              int64Ptr(1024),
+		TimeWindow:           time.Hour,
+		DeleteMode:           DeleteModeTombstone,
+		PreserveParentMTimes: true,
+		FS:                   fs,
+		DiskInfo:             &StaticDiskInfoProvider{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 {
+		t.Fatalf("Expected 1 soft-deleted file, got %d", report.DeletedFiles)
+	}
+	if len(fs.changes) != 2 || !strings.HasPrefix(fs.changes[0], "rename old.txt old.txt"+tombstoneMarker) || fs.changes[1] != "chtimes "+filepath.Base(tmpDir) {
+		t.Errorf("Expected a rename to a tombstone and a parent time restore, got %v", fs.changes)
+	}
+	if countFiles(t, tmpDir) != 2 {
+		t.Error("Expected the disk to be left untouched")
+	}
+
+	// Purging goes through the file system too
+	tombstone := tombstonePath("gone.txt", now.Add(-48*time.Hour))
+	if err := os.WriteFile(filepath.Join(tmpDir, tombstone), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs.changes = nil
+	var result PurgeResult
+	if err := purgeTombstones(context.Background(), fs, tmpDir, now.Add(-24*time.Hour), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.PurgedFiles != 1 || len(fs.changes) != 1 || fs.changes[0] != "remove "+tombstone {
+		t.Errorf("Expected the tombstone to be purged through the file system, got %+v and %v", result, fs.changes)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, tombstone)); err != nil {
+		t.Errorf("Expected the tombstone to remain on disk: %v", err)
+	}
+}
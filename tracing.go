@@ -0,0 +1,59 @@
+package gobackupcleaner
+
+import "context"
+
+// Tracer creates spans for the phases of a cleaning run.
+// The package has no tracing dependency; implement this interface with a thin
+// adapter around OpenTelemetry (or any other tracing system) to correlate
+// slow cleanups with storage latency.
+type Tracer interface {
+	// StartSpan starts a span as a child of any span in ctx and returns
+	// a context carrying the new span.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span represents a single traced operation
+type Span interface {
+	// SetAttribute records an attribute on the span.
+	// Values are int, int64, string or bool.
+	SetAttribute(key string, value any)
+	// End finishes the span, recording err if it is not nil.
+	End(err error)
+}
+
+// Span names used by the cleaner
+const (
+	SpanClean     = "backup_cleaner.clean"
+	SpanPlan      = "backup_cleaner.plan"
+	SpanScan      = "backup_cleaner.scan"
+	SpanThreshold = "backup_cleaner.threshold"
+	SpanDelete    = "backup_cleaner.delete"
+)
+
+// Span attribute keys used by the cleaner
+const (
+	AttrRunID          = "backup_cleaner.run_id"
+	AttrTargetDir      = "backup_cleaner.target_dir"
+	AttrTargetSize     = "backup_cleaner.target_size"
+	AttrScannedFiles   = "backup_cleaner.scanned_files"
+	AttrScannedBytes   = "backup_cleaner.scanned_bytes"
+	AttrEstimatedFiles = "backup_cleaner.estimated_files"
+	AttrEstimatedBytes = "backup_cleaner.estimated_bytes"
+	AttrDeletedFiles   = "backup_cleaner.deleted_files"
+	AttrDeletedBytes   = "backup_cleaner.deleted_bytes"
+	AttrDeletedDirs    = "backup_cleaner.deleted_dirs"
+)
+
+// noopSpan is used when no tracer is configured
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value any) {}
+func (noopSpan) End(err error)                      {}
+
+// startSpan starts a span with the configured tracer, or a no-op span if none is set
+func startSpan(ctx context.Context, config *CleaningConfig, name string) (context.Context, Span) {
+	if config.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return config.Tracer.StartSpan(ctx, name)
+}
@@ -0,0 +1,87 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTracer records the spans started and ended during a run
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	name  string
+	attrs map[string]any
+	ended bool
+}
+
+func (r *recordingTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	span := &recordingSpan{name: name, attrs: make(map[string]any)}
+	r.spans = append(r.spans, span)
+	return ctx, span
+}
+
+func (s *recordingSpan) SetAttribute(key string, value any) {
+	s.attrs[key] = value
+}
+
+func (s *recordingSpan) End(err error) {
+	s.ended = true
+}
+
+// TestTracerSpans tests that each phase of a cleaning run is traced
+func TestTracerSpans(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "backup-cleaner-trace-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			t.Logf("cleanup failed: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.txt"), 1024, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "recent.txt"), 1024, now); err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := &recordingTracer{}
+	maxUsage := float64(70)
+	_, err = CleanBackup(tmpDir, CleaningConfig{
+		MaxUsagePercent: &maxUsage,
+		DiskInfo:        &mockDiskInfoProvider{},
+		Tracer:          tracer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{SpanClean, SpanScan, SpanThreshold, SpanDelete}
+	if len(tracer.spans) != len(expected) {
+		t.Fatalf("Expected %d spans, got %d", len(expected), len(tracer.spans))
+	}
+	for i, name := range expected {
+		span := tracer.spans[i]
+		if span.name != name {
+			t.Errorf("Expected span %d to be %s, got %s", i, name, span.name)
+		}
+		if !span.ended {
+			t.Errorf("Span %s was not ended", span.name)
+		}
+	}
+	if tracer.spans[1].attrs[AttrScannedFiles] != 2 {
+		t.Errorf("Expected scan span to record 2 files, got %v", tracer.spans[1].attrs[AttrScannedFiles])
+	}
+}
@@ -0,0 +1,136 @@
+package gobackupcleaner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sizeUnits maps size suffixes to their multipliers. Units are binary
+// (1KB = 1024 bytes) as disk space is usually reported that way.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   1 << 10,
+	"KB":  1 << 10,
+	"KIB": 1 << 10,
+	"M":   1 << 20,
+	"MB":  1 << 20,
+	"MIB": 1 << 20,
+	"G":   1 << 30,
+	"GB":  1 << 30,
+	"GIB": 1 << 30,
+	"T":   1 << 40,
+	"TB":  1 << 40,
+	"TIB": 1 << 40,
+	"P":   1 << 50,
+	"PB":  1 << 50,
+	"PIB": 1 << 50,
+}
+
+// ParseSize parses a human readable size such as "500MB", "1.5G" or "1024".
+// Units are case-insensitive and binary (1KB = 1024 bytes).
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q", s)
+	}
+	// Integers are exact, as a float64 only holds 53 bits
+	if n, err := strconv.ParseInt(s[:i], 10, 64); err == nil {
+		if n > math.MaxInt64/unit {
+			return 0, fmt.Errorf("size %q out of range", s)
+		}
+		return n * unit, nil
+	}
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	size := value * float64(unit)
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q out of range", s)
+	}
+	return int64(size), nil
+}
+
+// ParseAge parses a duration such as "30d", "2w", "1d12h" or "90m". In
+// addition to the units of time.ParseDuration it accepts "d" (24 hours)
+// and "w" (7 days).
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && (rest[i] >= '0' && rest[i] <= '9' || rest[i] == '.') {
+			i++
+		}
+		j := i
+		for j < len(rest) && !(rest[j] >= '0' && rest[j] <= '9' || rest[j] == '.') {
+			j++
+		}
+		if i == 0 || j == i {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		number, unit := rest[:i], rest[i:j]
+		rest = rest[j:]
+
+		var d time.Duration
+		switch unit {
+		case "d", "w":
+			value, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			day := 24 * time.Hour
+			if unit == "w" {
+				day *= 7
+			}
+			if value*float64(day) >= math.MaxInt64 {
+				return 0, fmt.Errorf("age %q out of range", s)
+			}
+			d = time.Duration(value * float64(day))
+		default:
+			var err error
+			if d, err = time.ParseDuration(number + unit); err != nil {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+		}
+		if d > math.MaxInt64-total {
+			return 0, fmt.Errorf("age %q out of range", s)
+		}
+		total += d
+	}
+	return total, nil
+}
+
+// formatSize formats a size in the binary units accepted by ParseSize,
+// e.g. "1.5GB"
+func formatSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	v := float64(n)
+	i := 0
+	for (v >= 1024 || v <= -1024) && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.1f%s", v, units[i])
+}
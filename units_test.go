@@ -0,0 +1,116 @@
+package gobackupcleaner
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		wantErr  bool
+	}{
+		{"1024", 1024, false},
+		{"10B", 10, false},
+		{"500MB", 500 * 1024 * 1024, false},
+		{"1.5G", 1536 * 1024 * 1024, false},
+		{"2 TiB", 2 << 40, false},
+		{"1gb", 1 << 30, false},
+		{"", 0, true},
+		{"GB", 0, true},
+		{"10XB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"1.5h", 90 * time.Minute, false},
+		{"", 0, true},
+		{"d", 0, true},
+		{"30", 0, true},
+		{"10y", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAge(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAge(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ParseAge(%q) = %v, want %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1536, "1.5KB"},
+		{3 << 30, "3.0GB"},
+		{-2048, "-2.0KB"},
+	}
+	for _, tt := range tests {
+		if got := formatSize(tt.input); got != tt.expected {
+			t.Errorf("formatSize(%d) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func FuzzParseSize(f *testing.F) {
+	for _, seed := range []string{"1024", "500MB", "1.5G", "2 TiB", "8191P", "99999999999999999999", "1e3", "."} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		size, err := ParseSize(s)
+		if err != nil {
+			return
+		}
+		if size < 0 {
+			t.Fatalf("ParseSize(%q) = %d, want a non-negative size", s, size)
+		}
+		// Plain integers are taken as is
+		if n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil && n != size {
+			t.Fatalf("ParseSize(%q) = %d, want %d", s, size, n)
+		}
+	})
+}
+
+func FuzzParseAge(f *testing.F) {
+	for _, seed := range []string{"30d", "2w", "1d12h", "90m", "1.5h", "9999999999w", "1h1h", "d"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		age, err := ParseAge(s)
+		if err != nil {
+			return
+		}
+		if age < 0 {
+			t.Fatalf("ParseAge(%q) = %v, want a non-negative age", s, age)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/ideamans/go-backup-cleaner"
+)
+
+// Cleaner runs cleaning operations with a fixed configuration. It is safe for
+// concurrent use.
+type Cleaner struct {
+	engine *v1.Cleaner
+	config v1.CleaningConfig
+}
+
+// New creates a Cleaner from options, applied in order. The configuration is
+// validated once, with the rules of version 1.
+func New(opts ...Option) (*Cleaner, error) {
+	config := defaultConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+	engineConfig := config.engineConfig()
+	engine, err := v1.NewCleaner(engineConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Cleaner{engine: engine, config: engineConfig}, nil
+}
+
+// Clean cleans backup files in dirPath. If ctx is done the run stops
+// gracefully and the partial report is returned with the context error.
+func (c *Cleaner) Clean(ctx context.Context, dirPath string) (CleaningReport, error) {
+	return c.engine.Clean(ctx, dirPath)
+}
+
+// CleanFromIndex is like Clean, but takes the files from a precomputed index
+// instead of scanning dirPath
+func (c *Cleaner) CleanFromIndex(ctx context.Context, dirPath string, index []FileRecord) (CleaningReport, error) {
+	return c.engine.CleanFromIndex(ctx, dirPath, index)
+}
+
+// Plan computes which files in dirPath would be deleted, without deleting
+// anything. Execute deletes them after a review.
+func (c *Cleaner) Plan(ctx context.Context, dirPath string) (*CleaningPlan, error) {
+	return c.engine.Plan(ctx, dirPath)
+}
+
+// PlanFromIndex is like Plan, but takes the files from a precomputed index
+func (c *Cleaner) PlanFromIndex(ctx context.Context, dirPath string, index []FileRecord) (*CleaningPlan, error) {
+	return c.engine.PlanFromIndex(ctx, dirPath, index)
+}
+
+// Execute deletes the candidates of a plan computed with the configuration
+// of the Cleaner, skipping those that changed since
+func (c *Cleaner) Execute(ctx context.Context, plan *CleaningPlan) (CleaningReport, error) {
+	return c.engine.Execute(ctx, plan)
+}
+
+// Scan lists the files of dirPath with their deletion category, without
+// deleting anything
+func (c *Cleaner) Scan(ctx context.Context, dirPath string) (*ScanResult, error) {
+	return c.engine.Scan(ctx, dirPath)
+}
+
+// NeedsCleaning reports whether a run would delete files to free space in
+// dirPath, along with the current disk usage
+func (c *Cleaner) NeedsCleaning(ctx context.Context, dirPath string) (bool, DiskUsage, error) {
+	if err := ctx.Err(); err != nil {
+		return false, DiskUsage{}, err
+	}
+	return c.engine.NeedsCleaning(dirPath)
+}
+
+// Estimate samples dirPath to recommend a threshold within seconds, without
+// scanning every file or deleting anything
+func (c *Cleaner) Estimate(ctx context.Context, dirPath string, opts EstimateOptions) (*CleaningEstimate, error) {
+	return v1.EstimateContext(ctx, dirPath, c.config, opts)
+}
+
+// AnalyzeRetention scans dirPath and returns its retention inventory without
+// deleting anything
+func (c *Cleaner) AnalyzeRetention(ctx context.Context, dirPath string) (*RetentionInventory, error) {
+	result, err := c.engine.Scan(ctx, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	inventory := result.Retention()
+	return &inventory, nil
+}
+
+// Clean creates a Cleaner from options and cleans dirPath once
+func Clean(ctx context.Context, dirPath string, opts ...Option) (CleaningReport, error) {
+	cleaner, err := New(opts...)
+	if err != nil {
+		return CleaningReport{}, err
+	}
+	return cleaner.Clean(ctx, dirPath)
+}
+
+// PurgeTombstones permanently removes files soft-deleted with
+// DeleteModeTombstone more than olderThan ago. Once ctx is done it stops and
+// returns the tombstones purged so far with the context error.
+func PurgeTombstones(ctx context.Context, dirPath string, olderThan time.Duration) (PurgeResult, error) {
+	return v1.PurgeTombstonesContext(ctx, dirPath, olderThan)
+}
+
+// PlanDiff compares two plans, either of which may be nil
+func PlanDiff(oldPlan, newPlan *CleaningPlan) PlanDifference {
+	return v1.PlanDiff(oldPlan, newPlan)
+}
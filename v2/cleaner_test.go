@@ -0,0 +1,150 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/ideamans/go-backup-cleaner"
+)
+
+// createTestFiles creates files of 1KB, one per hour of age
+func createTestFiles(t *testing.T, dir string, count int) {
+	t.Helper()
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < count; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("backup%d.tar", i))
+		if err := os.WriteFile(path, make([]byte, 1024), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-time.Duration(i+1) * time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewRequiresCapacity(t *testing.T) {
+	if _, err := New(); !errors.Is(err, ErrNoCapacitySpecified) {
+		t.Errorf("Expected ErrNoCapacitySpecified, got %v", err)
+	}
+	if _, err := New(WithMaxUsagePercent(150)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+func TestOptionsMatchV1(t *testing.T) {
+	v2Config := defaultConfig()
+	for _, opt := range []Option{
+		WithMinFreeSpace(1 << 30),
+		WithTargetLevels(Some[int64](2<<30), None[float64]()),
+		WithMaxAge(24 * time.Hour),
+		WithRemoveEmptyDirs(false),
+	} {
+		opt(&v2Config)
+	}
+	v1Config := v1.CleaningConfig{
+		MinFreeSpace:              &[]int64{1 << 30}[0],
+		TargetFreeSpaceAfterClean: &[]int64{2 << 30}[0],
+		MaxAge:                    24 * time.Hour,
+	}
+	engineConfig := v2Config.engineConfig()
+	if engineConfig.Fingerprint() != v1Config.Fingerprint() {
+		t.Error("Expected the options to produce the version 1 configuration")
+	}
+
+	// FromV1 converts it back, later options override it
+	converted := defaultConfig()
+	FromV1(v1Config)(&converted)
+	WithMaxSize(1 << 40)(&converted)
+	v1Config.MaxSize = &[]int64{1 << 40}[0]
+	engineConfig = converted.engineConfig()
+	if engineConfig.Fingerprint() != v1Config.Fingerprint() {
+		t.Error("Expected FromV1 to take over the version 1 configuration")
+	}
+	// Capacity limits set on the engine configuration are not dropped
+	withEngine := defaultConfig()
+	WithMaxUsagePercent(90)(&withEngine)
+	WithEngineConfig(func(config *v1.CleaningConfig) {
+		if config.MaxUsagePercent == nil || *config.MaxUsagePercent != 90 {
+			t.Errorf("Expected the options set so far, got %v", config.MaxUsagePercent)
+		}
+		config.MinFreeSpace = &[]int64{1 << 30}[0]
+		config.FairShare = true
+	})(&withEngine)
+	if withEngine.MinFreeSpace != Some[int64](1<<30) || withEngine.MaxUsagePercent != Some(90.0) || !withEngine.Engine.FairShare {
+		t.Errorf("Expected the engine settings to be carried over, got %+v", withEngine)
+	}
+	engineConfig = withEngine.engineConfig()
+	if engineConfig.MinFreeSpace == nil || *engineConfig.MinFreeSpace != 1<<30 {
+		t.Error("Expected MinFreeSpace to reach the engine")
+	}
+
+	if !defaultConfig().Engine.RemoveEmptyDirs {
+		t.Error("Expected RemoveEmptyDirs to default to true")
+	}
+}
+
+func TestCleanerPlanExecute(t *testing.T) {
+	dir := t.TempDir()
+	createTestFiles(t, dir, 4)
+
+	cleaner, err := New(
+		WithMaxSize(2*4096),
+		WithTimeWindow(time.Minute),
+		WithDiskInfo(&v1.StaticDiskInfoProvider{BlockSize: 4096}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	plan, err := cleaner.Plan(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Candidates) != 2 {
+		t.Fatalf("Expected the 2 oldest files as candidates, got %+v", plan.Candidates)
+	}
+	report, err := cleaner.Execute(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 2 {
+		t.Errorf("Expected 2 deleted files, got %d", report.DeletedFiles)
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	dir := t.TempDir()
+	createTestFiles(t, dir, 2)
+	cleaner, err := New(WithMaxSize(0), WithDiskInfo(&v1.StaticDiskInfoProvider{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := cleaner.NeedsCleaning(ctx, dir); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected NeedsCleaning to fail with context.Canceled, got %v", err)
+	}
+	if _, err := cleaner.Estimate(ctx, dir, EstimateOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Estimate to fail with context.Canceled, got %v", err)
+	}
+	if _, err := PurgeTombstones(ctx, dir, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected PurgeTombstones to fail with context.Canceled, got %v", err)
+	}
+	if _, err := Clean(ctx, dir, WithMaxSize(0), WithDiskInfo(&v1.StaticDiskInfoProvider{})); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Clean to fail with context.Canceled, got %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected nothing to be deleted, %d files left", len(entries))
+	}
+}
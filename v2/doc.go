@@ -0,0 +1,27 @@
+// Package gobackupcleaner is version 2 of the backup cleaner API. It runs on
+// the same engine as version 1, github.com/ideamans/go-backup-cleaner, so
+// runs behave the same; only the way they are configured and started
+// changes:
+//
+//   - every blocking entry point takes a context.Context first
+//   - a Cleaner is configured with functional options passed to New instead
+//     of a CleaningConfig literal
+//   - the capacity limits are Optional values instead of pointers, so
+//     WithMinFreeSpace(10 << 30) replaces int64Ptr helpers
+//   - RemoveEmptyDirs defaults to true, as documented but never applied in
+//     version 1
+//
+// The result types, such as CleaningReport and CleaningPlan, are the version 1
+// types, so code inspecting them needs no changes. Settings without an
+// option of their own are set with WithEngineConfig, and FromV1 converts a
+// whole version 1 configuration:
+//
+//	cleaner, err := gobackupcleaner.New(
+//		gobackupcleaner.WithMinFreeSpace(10<<30),
+//		gobackupcleaner.WithMaxAge(30*24*time.Hour),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	report, err := cleaner.Clean(ctx, "/backup")
+package gobackupcleaner
@@ -0,0 +1,8 @@
+module github.com/ideamans/go-backup-cleaner/v2
+
+go 1.22.2
+
+require github.com/ideamans/go-backup-cleaner v0.0.0
+
+// The v2 API runs on the v1 engine of the same repository
+replace github.com/ideamans/go-backup-cleaner => ../
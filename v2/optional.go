@@ -0,0 +1,80 @@
+package gobackupcleaner
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Optional is a value that may be unset, replacing the pointer fields of
+// version 1. The zero value is unset. In JSON an unset value is null.
+type Optional[T any] struct {
+	value T
+	set   bool
+}
+
+// Some returns a set Optional holding v
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{value: v, set: true}
+}
+
+// None returns an unset Optional
+func None[T any]() Optional[T] {
+	return Optional[T]{}
+}
+
+// Get returns the value and whether it is set
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.set
+}
+
+// IsSet reports whether the value is set
+func (o Optional[T]) IsSet() bool {
+	return o.set
+}
+
+// OrElse returns the value if it is set, def otherwise
+func (o Optional[T]) OrElse(def T) T {
+	if o.set {
+		return o.value
+	}
+	return def
+}
+
+// ptr returns the value as the pointer of a version 1 field, nil if unset
+func (o Optional[T]) ptr() *T {
+	if !o.set {
+		return nil
+	}
+	v := o.value
+	return &v
+}
+
+// optionalOf converts a pointer field of version 1
+func optionalOf[T any](p *T) Optional[T] {
+	if p == nil {
+		return None[T]()
+	}
+	return Some(*p)
+}
+
+// MarshalJSON implements json.Marshaler
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		*o = None[T]()
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*o = Some(v)
+	return nil
+}
@@ -0,0 +1,45 @@
+package gobackupcleaner
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOptional(t *testing.T) {
+	var unset Optional[int64]
+	if unset.IsSet() || unset.OrElse(7) != 7 || unset.ptr() != nil {
+		t.Errorf("Expected the zero value to be unset, got %+v", unset)
+	}
+	set := Some[int64](0)
+	if v, ok := set.Get(); !ok || v != 0 || *set.ptr() != 0 {
+		t.Errorf("Expected a set zero, got %+v", set)
+	}
+	if p := int64(5); optionalOf(&p) != Some[int64](5) || optionalOf[int64](nil).IsSet() {
+		t.Error("Expected pointers to convert to Optional values")
+	}
+}
+
+func TestOptionalJSON(t *testing.T) {
+	type limits struct {
+		MinFreeSpace    Optional[int64]
+		MaxUsagePercent Optional[float64]
+	}
+	data, err := json.Marshal(limits{MinFreeSpace: Some[int64](1024)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"MinFreeSpace":1024,"MaxUsagePercent":null}`; string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	var out limits
+	if err := json.Unmarshal([]byte(`{"MinFreeSpace":null,"MaxUsagePercent":80.5}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.MinFreeSpace.IsSet() || out.MaxUsagePercent != Some(80.5) {
+		t.Errorf("Unexpected round trip %+v", out)
+	}
+	if err := json.Unmarshal([]byte(`{"MinFreeSpace":"10GB"}`), &out); err == nil {
+		t.Error("Expected a string to fail to unmarshal into Optional[int64]")
+	}
+}
@@ -0,0 +1,229 @@
+package gobackupcleaner
+
+import (
+	"time"
+
+	v1 "github.com/ideamans/go-backup-cleaner"
+)
+
+// Config is the configuration a Cleaner is built from with options. The
+// capacity limits have the semantics of the version 1 fields of the same
+// name; at least one of MinFreeSpace, MaxUsagePercent and MaxSize is
+// required.
+type Config struct {
+	MinFreeSpace    Optional[int64]   // Minimum free space in bytes (recommended)
+	MaxUsagePercent Optional[float64] // Maximum disk usage percentage (0-100)
+	MaxSize         Optional[int64]   // Maximum size in bytes (use when disk info is unavailable)
+
+	StartFreeSpace    Optional[int64]   // At most MinFreeSpace
+	StartUsagePercent Optional[float64] // At least MaxUsagePercent
+
+	TargetFreeSpaceAfterClean    Optional[int64]   // At least MinFreeSpace
+	TargetUsagePercentAfterClean Optional[float64] // At most MaxUsagePercent
+
+	BlockSizeOverride Optional[int64] // Block size used instead of the file system's
+
+	// Engine holds the other settings, see the version 1 CleaningConfig. Its
+	// pointer fields are replaced by the Optional fields above.
+	Engine v1.CleaningConfig
+}
+
+// Option configures a Cleaner (see New)
+type Option func(*Config)
+
+// defaultConfig returns the configuration options are applied to
+func defaultConfig() Config {
+	return Config{Engine: v1.CleaningConfig{RemoveEmptyDirs: true}}
+}
+
+// engineConfig returns the version 1 configuration of c
+func (c *Config) engineConfig() v1.CleaningConfig {
+	config := c.Engine
+	config.MinFreeSpace = c.MinFreeSpace.ptr()
+	config.MaxUsagePercent = c.MaxUsagePercent.ptr()
+	config.MaxSize = c.MaxSize.ptr()
+	config.StartFreeSpace = c.StartFreeSpace.ptr()
+	config.StartUsagePercent = c.StartUsagePercent.ptr()
+	config.TargetFreeSpaceAfterClean = c.TargetFreeSpaceAfterClean.ptr()
+	config.TargetUsagePercentAfterClean = c.TargetUsagePercentAfterClean.ptr()
+	config.BlockSizeOverride = c.BlockSizeOverride.ptr()
+	return config
+}
+
+// FromV1 takes over a whole version 1 configuration, including its
+// RemoveEmptyDirs value. Options after it override its settings.
+func FromV1(config v1.CleaningConfig) Option {
+	return func(c *Config) {
+		c.MinFreeSpace = optionalOf(config.MinFreeSpace)
+		c.MaxUsagePercent = optionalOf(config.MaxUsagePercent)
+		c.MaxSize = optionalOf(config.MaxSize)
+		c.StartFreeSpace = optionalOf(config.StartFreeSpace)
+		c.StartUsagePercent = optionalOf(config.StartUsagePercent)
+		c.TargetFreeSpaceAfterClean = optionalOf(config.TargetFreeSpaceAfterClean)
+		c.TargetUsagePercentAfterClean = optionalOf(config.TargetUsagePercentAfterClean)
+		c.BlockSizeOverride = optionalOf(config.BlockSizeOverride)
+		c.Engine = config
+	}
+}
+
+// WithEngineConfig sets settings without an option of their own on the
+// version 1 configuration, e.g. FairShare or ManifestPath. configure sees
+// the capacity limits set so far in the pointer fields, and changes to them
+// are carried over.
+func WithEngineConfig(configure func(*v1.CleaningConfig)) Option {
+	return func(c *Config) {
+		config := c.engineConfig()
+		configure(&config)
+		FromV1(config)(c)
+	}
+}
+
+// WithMinFreeSpace keeps at least bytes free
+func WithMinFreeSpace(bytes int64) Option {
+	return func(c *Config) { c.MinFreeSpace = Some(bytes) }
+}
+
+// WithMaxUsagePercent keeps the disk usage at most percent (0-100)
+func WithMaxUsagePercent(percent float64) Option {
+	return func(c *Config) { c.MaxUsagePercent = Some(percent) }
+}
+
+// WithMaxSize keeps the files below the target directory at most bytes
+func WithMaxSize(bytes int64) Option {
+	return func(c *Config) { c.MaxSize = Some(bytes) }
+}
+
+// WithStartLevels delays cleaning until free space falls below freeBytes or
+// usage exceeds percent; an unset Optional leaves that level off
+func WithStartLevels(freeBytes Optional[int64], percent Optional[float64]) Option {
+	return func(c *Config) {
+		c.StartFreeSpace = freeBytes
+		c.StartUsagePercent = percent
+	}
+}
+
+// WithTargetLevels frees space down to these levels once a constraint is
+// breached; an unset Optional leaves that level off
+func WithTargetLevels(freeBytes Optional[int64], percent Optional[float64]) Option {
+	return func(c *Config) {
+		c.TargetFreeSpaceAfterClean = freeBytes
+		c.TargetUsagePercentAfterClean = percent
+	}
+}
+
+// WithBlockSize accounts file sizes in blocks of bytes instead of the block
+// size of the file system
+func WithBlockSize(bytes int64) Option {
+	return func(c *Config) { c.BlockSizeOverride = Some(bytes) }
+}
+
+// WithMaxAge deletes files older than age on every run
+func WithMaxAge(age time.Duration) Option {
+	return func(c *Config) { c.Engine.MaxAge = age }
+}
+
+// WithMinKeep never deletes the newest files of the tree and of each
+// directory; 0 disables either
+func WithMinKeep(files, perDir int) Option {
+	return func(c *Config) {
+		c.Engine.MinKeepFiles = files
+		c.Engine.MinKeepPerDir = perDir
+	}
+}
+
+// WithTimeWindow aggregates files modified within window (default: 5 minutes)
+func WithTimeWindow(window time.Duration) Option {
+	return func(c *Config) { c.Engine.TimeWindow = window }
+}
+
+// WithRemoveEmptyDirs sets whether directories emptied by a run are removed
+// (default: true)
+func WithRemoveEmptyDirs(remove bool) Option {
+	return func(c *Config) { c.Engine.RemoveEmptyDirs = remove }
+}
+
+// WithPatterns restricts the files considered to include, if not empty, and
+// skips those matching exclude
+func WithPatterns(include, exclude []string) Option {
+	return func(c *Config) {
+		c.Engine.IncludePatterns = include
+		c.Engine.ExcludePatterns = exclude
+	}
+}
+
+// WithRules appends rules, evaluated in order for every file
+func WithRules(rules ...Rule) Option {
+	return func(c *Config) { c.Engine.Rules = append(c.Engine.Rules, rules...) }
+}
+
+// WithOverrides appends retention overrides of subdirectories
+func WithOverrides(overrides ...RetentionOverride) Option {
+	return func(c *Config) { c.Engine.Overrides = append(c.Engine.Overrides, overrides...) }
+}
+
+// WithDeleteMode selects how files are deleted (default: DeleteModeRemove)
+func WithDeleteMode(mode DeleteMode) Option {
+	return func(c *Config) { c.Engine.DeleteMode = mode }
+}
+
+// WithSizeMode selects how the space used by files is accounted (default:
+// SizeModeBlock)
+func WithSizeMode(mode SizeMode) Option {
+	return func(c *Config) { c.Engine.SizeMode = mode }
+}
+
+// WithUsageBase selects the size percent constraints are computed on
+// (default: UsageBaseTotal)
+func WithUsageBase(base UsageBase) Option {
+	return func(c *Config) { c.Engine.UsageBase = base }
+}
+
+// WithFreeSpaceScope selects the free space the free space constraints are
+// compared with (default: FreeSpaceCaller)
+func WithFreeSpaceScope(scope FreeSpaceScope) Option {
+	return func(c *Config) { c.Engine.FreeSpaceScope = scope }
+}
+
+// WithMaxDuration bounds a run, which then stops gracefully
+func WithMaxDuration(d time.Duration) Option {
+	return func(c *Config) { c.Engine.MaxDuration = d }
+}
+
+// WithConcurrency sets the number of workers; 0 picks it automatically
+func WithConcurrency(workers int) Option {
+	return func(c *Config) { c.Engine.Concurrency = workers }
+}
+
+// WithCallbacks monitors runs
+func WithCallbacks(callbacks Callbacks) Option {
+	return func(c *Config) { c.Engine.Callbacks = callbacks }
+}
+
+// WithDiskInfo reads disk usage and block sizes from provider
+func WithDiskInfo(provider DiskInfoProvider) Option {
+	return func(c *Config) { c.Engine.DiskInfo = provider }
+}
+
+// WithFileSystem accesses the files through fs, e.g. to inject faults
+func WithFileSystem(fs FileSystem) Option {
+	return func(c *Config) { c.Engine.FS = fs }
+}
+
+// WithTracer records a span per run phase
+func WithTracer(tracer Tracer) Option {
+	return func(c *Config) { c.Engine.Tracer = tracer }
+}
+
+// WithPolicy attributes runs to a named, versioned policy
+func WithPolicy(name, version string) Option {
+	return func(c *Config) {
+		c.Engine.PolicyName = name
+		c.Engine.PolicyVersion = version
+	}
+}
+
+// WithStrictPolicy fails runs whose protections keep the target out of reach
+// before anything is deleted
+func WithStrictPolicy() Option {
+	return func(c *Config) { c.Engine.StrictPolicy = true }
+}
@@ -0,0 +1,58 @@
+package gobackupcleaner
+
+import (
+	v1 "github.com/ideamans/go-backup-cleaner"
+)
+
+// Types shared with version 1, so results and extension points need no
+// conversion
+type (
+	CleaningReport     = v1.CleaningReport
+	CleaningPlan       = v1.CleaningPlan
+	PlanFile           = v1.PlanFile
+	ScanResult         = v1.ScanResult
+	CleaningEstimate   = v1.CleaningEstimate
+	EstimateOptions    = v1.EstimateOptions
+	RetentionInventory = v1.RetentionInventory
+	PurgeResult        = v1.PurgeResult
+	FileRecord         = v1.FileRecord
+	DiskUsage          = v1.DiskUsage
+	DiskInfoProvider   = v1.DiskInfoProvider
+	FileSystem         = v1.FileSystem
+	Callbacks          = v1.Callbacks
+	Rule               = v1.Rule
+	RetentionOverride  = v1.RetentionOverride
+	Tracer             = v1.Tracer
+	DeleteMode         = v1.DeleteMode
+	SizeMode           = v1.SizeMode
+	UsageBase          = v1.UsageBase
+	FreeSpaceScope     = v1.FreeSpaceScope
+	PlanDifference     = v1.PlanDifference
+)
+
+// Enum values of version 1
+const (
+	DeleteModeRemove    = v1.DeleteModeRemove
+	DeleteModeTombstone = v1.DeleteModeTombstone
+	SizeModeBlock       = v1.SizeModeBlock
+	SizeModeApparent    = v1.SizeModeApparent
+	SizeModeAllocated   = v1.SizeModeAllocated
+	UsageBaseTotal      = v1.UsageBaseTotal
+	UsageBaseUsable     = v1.UsageBaseUsable
+	FreeSpaceCaller     = v1.FreeSpaceCaller
+	FreeSpaceVolume     = v1.FreeSpaceVolume
+)
+
+// Errors of version 1, so errors.Is works with either package
+var (
+	ErrNoCapacitySpecified = v1.ErrNoCapacitySpecified
+	ErrInvalidConfig       = v1.ErrInvalidConfig
+	ErrDirectoryNotFound   = v1.ErrDirectoryNotFound
+	ErrInsufficientSpace   = v1.ErrInsufficientSpace
+	ErrInvalidIndex        = v1.ErrInvalidIndex
+	ErrDiskInfoUnsupported = v1.ErrDiskInfoUnsupported
+	ErrInvalidDiskUsage    = v1.ErrInvalidDiskUsage
+	ErrPlanMismatch        = v1.ErrPlanMismatch
+	ErrPlanNotExecutable   = v1.ErrPlanNotExecutable
+	ErrWatchdogTimeout     = v1.ErrWatchdogTimeout
+)
@@ -0,0 +1,120 @@
+package gobackupcleaner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Discrepancy is a file that still takes space after the run deleted it,
+// found by VerifyAfterClean
+type Discrepancy struct {
+	Path string
+	Size int64
+	Err  error // ErrNotDeleted, or a *SillyRenameError for NFS leftovers
+}
+
+// SillyRenameError reports a .nfsXXXX file an NFS client left behind when a
+// file that was still open was deleted. Its space is only freed once the last
+// process holding the file closes it.
+type SillyRenameError struct {
+	Path string // Path of the .nfsXXXX file
+}
+
+func (e *SillyRenameError) Error() string {
+	return fmt.Sprintf("%s: deleted file still open, renamed by NFS", e.Path)
+}
+
+// isSillyRename reports whether a file name is one NFS clients give to
+// deleted files that are still open, ".nfs" followed by hex digits
+func isSillyRename(name string) bool {
+	hex := strings.TrimPrefix(name, ".nfs")
+	if len(hex) == len(name) || hex == "" {
+		return false
+	}
+	for _, c := range hex {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// findSillyRenamed returns the .nfsXXXX files in the directories the run
+// deleted from that the scan did not see, left behind by deleting files that
+// were still open
+func (d *deleter) findSillyRenamed(seen map[string]struct{}) []Discrepancy {
+	var leftovers []Discrepancy
+	for _, dir := range d.deletedDirs.toSlice() {
+		entries, err := d.config.fs().ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isSillyRename(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if _, ok := seen[path]; ok {
+				continue
+			}
+			var size int64
+			if info, err := entry.Info(); err == nil {
+				size = info.Size()
+			}
+			leftovers = append(leftovers, Discrepancy{Path: path, Size: size, Err: &SillyRenameError{Path: path}})
+		}
+	}
+	return leftovers
+}
+
+// retrySillyRenamed deletes the leftovers again after increasing delays, as
+// NFS refuses it only while the file is still open. It returns the leftovers
+// that remain.
+func (d *deleter) retrySillyRenamed(ctx context.Context, leftovers []Discrepancy) []Discrepancy {
+	for i := 0; len(leftovers) > 0 && i < max(d.config.DeleteRetries, 3); i++ {
+		timer := time.NewTimer(deleteRetryDelay << i)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return leftovers
+		}
+		remaining := leftovers[:0]
+		for _, leftover := range leftovers {
+			if err := d.config.fs().Remove(leftover.Path); err != nil && !os.IsNotExist(err) {
+				remaining = append(remaining, leftover)
+			}
+		}
+		leftovers = remaining
+	}
+	return leftovers
+}
+
+// verify checks that the deleted files are gone. Each discrepancy, including
+// the silly-renamed leftovers, is reported via OnError.
+func (d *deleter) verify(leftovers []Discrepancy) []Discrepancy {
+	var discrepancies []Discrepancy
+	for path := range d.deletedPaths {
+		if info, err := d.config.fs().Lstat(path); err == nil {
+			discrepancies = append(discrepancies, Discrepancy{Path: path, Size: info.Size(), Err: ErrNotDeleted})
+		}
+	}
+	discrepancies = append(discrepancies, leftovers...)
+
+	sort.Slice(discrepancies, func(i, j int) bool {
+		return discrepancies[i].Path < discrepancies[j].Path
+	})
+	for _, discrepancy := range discrepancies {
+		callSafe(d.config.Callbacks.OnError, ErrorInfo{
+			Type:  ErrorTypeVerify,
+			Path:  discrepancy.Path,
+			Error: discrepancy.Err,
+		})
+	}
+	return discrepancies
+}
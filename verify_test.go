@@ -0,0 +1,158 @@
+package gobackupcleaner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsSillyRename(t *testing.T) {
+	for name, want := range map[string]bool{
+		".nfs000000000189806400000001": true,
+		".nfsA1b2":                     true,
+		".nfs":                         false,
+		".nfsconfig":                   false,
+		"backup.nfs0001":               false,
+	} {
+		if got := isSillyRename(name); got != want {
+			t.Errorf("isSillyRename(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
+
+func TestVerifyAfterClean(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.tar"), 4096, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "new.tar"), 4096, now.Add(-24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	// Left by NFS as a process still has the deleted backup open
+	leftover := filepath.Join(tmpDir, ".nfs000000000189806400000001")
+
+	var errs []ErrorInfo
+	report, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:          int64Ptr(4096),
+		TimeWindow:       time.Hour,
+		VerifyAfterClean: true,
+		DiskInfo:         &failingDiskInfoProvider{},
+		Callbacks: Callbacks{
+			OnError: func(info ErrorInfo) { errs = append(errs, info) },
+			OnFileDeleted: func(info FileDeletedInfo) {
+				if err := os.WriteFile(leftover, make([]byte, 2048), 0644); err != nil {
+					t.Error(err)
+				}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeletedFiles != 1 {
+		t.Fatalf("Expected the old file to be deleted, got %d files", report.DeletedFiles)
+	}
+	if len(report.Discrepancies) != 1 || report.Discrepancies[0].Path != leftover || report.Discrepancies[0].Size != 2048 {
+		t.Fatalf("Expected the silly-renamed leftover, got %+v", report.Discrepancies)
+	}
+	var sillyRename *SillyRenameError
+	if !errors.As(report.Discrepancies[0].Err, &sillyRename) || sillyRename.Path != leftover {
+		t.Errorf("Expected a SillyRenameError, got %v", report.Discrepancies[0].Err)
+	}
+	if len(errs) != 1 || errs[0].Type != ErrorTypeVerify {
+		t.Errorf("Expected the discrepancy to be reported via OnError, got %+v", errs)
+	}
+}
+
+func TestVerifyNotDeleted(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "backup.tar")
+	if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := CleaningConfig{VerifyAfterClean: true}
+	deleter := newDeleter(&config, nil, tmpDir, 0)
+	// A deletion the file system acknowledged without removing the file
+	deleter.recordDeleted(path, false, classNormal, 1, 100, 100)
+	deleter.recordDeleted(filepath.Join(tmpDir, "gone.tar"), false, classNormal, 1, 100, 100)
+
+	discrepancies := deleter.verify(nil)
+	if len(discrepancies) != 1 || discrepancies[0].Path != path || !errors.Is(discrepancies[0].Err, ErrNotDeleted) {
+		t.Errorf("Expected the remaining file to be reported, got %+v", discrepancies)
+	}
+}
+
+func TestSillyRenamedAccounting(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	for name, age := range map[string]time.Duration{"old.tar": 72 * time.Hour, "new.tar": 24 * time.Hour} {
+		if err := createTestFile(t, filepath.Join(tmpDir, name), 4096, now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Left by an earlier run, neither deleted nor counted against this one
+	earlier := filepath.Join(tmpDir, ".nfs0000000000000001")
+	if err := createTestFile(t, earlier, 4096, now.Add(-96*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	leftover := filepath.Join(tmpDir, ".nfs0000000000000002")
+
+	config := CleaningConfig{
+		MaxSize:    int64Ptr(4096),
+		TimeWindow: time.Hour,
+		DiskInfo:   &failingDiskInfoProvider{},
+		Callbacks: Callbacks{
+			OnFileDeleted: func(info FileDeletedInfo) {
+				if err := os.WriteFile(leftover, make([]byte, 100), 0644); err != nil {
+					t.Error(err)
+				}
+			},
+		},
+	}
+	report, err := CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without VerifyAfterClean the leftovers are only looked for on NFS
+	if report.DeletedFiles != 1 || report.SillyRenamedFiles != 0 || report.ScannedFiles != 2 {
+		t.Fatalf("Expected the old file to be deleted, got %+v", report)
+	}
+	if _, err := os.Stat(earlier); err != nil {
+		t.Errorf("Expected the earlier leftover to be left alone: %v", err)
+	}
+
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.tar"), 4096, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(leftover)
+	config.VerifyAfterClean = true
+	report, err = CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SillyRenamedFiles != 1 || report.SillyRenamedSize != 4096 || report.FreedSize != 0 || report.ShortfallSize != 4096 {
+		t.Errorf("Expected the leftover to be excluded from the freed size, got %d files, %d bytes, freed %d, shortfall %d",
+			report.SillyRenamedFiles, report.SillyRenamedSize, report.FreedSize, report.ShortfallSize)
+	}
+
+	// Closed by now, the retry deletes it
+	if err := createTestFile(t, filepath.Join(tmpDir, "old.tar"), 4096, now.Add(-72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(leftover)
+	config.VerifyAfterClean = false
+	config.RetrySillyRenamed = true
+	report, err = CleanBackup(tmpDir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SillyRenamedFiles != 0 || report.FreedSize != 4096 {
+		t.Errorf("Expected the retry to free the leftover, got %d files, freed %d", report.SillyRenamedFiles, report.FreedSize)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("Expected the leftover to be deleted: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+//go:build windows
+// +build windows
+
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	mpr                   = syscall.NewLazyDLL("mpr.dll")
+	procWNetGetConnection = mpr.NewProc("WNetGetConnectionW")
+	procQueryDosDevice    = kernel32.NewProc("QueryDosDeviceW")
+	procGetVolumePathName = kernel32.NewProc("GetVolumePathNameW")
+)
+
+// maxDriveLinks bounds the substituted drives followed, as a drive may be
+// substituted to a folder on another substituted drive
+const maxDriveLinks = 8
+
+// volumeRoot returns the root of the volume backing path, with a trailing
+// backslash as GetDiskFreeSpace and GetVolumeInformation require. The target
+// of substituted drives (subst) and the share of mapped network drives
+// replace their drive letter, and volumes mounted on a folder, such as
+// D:\mounts\backup, are queried at their mount point instead of the parent
+// drive. path must exist.
+func volumeRoot(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return "", err
+	}
+	resolved := resolveDrive(absPath)
+	if root, err := volumePathName(resolved); err == nil {
+		return root, nil
+	}
+	// GetVolumePathName does not handle every share, the share root does
+	return filepath.VolumeName(resolved) + `\`, nil
+}
+
+// resolveDrive replaces the drive letter of substituted and mapped network
+// drives with the path they stand for
+func resolveDrive(path string) string {
+	for i := 0; i < maxDriveLinks; i++ {
+		drive := filepath.VolumeName(path)
+		if len(drive) != 2 || drive[1] != ':' {
+			return path
+		}
+		if target, ok := substTarget(drive); ok {
+			path = spliceDrive(path, target)
+			continue
+		}
+		if remote, ok := networkDrive(drive); ok {
+			return spliceDrive(path, remote)
+		}
+		return path
+	}
+	return path
+}
+
+// spliceDrive replaces the drive of path with root
+func spliceDrive(path, root string) string {
+	return filepath.Join(root, path[len(filepath.VolumeName(path)):])
+}
+
+// substTarget returns the folder a drive was substituted for with subst
+func substTarget(drive string) (string, bool) {
+	drivePtr, err := syscall.UTF16PtrFromString(drive)
+	if err != nil {
+		return "", false
+	}
+	var buf [1024]uint16
+	n, _, _ := procQueryDosDevice.Call(
+		uintptr(unsafe.Pointer(drivePtr)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+	)
+	if n == 0 {
+		return "", false
+	}
+	return parseDosDevice(syscall.UTF16ToString(buf[:]))
+}
+
+// parseDosDevice returns the folder of a DOS device target such as
+// \??\C:\backups or \??\UNC\server\share; volumes such as
+// \Device\HarddiskVolume2 are no substitutes
+func parseDosDevice(target string) (string, bool) {
+	rest, ok := strings.CutPrefix(target, `\??\`)
+	if !ok {
+		return "", false
+	}
+	if share, ok := strings.CutPrefix(rest, `UNC\`); ok {
+		return `\\` + share, true
+	}
+	return rest, true
+}
+
+// networkDrive returns the UNC path of a mapped network drive
+func networkDrive(drive string) (string, bool) {
+	drivePtr, err := syscall.UTF16PtrFromString(drive)
+	if err != nil {
+		return "", false
+	}
+	var buf [1024]uint16
+	n := uint32(len(buf))
+	ret, _, _ := procWNetGetConnection.Call(
+		uintptr(unsafe.Pointer(drivePtr)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&n)),
+	)
+	if ret != 0 {
+		// ERROR_NOT_CONNECTED for local drives
+		return "", false
+	}
+	return syscall.UTF16ToString(buf[:]), true
+}
+
+// volumePathName returns the mount point of the volume containing path
+func volumePathName(path string) (string, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+	var buf [1024]uint16
+	ret, _, err := procGetVolumePathName.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+	)
+	if ret == 0 {
+		return "", err
+	}
+	root := syscall.UTF16ToString(buf[:])
+	if !strings.HasSuffix(root, `\`) {
+		root += `\`
+	}
+	return root, nil
+}
@@ -0,0 +1,51 @@
+//go:build windows
+// +build windows
+
+package gobackupcleaner
+
+import "testing"
+
+func TestParseDosDevice(t *testing.T) {
+	tests := []struct {
+		target   string
+		expected string
+		ok       bool
+	}{
+		{`\??\C:\backups`, `C:\backups`, true},
+		{`\??\UNC\server\share\dir`, `\\server\share\dir`, true},
+		{`\Device\HarddiskVolume2`, "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseDosDevice(tt.target); got != tt.expected || ok != tt.ok {
+			t.Errorf("parseDosDevice(%q) = %q, %v, expected %q, %v", tt.target, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestSpliceDrive(t *testing.T) {
+	tests := []struct {
+		path, root, expected string
+	}{
+		{`X:\daily\db.bak`, `C:\backups`, `C:\backups\daily\db.bak`},
+		{`X:\`, `C:\backups`, `C:\backups`},
+		{`Z:\daily`, `\\server\share`, `\\server\share\daily`},
+	}
+	for _, tt := range tests {
+		if got := spliceDrive(tt.path, tt.root); got != tt.expected {
+			t.Errorf("spliceDrive(%q, %q) = %q, expected %q", tt.path, tt.root, got, tt.expected)
+		}
+	}
+}
+
+func TestVolumeRoot(t *testing.T) {
+	root, err := volumeRoot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root == "" || root[len(root)-1] != '\\' {
+		t.Errorf("Expected a volume root with a trailing backslash, got %q", root)
+	}
+	if _, err := volumeRoot(`C:\does\not\exist\backup-cleaner`); err == nil {
+		t.Error("Expected an error for a non-existent path")
+	}
+}
@@ -0,0 +1,188 @@
+package gobackupcleaner
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VolumeShare describes a file system taking part in a PerVolumeTargets run
+type VolumeShare struct {
+	Path       string    // Mount point, the target directory for its own file system
+	TargetSize int64     // Block-aligned size to free on the volume, from its own disk usage
+	Threshold  time.Time // Files older than this are deleted by age (zero if none)
+
+	// Deleted files of the volume, including priority files (only set in reports)
+	DeletedFiles int
+	FreedSize    int64 // Block-aligned
+}
+
+// volumeSet resolves the volume of scanned paths from the mount points found
+// during the scan
+type volumeSet struct {
+	roots []string // Sorted longest first, the target directory last
+}
+
+// of returns the root of the volume holding path
+func (v *volumeSet) of(path string) string {
+	for _, root := range v.roots[:len(v.roots)-1] {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return root
+		}
+	}
+	return v.roots[len(v.roots)-1]
+}
+
+// addVolume records the first directory seen on each device, which is the
+// mount point as directories are scanned before their contents
+func (s *scanner) addVolume(path string, info os.FileInfo) {
+	dev, ok := deviceOf(info)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.volumes == nil {
+		s.volumes = make(map[uint64]string)
+	}
+	if _, ok := s.volumes[dev]; !ok {
+		s.volumes[dev] = path
+	}
+}
+
+// getVolumes returns the volumes below rootPath, or nil if the tree does not
+// span mount points
+func (s *scanner) getVolumes(rootPath string) *volumeSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.volumes) < 2 {
+		return nil
+	}
+	var roots []string
+	for _, path := range s.volumes {
+		if path != rootPath {
+			roots = append(roots, path)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		if len(roots[i]) != len(roots[j]) {
+			return len(roots[i]) > len(roots[j])
+		}
+		return roots[i] < roots[j]
+	})
+	return &volumeSet{roots: append(roots, rootPath)}
+}
+
+// volumeSlots holds the files of one volume
+type volumeSlots struct {
+	root              string
+	slots             []*timeSlot // Sorted oldest first
+	priority          []fileInfo
+	priorityBlockSize int64
+}
+
+// groupByVolume splits the time slots and priority files by volume
+func groupByVolume(volumes *volumeSet, slots []*timeSlot, priority []fileInfo) []*volumeSlots {
+	byRoot := make(map[string]*volumeSlots, len(volumes.roots))
+	result := make([]*volumeSlots, 0, len(volumes.roots))
+	for _, root := range volumes.roots {
+		v := &volumeSlots{root: root}
+		byRoot[root] = v
+		result = append(result, v)
+	}
+	for _, slot := range slots {
+		// Slots are sorted, so the slots of each volume are sorted too
+		current := make(map[string]*timeSlot)
+		for _, fi := range slot.files {
+			root := volumes.of(fi.path)
+			vs, ok := current[root]
+			if !ok {
+				vs = &timeSlot{time: slot.time}
+				current[root] = vs
+				byRoot[root].slots = append(byRoot[root].slots, vs)
+			}
+			vs.files = append(vs.files, fi)
+			vs.totalSize += fi.size
+			vs.totalBlockSize += fi.blockSize
+		}
+	}
+	for _, fi := range priority {
+		v := byRoot[volumes.of(fi.path)]
+		v.priority = append(v.priority, fi)
+		v.priorityBlockSize += fi.blockSize
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].root < result[j].root
+	})
+	return result
+}
+
+// volumeThresholds calculates a threshold per volume from its own target.
+// The target of the target directory's volume is rootTarget, the others are
+// computed from their disk usage; a volume whose usage cannot be read frees
+// nothing by age. Priority files are not included in the estimates.
+func volumeThresholds(volumes []*volumeSlots, rootPath string, rootTarget int64, config *CleaningConfig) ([]VolumeShare, int, int64) {
+	shares := make([]VolumeShare, 0, len(volumes))
+	var files int
+	var size int64
+	for _, v := range volumes {
+		target := rootTarget
+		if v.root != rootPath {
+			target = 0
+			if usage, err := getDiskUsage(config.DiskInfo, v.root); err == nil && needsCleaning(usage, config) {
+				target = max(calculateTargetSize(usage, config), 0)
+			}
+		}
+		share := VolumeShare{Path: v.root, TargetSize: target}
+		if remaining := target - v.priorityBlockSize; remaining > 0 {
+			var n int
+			var s int64
+			share.Threshold, n, s = calculateThreshold(v.slots, remaining)
+			files += n
+			size += s
+		}
+		shares = append(shares, share)
+	}
+	return shares, files, size
+}
+
+// volumeCandidates collects the files each volume deletes below its threshold
+func volumeCandidates(volumes []*volumeSlots, shares []VolumeShare) []PlanFile {
+	var candidates []PlanFile
+	for i, v := range volumes {
+		candidates = append(candidates, collectCandidates(v.slots, v.priority, shares[i].Threshold)...)
+	}
+	sortPlanFiles(candidates)
+	return candidates
+}
+
+// volumeThresholdsByPath returns the thresholds of the volumes by path
+func volumeThresholdsByPath(shares []VolumeShare) map[string]time.Time {
+	if shares == nil {
+		return nil
+	}
+	thresholds := make(map[string]time.Time, len(shares))
+	for _, vs := range shares {
+		thresholds[vs.Path] = vs.Threshold
+	}
+	return thresholds
+}
+
+// volumeReport adds the deleted files of each volume to the shares
+func (d *deleter) volumeReport(shares []VolumeShare) []VolumeShare {
+	if shares == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	report := make([]VolumeShare, len(shares))
+	for i, vs := range shares {
+		stats := d.volumeDeleted[vs.Path]
+		vs.DeletedFiles = stats.files
+		vs.FreedSize = stats.size
+		report[i] = vs
+	}
+	return report
+}
@@ -0,0 +1,101 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// pathDiskInfoProvider reports a disk usage per path
+type pathDiskInfoProvider map[string]*DiskUsage
+
+func (p pathDiskInfoProvider) GetDiskUsage(path string) (*DiskUsage, error) {
+	usage, ok := p[path]
+	if !ok {
+		return nil, ErrDiskInfoUnsupported
+	}
+	return usage, nil
+}
+
+func (p pathDiskInfoProvider) GetBlockSize(path string) (int64, error) {
+	return 4096, nil
+}
+
+func TestVolumeSetOf(t *testing.T) {
+	root := filepath.FromSlash("/backup")
+	volumes := &volumeSet{roots: []string{filepath.Join(root, "usb", "nested"), filepath.Join(root, "usb"), root}}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(root, "a.tar"), root},
+		{filepath.Join(root, "usb"), filepath.Join(root, "usb")},
+		{filepath.Join(root, "usb", "a.tar"), filepath.Join(root, "usb")},
+		{filepath.Join(root, "usb", "nested", "a.tar"), filepath.Join(root, "usb", "nested")},
+		{filepath.Join(root, "usb2", "a.tar"), root},
+	}
+	for _, tt := range tests {
+		if got := volumes.of(tt.path); got != tt.want {
+			t.Errorf("of(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestVolumeThresholds(t *testing.T) {
+	root := filepath.FromSlash("/backup")
+	usb := filepath.Join(root, "usb")
+	now := time.Now().Truncate(time.Hour)
+
+	// Four hourly files on each volume, the oldest first
+	var slots []*timeSlot
+	for i := 3; i >= 0; i-- {
+		slot := &timeSlot{time: now.Add(-time.Duration(i) * time.Hour)}
+		for _, dir := range []string{root, usb} {
+			slot.files = append(slot.files, fileInfo{
+				path:      filepath.Join(dir, fmt.Sprintf("%02d.bak", i)),
+				size:      4096,
+				blockSize: 4096,
+				modTime:   slot.time,
+			})
+			slot.totalSize += 4096
+			slot.totalBlockSize += 4096
+		}
+		slots = append(slots, slot)
+	}
+	priority := []fileInfo{{path: filepath.Join(usb, "broken.bak"), size: 4096, blockSize: 4096, modTime: now}}
+
+	// The USB volume has to free 3 files, the broken file counting toward it
+	config := &CleaningConfig{
+		MinFreeSpace: int64Ptr(100 << 20),
+		DiskInfo: pathDiskInfoProvider{
+			usb: {Total: 1 << 30, Used: 1<<30 - (100<<20 - 3*4096), Free: 100<<20 - 3*4096, UsedPercent: 90},
+		},
+	}
+	volumes := groupByVolume(&volumeSet{roots: []string{usb, root}}, slots, priority)
+	shares, files, size := volumeThresholds(volumes, root, 4096, config)
+	if len(shares) != 2 || shares[0].Path != root || shares[1].Path != usb {
+		t.Fatalf("Expected the shares of both volumes sorted by path, got %+v", shares)
+	}
+	if shares[0].TargetSize != 4096 || !shares[0].Threshold.Equal(now.Add(-3*time.Hour).Add(time.Second)) {
+		t.Errorf("Expected the root volume to free its oldest file, got %+v", shares[0])
+	}
+	if shares[1].TargetSize != 3*4096 || !shares[1].Threshold.Equal(now.Add(-2*time.Hour).Add(time.Second)) {
+		t.Errorf("Expected the USB volume to free its two oldest files, got %+v", shares[1])
+	}
+	if files != 3 || size != 3*4096 {
+		t.Errorf("Expected 3 files by age, got %d files, %d bytes", files, size)
+	}
+
+	candidates := volumeCandidates(volumes, shares)
+	if len(candidates) != 4 {
+		t.Errorf("Expected 4 candidates including the broken file, got %+v", candidates)
+	}
+
+	// Without disk usage the volume frees nothing by age
+	config.DiskInfo = pathDiskInfoProvider{}
+	shares, _, _ = volumeThresholds(volumes, root, 4096, config)
+	if shares[1].TargetSize != 0 || !shares[1].Threshold.IsZero() {
+		t.Errorf("Expected no target for the USB volume, got %+v", shares[1])
+	}
+}
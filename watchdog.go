@@ -0,0 +1,77 @@
+package gobackupcleaner
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// PanicError is reported for a path whose processing panicked, e.g. in a
+// callback, instead of crashing the program or hanging the run
+type PanicError struct {
+	Path  string
+	Value any    // Value passed to panic
+	Stack []byte // Stack trace of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic while processing %s: %v", e.Path, e.Value)
+}
+
+// runTask runs the task of a worker, converting a panic into a PanicError so
+// the worker still marks the task done and the traversal can finish
+func runTask(path string, task func() error) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = &PanicError{Path: path, Value: value, Stack: debug.Stack()}
+		}
+	}()
+	return task()
+}
+
+// watchdog fails a traversal that made no progress for WatchdogTimeout.
+// Workers blocked on a hung mount or in a callback cannot be stopped, so they
+// are abandoned and the run returns ErrWatchdogTimeout instead of hanging.
+type watchdog struct {
+	timeout  time.Duration
+	progress atomic.Int64 // Unix nanoseconds of the last progress
+}
+
+// newWatchdog returns a watchdog for timeout, nil if it is disabled
+func newWatchdog(timeout time.Duration) *watchdog {
+	if timeout <= 0 {
+		return nil
+	}
+	w := &watchdog{timeout: timeout}
+	w.touch()
+	return w
+}
+
+// touch records progress. It is a no-op on a nil watchdog.
+func (w *watchdog) touch() {
+	if w != nil {
+		w.progress.Store(time.Now().UnixNano())
+	}
+}
+
+// wait waits until done is closed, or until no progress was made for the
+// timeout. A nil watchdog waits forever.
+func (w *watchdog) wait(done <-chan struct{}) error {
+	if w == nil {
+		<-done
+		return nil
+	}
+	ticker := time.NewTicker(max(w.timeout/4, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+		case now := <-ticker.C:
+			if idle := now.Sub(time.Unix(0, w.progress.Load())); idle >= w.timeout {
+				return fmt.Errorf("%w: no progress for %v", ErrWatchdogTimeout, idle.Round(time.Millisecond))
+			}
+		}
+	}
+}
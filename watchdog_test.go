@@ -0,0 +1,139 @@
+package gobackupcleaner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// createWideTree creates dirs directories of files files each below root, more
+// entries than the task channel holds so workers fall back to synchronous
+// processing, and returns the number of files
+func createWideTree(t *testing.T, root string, dirs, files int, modTime time.Time) int {
+	t.Helper()
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("d%02d", d), "nested")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			if err := createTestFile(t, filepath.Join(dir, fmt.Sprintf("f%03d.bak", f)), 1, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dirs * files
+}
+
+// runWithin fails the test if fn does not return within timeout
+func runWithin(t *testing.T, timeout time.Duration, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("Run did not finish within %v", timeout)
+	}
+}
+
+func TestTraversalStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+	now := time.Now().Truncate(time.Hour)
+	for i := 0; i < 5; i++ {
+		tmpDir := t.TempDir()
+		total := createWideTree(t, tmpDir, 6, 150, now.Add(-72*time.Hour))
+		if err := createTestFile(t, filepath.Join(tmpDir, "new.bak"), 1, now); err != nil {
+			t.Fatal(err)
+		}
+		config := CleaningConfig{
+			MaxSize:        int64Ptr(4096),
+			TimeWindow:     time.Hour,
+			Concurrency:    8,
+			MaxConcurrency: 8,
+			DiskInfo:       &failingDiskInfoProvider{},
+		}
+
+		runWithin(t, time.Minute, func() {
+			result, err := Scan(tmpDir, config)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(result.Files) != total+1 {
+				t.Errorf("run %d: expected %d scanned files, got %d", i, total+1, len(result.Files))
+			}
+
+			report, err := CleanBackup(tmpDir, config)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if report.ScannedFiles != total+1 || report.DeletedFiles != total {
+				t.Errorf("run %d: expected %d scanned and %d deleted files, got %d and %d", i, total+1, total, report.ScannedFiles, report.DeletedFiles)
+			}
+		})
+	}
+}
+
+func TestWorkerPanic(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	createWideTree(t, tmpDir, 3, 150, now.Add(-72*time.Hour))
+
+	var deleted atomic.Int64
+	runWithin(t, time.Minute, func() {
+		_, err := CleanBackup(tmpDir, CleaningConfig{
+			MaxSize:        int64Ptr(4096),
+			TimeWindow:     time.Hour,
+			Concurrency:    4,
+			MaxConcurrency: 4,
+			DiskInfo:       &failingDiskInfoProvider{},
+			Callbacks: Callbacks{
+				OnFileDeleted: func(info FileDeletedInfo) {
+					if deleted.Add(1) == 10 {
+						panic("callback failed")
+					}
+				},
+			},
+		})
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) || panicErr.Value != "callback failed" || len(panicErr.Stack) == 0 {
+			t.Errorf("Expected a PanicError, got %v", err)
+		}
+	})
+}
+
+func TestWatchdogTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	createWideTree(t, tmpDir, 1, 10, now.Add(-72*time.Hour))
+
+	// The stuck callback is released once the test is done
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	runWithin(t, time.Minute, func() {
+		_, err := CleanBackup(tmpDir, CleaningConfig{
+			MaxSize:         int64Ptr(4096),
+			TimeWindow:      time.Hour,
+			WatchdogTimeout: 100 * time.Millisecond,
+			DiskInfo:        &failingDiskInfoProvider{},
+			Callbacks: Callbacks{
+				OnFileDeleted: func(info FileDeletedInfo) { <-release },
+			},
+		})
+		if !errors.Is(err, ErrWatchdogTimeout) {
+			t.Errorf("Expected ErrWatchdogTimeout, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+package gobackupcleaner
+
+// captureXattrs reads the CaptureXattrs of the file at path, nil if it has
+// none of them
+func (c *CleaningConfig) captureXattrs(path string) map[string]string {
+	var values map[string]string
+	for _, name := range c.CaptureXattrs {
+		value, err := readXattr(path, name)
+		if err != nil {
+			continue
+		}
+		if values == nil {
+			values = make(map[string]string, len(c.CaptureXattrs))
+		}
+		values[name] = string(value)
+	}
+	return values
+}
@@ -0,0 +1,26 @@
+//go:build linux
+// +build linux
+
+package gobackupcleaner
+
+import "syscall"
+
+// readXattr reads an extended attribute of a file, e.g. "user.restore_tested"
+func readXattr(path, name string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		n, err := syscall.Getxattr(path, name, value)
+		if err == syscall.ERANGE {
+			// The attribute grew in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	}
+}
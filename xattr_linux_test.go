@@ -0,0 +1,47 @@
+//go:build linux
+// +build linux
+
+package gobackupcleaner
+
+import (
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCaptureXattrs(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now().Truncate(time.Hour)
+	path := filepath.Join(tmpDir, "old.tar")
+	if err := createTestFile(t, path, 4096, now.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Setxattr(path, "user.origin_host", []byte("db1"), 0); err != nil {
+		t.Skipf("user extended attributes not supported: %v", err)
+	}
+	if err := createTestFile(t, filepath.Join(tmpDir, "new.tar"), 4096, now); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var deleted []FileDeletedInfo
+	_, err := CleanBackup(tmpDir, CleaningConfig{
+		MaxSize:       int64Ptr(4096),
+		TimeWindow:    time.Hour,
+		CaptureXattrs: []string{"user.origin_host", "user.checksum"},
+		DiskInfo:      &failingDiskInfoProvider{},
+		Callbacks: Callbacks{OnFileDeleted: func(info FileDeletedInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted = append(deleted, info)
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || len(deleted[0].Xattrs) != 1 || deleted[0].Xattrs["user.origin_host"] != "db1" {
+		t.Errorf("Expected the origin host of old.tar to be captured, got %+v", deleted)
+	}
+}
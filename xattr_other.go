@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package gobackupcleaner
+
+// readXattr is not supported on this platform
+func readXattr(path, name string) ([]byte, error) {
+	return nil, ErrXattrUnsupported
+}
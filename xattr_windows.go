@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package gobackupcleaner
+
+import "os"
+
+// readXattr reads the alternate data stream of a file named name, the NTFS
+// counterpart of an extended attribute
+func readXattr(path, name string) ([]byte, error) {
+	return os.ReadFile(path + ":" + name)
+}